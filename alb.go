@@ -0,0 +1,129 @@
+// Copyright 2022-2024 The Connect Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package grpchealth
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"strings"
+
+	"connectrpc.com/connect"
+)
+
+const (
+	// ALBHealthCheckPath is the health check path to configure on an AWS
+	// Application Load Balancer target group using the gRPC protocol version,
+	// for example with the alb.ingress.kubernetes.io/healthcheck-path
+	// annotation of the AWS Load Balancer Controller.
+	ALBHealthCheckPath = "/" + HealthV1ServiceName + "/Check"
+
+	// ALBSuccessCodes are the gRPC status codes to configure as healthy on the
+	// target group, for example with the alb.ingress.kubernetes.io/success-codes
+	// annotation. The ALB default, 12, treats any gRPC server as healthy.
+	ALBSuccessCodes = "0"
+)
+
+// ALBProfileParams configure NewALBProfile.
+type ALBProfileParams struct {
+	// NotServingCode is the error code Check returns instead of a response
+	// whenever the service isn't StatusServing. The default is
+	// connect.CodeUnavailable.
+	NotServingCode connect.Code
+}
+
+// ALBProfile bundles the options that make health checks work with AWS
+// Application Load Balancers. ALBs ignore the response message and only
+// examine the gRPC status code, send Check requests without a payload, and
+// check a single path rather than a particular service:
+//
+//	profile := grpchealth.NewALBProfile(grpchealth.ALBProfileParams{})
+//	checker := grpchealth.NewStaticCheckerWithOptions(services, profile.CheckerOptions...)
+//	mux.Handle(grpchealth.NewHandler(checker, profile.HandlerOptions...))
+//	mux.Handle("/healthz", grpchealth.NewHTTPHandler(checker, profile.HandlerOptions...))
+//
+// Configure the target group with ALBHealthCheckPath and ALBSuccessCodes. ALBs
+// using HTTP health checks can use the plain HTTP endpoint, which already
+// responds with HTTP 503 when the process isn't serving.
+type ALBProfile struct {
+	// CheckerOptions make the process status the aggregate of all services,
+	// since ALBs only check the process as a whole.
+	CheckerOptions []StaticCheckerOption
+	// HandlerOptions make Check accept requests without a payload, and return
+	// an error with the NotServingCode instead of a response carrying a status
+	// other than StatusServing.
+	HandlerOptions []connect.HandlerOption
+}
+
+// NewALBProfile constructs an ALBProfile.
+func NewALBProfile(params ALBProfileParams) *ALBProfile {
+	code := params.NotServingCode
+	if code == 0 {
+		code = connect.CodeUnavailable
+	}
+	return &ALBProfile{
+		CheckerOptions: []StaticCheckerOption{WithAggregatedProcessStatus()},
+		HandlerOptions: []connect.HandlerOption{
+			WithNotServingAsError(code),
+			newHandlerOption(func(config *handlerConfig) {
+				config.EmptyCheckRequests = true
+			}),
+		},
+	}
+}
+
+// acceptEmptyRequests wraps a Check handler so that gRPC requests without any
+// messages are treated as requests for the whole process, rather than
+// failing because the unary request is missing.
+func acceptEmptyRequests(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.Header.Get("Content-Type"), "application/grpc") {
+			r.Body = &defaultGRPCBody{ReadCloser: r.Body}
+		}
+		handler.ServeHTTP(w, r)
+	})
+}
+
+// defaultGRPCBody substitutes an empty, uncompressed gRPC message for an empty
+// request body.
+type defaultGRPCBody struct {
+	io.ReadCloser
+
+	started  bool
+	fallback io.Reader
+}
+
+func (b *defaultGRPCBody) Read(data []byte) (int, error) {
+	if b.fallback != nil {
+		return b.fallback.Read(data)
+	}
+	if b.started || len(data) == 0 {
+		return b.ReadCloser.Read(data)
+	}
+	for {
+		n, err := b.ReadCloser.Read(data)
+		if n > 0 {
+			b.started = true
+			return n, err
+		}
+		if err == io.EOF {
+			b.fallback = bytes.NewReader(make([]byte, 5))
+			return b.fallback.Read(data)
+		}
+		if err != nil {
+			return 0, err
+		}
+	}
+}
@@ -0,0 +1,69 @@
+// Copyright 2022-2024 The Connect Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package grpchealth
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"connectrpc.com/connect"
+)
+
+func TestALBProfile(t *testing.T) {
+	const userFQN = "acme.user.v1.UserService"
+	t.Parallel()
+	profile := NewALBProfile(ALBProfileParams{})
+	checker := NewStaticCheckerWithOptions([]string{userFQN}, profile.CheckerOptions...)
+	mux := http.NewServeMux()
+	mux.Handle(NewHandler(checker, profile.HandlerOptions...))
+	server := httptest.NewUnstartedServer(mux)
+	server.EnableHTTP2 = true
+	server.StartTLS()
+	t.Cleanup(server.Close)
+
+	// ALBs send Check without a payload and only look at grpc-status.
+	probe := func() string {
+		t.Helper()
+		req, err := http.NewRequest(http.MethodPost, server.URL+ALBHealthCheckPath, strings.NewReader(""))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Content-Type", "application/grpc")
+		req.Header.Set("Te", "trailers")
+		res, err := server.Client().Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer res.Body.Close()
+		if _, err := io.Copy(io.Discard, res.Body); err != nil {
+			t.Fatal(err)
+		}
+		if status := res.Header.Get("Grpc-Status"); status != "" {
+			return status
+		}
+		return res.Trailer.Get("Grpc-Status")
+	}
+	if got := probe(); got != ALBSuccessCodes {
+		t.Fatalf("got grpc-status %q while serving, expected %q", got, ALBSuccessCodes)
+	}
+	checker.SetStatus(userFQN, StatusNotServing)
+	if got, expect := probe(), strconv.Itoa(int(connect.CodeUnavailable)); got != expect {
+		t.Fatalf("got grpc-status %q while not serving, expected %q", got, expect)
+	}
+}
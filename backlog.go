@@ -0,0 +1,74 @@
+// Copyright 2022-2024 The Connect Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package grpchealth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// BacklogCheckerParams configure a BacklogChecker.
+type BacklogCheckerParams struct {
+	// Backlog reports how far behind the worker is, in whatever unit the
+	// application tracks: queued messages, unprocessed rows, or seconds of
+	// lag.
+	Backlog func(ctx context.Context) (int64, error)
+	// Threshold is the backlog above which the worker reports
+	// StatusNotServing.
+	Threshold int64
+	// Recovery is the backlog at or below which the worker reports
+	// StatusServing again. It must not exceed Threshold; the gap between
+	// them keeps the status from flapping around a single value. Zero, the
+	// default, waits for the backlog to drain completely. If it's negative,
+	// it's set to Threshold, so there's no gap.
+	Recovery int64
+}
+
+// BacklogChecker is a Checker for workers that can fall behind. It reports
+// StatusNotServing once the backlog exceeds its threshold and until it drains
+// back to the recovery level. If the backlog can't be measured, it reports
+// StatusNotServing. The details of the response include the backlog or the
+// error.
+//
+// BacklogChecker reports the same status for every service.
+type BacklogChecker struct {
+	*ThresholdChecker
+}
+
+// NewBacklogChecker constructs a BacklogChecker.
+func NewBacklogChecker(params BacklogCheckerParams) (*BacklogChecker, error) {
+	if params.Backlog == nil {
+		return nil, errors.New("backlog checker requires a backlog function")
+	}
+	if params.Recovery < 0 {
+		params.Recovery = params.Threshold
+	}
+	if params.Recovery > params.Threshold {
+		return nil, fmt.Errorf("recovery %d exceeds threshold %d", params.Recovery, params.Threshold)
+	}
+	threshold, err := NewThresholdChecker(
+		func(ctx context.Context) (float64, error) {
+			backlog, err := params.Backlog(ctx)
+			return float64(backlog), err
+		},
+		WithMaxThreshold(float64(params.Threshold), float64(params.Recovery)),
+		WithThresholdDetail("backlog"),
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &BacklogChecker{ThresholdChecker: threshold}, nil
+}
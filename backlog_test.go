@@ -0,0 +1,88 @@
+// Copyright 2022-2024 The Connect Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package grpchealth
+
+import (
+	"context"
+	"testing"
+)
+
+func TestBacklogChecker(t *testing.T) {
+	t.Parallel()
+	var backlog int64
+	checker, err := NewBacklogChecker(BacklogCheckerParams{
+		Backlog:   func(context.Context) (int64, error) { return backlog, nil },
+		Threshold: 1000,
+		Recovery:  100,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, testCase := range []struct {
+		backlog int64
+		expect  Status
+	}{
+		{backlog: 500, expect: StatusServing},
+		{backlog: 1001, expect: StatusNotServing},
+		{backlog: 500, expect: StatusNotServing},
+		{backlog: 100, expect: StatusServing},
+		{backlog: 1000, expect: StatusServing},
+	} {
+		backlog = testCase.backlog
+		res, err := checker.Check(context.Background(), &CheckRequest{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.Status != testCase.expect {
+			t.Fatalf("backlog %d: got status %v, expected %v", backlog, res.Status, testCase.expect)
+		}
+	}
+
+	for _, testCase := range []struct {
+		name     string
+		recovery int64
+		expect   Status
+	}{
+		{name: "drained", recovery: 0, expect: StatusNotServing},
+		{name: "no gap", recovery: -1, expect: StatusServing},
+	} {
+		checker, err := NewBacklogChecker(BacklogCheckerParams{
+			Backlog:   func(context.Context) (int64, error) { return backlog, nil },
+			Threshold: 1000,
+			Recovery:  testCase.recovery,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, backlog = range []int64{1001, 1000} {
+			res, err := checker.Check(context.Background(), &CheckRequest{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if backlog == 1000 && res.Status != testCase.expect {
+				t.Fatalf("%s: got status %v at the threshold, expected %v", testCase.name, res.Status, testCase.expect)
+			}
+		}
+	}
+
+	_, err = NewBacklogChecker(BacklogCheckerParams{
+		Backlog:   func(context.Context) (int64, error) { return 0, nil },
+		Threshold: 100,
+		Recovery:  1000,
+	})
+	if err == nil {
+		t.Fatal("expected error when recovery exceeds threshold")
+	}
+}
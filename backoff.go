@@ -0,0 +1,105 @@
+// Copyright 2022-2024 The Connect Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package grpchealth
+
+import (
+	"context"
+	"math"
+	"math/rand"
+	"time"
+)
+
+// Backoff computes randomized, exponentially increasing delays between
+// retries. The Client uses it to reconnect Watch streams, as do
+// HeartbeatFile, StatusFileWriter, and TransitionBatcher when watching fails,
+// so dependents can pace their own health plumbing the same way without a
+// separate backoff library.
+//
+// By default, the delay before retry n is Base * Multiplier^n, capped at Max,
+// and then randomly adjusted by up to Jitter in either direction. A Backoff
+// has no mutable state, so one can be shared by concurrent retry loops.
+type Backoff struct {
+	// Base is the delay before the first retry.
+	Base time.Duration
+	// Max caps the delay before jitter is applied.
+	Max time.Duration
+	// Multiplier is the growth factor between retries.
+	Multiplier float64
+	// Jitter is the fraction by which each delay is randomly adjusted, in
+	// either direction. It's ignored if FullJitter is set.
+	Jitter float64
+	// FullJitter, if set, draws each delay uniformly between zero and the
+	// capped exponential delay. It spreads out retries from many clients more
+	// than Jitter does, at the cost of sometimes retrying almost immediately.
+	FullJitter bool
+	// Clock schedules Wait's timer. If it's nil, the system clock is used.
+	Clock Clock
+}
+
+// NewBackoff returns a Backoff with the defaults of gRPC's connection backoff
+// protocol: a one second base, two minute maximum, 1.6 multiplier, and 20%
+// jitter.
+func NewBackoff() *Backoff {
+	return &Backoff{
+		Base:       time.Second,
+		Max:        2 * time.Minute,
+		Multiplier: 1.6,
+		Jitter:     0.2,
+	}
+}
+
+// Delay returns the delay before the given retry, counting from zero.
+func (b *Backoff) Delay(attempt int) time.Duration {
+	delay := math.Min(
+		float64(b.Base)*math.Pow(b.Multiplier, float64(attempt)),
+		float64(b.Max),
+	)
+	if b.FullJitter {
+		return time.Duration(delay * rand.Float64()) //nolint:gosec // jitter doesn't need a secure source
+	}
+	delay *= 1 + b.Jitter*(2*rand.Float64()-1) //nolint:gosec // jitter doesn't need a secure source
+	return time.Duration(delay)
+}
+
+// DecorrelatedDelay returns the delay following previous using decorrelated
+// jitter: a random delay between Base and three times previous, capped at
+// Max. Pass zero for the first retry. Unlike Delay, it needs the previous
+// delay rather than the attempt number, so callers keep that state themselves.
+// Multiplier, Jitter, and FullJitter are ignored.
+func (b *Backoff) DecorrelatedDelay(previous time.Duration) time.Duration {
+	high := 3 * float64(previous)
+	if high < float64(b.Base) {
+		high = float64(b.Base)
+	}
+	delay := float64(b.Base) + (high-float64(b.Base))*rand.Float64() //nolint:gosec // jitter doesn't need a secure source
+	return time.Duration(math.Min(delay, float64(b.Max)))
+}
+
+// Wait sleeps until the delay before the given retry elapses or the context is
+// done, whichever comes first.
+func (b *Backoff) Wait(ctx context.Context, attempt int) error {
+	clock := b.Clock
+	if clock == nil {
+		clock = systemClock{}
+	}
+	timer := clock.NewTimer(b.Delay(attempt))
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.Chan():
+		return nil
+	}
+}
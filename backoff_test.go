@@ -0,0 +1,78 @@
+// Copyright 2022-2024 The Connect Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package grpchealth
+
+import (
+	"context"
+	"errors"
+	"math"
+	"testing"
+	"time"
+)
+
+func TestBackoff(t *testing.T) {
+	t.Parallel()
+	b := NewBackoff()
+	for attempt, expect := range []time.Duration{
+		time.Second,
+		1600 * time.Millisecond,
+		2560 * time.Millisecond,
+	} {
+		delay := b.Delay(attempt)
+		low := time.Duration(float64(expect) * (1 - b.Jitter))
+		high := time.Duration(float64(expect) * (1 + b.Jitter))
+		if delay < low || delay > high {
+			t.Errorf("attempt %d: got delay %v, expected %v-%v", attempt, delay, low, high)
+		}
+	}
+	if delay := b.Delay(100); delay > time.Duration(float64(b.Max)*(1+b.Jitter)) {
+		t.Errorf("got delay %v, expected at most %v", delay, b.Max)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := b.Wait(ctx, 0); !errors.Is(err, context.Canceled) {
+		t.Errorf("got error %v, expected %v", err, context.Canceled)
+	}
+}
+
+func TestBackoffFullJitter(t *testing.T) {
+	t.Parallel()
+	b := NewBackoff()
+	b.FullJitter = true
+	for attempt := 0; attempt < 20; attempt++ {
+		expect := time.Duration(math.Min(float64(b.Base)*math.Pow(b.Multiplier, float64(attempt)), float64(b.Max)))
+		if delay := b.Delay(attempt); delay < 0 || delay > expect {
+			t.Errorf("attempt %d: got delay %v, expected 0-%v", attempt, delay, expect)
+		}
+	}
+}
+
+func TestBackoffDecorrelated(t *testing.T) {
+	t.Parallel()
+	b := NewBackoff()
+	if delay := b.DecorrelatedDelay(0); delay != b.Base {
+		t.Errorf("got first delay %v, expected %v", delay, b.Base)
+	}
+	for _, previous := range []time.Duration{time.Second, 10 * time.Second, time.Hour} {
+		high := 3 * previous
+		if high > b.Max {
+			high = b.Max
+		}
+		if delay := b.DecorrelatedDelay(previous); delay < b.Base || delay > high {
+			t.Errorf("after %v: got delay %v, expected %v-%v", previous, delay, b.Base, high)
+		}
+	}
+}
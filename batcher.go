@@ -0,0 +1,217 @@
+// Copyright 2022-2024 The Connect Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package grpchealth
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// TransitionBatcherParams configure a TransitionBatcher.
+type TransitionBatcherParams struct {
+	// Watcher reports the status of the services, such as a StaticChecker.
+	Watcher Watcher
+	// Services are the services to publish. The default is only the empty
+	// string, which represents the whole process.
+	Services []string
+	// Publish pushes a batch of statuses to an external system, such as
+	// Consul, etcd, or a webhook. The batch contains only the services whose
+	// status differs from the last successful publish. Calls are sequential.
+	Publish func(ctx context.Context, statuses map[string]Status) error
+	// Quiet is how long the statuses must stay unchanged before a batch is
+	// published. The default is one second.
+	Quiet time.Duration
+	// MaxStaleness bounds how long a change may wait for the statuses to
+	// settle: during continuous flapping, a batch is published at least this
+	// often. The default is ten seconds.
+	MaxStaleness time.Duration
+	// OnError, if set, is called with errors watching services and publishing.
+	// Failed batches are retried after a backoff, merged with any later
+	// changes.
+	OnError func(error)
+	// Clock schedules publishing and retries. The default is the system
+	// clock.
+	Clock Clock
+}
+
+// TransitionBatcher watches services and pushes their statuses to an external
+// control plane in batches. Rapid transitions are coalesced, so a flapping
+// service doesn't hammer the control plane, and a service that flaps back to
+// its published status isn't published at all.
+type TransitionBatcher struct {
+	params  TransitionBatcherParams
+	changes chan batchedChange
+}
+
+type batchedChange struct {
+	service string
+	status  Status
+}
+
+// NewTransitionBatcher constructs a TransitionBatcher. It returns an error if
+// the Watcher or Publish function is missing, or if Quiet exceeds
+// MaxStaleness.
+func NewTransitionBatcher(params TransitionBatcherParams) (*TransitionBatcher, error) {
+	if params.Watcher == nil {
+		return nil, errors.New("transition batcher requires a watcher")
+	}
+	if params.Publish == nil {
+		return nil, errors.New("transition batcher requires a publish function")
+	}
+	if len(params.Services) == 0 {
+		params.Services = []string{""}
+	}
+	if params.Quiet <= 0 {
+		params.Quiet = time.Second
+	}
+	if params.MaxStaleness <= 0 {
+		params.MaxStaleness = 10 * time.Second
+	}
+	if params.Quiet > params.MaxStaleness {
+		return nil, errors.New("transition batcher's quiet period exceeds its max staleness")
+	}
+	if params.Clock == nil {
+		params.Clock = systemClock{}
+	}
+	return &TransitionBatcher{
+		params:  params,
+		changes: make(chan batchedChange),
+	}, nil
+}
+
+// Run watches the services and publishes batches until ctx ends, then returns
+// ctx's error. Changes not yet published when ctx ends are discarded. Run
+// should be called once.
+func (b *TransitionBatcher) Run(ctx context.Context) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	done := make(chan struct{}, len(b.params.Services))
+	for _, service := range b.params.Services {
+		go func(service string) {
+			defer func() { done <- struct{}{} }()
+			b.watch(ctx, service)
+		}(service)
+	}
+	defer func() {
+		for range b.params.Services {
+			<-done
+		}
+	}()
+
+	var (
+		pending   = make(map[string]Status)
+		published = make(map[string]Status)
+		first     time.Time // of the oldest unpublished change
+		last      time.Time // of the newest unpublished change
+		retryAt   time.Time
+		failures  int
+		timer     Timer
+	)
+	retry := NewBackoff()
+	retry.Clock = b.params.Clock
+	schedule := func() {
+		due := last.Add(b.params.Quiet)
+		if deadline := first.Add(b.params.MaxStaleness); deadline.Before(due) {
+			due = deadline
+		}
+		if retryAt.After(due) {
+			due = retryAt
+		}
+		if timer != nil {
+			timer.Stop()
+		}
+		timer = b.params.Clock.NewTimer(due.Sub(b.params.Clock.Now()))
+	}
+	defer func() {
+		if timer != nil {
+			timer.Stop()
+		}
+	}()
+	for {
+		var fire <-chan time.Time
+		if timer != nil {
+			fire = timer.Chan()
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case change := <-b.changes:
+			now := b.params.Clock.Now()
+			if len(pending) == 0 {
+				first = now
+			}
+			pending[change.service] = change.status
+			last = now
+			schedule()
+		case <-fire:
+			timer = nil
+			batch := make(map[string]Status, len(pending))
+			for service, status := range pending {
+				if previous, ok := published[service]; !ok || previous != status {
+					batch[service] = status
+				}
+			}
+			if len(batch) > 0 {
+				if err := b.params.Publish(ctx, batch); err != nil {
+					if ctx.Err() != nil {
+						return ctx.Err()
+					}
+					b.report(err)
+					retryAt = b.params.Clock.Now().Add(retry.Delay(failures))
+					failures++
+					schedule()
+					continue
+				}
+			}
+			for service, status := range batch {
+				published[service] = status
+			}
+			clear(pending)
+			retryAt, failures = time.Time{}, 0
+		}
+	}
+}
+
+// watch sends a service's statuses to Run until ctx ends, watching again
+// after a backoff if the Watcher fails.
+func (b *TransitionBatcher) watch(ctx context.Context, service string) {
+	retry := NewBackoff()
+	retry.Clock = b.params.Clock
+	for attempt := 0; ; attempt++ {
+		err := b.params.Watcher.Watch(ctx, &CheckRequest{Service: service}, func(res *CheckResponse) error {
+			attempt = 0
+			select {
+			case b.changes <- batchedChange{service: service, status: res.Status}:
+				return nil
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		})
+		if ctx.Err() != nil {
+			return
+		}
+		b.report(err)
+		if retry.Wait(ctx, attempt) != nil {
+			return
+		}
+	}
+}
+
+func (b *TransitionBatcher) report(err error) {
+	if err != nil && b.params.OnError != nil {
+		b.params.OnError(err)
+	}
+}
@@ -0,0 +1,156 @@
+// Copyright 2022-2024 The Connect Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package grpchealth
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestTransitionBatcher(t *testing.T) {
+	t.Parallel()
+	checker := NewStaticChecker("a")
+	batches := make(chan map[string]Status, 10)
+	batcher, err := NewTransitionBatcher(TransitionBatcherParams{
+		Watcher:  checker,
+		Services: []string{"", "a"},
+		Publish: func(_ context.Context, statuses map[string]Status) error {
+			batches <- statuses
+			return nil
+		},
+		Quiet:        100 * time.Millisecond,
+		MaxStaleness: time.Second,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() { _ = batcher.Run(ctx) }()
+
+	expect := func(want map[string]Status) {
+		t.Helper()
+		if got := <-batches; !reflect.DeepEqual(got, want) {
+			t.Fatalf("got batch %v, expected %v", got, want)
+		}
+	}
+	expect(map[string]Status{"": StatusServing, "a": StatusServing})
+
+	// A flap back to the published status isn't published, and changes are
+	// coalesced.
+	checker.SetStatus("a", StatusNotServing)
+	checker.SetStatus("a", StatusServing)
+	checker.SetStatus("", StatusNotServing)
+	checker.SetStatus("", StatusServiceUnknown)
+	expect(map[string]Status{"": StatusServiceUnknown})
+	select {
+	case batch := <-batches:
+		t.Fatalf("got unexpected batch %v", batch)
+	case <-time.After(200 * time.Millisecond):
+	}
+}
+
+func TestTransitionBatcherMaxStaleness(t *testing.T) {
+	t.Parallel()
+	checker := NewStaticChecker()
+	published := make(chan struct{}, 10)
+	batcher, err := NewTransitionBatcher(TransitionBatcherParams{
+		Watcher: checker,
+		Publish: func(context.Context, map[string]Status) error {
+			published <- struct{}{}
+			return nil
+		},
+		Quiet:        100 * time.Millisecond,
+		MaxStaleness: 200 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() { _ = batcher.Run(ctx) }()
+	<-published
+
+	// The statuses never settle, but batches are still published.
+	start := time.Now()
+	for i := 0; ; i++ {
+		status := StatusNotServing
+		if i%2 == 1 {
+			status = StatusServiceUnknown
+		}
+		checker.SetStatus("", status)
+		select {
+		case <-published:
+			if elapsed := time.Since(start); elapsed < 150*time.Millisecond {
+				t.Fatalf("published after %v of flapping", elapsed)
+			}
+			return
+		case <-time.After(10 * time.Millisecond):
+		}
+		if time.Since(start) > 5*time.Second {
+			t.Fatal("nothing published while flapping")
+		}
+	}
+}
+
+func TestTransitionBatcherRetry(t *testing.T) {
+	t.Parallel()
+	errUnavailable := errors.New("control plane unavailable")
+	reported := make(chan error, 1)
+	batches := make(chan map[string]Status, 1)
+	var calls int
+	batcher, err := NewTransitionBatcher(TransitionBatcherParams{
+		Watcher: NewStaticChecker(),
+		Publish: func(_ context.Context, statuses map[string]Status) error {
+			calls++
+			if calls == 1 {
+				return errUnavailable
+			}
+			batches <- statuses
+			return nil
+		},
+		Quiet:   time.Millisecond,
+		OnError: func(err error) { reported <- err },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() { _ = batcher.Run(ctx) }()
+	if err := <-reported; !errors.Is(err, errUnavailable) {
+		t.Fatalf("got error %v, expected %v", err, errUnavailable)
+	}
+	if got := <-batches; got[""] != StatusServing {
+		t.Fatalf("got batch %v after retrying", got)
+	}
+}
+
+func TestTransitionBatcherInvalid(t *testing.T) {
+	t.Parallel()
+	publish := func(context.Context, map[string]Status) error { return nil }
+	for name, params := range map[string]TransitionBatcherParams{
+		"no watcher": {Publish: publish},
+		"no publish": {Watcher: NewStaticChecker()},
+		"quiet":      {Watcher: NewStaticChecker(), Publish: publish, Quiet: time.Minute, MaxStaleness: time.Second},
+	} {
+		if _, err := NewTransitionBatcher(params); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
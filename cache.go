@@ -0,0 +1,83 @@
+// Copyright 2022-2024 The Connect Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package grpchealth
+
+import (
+	"net/http"
+	"strings"
+)
+
+// WithCacheControl sets the Cache-Control header of responses to GET requests:
+// those of NewHTTPHandler, NewEnvoyHandler, and Check requests made with
+// Connect's GET support. The default is "no-store", so proxies and browsers
+// never serve a stale status. Status pages fronted by a CDN might allow a
+// short "public, max-age=5" instead. An empty value omits the header.
+func WithCacheControl(value string) HandlerOption {
+	return newHandlerOption(func(config *handlerConfig) {
+		config.CacheControl = value
+	})
+}
+
+// WithETags makes responses to GET requests carry a weak ETag derived from the
+// checked status, so caches can revalidate cheaply. NewHTTPHandler answers
+// requests whose If-None-Match header matches the current ETag with 304 Not
+// Modified, but only when the status would otherwise get a 2xx code: probes
+// treat 304 as healthy, so failing statuses always get their full response.
+func WithETags() HandlerOption {
+	return newHandlerOption(func(config *handlerConfig) {
+		config.ETags = true
+	})
+}
+
+// setCacheHeaders adds the configured Cache-Control and ETag headers to the
+// response to a GET request.
+func (c *handlerConfig) setCacheHeaders(header http.Header, result *CheckResult) {
+	if c.CacheControl != "" {
+		header.Set("Cache-Control", c.CacheControl)
+	}
+	if etag, ok := c.etag(result); ok {
+		header.Set("ETag", etag)
+	}
+}
+
+// etag returns the ETag for the outcome of a check, if ETags are enabled and
+// the check succeeded.
+func (c *handlerConfig) etag(result *CheckResult) (string, bool) {
+	if !c.ETags || result.Err != nil {
+		return "", false
+	}
+	return `W/"` + result.Status.String() + `"`, true
+}
+
+// notModified reports whether a request's If-None-Match header matches the
+// ETag for the outcome of a check. As RFC 9110 requires, preconditions are
+// only evaluated for responses that would otherwise be 2xx.
+func (c *handlerConfig) notModified(r *http.Request, result *CheckResult) bool {
+	etag, ok := c.etag(result)
+	if !ok {
+		return false
+	}
+	if code := c.httpStatusCode(result); code < 200 || code > 299 {
+		return false
+	}
+	for _, candidate := range strings.Split(r.Header.Get("If-None-Match"), ",") {
+		candidate = strings.TrimSpace(candidate)
+		// Weak comparison, as RFC 9110 requires for If-None-Match.
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == strings.TrimPrefix(etag, "W/") {
+			return true
+		}
+	}
+	return false
+}
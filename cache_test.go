@@ -0,0 +1,124 @@
+// Copyright 2022-2024 The Connect Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package grpchealth
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"connectrpc.com/connect"
+	healthv1 "connectrpc.com/grpchealth/internal/gen/go/connectext/grpc/health/v1"
+)
+
+func TestCacheHeaders(t *testing.T) {
+	t.Parallel()
+	t.Run("default", func(t *testing.T) {
+		t.Parallel()
+		handler := NewHTTPHandler(NewStaticChecker())
+		res := httptest.NewRecorder()
+		handler.ServeHTTP(res, httptest.NewRequest(http.MethodGet, "/", nil))
+		if got := res.Header().Get("Cache-Control"); got != "no-store" {
+			t.Errorf("got Cache-Control %q, expected %q", got, "no-store")
+		}
+		if got := res.Header().Get("ETag"); got != "" {
+			t.Errorf("got ETag %q, expected none", got)
+		}
+	})
+	t.Run("disabled", func(t *testing.T) {
+		t.Parallel()
+		_, handler := NewEnvoyHandler(NewStaticChecker(), EnvoyHealthCheckParams{}, WithCacheControl(""))
+		res := httptest.NewRecorder()
+		handler.ServeHTTP(res, httptest.NewRequest(http.MethodGet, "/healthcheck", nil))
+		if _, ok := res.Header()["Cache-Control"]; ok {
+			t.Errorf("got Cache-Control %q, expected none", res.Header().Get("Cache-Control"))
+		}
+	})
+	t.Run("etag", func(t *testing.T) {
+		t.Parallel()
+		checker := NewStaticChecker()
+		handler := NewHTTPHandler(checker, WithCacheControl("public, max-age=5"), WithETags())
+		get := func(ifNoneMatch string) *httptest.ResponseRecorder {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if ifNoneMatch != "" {
+				req.Header.Set("If-None-Match", ifNoneMatch)
+			}
+			res := httptest.NewRecorder()
+			handler.ServeHTTP(res, req)
+			return res
+		}
+		res := get("")
+		if res.Code != http.StatusOK {
+			t.Fatalf("got HTTP %d, expected %d", res.Code, http.StatusOK)
+		}
+		if got := res.Header().Get("Cache-Control"); got != "public, max-age=5" {
+			t.Errorf("got Cache-Control %q, expected %q", got, "public, max-age=5")
+		}
+		etag := res.Header().Get("ETag")
+		if etag != `W/"serving"` {
+			t.Fatalf("got ETag %q, expected %q", etag, `W/"serving"`)
+		}
+		if res := get(etag); res.Code != http.StatusNotModified {
+			t.Errorf("got HTTP %d for matching ETag, expected %d", res.Code, http.StatusNotModified)
+		}
+		if res := get(`"other", "serving"`); res.Code != http.StatusNotModified {
+			t.Errorf("got HTTP %d for strong match in list, expected %d", res.Code, http.StatusNotModified)
+		}
+		checker.SetStatus("", StatusNotServing)
+		if res := get(etag); res.Code != http.StatusServiceUnavailable {
+			t.Errorf("got HTTP %d for stale ETag, expected %d", res.Code, http.StatusServiceUnavailable)
+		}
+		// Probes treat 304 as healthy, so failing statuses never get one.
+		if res := get(`W/"not_serving"`); res.Code != http.StatusServiceUnavailable {
+			t.Errorf("got HTTP %d for matching ETag of a failing status, expected %d", res.Code, http.StatusServiceUnavailable)
+		}
+		if res := get("*"); res.Code != http.StatusServiceUnavailable {
+			t.Errorf("got HTTP %d for wildcard with a failing status, expected %d", res.Code, http.StatusServiceUnavailable)
+		}
+	})
+	t.Run("connect_get", func(t *testing.T) {
+		t.Parallel()
+		mux := http.NewServeMux()
+		mux.Handle(NewHandler(NewStaticChecker(), WithETags()))
+		server := httptest.NewServer(mux)
+		t.Cleanup(server.Close)
+		newClient := func(options ...connect.ClientOption) *connect.Client[healthv1.HealthCheckRequest, healthv1.HealthCheckResponse] {
+			return connect.NewClient[healthv1.HealthCheckRequest, healthv1.HealthCheckResponse](
+				server.Client(),
+				server.URL+"/grpc.health.v1.Health/Check",
+				options...,
+			)
+		}
+		res, err := newClient(connect.WithHTTPGet(), connect.WithIdempotency(connect.IdempotencyNoSideEffects)).CallUnary(context.Background(), connect.NewRequest(&healthv1.HealthCheckRequest{}))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := res.Header().Get("Cache-Control"); got != "no-store" {
+			t.Errorf("got Cache-Control %q, expected %q", got, "no-store")
+		}
+		if got := res.Header().Get("ETag"); got != `W/"serving"` {
+			t.Errorf("got ETag %q, expected %q", got, `W/"serving"`)
+		}
+		// POST responses can't be cached, so they don't need the headers.
+		res, err = newClient().CallUnary(context.Background(), connect.NewRequest(&healthv1.HealthCheckRequest{}))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := res.Header().Get("ETag"); got != "" {
+			t.Errorf("got ETag %q for POST, expected none", got)
+		}
+	})
+}
@@ -0,0 +1,161 @@
+// Copyright 2022-2024 The Connect Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package grpchealth
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"connectrpc.com/connect"
+)
+
+// CheckCancellation controls what happens to a check when the client that
+// requested it disconnects or its deadline passes.
+type CheckCancellation uint8
+
+const (
+	// CancelChecks cancels the check's context immediately. This is the
+	// default.
+	CancelChecks CheckCancellation = iota
+
+	// CompleteChecks lets the check run to completion without the client, and
+	// shares its result: concurrent requests for the same service wait for
+	// the check already in flight rather than starting another, and the
+	// result answers later requests until it expires. Use it with expensive
+	// checks behind load balancers whose probe timeouts are tighter than the
+	// checks, which otherwise start and abandon the same check over and over.
+	// Checkers should still bound their own work, since a check that never
+	// finishes holds up every request for its service.
+	CompleteChecks
+)
+
+// WithCheckCancellation sets what happens to checks when their clients go
+// away. With CompleteChecks, results are reused for cacheTTL after the check
+// finishes; if it's not positive, results are only shared with requests that
+// arrive while the check is in flight. Watch streams are unaffected.
+func WithCheckCancellation(policy CheckCancellation, cacheTTL time.Duration) HandlerOption {
+	return newHandlerOption(func(config *handlerConfig) {
+		config.DetachedChecks = nil
+		if policy == CompleteChecks {
+			config.DetachedChecks = &detachedChecks{
+				ttl:    cacheTTL,
+				checks: make(map[detachedKey]*detachedCheck),
+			}
+		}
+	})
+}
+
+// WithNegativeCheckCacheTTL sets how long results of failed checks and of
+// services that aren't StatusServing are reused under CompleteChecks (see
+// WithCheckCancellation). A short negative TTL detects recovery quickly while
+// a longer cache TTL keeps steady-state probing cheap. If it's zero, the
+// default, the cache TTL applies to every result.
+func WithNegativeCheckCacheTTL(ttl time.Duration) HandlerOption {
+	return newHandlerOption(func(config *handlerConfig) {
+		config.NegativeCacheTTL = ttl
+	})
+}
+
+// cacheTTL returns how long to reuse a result: the negative TTL for failures
+// and unhealthy statuses, if it's set, and the positive TTL otherwise.
+func cacheTTL(status Status, err error, positive, negative time.Duration) time.Duration {
+	if negative != 0 && (err != nil || status != StatusServing) {
+		return negative
+	}
+	return positive
+}
+
+// detachedChecks runs checks independently of the requests that start them,
+// sharing each check's result with every request for the same service.
+type detachedChecks struct {
+	ttl         time.Duration
+	negativeTTL time.Duration
+
+	mu     sync.Mutex
+	checks map[detachedKey]*detachedCheck
+}
+
+// detachedKey identifies the checks that may share a result. Requests on
+// different health channels (see WithChannel) may see different statuses.
+type detachedKey struct {
+	channel string
+	service string
+}
+
+type detachedCheck struct {
+	done    chan struct{}
+	result  *CheckResult // set before done is closed
+	expires time.Time    // guarded by detachedChecks.mu
+}
+
+// run returns the result of the check in flight or cached for the requested
+// service, starting a check if there's none. If ctx ends first, it returns a
+// result carrying ctx's error, and the check continues without it.
+func (d *detachedChecks) run(ctx context.Context, clock Clock, checker Checker, req *CheckRequest) *CheckResult {
+	key := detachedKey{channel: ChannelFromContext(ctx), service: req.Service}
+	d.mu.Lock()
+	check, ok := d.checks[key]
+	if !ok || (check.result != nil && !clock.Now().Before(check.expires)) {
+		check = &detachedCheck{done: make(chan struct{})}
+		d.checks[key] = check
+		go d.complete(context.WithoutCancel(ctx), clock, checker, req, key, check)
+	}
+	d.mu.Unlock()
+
+	requestID, _ := RequestIDFromContext(ctx)
+	select {
+	case <-check.done:
+		result := *check.result
+		result.RequestID = requestID
+		return &result
+	case <-ctx.Done():
+		return &CheckResult{
+			Service:    req.Service,
+			Err:        ctx.Err(),
+			ObservedAt: clock.Now(),
+			RequestID:  requestID,
+		}
+	}
+}
+
+func (d *detachedChecks) complete(ctx context.Context, clock Clock, checker Checker, req *CheckRequest, key detachedKey, check *detachedCheck) {
+	result := runCheck(ctx, clock, checker, req)
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	check.result = result
+	ttl := cacheTTL(result.Status, result.Err, d.ttl, d.negativeTTL)
+	check.expires = clock.Now().Add(ttl)
+	close(check.done)
+	// Don't cache unknown services, and forget results once they expire, so
+	// clients can't grow the cache without bound by checking many names.
+	if ttl <= 0 || connect.CodeOf(result.Err) == connect.CodeNotFound {
+		d.forget(key, check)
+		return
+	}
+	clock.AfterFunc(ttl, func() {
+		d.mu.Lock()
+		defer d.mu.Unlock()
+		d.forget(key, check)
+	})
+}
+
+// forget removes a check from the cache, unless another check has replaced
+// it. The caller must hold d.mu.
+func (d *detachedChecks) forget(key detachedKey, check *detachedCheck) {
+	if d.checks[key] == check {
+		delete(d.checks, key)
+	}
+}
@@ -0,0 +1,177 @@
+// Copyright 2022-2024 The Connect Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package grpchealth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"connectrpc.com/connect"
+)
+
+func TestCheckCancellation(t *testing.T) {
+	const userFQN = "acme.user.v1.UserService"
+	t.Parallel()
+	var calls atomic.Int32
+	release := make(chan struct{})
+	slow := checkerFunc(func(ctx context.Context, req *CheckRequest) (*CheckResponse, error) {
+		calls.Add(1)
+		select {
+		case <-release:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		return NewStaticChecker(userFQN).Check(ctx, req)
+	})
+	config := newHandlerConfig([]connect.HandlerOption{WithCheckCancellation(CompleteChecks, time.Hour)})
+	req := &CheckRequest{Service: userFQN}
+
+	// Impatient clients abandon the check, but it keeps running and they
+	// share it.
+	for i := 0; i < 3; i++ {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Millisecond)
+		result := config.runCheck(ctx, slow, req)
+		cancel()
+		if !errors.Is(result.Err, context.DeadlineExceeded) {
+			t.Fatalf("got error %v, expected %v", result.Err, context.DeadlineExceeded)
+		}
+	}
+	close(release)
+	for i := 0; i < 3; i++ {
+		result := config.runCheck(context.Background(), slow, req)
+		if result.Err != nil || result.Status != StatusServing {
+			t.Fatalf("got %v, %v", result.Status, result.Err)
+		}
+	}
+	if got := calls.Load(); got != 1 {
+		t.Fatalf("got %d checks, expected 1", got)
+	}
+
+	// Unknown services aren't cached.
+	unknown := &CheckRequest{Service: "unknown"}
+	for i := 0; i < 2; i++ {
+		if result := config.runCheck(context.Background(), slow, unknown); result.Err == nil {
+			t.Fatal("expected error for unknown service")
+		}
+	}
+	if got := calls.Load(); got != 3 {
+		t.Fatalf("got %d checks, expected 3", got)
+	}
+
+	// By default, checks are canceled with their clients.
+	config = newHandlerConfig(nil)
+	var canceled atomic.Bool
+	blocking := checkerFunc(func(ctx context.Context, _ *CheckRequest) (*CheckResponse, error) {
+		<-ctx.Done()
+		canceled.Store(true)
+		return nil, ctx.Err()
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Millisecond)
+	defer cancel()
+	config.runCheck(ctx, blocking, req)
+	if !canceled.Load() {
+		t.Fatal("check wasn't canceled")
+	}
+}
+
+func TestNegativeCheckCacheTTL(t *testing.T) {
+	t.Parallel()
+	clock := &manualClock{now: time.Unix(0, 0)}
+	var (
+		calls  atomic.Int32
+		status atomic.Uint32
+	)
+	status.Store(uint32(StatusNotServing))
+	checker := checkerFunc(func(context.Context, *CheckRequest) (*CheckResponse, error) {
+		calls.Add(1)
+		return &CheckResponse{Status: Status(status.Load())}, nil
+	})
+	config := newHandlerConfig([]connect.HandlerOption{
+		WithNegativeCheckCacheTTL(time.Second),
+		WithCheckCancellation(CompleteChecks, time.Hour),
+		WithHandlerClock(clock),
+	})
+	check := func(expect Status, expectCalls int32) {
+		t.Helper()
+		if result := config.runCheck(context.Background(), checker, &CheckRequest{}); result.Status != expect {
+			t.Fatalf("got status %v, expected %v", result.Status, expect)
+		}
+		if got := calls.Load(); got != expectCalls {
+			t.Fatalf("got %d checks, expected %d", got, expectCalls)
+		}
+	}
+	check(StatusNotServing, 1)
+	check(StatusNotServing, 1)
+	// Recovery is noticed once the short negative TTL expires...
+	status.Store(uint32(StatusServing))
+	clock.Advance(time.Second)
+	check(StatusServing, 2)
+	// ...but healthy results are reused for the full TTL.
+	clock.Advance(time.Minute)
+	check(StatusServing, 2)
+}
+
+func TestCheckCancellationForgetsExpired(t *testing.T) {
+	t.Parallel()
+	checker := NewStaticCheckerWithOptions(nil, WithUnregisteredPolicy(UnregisteredServiceUnknown))
+	config := newHandlerConfig([]connect.HandlerOption{
+		WithCheckCancellation(CompleteChecks, 10*time.Millisecond),
+	})
+	// Unregistered services succeed under this policy, so each distinct name
+	// is cached until it expires.
+	for i := 0; i < 1000; i++ {
+		result := config.runCheck(context.Background(), checker, &CheckRequest{Service: fmt.Sprintf("random.Service%d", i)})
+		if result.Err != nil || result.Status != StatusServiceUnknown {
+			t.Fatalf("got %v, %v", result.Status, result.Err)
+		}
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		config.DetachedChecks.mu.Lock()
+		cached := len(config.DetachedChecks.checks)
+		config.DetachedChecks.mu.Unlock()
+		if cached == 0 {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("%d expired results still cached", cached)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestCacheTTL(t *testing.T) {
+	t.Parallel()
+	for _, test := range []struct {
+		status             Status
+		err                error
+		positive, negative time.Duration
+		expect             time.Duration
+	}{
+		{status: StatusServing, positive: time.Hour, negative: time.Second, expect: time.Hour},
+		{status: StatusNotServing, positive: time.Hour, negative: time.Second, expect: time.Second},
+		{err: errors.New("boom"), positive: time.Hour, negative: time.Second, expect: time.Second},
+		{status: StatusNotServing, positive: time.Hour, expect: time.Hour},
+		{status: StatusNotServing, positive: time.Hour, negative: -1, expect: -1},
+	} {
+		if got := cacheTTL(test.status, test.err, test.positive, test.negative); got != test.expect {
+			t.Errorf("got TTL %v for %v, %v, expected %v", got, test.status, test.err, test.expect)
+		}
+	}
+}
@@ -0,0 +1,136 @@
+// Copyright 2022-2024 The Connect Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package grpchealth
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"time"
+)
+
+// CertificateCheckerParams configure a CertificateChecker.
+type CertificateCheckerParams struct {
+	// Files are paths to PEM-encoded certificate files. Every certificate in
+	// each file is checked, including intermediates. Files are re-read on each
+	// check, so rotated certificates are picked up.
+	Files []string
+	// Config is a TLS configuration whose Certificates are checked. Its
+	// GetCertificate and GetConfigForClient callbacks are ignored.
+	Config *tls.Config
+	// RenewalWindow is how long before expiry a certificate is considered
+	// unhealthy. It should be shorter than the time automated renewal needs
+	// and longer than the time a human needs to respond.
+	RenewalWindow time.Duration
+	// Clock supplies the current time. The default is the system clock.
+	Clock Clock
+}
+
+// CertificateChecker is a Checker that reports StatusNotServing when any
+// certificate it watches has expired, isn't valid yet, or expires within the
+// renewal window. The details of the response include the soonest expiry and
+// the subject of that certificate.
+//
+// CertificateChecker reports the same status for every service. If a file
+// can't be read or parsed, or holds no certificates (as when it's a key or
+// DER-encoded), Check returns an error, so a misconfigured path can't pass
+// for healthy certificates.
+type CertificateChecker struct {
+	params CertificateCheckerParams
+}
+
+// NewCertificateChecker constructs a CertificateChecker.
+func NewCertificateChecker(params CertificateCheckerParams) *CertificateChecker {
+	if params.Clock == nil {
+		params.Clock = systemClock{}
+	}
+	return &CertificateChecker{params: params}
+}
+
+// Check implements Checker.
+func (c *CertificateChecker) Check(_ context.Context, _ *CheckRequest) (*CheckResponse, error) {
+	certs, err := c.certificates()
+	if err != nil {
+		return nil, err
+	}
+	now := c.params.Clock.Now()
+	status := StatusServing
+	var soonest *x509.Certificate
+	for _, cert := range certs {
+		if now.Before(cert.NotBefore) || now.Add(c.params.RenewalWindow).After(cert.NotAfter) {
+			status = StatusNotServing
+		}
+		if soonest == nil || cert.NotAfter.Before(soonest.NotAfter) {
+			soonest = cert
+		}
+	}
+	res := &CheckResponse{Status: status}
+	if soonest != nil {
+		res.Details = map[string]string{
+			"not_after": soonest.NotAfter.UTC().Format(time.RFC3339),
+			"subject":   soonest.Subject.String(),
+		}
+	}
+	return res, nil
+}
+
+func (c *CertificateChecker) certificates() ([]*x509.Certificate, error) {
+	var certs []*x509.Certificate
+	for _, path := range c.params.Files {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		found := len(certs)
+		for {
+			var block *pem.Block
+			block, data = pem.Decode(data)
+			if block == nil {
+				break
+			}
+			if block.Type != "CERTIFICATE" {
+				continue
+			}
+			cert, err := x509.ParseCertificate(block.Bytes)
+			if err != nil {
+				return nil, fmt.Errorf("parse %s: %w", path, err)
+			}
+			certs = append(certs, cert)
+		}
+		if len(certs) == found {
+			return nil, fmt.Errorf("no PEM certificates in %s", path)
+		}
+	}
+	if c.params.Config == nil {
+		return certs, nil
+	}
+	for _, chain := range c.params.Config.Certificates {
+		for i, der := range chain.Certificate {
+			if i == 0 && chain.Leaf != nil {
+				certs = append(certs, chain.Leaf)
+				continue
+			}
+			cert, err := x509.ParseCertificate(der)
+			if err != nil {
+				return nil, fmt.Errorf("parse TLS certificate: %w", err)
+			}
+			certs = append(certs, cert)
+		}
+	}
+	return certs, nil
+}
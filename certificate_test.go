@@ -0,0 +1,109 @@
+// Copyright 2022-2024 The Connect Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package grpchealth
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestCertificateChecker(t *testing.T) {
+	t.Parallel()
+	now := time.Now()
+	soon := newTestCertificate(t, "soon", now.Add(time.Hour))
+	later := newTestCertificate(t, "later", now.Add(30*24*time.Hour))
+	path := filepath.Join(t.TempDir(), "cert.pem")
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: later}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	clock := &manualClock{now: now}
+	checker := NewCertificateChecker(CertificateCheckerParams{
+		Files:         []string{path},
+		Config:        &tls.Config{Certificates: []tls.Certificate{{Certificate: [][]byte{soon}}}}, //nolint:gosec // only the certificates are used
+		RenewalWindow: 24 * time.Hour,
+		Clock:         clock,
+	})
+	res, err := checker.Check(context.Background(), &CheckRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Status != StatusNotServing || res.Details["subject"] != "CN=soon" {
+		t.Fatalf("got %v with details %v", res.Status, res.Details)
+	}
+
+	checker.params.Config = nil
+	res, err = checker.Check(context.Background(), &CheckRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Status != StatusServing || res.Details["subject"] != "CN=later" {
+		t.Fatalf("got %v with details %v", res.Status, res.Details)
+	}
+
+	clock.Advance(60 * 24 * time.Hour)
+	res, err = checker.Check(context.Background(), &CheckRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Status != StatusNotServing {
+		t.Fatalf("got %v for expired certificate", res.Status)
+	}
+
+	checker.params.Files = []string{filepath.Join(t.TempDir(), "missing.pem")}
+	if _, err := checker.Check(context.Background(), &CheckRequest{}); err == nil {
+		t.Fatal("expected error for missing file")
+	}
+
+	// Files without PEM certificates, such as DER files, are errors rather
+	// than an empty set of healthy certificates.
+	der := filepath.Join(t.TempDir(), "cert.der")
+	if err := os.WriteFile(der, later, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	checker.params.Files = []string{der}
+	if _, err := checker.Check(context.Background(), &CheckRequest{}); err == nil {
+		t.Fatal("expected error for file without PEM certificates")
+	}
+}
+
+func newTestCertificate(t *testing.T, name string, notAfter time.Time) []byte {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     notAfter,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return der
+}
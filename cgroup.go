@@ -0,0 +1,218 @@
+// Copyright 2022-2024 The Connect Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package grpchealth
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// CgroupCheckerParams configure a CgroupChecker. A zero limit disables the
+// corresponding check.
+type CgroupCheckerParams struct {
+	// Root is the directory where the container's cgroup is mounted. If empty,
+	// it defaults to /sys/fs/cgroup.
+	Root string
+	// MaxMemoryFraction is the fraction of the container's memory limit,
+	// between 0 and 1, above which the container is under memory pressure.
+	// Memory usage is measured as the working set: total usage minus inactive
+	// page cache, which the kernel can reclaim.
+	MaxMemoryFraction float64
+	// MaxThrottledFraction is the fraction of CPU scheduling periods, between
+	// 0 and 1, in which the container may be throttled before it's considered
+	// under CPU pressure. It's measured over the period since the previous
+	// sample.
+	MaxThrottledFraction float64
+	// Interval is the minimum time between samples. Checks made more often
+	// reuse the previous result.
+	Interval time.Duration
+	// Clock times samples. The default is the system clock.
+	Clock Clock
+}
+
+// CgroupChecker is a Checker that reports StatusNotServing when the container
+// it's running in is near its memory limit or heavily CPU-throttled, the
+// conditions that typically precede out-of-memory kills and timeouts. It
+// supports both cgroup v1 and v2, and it ignores limits that aren't set. The
+// details of the response include the measured values.
+//
+// CgroupChecker reports the same status for every service. If the cgroup
+// filesystem can't be read, Check returns an error.
+type CgroupChecker struct {
+	params CgroupCheckerParams
+
+	mu       sync.Mutex
+	sampled  time.Time
+	periods  uint64
+	throttle uint64
+	response *CheckResponse
+}
+
+// NewCgroupChecker constructs a CgroupChecker.
+func NewCgroupChecker(params CgroupCheckerParams) *CgroupChecker {
+	if params.Root == "" {
+		params.Root = "/sys/fs/cgroup"
+	}
+	if params.Clock == nil {
+		params.Clock = systemClock{}
+	}
+	return &CgroupChecker{params: params}
+}
+
+// Check implements Checker.
+func (c *CgroupChecker) Check(_ context.Context, _ *CheckRequest) (*CheckResponse, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.response != nil && c.params.Clock.Now().Sub(c.sampled) < c.params.Interval {
+		return c.response, nil
+	}
+	stats, err := readCgroupStats(c.params.Root)
+	if err != nil {
+		return nil, err
+	}
+	status := StatusServing
+	details := make(map[string]string, 2)
+	if stats.memoryLimit > 0 {
+		fraction := float64(stats.memoryWorkingSet) / float64(stats.memoryLimit)
+		details["memory"] = strconv.FormatFloat(fraction, 'f', 3, 64)
+		if c.params.MaxMemoryFraction > 0 && fraction > c.params.MaxMemoryFraction {
+			status = StatusNotServing
+		}
+	}
+	if c.response != nil && stats.periods > c.periods {
+		fraction := float64(stats.throttled-c.throttle) / float64(stats.periods-c.periods)
+		details["cpu_throttled"] = strconv.FormatFloat(fraction, 'f', 3, 64)
+		if c.params.MaxThrottledFraction > 0 && fraction > c.params.MaxThrottledFraction {
+			status = StatusNotServing
+		}
+	}
+	c.sampled = c.params.Clock.Now()
+	c.periods, c.throttle = stats.periods, stats.throttled
+	c.response = &CheckResponse{Status: status, Details: details}
+	return c.response, nil
+}
+
+type cgroupStats struct {
+	memoryWorkingSet uint64
+	memoryLimit      uint64 // zero if unlimited
+	periods          uint64
+	throttled        uint64
+}
+
+func readCgroupStats(root string) (*cgroupStats, error) {
+	if _, err := os.Stat(filepath.Join(root, "cgroup.controllers")); err == nil {
+		return readCgroupV2Stats(root)
+	}
+	return readCgroupV1Stats(root)
+}
+
+func readCgroupV2Stats(root string) (*cgroupStats, error) {
+	var stats cgroupStats
+	usage, err := readCgroupUint(filepath.Join(root, "memory.current"))
+	if err != nil {
+		return nil, err
+	}
+	memoryStat, err := readCgroupKeyValues(filepath.Join(root, "memory.stat"))
+	if err != nil {
+		return nil, err
+	}
+	stats.memoryWorkingSet = usage - min(usage, memoryStat["inactive_file"])
+	limit, err := readCgroupUint(filepath.Join(root, "memory.max"))
+	if err != nil && !errors.Is(err, errCgroupUnlimited) {
+		return nil, err
+	}
+	stats.memoryLimit = limit
+	cpuStat, err := readCgroupKeyValues(filepath.Join(root, "cpu.stat"))
+	if err != nil {
+		return nil, err
+	}
+	stats.periods, stats.throttled = cpuStat["nr_periods"], cpuStat["nr_throttled"]
+	return &stats, nil
+}
+
+func readCgroupV1Stats(root string) (*cgroupStats, error) {
+	var stats cgroupStats
+	memory := filepath.Join(root, "memory")
+	usage, err := readCgroupUint(filepath.Join(memory, "memory.usage_in_bytes"))
+	if err != nil {
+		return nil, err
+	}
+	memoryStat, err := readCgroupKeyValues(filepath.Join(memory, "memory.stat"))
+	if err != nil {
+		return nil, err
+	}
+	stats.memoryWorkingSet = usage - min(usage, memoryStat["total_inactive_file"])
+	limit, err := readCgroupUint(filepath.Join(memory, "memory.limit_in_bytes"))
+	if err != nil {
+		return nil, err
+	}
+	// Without a limit, cgroup v1 reports a huge, page-aligned value.
+	if limit < 1<<62 {
+		stats.memoryLimit = limit
+	}
+	cpuStat, err := readCgroupKeyValues(filepath.Join(root, "cpu", "cpu.stat"))
+	if err != nil {
+		return nil, err
+	}
+	stats.periods, stats.throttled = cpuStat["nr_periods"], cpuStat["nr_throttled"]
+	return &stats, nil
+}
+
+var errCgroupUnlimited = errors.New("cgroup limit not set")
+
+func readCgroupUint(path string) (uint64, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	text := string(bytes.TrimSpace(data))
+	if text == "max" {
+		return 0, errCgroupUnlimited
+	}
+	value, err := strconv.ParseUint(text, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("parse %s: %w", path, err)
+	}
+	return value, nil
+}
+
+func readCgroupKeyValues(path string) (map[string]uint64, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	values := make(map[string]uint64)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		key, text, ok := strings.Cut(scanner.Text(), " ")
+		if !ok {
+			continue
+		}
+		if value, err := strconv.ParseUint(text, 10, 64); err == nil {
+			values[key] = value
+		}
+	}
+	return values, scanner.Err()
+}
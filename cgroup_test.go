@@ -0,0 +1,117 @@
+// Copyright 2022-2024 The Connect Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package grpchealth
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCgroupCheckerV2(t *testing.T) {
+	t.Parallel()
+	root := t.TempDir()
+	writeCgroupFiles(t, root, map[string]string{
+		"cgroup.controllers": "cpu memory\n",
+		"memory.current":     "900\n",
+		"memory.stat":        "anon 700\ninactive_file 100\n",
+		"memory.max":         "1000\n",
+		"cpu.stat":           "usage_usec 100\nnr_periods 10\nnr_throttled 1\n",
+	})
+	checker := NewCgroupChecker(CgroupCheckerParams{
+		Root:                 root,
+		MaxMemoryFraction:    0.9,
+		MaxThrottledFraction: 0.5,
+		Interval:             0,
+	})
+	assertCgroupStatus(t, checker, StatusServing)
+
+	// 80% of CPU periods throttled since the last check.
+	writeCgroupFiles(t, root, map[string]string{
+		"cpu.stat": "usage_usec 200\nnr_periods 20\nnr_throttled 9\n",
+	})
+	res := assertCgroupStatus(t, checker, StatusNotServing)
+	if res.Details["cpu_throttled"] != "0.800" || res.Details["memory"] != "0.800" {
+		t.Fatalf("got details %v", res.Details)
+	}
+
+	writeCgroupFiles(t, root, map[string]string{
+		"memory.max": "max\n",
+		"cpu.stat":   "usage_usec 300\nnr_periods 30\nnr_throttled 9\n",
+	})
+	assertCgroupStatus(t, checker, StatusServing)
+}
+
+func TestCgroupCheckerV1(t *testing.T) {
+	t.Parallel()
+	root := t.TempDir()
+	writeCgroupFiles(t, root, map[string]string{
+		"memory/memory.usage_in_bytes": "1000\n",
+		"memory/memory.stat":           "total_inactive_file 50\n",
+		"memory/memory.limit_in_bytes": "1000\n",
+		"cpu/cpu.stat":                 "nr_periods 0\nnr_throttled 0\nthrottled_time 0\n",
+	})
+	checker := NewCgroupChecker(CgroupCheckerParams{
+		Root:                 root,
+		MaxMemoryFraction:    0.9,
+		MaxThrottledFraction: 0,
+		Interval:             0,
+	})
+	assertCgroupStatus(t, checker, StatusNotServing)
+
+	writeCgroupFiles(t, root, map[string]string{
+		"memory/memory.limit_in_bytes": "9223372036854771712\n",
+	})
+	assertCgroupStatus(t, checker, StatusServing)
+}
+
+func TestCgroupCheckerMissing(t *testing.T) {
+	t.Parallel()
+	checker := NewCgroupChecker(CgroupCheckerParams{
+		Root:                 t.TempDir(),
+		MaxMemoryFraction:    0.9,
+		MaxThrottledFraction: 0.5,
+		Interval:             0,
+	})
+	if _, err := checker.Check(context.Background(), &CheckRequest{}); err == nil {
+		t.Fatal("expected error without cgroup files")
+	}
+}
+
+func assertCgroupStatus(t *testing.T, checker *CgroupChecker, expect Status) *CheckResponse {
+	t.Helper()
+	res, err := checker.Check(context.Background(), &CheckRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Status != expect {
+		t.Fatalf("got status %v, expected %v (details %v)", res.Status, expect, res.Details)
+	}
+	return res
+}
+
+func writeCgroupFiles(t *testing.T, root string, files map[string]string) {
+	t.Helper()
+	for name, contents := range files {
+		path := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(contents), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
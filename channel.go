@@ -0,0 +1,151 @@
+// Copyright 2022-2024 The Connect Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package grpchealth
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"connectrpc.com/connect"
+)
+
+// ChannelCanary is the conventional name of the health channel for canary
+// traffic. The empty channel name refers to stable traffic.
+const ChannelCanary = "canary"
+
+// WithChannelHeader makes handlers read the health channel from the named
+// request header, so load balancers for canary and stable pools can probe the
+// same endpoint and see different statuses. Checkers read the channel through
+// ChannelFromContext; ChannelChecker routes on it directly.
+func WithChannelHeader(header string) HandlerOption {
+	return newHandlerOption(func(config *handlerConfig) {
+		config.ChannelHeader = header
+	})
+}
+
+// WithChannel labels every request served by a handler with a fixed health
+// channel, for binaries that serve canary health on a separate port or path.
+// It takes precedence over WithChannelHeader.
+func WithChannel(channel string) HandlerOption {
+	return newHandlerOption(func(config *handlerConfig) {
+		config.Channel = channel
+	})
+}
+
+// ChannelFromContext returns the health channel attached by a handler built
+// with WithChannel or WithChannelHeader. It returns the empty string for
+// stable traffic.
+func ChannelFromContext(ctx context.Context) string {
+	channel, _ := ctx.Value(channelKey{}).(string)
+	return channel
+}
+
+// ChannelCheckerParams configure a ChannelChecker.
+type ChannelCheckerParams struct {
+	// Stable serves requests without a channel, and requests for channels
+	// that aren't listed in Channels.
+	Stable Checker
+	// Channels maps channel names, such as ChannelCanary, to the Checker that
+	// serves them.
+	Channels map[string]Checker
+}
+
+// ChannelChecker maintains separate health for canary and stable traffic
+// served by the same binary. Each request is routed to a Checker by the
+// channel attached to its context, so a canary rollout can be pulled from its
+// load balancer pool by setting a status in the canary Checker without
+// affecting the stable pool.
+//
+//	stable, canary := grpchealth.NewStaticChecker(), grpchealth.NewStaticChecker()
+//	checker, _ := grpchealth.NewChannelChecker(grpchealth.ChannelCheckerParams{
+//		Stable:   stable,
+//		Channels: map[string]grpchealth.Checker{grpchealth.ChannelCanary: canary},
+//	})
+//	mux.Handle(grpchealth.NewHandler(checker, grpchealth.WithChannelHeader("Health-Channel")))
+type ChannelChecker struct {
+	stable   Checker
+	channels map[string]Checker
+}
+
+// NewChannelChecker constructs a ChannelChecker. It returns an error if the
+// stable Checker or any channel's Checker is missing.
+func NewChannelChecker(params ChannelCheckerParams) (*ChannelChecker, error) {
+	if params.Stable == nil {
+		return nil, errors.New("channel checker requires a stable checker")
+	}
+	channels := make(map[string]Checker, len(params.Channels))
+	for channel, checker := range params.Channels {
+		if checker == nil {
+			return nil, errors.New("channel checker requires a checker for channel " + channel)
+		}
+		channels[channel] = checker
+	}
+	return &ChannelChecker{stable: params.Stable, channels: channels}, nil
+}
+
+// Checker returns the Checker that serves a channel.
+func (c *ChannelChecker) Checker(channel string) Checker {
+	if checker, ok := c.channels[channel]; ok {
+		return checker
+	}
+	return c.stable
+}
+
+// Check implements Checker.
+func (c *ChannelChecker) Check(ctx context.Context, req *CheckRequest) (*CheckResponse, error) {
+	return c.Checker(ChannelFromContext(ctx)).Check(ctx, req)
+}
+
+// Watch implements Watcher. It returns an error if the channel's Checker
+// isn't a Watcher.
+func (c *ChannelChecker) Watch(ctx context.Context, req *CheckRequest, update func(*CheckResponse) error) error {
+	watcher, ok := c.Checker(ChannelFromContext(ctx)).(Watcher)
+	if !ok {
+		return connect.NewError(
+			connect.CodeUnimplemented,
+			errors.New("channel checker doesn't support watching health state"),
+		)
+	}
+	return watcher.Watch(ctx, req, update)
+}
+
+// List implements Lister. It returns an error if the channel's Checker isn't a
+// Lister.
+func (c *ChannelChecker) List(ctx context.Context) (map[string]Status, error) {
+	lister, ok := c.Checker(ChannelFromContext(ctx)).(Lister)
+	if !ok {
+		return nil, connect.NewError(
+			connect.CodeUnimplemented,
+			errors.New("channel checker doesn't support listing services"),
+		)
+	}
+	return lister.List(ctx)
+}
+
+type channelKey struct{}
+
+// withChannel attaches the request's health channel to the context. Without
+// a configured channel or header, it returns the context unchanged.
+func (c *handlerConfig) withChannel(ctx context.Context, request http.Header) context.Context {
+	channel := c.Channel
+	if channel == "" && c.ChannelHeader != "" {
+		channel = request.Get(c.ChannelHeader)
+	}
+	if channel == "" {
+		return ctx
+	}
+	return context.WithValue(ctx, channelKey{}, channel)
+}
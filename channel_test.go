@@ -0,0 +1,90 @@
+// Copyright 2022-2024 The Connect Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package grpchealth
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"connectrpc.com/connect"
+	healthv1 "connectrpc.com/grpchealth/internal/gen/go/connectext/grpc/health/v1"
+)
+
+func TestChannelChecker(t *testing.T) {
+	const userFQN = "acme.user.v1.UserService"
+	t.Parallel()
+	stable, canary := NewStaticChecker(userFQN), NewStaticChecker(userFQN)
+	checker, err := NewChannelChecker(ChannelCheckerParams{
+		Stable:   stable,
+		Channels: map[string]Checker{ChannelCanary: canary},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	canary.SetStatus(userFQN, StatusNotServing)
+
+	mux := http.NewServeMux()
+	mux.Handle(NewHandler(checker, WithChannelHeader("Health-Channel")))
+	server := httptest.NewUnstartedServer(mux)
+	server.EnableHTTP2 = true
+	server.StartTLS()
+	t.Cleanup(server.Close)
+	client := connect.NewClient[healthv1.HealthCheckRequest, healthv1.HealthCheckResponse](
+		server.Client(),
+		server.URL+"/grpc.health.v1.Health/Check",
+		connect.WithGRPC(),
+	)
+	for channel, expect := range map[string]Status{
+		"":            StatusServing,
+		ChannelCanary: StatusNotServing,
+		"unknown":     StatusServing,
+	} {
+		req := connect.NewRequest(&healthv1.HealthCheckRequest{Service: userFQN})
+		req.Header().Set("Health-Channel", channel)
+		res, err := client.CallUnary(context.Background(), req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := Status(res.Msg.GetStatus()); got != expect {
+			t.Errorf("got status %v for channel %q, expected %v", got, channel, expect)
+		}
+	}
+
+	fixed := httptest.NewServer(NewHTTPHandler(checker, WithChannel(ChannelCanary)))
+	t.Cleanup(fixed.Close)
+	res, err := fixed.Client().Get(fixed.URL + "?service=" + userFQN)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusServiceUnavailable {
+		t.Fatalf("got HTTP status %d for fixed canary channel, expected %d", res.StatusCode, http.StatusServiceUnavailable)
+	}
+
+	ctx := context.WithValue(context.Background(), channelKey{}, ChannelCanary)
+	statuses, err := checker.List(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if statuses[userFQN] != StatusNotServing {
+		t.Fatalf("got canary list %v", statuses)
+	}
+
+	if _, err := NewChannelChecker(ChannelCheckerParams{}); err == nil {
+		t.Fatal("expected error without stable checker")
+	}
+}
@@ -0,0 +1,158 @@
+// Copyright 2022-2024 The Connect Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package grpchealth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+
+	"connectrpc.com/connect"
+)
+
+// ChaosParams configure a ChaosChecker.
+type ChaosParams struct {
+	// Checker is the wrapped Checker, which answers checks when no fault is
+	// injected.
+	Checker Checker
+	// FailureRate is the fraction of checks, from 0 to 1, that fail with a
+	// connect.CodeUnavailable error.
+	FailureRate float64
+	// Latency is added to every check.
+	Latency time.Duration
+	// LatencyJitter is the most random latency added to each check, on top of
+	// Latency.
+	LatencyJitter time.Duration
+	// Every and For schedule recurring outages: for the first For of every
+	// Every, counting from construction, checks report ScheduledStatus.
+	Every time.Duration
+	For   time.Duration
+	// ScheduledStatus is reported during scheduled outages. The default is
+	// StatusNotServing.
+	ScheduledStatus Status
+	// Seed seeds the random source, so injected faults are reproducible.
+	Seed int64
+	// Clock schedules outages and injected latency. The default is the system
+	// clock.
+	Clock Clock
+}
+
+// ChaosChecker wraps a Checker to inject failures, latency, and forced
+// statuses, so teams can rehearse how load balancers, orchestrators, and
+// alerting react to unhealthy reports. It's meant for testing and game days,
+// not for production traffic.
+//
+// Faults can be toggled at runtime with SetEnabled and Force, for example from
+// an authenticated admin endpoint.
+type ChaosChecker struct {
+	params ChaosParams
+	start  time.Time
+
+	mu      sync.Mutex
+	rng     *rand.Rand
+	enabled bool
+	forced  *Status
+}
+
+// NewChaosChecker constructs a ChaosChecker, with faults enabled. It returns
+// an error if the wrapped Checker is missing or the parameters are out of
+// range.
+func NewChaosChecker(params ChaosParams) (*ChaosChecker, error) {
+	if params.Checker == nil {
+		return nil, errors.New("chaos checker requires a checker")
+	}
+	if params.FailureRate < 0 || params.FailureRate > 1 {
+		return nil, fmt.Errorf("chaos failure rate %v isn't between 0 and 1", params.FailureRate)
+	}
+	if params.Latency < 0 || params.LatencyJitter < 0 {
+		return nil, errors.New("chaos latency must not be negative")
+	}
+	if params.Every < 0 || params.For < 0 || params.For > params.Every {
+		return nil, fmt.Errorf("chaos outages of %v every %v aren't a valid schedule", params.For, params.Every)
+	}
+	if params.Clock == nil {
+		params.Clock = systemClock{}
+	}
+	if params.ScheduledStatus == StatusUnknown {
+		params.ScheduledStatus = StatusNotServing
+	}
+	return &ChaosChecker{
+		params:  params,
+		start:   params.Clock.Now(),
+		rng:     rand.New(rand.NewSource(params.Seed)), //nolint:gosec // chaos doesn't need a secure source
+		enabled: true,
+	}, nil
+}
+
+// SetEnabled turns fault injection on or off. While it's off, checks pass
+// straight through to the wrapped Checker.
+func (c *ChaosChecker) SetEnabled(enabled bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.enabled = enabled
+}
+
+// Force makes every check report a status, overriding the schedule and the
+// failure rate, until Unforce is called. Latency is still injected.
+func (c *ChaosChecker) Force(status Status) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.forced = &status
+}
+
+// Unforce undoes Force.
+func (c *ChaosChecker) Unforce() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.forced = nil
+}
+
+// Check implements Checker.
+func (c *ChaosChecker) Check(ctx context.Context, req *CheckRequest) (*CheckResponse, error) {
+	c.mu.Lock()
+	if !c.enabled {
+		c.mu.Unlock()
+		return c.params.Checker.Check(ctx, req)
+	}
+	delay := c.params.Latency
+	if c.params.LatencyJitter > 0 {
+		delay += time.Duration(c.rng.Int63n(int64(c.params.LatencyJitter) + 1))
+	}
+	fail := c.params.FailureRate > 0 && c.rng.Float64() < c.params.FailureRate
+	forced := c.forced
+	c.mu.Unlock()
+
+	if delay > 0 {
+		timer := c.params.Clock.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-timer.Chan():
+		}
+	}
+	switch {
+	case forced != nil:
+		return &CheckResponse{Status: *forced}, nil
+	case c.params.Every > 0 && c.params.Clock.Now().Sub(c.start)%c.params.Every < c.params.For:
+		return &CheckResponse{Status: c.params.ScheduledStatus}, nil
+	case fail:
+		return nil, connect.NewError(connect.CodeUnavailable, errors.New("chaos: injected failure"))
+	}
+	return c.params.Checker.Check(ctx, req)
+}
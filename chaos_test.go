@@ -0,0 +1,115 @@
+// Copyright 2022-2024 The Connect Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package grpchealth
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"connectrpc.com/connect"
+)
+
+func TestChaosChecker(t *testing.T) {
+	t.Parallel()
+	check := func(t *testing.T, checker Checker) (Status, error) {
+		t.Helper()
+		res, err := checker.Check(context.Background(), &CheckRequest{})
+		if err != nil {
+			return StatusUnknown, err
+		}
+		return res.Status, nil
+	}
+	t.Run("failure_rate", func(t *testing.T) {
+		t.Parallel()
+		chaos, err := NewChaosChecker(ChaosParams{Checker: NewStaticChecker(), FailureRate: 0.5, Seed: 1})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var failures int
+		for i := 0; i < 1000; i++ {
+			if _, err := check(t, chaos); err != nil {
+				if code := connect.CodeOf(err); code != connect.CodeUnavailable {
+					t.Fatalf("got code %v, expected %v", code, connect.CodeUnavailable)
+				}
+				failures++
+			}
+		}
+		if failures < 400 || failures > 600 {
+			t.Fatalf("got %d failures in 1000 checks, expected about 500", failures)
+		}
+		chaos.SetEnabled(false)
+		for i := 0; i < 100; i++ {
+			if _, err := check(t, chaos); err != nil {
+				t.Fatalf("got error %v with faults disabled", err)
+			}
+		}
+	})
+	t.Run("force", func(t *testing.T) {
+		t.Parallel()
+		chaos, err := NewChaosChecker(ChaosParams{Checker: NewStaticChecker(), FailureRate: 1})
+		if err != nil {
+			t.Fatal(err)
+		}
+		chaos.Force(StatusNotServing)
+		if status, err := check(t, chaos); err != nil || status != StatusNotServing {
+			t.Fatalf("got %v, %v while forced", status, err)
+		}
+		chaos.Unforce()
+		if _, err := check(t, chaos); err == nil {
+			t.Fatal("expected injected failure after unforcing")
+		}
+	})
+	t.Run("schedule", func(t *testing.T) {
+		t.Parallel()
+		chaos, err := NewChaosChecker(ChaosParams{Checker: NewStaticChecker(), Every: time.Hour, For: time.Hour / 2})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if status, _ := check(t, chaos); status != StatusNotServing {
+			t.Fatalf("got %v during scheduled outage", status)
+		}
+		chaos.start = chaos.start.Add(-time.Hour / 2)
+		if status, _ := check(t, chaos); status != StatusServing {
+			t.Fatalf("got %v after scheduled outage", status)
+		}
+	})
+	t.Run("latency", func(t *testing.T) {
+		t.Parallel()
+		chaos, err := NewChaosChecker(ChaosParams{Checker: NewStaticChecker(), Latency: time.Hour})
+		if err != nil {
+			t.Fatal(err)
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		if _, err := chaos.Check(ctx, &CheckRequest{}); !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("got error %v, expected %v", err, context.DeadlineExceeded)
+		}
+	})
+	t.Run("invalid", func(t *testing.T) {
+		t.Parallel()
+		for _, params := range []ChaosParams{
+			{},
+			{Checker: NewStaticChecker(), FailureRate: 2},
+			{Checker: NewStaticChecker(), Latency: -time.Second},
+			{Checker: NewStaticChecker(), Every: time.Second, For: time.Minute},
+		} {
+			if _, err := NewChaosChecker(params); err == nil {
+				t.Errorf("expected error for %+v", params)
+			}
+		}
+	})
+}
@@ -0,0 +1,552 @@
+// Copyright 2022-2024 The Connect Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package grpchealth
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"connectrpc.com/connect"
+	healthv1 "connectrpc.com/grpchealth/internal/gen/go/connectext/grpc/health/v1"
+)
+
+// Client checks the health of a remote server using gRPC's health-checking
+// API. It works with any server implementing the API, including those built
+// with NewHandler and gRPC servers in other languages.
+//
+// Client implements Checker and Watcher, so it can also be used to re-export
+// the health of a remote server.
+type Client struct {
+	httpClient connect.HTTPClient
+	backoff    *Backoff
+	dedupe     bool
+	silence    time.Duration
+	poll       time.Duration
+	clock      Clock
+	validate   bool
+	check      *connect.Client[healthv1.HealthCheckRequest, healthv1.HealthCheckResponse]
+	watch      *connect.Client[healthv1.HealthCheckRequest, healthv1.HealthCheckResponse]
+	list       *connect.Client[healthv1.HealthListRequest, healthv1.HealthListResponse]
+
+	mu            sync.Mutex
+	supportsWatch *bool // nil until probed
+}
+
+// NewClient constructs a Client for the server at baseURL (for example,
+// "https://acme.com" or "http://localhost:8080"). The options may include both
+// connect.ClientOptions and this package's ClientOptions.
+//
+// By default, the Client uses the gRPC protocol over HTTP/2, using TLS for
+// https URLs and HTTP/2 without TLS (h2c) for http URLs. Pass
+// connect.WithGRPCWeb to use the gRPC-Web protocol, or WithConnectProtocol to
+// use the Connect protocol, instead.
+//
+// When compiled for GOOS=js, such as for browser dashboards, the Client
+// defaults to the gRPC-Web protocol and sends requests with the browser's
+// fetch API. The browser manages connections, so the transport options
+// WithKeepalive, WithIdleTimeout, WithTLSConfig, and WithServerName have no
+// effect.
+func NewClient(baseURL string, options ...connect.ClientOption) *Client {
+	config := clientConfig{
+		IdleTimeout:  90 * time.Second,
+		PollInterval: 5 * time.Second,
+		Clock:        systemClock{},
+	}
+	for _, opt := range options {
+		if healthOpt, ok := opt.(ClientOption); ok {
+			healthOpt.applyToHealthClient(&config)
+		}
+	}
+	httpClient := config.HTTPClient
+	if httpClient == nil {
+		httpClient = newDefaultHTTPClient(baseURL, &config)
+	}
+	callClient := httpClient
+	if config.Authority != "" {
+		callClient = &authorityClient{HTTPClient: httpClient, authority: config.Authority}
+	}
+	baseURL = strings.TrimSuffix(baseURL, "/")
+	if !config.ConnectProtocol {
+		options = append([]connect.ClientOption{defaultClientProtocol()}, options...)
+	}
+	backoff := NewBackoff()
+	backoff.Clock = config.Clock
+	return &Client{
+		httpClient: httpClient,
+		backoff:    backoff,
+		dedupe:     config.Dedupe,
+		silence:    config.WatchHeartbeatTimeout,
+		poll:       config.PollInterval,
+		clock:      config.Clock,
+		validate:   config.ValidateServices,
+		check: connect.NewClient[healthv1.HealthCheckRequest, healthv1.HealthCheckResponse](
+			callClient,
+			baseURL+"/"+HealthV1ServiceName+"/Check",
+			options...,
+		),
+		watch: connect.NewClient[healthv1.HealthCheckRequest, healthv1.HealthCheckResponse](
+			callClient,
+			baseURL+"/"+HealthV1ServiceName+"/Watch",
+			options...,
+		),
+		list: connect.NewClient[healthv1.HealthListRequest, healthv1.HealthListResponse](
+			callClient,
+			baseURL+"/"+HealthV1ServiceName+"/List",
+			options...,
+		),
+	}
+}
+
+// Check implements Checker. It calls the remote server's Check method. If the
+// server doesn't know about the requested service, it returns a
+// connect.CodeNotFound error.
+func (c *Client) Check(ctx context.Context, req *CheckRequest) (*CheckResponse, error) {
+	if err := c.validateService(req.Service); err != nil {
+		return nil, err
+	}
+	res, err := c.check.CallUnary(
+		ctx,
+		connect.NewRequest(&healthv1.HealthCheckRequest{Service: req.Service}),
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &CheckResponse{Status: Status(res.Msg.Status)}, nil
+}
+
+// Watch implements Watcher. It calls the remote server's Watch method and
+// passes each status received to update.
+//
+// If the stream fails or the server closes it, Watch reconnects after an
+// exponential backoff, as gRPC's health schema suggests. With
+// WithWatchHeartbeatTimeout, so does a stream that's silent for too long.
+// After reconnecting, the server sends the current status again, so update may
+// see the same status twice in a row (unless the Client was built with
+// WithDeduplicatedWatch). If the server doesn't implement Watch, Watch returns
+// a connect.CodeUnimplemented error without retrying.
+//
+// Each update's Previous field is the status passed to update before it, even
+// across reconnects.
+func (c *Client) Watch(ctx context.Context, req *CheckRequest, update func(*CheckResponse) error) error {
+	if err := c.validateService(req.Service); err != nil {
+		return err
+	}
+	var previous Status
+	deliver := update
+	update = func(res *CheckResponse) error {
+		res.Previous, previous = previous, res.Status
+		return deliver(res)
+	}
+	if c.dedupe {
+		var (
+			sent bool
+			last Status
+		)
+		next := update
+		update = func(res *CheckResponse) error {
+			if sent && res.Status == last {
+				return nil
+			}
+			sent, last = true, res.Status
+			return next(res)
+		}
+	}
+	for attempt := 0; ; attempt++ {
+		received, err := c.watchOnce(ctx, req, update)
+		if received {
+			attempt = 0
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		var updateErr *watchUpdateError
+		if errors.As(err, &updateErr) {
+			return updateErr.err
+		}
+		if connect.CodeOf(err) == connect.CodeUnimplemented {
+			return err
+		}
+		if err := c.backoff.Wait(ctx, attempt); err != nil {
+			return err
+		}
+	}
+}
+
+// SupportsWatch reports whether the remote server implements Watch, so
+// monitors can choose between streaming and polling up front. It probes by
+// opening a Watch stream for the service and waiting for the first message.
+//
+// The Client remembers the answer, so only the first successful call contacts
+// the server. Errors other than connect.CodeUnimplemented, such as an
+// unreachable server, are returned without being remembered.
+func (c *Client) SupportsWatch(ctx context.Context, service string) (bool, error) {
+	if err := c.validateService(service); err != nil {
+		return false, err
+	}
+	c.mu.Lock()
+	known := c.supportsWatch
+	c.mu.Unlock()
+	if known != nil {
+		return *known, nil
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	stream, err := c.watch.CallServerStream(
+		ctx,
+		connect.NewRequest(&healthv1.HealthCheckRequest{Service: service}),
+	)
+	if err == nil {
+		if !stream.Receive() {
+			err = stream.Err()
+			if err == nil {
+				err = connect.NewError(connect.CodeUnavailable, errors.New("watch ended without a status"))
+			}
+		}
+		// Cancel before closing, since closing drains the rest of the stream.
+		cancel()
+		_ = stream.Close()
+	}
+	supported := err == nil
+	if err != nil && connect.CodeOf(err) != connect.CodeUnimplemented {
+		return false, err
+	}
+	c.mu.Lock()
+	c.supportsWatch = &supported
+	c.mu.Unlock()
+	return supported, nil
+}
+
+// OnChange calls fn each time the status of a service on the remote server
+// changes, until stop is called. The first call reports the transition from
+// StatusUnknown to the service's current status.
+//
+// Unlike Watch, OnChange doesn't expose the underlying stream: it reconnects
+// after failures without reporting the repeated status, and if the server
+// doesn't implement Watch, it polls Check instead (see WithPollInterval).
+// While the server is unreachable, no transitions are reported. A service the
+// server doesn't know about has StatusServiceUnknown.
+//
+// Calls to fn are sequential. Stop waits for any call in progress to return,
+// so it must not be called from fn.
+func (c *Client) OnChange(service string, fn func(prev, next Status)) (stop func()) {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		c.followChanges(ctx, service, fn)
+	}()
+	return func() {
+		cancel()
+		<-done
+	}
+}
+
+// CheckAll reports the health of every service on the remote server, keyed by
+// service name. The empty service name represents the whole process.
+//
+// CheckAll calls the server's List method. If the server doesn't implement
+// List, CheckAll falls back to checking only the whole process.
+func (c *Client) CheckAll(ctx context.Context) (map[string]Status, error) {
+	res, err := c.list.CallUnary(ctx, connect.NewRequest(&healthv1.HealthListRequest{}))
+	if connect.CodeOf(err) == connect.CodeUnimplemented {
+		checkResponse, err := c.Check(ctx, &CheckRequest{})
+		if err != nil {
+			return nil, err
+		}
+		return map[string]Status{"": checkResponse.Status}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	statuses := make(map[string]Status, len(res.Msg.Statuses))
+	for service, checkResponse := range res.Msg.Statuses {
+		statuses[service] = Status(checkResponse.GetStatus())
+	}
+	return statuses, nil
+}
+
+// Close closes any idle connections. It doesn't interrupt active calls.
+func (c *Client) Close() {
+	type idleCloser interface {
+		CloseIdleConnections()
+	}
+	if closer, ok := c.httpClient.(idleCloser); ok {
+		closer.CloseIdleConnections()
+	}
+}
+
+// followChanges reports a service's transitions to fn until ctx ends,
+// watching the service if possible and polling it otherwise.
+func (c *Client) followChanges(ctx context.Context, service string, fn func(prev, next Status)) {
+	var last Status
+	report := func(status Status) {
+		if status != last {
+			fn(last, status)
+			last = status
+		}
+	}
+	req := &CheckRequest{Service: service}
+	err := c.Watch(ctx, req, func(res *CheckResponse) error {
+		report(res.Status)
+		return nil
+	})
+	if connect.CodeOf(err) != connect.CodeUnimplemented {
+		return
+	}
+	timer := c.clock.NewTimer(c.poll)
+	defer timer.Stop()
+	for {
+		res, err := c.Check(ctx, req)
+		switch {
+		case err == nil:
+			report(res.Status)
+		case connect.CodeOf(err) == connect.CodeNotFound:
+			report(StatusServiceUnknown)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-timer.Chan():
+			timer.Reset(c.poll)
+		}
+	}
+}
+
+// watchOnce runs a single Watch stream. It reports whether it received any
+// messages.
+func (c *Client) watchOnce(ctx context.Context, req *CheckRequest, update func(*CheckResponse) error) (bool, error) {
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+	if c.silence > 0 {
+		timer := c.clock.AfterFunc(c.silence, func() { cancel(errWatchSilent) })
+		defer timer.Stop()
+		next := update
+		update = func(res *CheckResponse) error {
+			timer.Reset(c.silence)
+			return next(res)
+		}
+	}
+	stream, err := c.watch.CallServerStream(
+		ctx,
+		connect.NewRequest(&healthv1.HealthCheckRequest{Service: req.Service}),
+	)
+	if err != nil {
+		return false, err
+	}
+	defer func() {
+		// Cancel before closing, since closing drains the rest of the stream.
+		cancel(nil)
+		_ = stream.Close()
+	}()
+	var received bool
+	for stream.Receive() {
+		received = true
+		if err := update(&CheckResponse{Status: Status(stream.Msg().Status)}); err != nil {
+			return received, &watchUpdateError{err: err}
+		}
+	}
+	if errors.Is(context.Cause(ctx), errWatchSilent) {
+		return received, errWatchSilent
+	}
+	return received, stream.Err()
+}
+
+// authorityClient sets the authority of every request.
+type authorityClient struct {
+	connect.HTTPClient
+
+	authority string
+}
+
+func (c *authorityClient) Do(req *http.Request) (*http.Response, error) {
+	req.Host = c.authority
+	return c.HTTPClient.Do(req)
+}
+
+// A ClientOption configures a Client.
+//
+// Every ClientOption is also a connect.ClientOption, so they can be passed
+// alongside options from the connect package. Connect ignores them.
+type ClientOption interface {
+	connect.ClientOption
+
+	applyToHealthClient(*clientConfig)
+}
+
+// WithHTTPClient makes the Client use the supplied HTTP client instead of
+// building its own. The transport options WithKeepalive, WithIdleTimeout,
+// WithTLSConfig, and WithServerName have no effect when using a custom HTTP
+// client.
+func WithHTTPClient(httpClient connect.HTTPClient) ClientOption {
+	return newClientOption(func(config *clientConfig) {
+		config.HTTPClient = httpClient
+	})
+}
+
+// WithKeepalive makes the Client send HTTP/2 PING frames on connections that
+// haven't received any frames for the interval, and close connections that
+// don't acknowledge a PING within the timeout. This detects dead connections,
+// which would otherwise leave long-lived Watch streams waiting forever: after
+// a network partition, Watch fails and reconnects within interval plus
+// timeout, independently of any application-level heartbeats.
+//
+// By default, the Client doesn't send keepalive pings.
+func WithKeepalive(interval, timeout time.Duration) ClientOption {
+	return newClientOption(func(config *clientConfig) {
+		config.KeepaliveInterval = interval
+		config.KeepaliveTimeout = timeout
+	})
+}
+
+// WithIdleTimeout sets how long the Client keeps idle connections open for
+// reuse. Zero keeps them open indefinitely. The default is 90 seconds.
+func WithIdleTimeout(timeout time.Duration) ClientOption {
+	return newClientOption(func(config *clientConfig) {
+		config.IdleTimeout = timeout
+	})
+}
+
+// WithDeduplicatedWatch makes Client.Watch suppress consecutive identical
+// statuses, including the repeated status the server sends after Watch
+// reconnects. Callers then see only true transitions.
+func WithDeduplicatedWatch() ClientOption {
+	return newClientOption(func(config *clientConfig) {
+		config.Dedupe = true
+	})
+}
+
+// WithWatchHeartbeatTimeout makes Client.Watch treat a stream that's been
+// silent for longer than the timeout as failed, and reconnect. Use it with
+// servers that send heartbeats (see WithWatchHeartbeat), setting the timeout
+// to a few heartbeat intervals. Without heartbeats, a healthy service's status
+// may not change for hours, and silence means nothing.
+//
+// Unlike WithKeepalive, which only proves the connection is alive, this
+// detects servers that are reachable but have stopped sending updates.
+func WithWatchHeartbeatTimeout(timeout time.Duration) ClientOption {
+	return newClientOption(func(config *clientConfig) {
+		config.WatchHeartbeatTimeout = timeout
+	})
+}
+
+// WithPollInterval sets how often Client.OnChange checks a service's status
+// when the server doesn't implement Watch. The default is five seconds.
+func WithPollInterval(interval time.Duration) ClientOption {
+	return newClientOption(func(config *clientConfig) {
+		if interval > 0 {
+			config.PollInterval = interval
+		}
+	})
+}
+
+// WithClientClock makes the Client use a Clock for reconnect backoff, polling,
+// and heartbeat timeouts.
+func WithClientClock(clock Clock) ClientOption {
+	return newClientOption(func(config *clientConfig) {
+		config.Clock = clock
+	})
+}
+
+// WithConnectProtocol makes the Client use the Connect protocol instead of
+// gRPC. It works with servers built with NewHandler and other Connect servers,
+// but not with servers that only speak gRPC.
+func WithConnectProtocol() ClientOption {
+	return newClientOption(func(config *clientConfig) {
+		config.ConnectProtocol = true
+	})
+}
+
+// WithTLSConfig sets the TLS configuration for https URLs.
+func WithTLSConfig(tlsConfig *tls.Config) ClientOption {
+	return newClientOption(func(config *clientConfig) {
+		config.TLSConfig = tlsConfig
+	})
+}
+
+// WithServerName overrides the server name the Client sends in the TLS
+// handshake (SNI) and verifies the server's certificate against, for targets
+// addressed by IP or through a tunnel. It applies to https URLs, and has no
+// effect with a custom HTTP client.
+func WithServerName(name string) ClientOption {
+	return newClientOption(func(config *clientConfig) {
+		config.ServerName = name
+	})
+}
+
+// WithAuthority overrides the authority (the Host header, or :authority in
+// HTTP/2) of the Client's requests, for servers and proxies that route by
+// virtual host. Unlike WithServerName, it also applies to custom HTTP clients
+// and plaintext URLs.
+func WithAuthority(authority string) ClientOption {
+	return newClientOption(func(config *clientConfig) {
+		config.Authority = authority
+	})
+}
+
+type clientConfig struct {
+	HTTPClient            connect.HTTPClient
+	KeepaliveInterval     time.Duration
+	KeepaliveTimeout      time.Duration
+	IdleTimeout           time.Duration
+	TLSConfig             *tls.Config
+	Dedupe                bool
+	WatchHeartbeatTimeout time.Duration
+	PollInterval          time.Duration
+	Clock                 Clock
+	ConnectProtocol       bool
+	ServerName            string
+	Authority             string
+	ValidateServices      bool
+}
+
+type clientOption struct {
+	connect.ClientOption // no-op
+
+	apply func(*clientConfig)
+}
+
+func newClientOption(apply func(*clientConfig)) *clientOption {
+	return &clientOption{
+		ClientOption: connect.WithClientOptions(),
+		apply:        apply,
+	}
+}
+
+func (o *clientOption) applyToHealthClient(config *clientConfig) {
+	o.apply(config)
+}
+
+// errWatchSilent ends a Watch stream that hasn't received a message within the
+// heartbeat timeout.
+var errWatchSilent = errors.New("watch stream silent for longer than heartbeat timeout")
+
+// watchUpdateError wraps errors returned by Watch callbacks, which end the
+// Watch instead of triggering a reconnect.
+type watchUpdateError struct {
+	err error
+}
+
+func (e *watchUpdateError) Error() string {
+	return e.err.Error()
+}
+
+func (e *watchUpdateError) Unwrap() error {
+	return e.err
+}
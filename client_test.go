@@ -0,0 +1,441 @@
+// Copyright 2022-2024 The Connect Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package grpchealth
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"connectrpc.com/connect"
+)
+
+func TestClient(t *testing.T) {
+	const (
+		userFQN = "acme.user.v1.UserService"
+		unknown = "foobar"
+	)
+	t.Parallel()
+	checker := NewStaticChecker(userFQN)
+	client := newTestClient(t, checker)
+
+	res, err := client.Check(context.Background(), &CheckRequest{Service: userFQN})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Status != StatusServing {
+		t.Fatalf("got status %v, expected %v", res.Status, StatusServing)
+	}
+	_, err = client.Check(context.Background(), &CheckRequest{Service: unknown})
+	if code := connect.CodeOf(err); code != connect.CodeNotFound {
+		t.Fatalf("got code %v, expected %v", code, connect.CodeNotFound)
+	}
+
+	errDone := errors.New("done")
+	var statuses []Status
+	err = client.Watch(context.Background(), &CheckRequest{Service: userFQN}, func(res *CheckResponse) error {
+		statuses = append(statuses, res.Status)
+		if len(statuses) == 2 {
+			return errDone
+		}
+		checker.SetStatus(userFQN, StatusNotServing)
+		return nil
+	})
+	if !errors.Is(err, errDone) {
+		t.Fatalf("got error %v, expected %v", err, errDone)
+	}
+	if statuses[0] != StatusServing || statuses[1] != StatusNotServing {
+		t.Fatalf("got statuses %v", statuses)
+	}
+}
+
+func TestClientCheckAll(t *testing.T) {
+	const userFQN = "acme.user.v1.UserService"
+	t.Parallel()
+	checker := NewStaticChecker(userFQN)
+	checker.SetStatus(userFQN, StatusNotServing)
+
+	statuses, err := newTestClient(t, checker).CheckAll(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(statuses) != 2 || statuses[""] != StatusServing || statuses[userFQN] != StatusNotServing {
+		t.Fatalf("got statuses %v", statuses)
+	}
+
+	// Hide StaticChecker's List method.
+	statuses, err = newTestClient(t, struct{ Checker }{checker}).CheckAll(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(statuses) != 1 || statuses[""] != StatusServing {
+		t.Fatalf("got statuses %v without List", statuses)
+	}
+}
+
+func TestClientWatchUnimplemented(t *testing.T) {
+	t.Parallel()
+	client := newTestClient(t, struct{ Checker }{NewStaticChecker()})
+	err := client.Watch(context.Background(), &CheckRequest{}, func(*CheckResponse) error {
+		return nil
+	})
+	if code := connect.CodeOf(err); code != connect.CodeUnimplemented {
+		t.Fatalf("got code %v, expected %v", code, connect.CodeUnimplemented)
+	}
+}
+
+func TestClientSupportsWatch(t *testing.T) {
+	t.Parallel()
+	var streams atomic.Int32
+	client := newTestClient(t, &oneShotWatcher{Checker: NewStaticChecker(), streams: &streams})
+	for i := 0; i < 2; i++ {
+		supported, err := client.SupportsWatch(context.Background(), "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !supported {
+			t.Fatal("got no Watch support, expected support")
+		}
+	}
+	if got := streams.Load(); got != 1 {
+		t.Errorf("got %d probes, expected the answer to be cached", got)
+	}
+
+	client = newTestClient(t, struct{ Checker }{NewStaticChecker()})
+	supported, err := client.SupportsWatch(context.Background(), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if supported {
+		t.Fatal("got Watch support from a server without Watch")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	client = newTestClient(t, NewStaticChecker())
+	if _, err := client.SupportsWatch(ctx, ""); err == nil {
+		t.Fatal("expected an error with a canceled context")
+	}
+	if supported, err := client.SupportsWatch(context.Background(), ""); err != nil || !supported {
+		t.Fatalf("got %v, %v after a failed probe, expected support", supported, err)
+	}
+}
+
+func TestClientAuthority(t *testing.T) {
+	t.Parallel()
+	hosts := make(chan string, 1)
+	mux := http.NewServeMux()
+	mux.Handle(NewHandler(NewStaticChecker()))
+	server := httptest.NewServer(NewH2CHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hosts <- r.Host
+		mux.ServeHTTP(w, r)
+	})))
+	t.Cleanup(server.Close)
+	client := NewClient(server.URL, WithAuthority("health.internal"))
+	t.Cleanup(client.Close)
+	if _, err := client.Check(context.Background(), &CheckRequest{}); err != nil {
+		t.Fatal(err)
+	}
+	if got := <-hosts; got != "health.internal" {
+		t.Fatalf("got authority %q, expected %q", got, "health.internal")
+	}
+}
+
+func TestClientOnChange(t *testing.T) {
+	const userFQN = "acme.user.v1.UserService"
+	t.Parallel()
+	type transition struct{ prev, next Status }
+	for name, wrap := range map[string]func(*StaticChecker) Checker{
+		"watch": func(checker *StaticChecker) Checker {
+			// Reconnects shouldn't be reported as transitions.
+			return &oneShotWatcher{Checker: checker, streams: &atomic.Int32{}}
+		},
+		"poll": func(checker *StaticChecker) Checker {
+			return struct{ Checker }{checker}
+		},
+	} {
+		wrap := wrap
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			checker := NewStaticChecker(userFQN)
+			client := newTestClient(t, wrap(checker), WithPollInterval(time.Millisecond))
+			client.backoff.Base = time.Millisecond
+			transitions := make(chan transition, 16)
+			stop := client.OnChange(userFQN, func(prev, next Status) {
+				transitions <- transition{prev, next}
+			})
+			for _, expect := range []transition{
+				{StatusUnknown, StatusServing},
+				{StatusServing, StatusNotServing},
+			} {
+				if got := <-transitions; got != expect {
+					t.Fatalf("got transition %v, expected %v", got, expect)
+				}
+				checker.SetStatus(userFQN, StatusNotServing)
+			}
+			time.Sleep(20 * time.Millisecond)
+			stop()
+			close(transitions)
+			for got := range transitions {
+				t.Errorf("got unexpected transition %v", got)
+			}
+		})
+	}
+}
+
+func TestClientWatchCanceled(t *testing.T) {
+	t.Parallel()
+	client := newTestClient(t, NewStaticChecker())
+	ctx, cancel := context.WithCancel(context.Background())
+	err := client.Watch(ctx, &CheckRequest{}, func(*CheckResponse) error {
+		cancel()
+		return nil
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("got error %v, expected %v", err, context.Canceled)
+	}
+}
+
+func TestClientWatchReconnect(t *testing.T) {
+	t.Parallel()
+	var streams atomic.Int32
+	client := newTestClient(t, &oneShotWatcher{
+		Checker: NewStaticChecker(),
+		streams: &streams,
+	})
+	client.backoff.Base = time.Millisecond
+	var updates int
+	err := client.Watch(context.Background(), &CheckRequest{}, func(res *CheckResponse) error {
+		updates++
+		// Previous carries over across reconnects.
+		expect := StatusServing
+		if updates == 1 {
+			expect = StatusUnknown
+		}
+		if res.Previous != expect {
+			t.Errorf("got previous status %v in update %d, expected %v", res.Previous, updates, expect)
+		}
+		if updates == 3 {
+			return errors.New("done")
+		}
+		return nil
+	})
+	if err == nil {
+		t.Fatal("expected error")
+	}
+	if got := streams.Load(); got != 3 {
+		t.Fatalf("got %d streams, expected 3", got)
+	}
+}
+
+func TestClientWatchDeduplicated(t *testing.T) {
+	t.Parallel()
+	var streams atomic.Int32
+	client := newTestClient(
+		t,
+		&oneShotWatcher{Checker: NewStaticChecker(), streams: &streams},
+		WithDeduplicatedWatch(),
+	)
+	client.backoff.Base = time.Millisecond
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var updates atomic.Int32
+	go func() {
+		for streams.Load() < 3 {
+			time.Sleep(time.Millisecond)
+		}
+		cancel()
+	}()
+	err := client.Watch(ctx, &CheckRequest{}, func(*CheckResponse) error {
+		updates.Add(1)
+		return nil
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("got error %v, expected %v", err, context.Canceled)
+	}
+	if got := updates.Load(); got != 1 {
+		t.Fatalf("got %d updates, expected 1", got)
+	}
+}
+
+func TestClientWatchHeartbeatTimeout(t *testing.T) {
+	t.Parallel()
+	var streams atomic.Int32
+	client := newTestClient(
+		t,
+		&silentWatcher{Checker: NewStaticChecker(), streams: &streams},
+		WithWatchHeartbeatTimeout(20*time.Millisecond),
+	)
+	client.backoff.Base = time.Millisecond
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		for streams.Load() < 3 {
+			time.Sleep(time.Millisecond)
+		}
+		cancel()
+	}()
+	err := client.Watch(ctx, &CheckRequest{}, func(*CheckResponse) error {
+		return nil
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("got error %v, expected %v", err, context.Canceled)
+	}
+}
+
+func TestClientWatchKeepalive(t *testing.T) {
+	t.Parallel()
+	var streams atomic.Int32
+	mux := http.NewServeMux()
+	mux.Handle(NewHandler(&silentWatcher{Checker: NewStaticChecker(), streams: &streams}))
+	server := httptest.NewServer(NewH2CHandler(mux))
+	t.Cleanup(server.Close)
+	proxy := newPartitionProxy(t, server.Listener.Addr().String())
+	client := NewClient("http://"+proxy.addr, WithKeepalive(20*time.Millisecond, 20*time.Millisecond))
+	t.Cleanup(client.Close)
+	client.backoff.Base = time.Millisecond
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	err := client.Watch(ctx, &CheckRequest{}, func(*CheckResponse) error {
+		if streams.Load() == 1 {
+			// Silently drop all traffic on the first connection. Only
+			// keepalive pings can notice.
+			proxy.partition()
+			return nil
+		}
+		return errors.New("done")
+	})
+	if err == nil || ctx.Err() != nil {
+		t.Fatalf("got error %v, expected reconnect after partition", err)
+	}
+}
+
+func newTestClient(t *testing.T, checker Checker, options ...ClientOption) *Client {
+	t.Helper()
+	mux := http.NewServeMux()
+	mux.Handle(NewHandler(checker))
+	server := httptest.NewServer(NewH2CHandler(mux))
+	t.Cleanup(server.Close)
+	clientOptions := []connect.ClientOption{WithKeepalive(time.Second, time.Second)}
+	for _, opt := range options {
+		clientOptions = append(clientOptions, opt)
+	}
+	client := NewClient(server.URL, clientOptions...)
+	t.Cleanup(client.Close)
+	return client
+}
+
+// oneShotWatcher sends the current status, then ends the stream.
+type oneShotWatcher struct {
+	Checker
+
+	streams *atomic.Int32
+}
+
+func (w *oneShotWatcher) Watch(ctx context.Context, req *CheckRequest, update func(*CheckResponse) error) error {
+	w.streams.Add(1)
+	res, err := w.Check(ctx, req)
+	if err != nil {
+		return err
+	}
+	return update(res)
+}
+
+// silentWatcher sends the current status, then goes quiet without ending the
+// stream, like a server that's hung.
+type silentWatcher struct {
+	Checker
+
+	streams *atomic.Int32
+}
+
+func (w *silentWatcher) Watch(ctx context.Context, req *CheckRequest, update func(*CheckResponse) error) error {
+	w.streams.Add(1)
+	res, err := w.Check(ctx, req)
+	if err != nil {
+		return err
+	}
+	if err := update(res); err != nil {
+		return err
+	}
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+// partitionProxy forwards TCP connections to a backend until partitioned,
+// after which it silently drops traffic on existing connections.
+type partitionProxy struct {
+	addr        string
+	partitioned atomic.Bool
+}
+
+func newPartitionProxy(t *testing.T, backend string) *partitionProxy {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	proxy := &partitionProxy{addr: listener.Addr().String()}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			upstream, err := net.Dial("tcp", backend)
+			if err != nil {
+				conn.Close()
+				return
+			}
+			// Connections opened before the partition are cut off; later
+			// ones work.
+			partitioned := &proxy.partitioned
+			if partitioned.Load() {
+				partitioned = &atomic.Bool{}
+			}
+			go proxyCopy(upstream, conn, partitioned)
+			go proxyCopy(conn, upstream, partitioned)
+		}
+	}()
+	return proxy
+}
+
+func (p *partitionProxy) partition() {
+	p.partitioned.Store(true)
+}
+
+func proxyCopy(dst, src net.Conn, partitioned *atomic.Bool) {
+	defer dst.Close()
+	buf := make([]byte, 32*1024)
+	for {
+		n, err := src.Read(buf)
+		if err != nil {
+			return
+		}
+		if partitioned.Load() {
+			continue
+		}
+		if _, err := dst.Write(buf[:n]); err != nil {
+			return
+		}
+	}
+}
@@ -0,0 +1,63 @@
+// Copyright 2022-2024 The Connect Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !js
+
+package grpchealth
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
+	"strings"
+
+	"connectrpc.com/connect"
+	"golang.org/x/net/http2"
+)
+
+// defaultClientProtocol is gRPC, which requires HTTP/2.
+func defaultClientProtocol() connect.ClientOption {
+	return connect.WithGRPC()
+}
+
+func newDefaultHTTPClient(baseURL string, config *clientConfig) connect.HTTPClient {
+	return &http.Client{Transport: newClientTransport(baseURL, config)}
+}
+
+func newClientTransport(baseURL string, config *clientConfig) *http2.Transport {
+	tlsConfig := config.TLSConfig
+	if config.ServerName != "" {
+		if tlsConfig == nil {
+			tlsConfig = &tls.Config{MinVersion: tls.VersionTLS12}
+		} else {
+			tlsConfig = tlsConfig.Clone()
+		}
+		tlsConfig.ServerName = config.ServerName
+	}
+	transport := &http2.Transport{
+		TLSClientConfig: tlsConfig,
+		ReadIdleTimeout: config.KeepaliveInterval,
+		PingTimeout:     config.KeepaliveTimeout,
+		IdleConnTimeout: config.IdleTimeout,
+	}
+	if strings.HasPrefix(baseURL, "http://") {
+		transport.AllowHTTP = true
+		transport.DialTLSContext = func(ctx context.Context, network, addr string, _ *tls.Config) (net.Conn, error) {
+			var dialer net.Dialer
+			return dialer.DialContext(ctx, network, addr)
+		}
+	}
+	return transport
+}
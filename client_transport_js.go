@@ -0,0 +1,35 @@
+// Copyright 2022-2024 The Connect Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build js
+
+package grpchealth
+
+import (
+	"net/http"
+
+	"connectrpc.com/connect"
+)
+
+// defaultClientProtocol is gRPC-Web, since browsers don't expose HTTP/2
+// trailers to fetch.
+func defaultClientProtocol() connect.ClientOption {
+	return connect.WithGRPCWeb()
+}
+
+// newDefaultHTTPClient uses net/http's default transport, which is backed by
+// the fetch API under GOOS=js.
+func newDefaultHTTPClient(string, *clientConfig) connect.HTTPClient {
+	return &http.Client{}
+}
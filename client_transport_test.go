@@ -0,0 +1,66 @@
+// Copyright 2022-2024 The Connect Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !js
+
+package grpchealth
+
+import (
+	"crypto/tls"
+	"testing"
+	"time"
+)
+
+func TestClientTransport(t *testing.T) {
+	t.Parallel()
+	var config clientConfig
+	for _, opt := range []ClientOption{
+		WithKeepalive(10*time.Second, 5*time.Second),
+		WithIdleTimeout(time.Minute),
+	} {
+		opt.applyToHealthClient(&config)
+	}
+	transport := newClientTransport("http://localhost:8080", &config)
+	if transport.ReadIdleTimeout != 10*time.Second || transport.PingTimeout != 5*time.Second {
+		t.Fatalf("got keepalive %v/%v", transport.ReadIdleTimeout, transport.PingTimeout)
+	}
+	if transport.IdleConnTimeout != time.Minute {
+		t.Fatalf("got idle timeout %v", transport.IdleConnTimeout)
+	}
+	if !transport.AllowHTTP {
+		t.Fatal("expected h2c for http URL")
+	}
+	if newClientTransport("https://localhost:8080", &config).AllowHTTP {
+		t.Fatal("expected TLS for https URL")
+	}
+}
+
+func TestClientServerName(t *testing.T) {
+	t.Parallel()
+	shared := &tls.Config{MinVersion: tls.VersionTLS13, ServerName: "shared.example.com"}
+	var config clientConfig
+	for _, opt := range []ClientOption{WithTLSConfig(shared), WithServerName("db-1.internal")} {
+		opt.applyToHealthClient(&config)
+	}
+	transport := newClientTransport("https://10.0.0.1:8443", &config)
+	if got := transport.TLSClientConfig.ServerName; got != "db-1.internal" {
+		t.Fatalf("got server name %q", got)
+	}
+	if transport.TLSClientConfig.MinVersion != tls.VersionTLS13 {
+		t.Fatal("expected the rest of the TLS config to be kept")
+	}
+	if shared.ServerName != "shared.example.com" {
+		t.Fatal("modified the caller's TLS config")
+	}
+}
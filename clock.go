@@ -0,0 +1,84 @@
+// Copyright 2022-2024 The Connect Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package grpchealth
+
+import "time"
+
+// A Clock tells time and schedules timers. Components that act on intervals
+// or deadlines, such as Watch heartbeats and override TTLs, accept a Clock so
+// tests can control time; the healthtest package's FakeClock is one such
+// Clock. By default, they use the system clock.
+type Clock interface {
+	Now() time.Time
+	// NewTimer returns a Timer that sends the current time on its channel
+	// once d elapses, like time.NewTimer.
+	NewTimer(d time.Duration) Timer
+	// AfterFunc returns a Timer that calls f in its own goroutine once d
+	// elapses, like time.AfterFunc. The Timer's channel is nil.
+	AfterFunc(d time.Duration, f func()) Timer
+}
+
+// A Timer is a single event scheduled by a Clock. Its methods behave like
+// those of time.Timer.
+type Timer interface {
+	Chan() <-chan time.Time
+	Stop() bool
+	Reset(d time.Duration) bool
+}
+
+// WithClock makes a StaticChecker use a Clock for override TTLs and watcher
+// sweeps.
+func WithClock(clock Clock) StaticCheckerOption {
+	return &clockOption{clock: clock}
+}
+
+// WithHandlerClock makes handlers use a Clock for Watch heartbeats, initial
+// delays, and jitter.
+func WithHandlerClock(clock Clock) HandlerOption {
+	return newHandlerOption(func(config *handlerConfig) {
+		config.Clock = clock
+	})
+}
+
+type clockOption struct {
+	clock Clock
+}
+
+func (o *clockOption) applyToStaticChecker(checker *StaticChecker) {
+	checker.clock = o.clock
+}
+
+// systemClock is the Clock backed by package time.
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+func (systemClock) NewTimer(d time.Duration) Timer {
+	return &systemTimer{Timer: time.NewTimer(d)}
+}
+
+func (systemClock) AfterFunc(d time.Duration, f func()) Timer {
+	return &systemTimer{Timer: time.AfterFunc(d, f)}
+}
+
+type systemTimer struct {
+	*time.Timer
+}
+
+func (t *systemTimer) Chan() <-chan time.Time {
+	return t.C
+}
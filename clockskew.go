@@ -0,0 +1,187 @@
+// Copyright 2022-2024 The Connect Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package grpchealth
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// ClockSkewCheckerParams configure a ClockSkewChecker.
+type ClockSkewCheckerParams struct {
+	// Offset measures how far a trusted reference clock is ahead of the local
+	// clock. NTPOffset and HTTPDateOffset construct common references.
+	Offset func(ctx context.Context) (time.Duration, error)
+	// MaxSkew is the largest tolerable difference between the clocks, in
+	// either direction.
+	MaxSkew time.Duration
+	// Interval is the minimum time between measurements. Checks made more
+	// often reuse the previous result, even if the reference couldn't be
+	// reached, so an unreachable reference isn't queried on every check.
+	Interval time.Duration
+	// Clock times measurements. It doesn't affect the offset, which Offset
+	// measures against the system clock. The default is the system clock.
+	Clock Clock
+}
+
+// ClockSkewChecker is a Checker that reports StatusNotServing when the local
+// clock has drifted too far from a trusted reference. Token validation,
+// leases, and many distributed protocols break silently under skew. The
+// details of the response include the measured offset or error.
+//
+// If the reference can't be reached, ClockSkewChecker reports the previous
+// result, or StatusServing if there's none: an unreachable time server says
+// nothing about the local clock. It reports the same status for every
+// service.
+type ClockSkewChecker struct {
+	params ClockSkewCheckerParams
+
+	mu       sync.Mutex
+	measured time.Time
+	response *CheckResponse
+}
+
+// NewClockSkewChecker constructs a ClockSkewChecker.
+func NewClockSkewChecker(params ClockSkewCheckerParams) (*ClockSkewChecker, error) {
+	if params.Offset == nil {
+		return nil, errors.New("clock skew checker requires an offset function")
+	}
+	if params.MaxSkew <= 0 {
+		return nil, fmt.Errorf("max skew must be positive, got %v", params.MaxSkew)
+	}
+	if params.Clock == nil {
+		params.Clock = systemClock{}
+	}
+	return &ClockSkewChecker{params: params}, nil
+}
+
+// Check implements Checker.
+func (c *ClockSkewChecker) Check(ctx context.Context, _ *CheckRequest) (*CheckResponse, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.response != nil && c.params.Clock.Now().Sub(c.measured) < c.params.Interval {
+		return c.response, nil
+	}
+	offset, err := c.params.Offset(ctx)
+	c.measured = c.params.Clock.Now()
+	if err != nil {
+		status := StatusServing
+		if c.response != nil {
+			status = c.response.Status
+		}
+		c.response = &CheckResponse{
+			Status:  status,
+			Details: map[string]string{"error": err.Error()},
+		}
+		return c.response, nil
+	}
+	status := StatusServing
+	if offset > c.params.MaxSkew || offset < -c.params.MaxSkew {
+		status = StatusNotServing
+	}
+	c.response = &CheckResponse{
+		Status:  status,
+		Details: map[string]string{"offset": offset.String()},
+	}
+	return c.response, nil
+}
+
+// ntpEpochOffset is the number of seconds between the NTP epoch (1900) and
+// the Unix epoch (1970).
+const ntpEpochOffset = 2208988800
+
+// NTPOffset returns a ClockSkewChecker offset function that queries an NTP
+// server, such as "pool.ntp.org:123", with a single SNTP request.
+func NTPOffset(server string) func(ctx context.Context) (time.Duration, error) {
+	return func(ctx context.Context) (time.Duration, error) {
+		var dialer net.Dialer
+		conn, err := dialer.DialContext(ctx, "udp", server)
+		if err != nil {
+			return 0, err
+		}
+		defer conn.Close()
+		if deadline, ok := ctx.Deadline(); ok {
+			if err := conn.SetDeadline(deadline); err != nil {
+				return 0, err
+			}
+		} else if err := conn.SetDeadline(time.Now().Add(5 * time.Second)); err != nil {
+			return 0, err
+		}
+		request := make([]byte, 48)
+		request[0] = 0x23 // leap indicator 0, version 4, client mode
+		sent := time.Now()
+		if _, err := conn.Write(request); err != nil {
+			return 0, err
+		}
+		response := make([]byte, 48)
+		if _, err := conn.Read(response); err != nil {
+			return 0, err
+		}
+		received := time.Now()
+		if response[0]&0x7 != 4 {
+			return 0, fmt.Errorf("ntp: unexpected mode %d", response[0]&0x7)
+		}
+		if response[1] == 0 {
+			return 0, errors.New("ntp: server sent kiss-of-death")
+		}
+		serverReceived := ntpTime(response[32:40])
+		serverSent := ntpTime(response[40:48])
+		return (serverReceived.Sub(sent) + serverSent.Sub(received)) / 2, nil
+	}
+}
+
+func ntpTime(b []byte) time.Time {
+	seconds := int64(binary.BigEndian.Uint32(b[0:4])) - ntpEpochOffset
+	fraction := int64(binary.BigEndian.Uint32(b[4:8]))
+	return time.Unix(seconds, fraction*int64(time.Second)>>32)
+}
+
+// HTTPDateOffset returns a ClockSkewChecker offset function that reads the
+// Date header of a HEAD request to a trusted URL. The header has one-second
+// resolution, so MaxSkew should be at least a few seconds. If client is nil,
+// http.DefaultClient is used.
+func HTTPDateOffset(client *http.Client, url string) func(ctx context.Context) (time.Duration, error) {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return func(ctx context.Context) (time.Duration, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodHead, url, http.NoBody)
+		if err != nil {
+			return 0, err
+		}
+		sent := time.Now()
+		res, err := client.Do(req)
+		if err != nil {
+			return 0, err
+		}
+		res.Body.Close()
+		received := time.Now()
+		date, err := http.ParseTime(res.Header.Get("Date"))
+		if err != nil {
+			return 0, fmt.Errorf("invalid Date header: %w", err)
+		}
+		// The header is truncated to the second, so its midpoint is the best
+		// estimate, as is the midpoint of the round trip.
+		date = date.Add(time.Second / 2)
+		local := sent.Add(received.Sub(sent) / 2)
+		return date.Sub(local), nil
+	}
+}
@@ -0,0 +1,153 @@
+// Copyright 2022-2024 The Connect Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package grpchealth
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestClockSkewChecker(t *testing.T) {
+	t.Parallel()
+	var offset time.Duration
+	var offsetErr error
+	checker, err := NewClockSkewChecker(ClockSkewCheckerParams{
+		Offset:   func(context.Context) (time.Duration, error) { return offset, offsetErr },
+		MaxSkew:  time.Second,
+		Interval: 0,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, testCase := range []struct {
+		name      string
+		offset    time.Duration
+		offsetErr error
+		expect    Status
+	}{
+		{name: "synced", offset: 100 * time.Millisecond, expect: StatusServing},
+		{name: "behind", offset: -2 * time.Second, expect: StatusNotServing},
+		{name: "unreachable", offsetErr: errors.New("timeout"), expect: StatusNotServing},
+		{name: "ahead", offset: 2 * time.Second, expect: StatusNotServing},
+		{name: "resynced", offset: 0, expect: StatusServing},
+	} {
+		offset, offsetErr = testCase.offset, testCase.offsetErr
+		res, err := checker.Check(context.Background(), &CheckRequest{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.Status != testCase.expect {
+			t.Fatalf("%s: got status %v, expected %v", testCase.name, res.Status, testCase.expect)
+		}
+	}
+}
+
+func TestClockSkewCheckerCachesErrors(t *testing.T) {
+	t.Parallel()
+	var queries int
+	clock := &manualClock{now: time.Unix(0, 0)}
+	checker, err := NewClockSkewChecker(ClockSkewCheckerParams{
+		Offset: func(context.Context) (time.Duration, error) {
+			queries++
+			return 0, errors.New("timeout")
+		},
+		MaxSkew:  time.Second,
+		Interval: time.Minute,
+		Clock:    clock,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	check := func() {
+		t.Helper()
+		res, err := checker.Check(context.Background(), &CheckRequest{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.Status != StatusServing || res.Details["error"] != "timeout" {
+			t.Fatalf("got response %+v", res)
+		}
+	}
+	check()
+	check()
+	if queries != 1 {
+		t.Fatalf("queried an unreachable reference %d times within the interval", queries)
+	}
+	clock.Advance(time.Minute)
+	check()
+	if queries != 2 {
+		t.Fatalf("got %d queries after the interval, expected 2", queries)
+	}
+}
+
+func TestNTPOffset(t *testing.T) {
+	t.Parallel()
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	const skew = time.Minute
+	go func() {
+		request := make([]byte, 48)
+		_, addr, err := conn.ReadFrom(request)
+		if err != nil {
+			return
+		}
+		now := time.Now().Add(skew)
+		response := make([]byte, 48)
+		response[0] = 0x24 // version 4, server mode
+		response[1] = 1    // stratum
+		putNTPTime(response[32:40], now)
+		putNTPTime(response[40:48], now)
+		_, _ = conn.WriteTo(response, addr)
+	}()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	offset, err := NTPOffset(conn.LocalAddr().String())(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := offset - skew; diff < -time.Second || diff > time.Second {
+		t.Fatalf("got offset %v, expected about %v", offset, skew)
+	}
+}
+
+func TestHTTPDateOffset(t *testing.T) {
+	t.Parallel()
+	const skew = -time.Hour
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Date", time.Now().Add(skew).UTC().Format(http.TimeFormat))
+	}))
+	t.Cleanup(server.Close)
+	offset, err := HTTPDateOffset(server.Client(), server.URL)(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := offset - skew; diff < -2*time.Second || diff > 2*time.Second {
+		t.Fatalf("got offset %v, expected about %v", offset, skew)
+	}
+}
+
+func putNTPTime(b []byte, t time.Time) {
+	binary.BigEndian.PutUint32(b[0:4], uint32(t.Unix()+ntpEpochOffset))
+	binary.BigEndian.PutUint32(b[4:8], uint32((int64(t.Nanosecond())<<32)/int64(time.Second)))
+}
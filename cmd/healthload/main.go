@@ -0,0 +1,195 @@
+// Copyright 2022-2024 The Connect Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Command healthload measures how a gRPC health server behaves under load. It
+// opens many Watch streams and sends a steady rate of Check requests, then
+// reports Check latency and how quickly status transitions reach every
+// watcher:
+//
+//	healthload -target http://localhost:8080 -watchers 1000 -qps 200 -duration 1m
+//
+// To measure propagation, change the target's status while healthload runs.
+// Each transition's propagation is measured from the first watcher to see it,
+// so the statistics show the spread across watchers rather than end-to-end
+// latency.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"sort"
+	"sync"
+	"syscall"
+	"time"
+
+	"connectrpc.com/grpchealth"
+)
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	if err := run(ctx, os.Args[1:], os.Stdout); err != nil && !errors.Is(err, flag.ErrHelp) {
+		fmt.Fprintln(os.Stderr, "healthload:", err)
+		os.Exit(1)
+	}
+}
+
+func run(ctx context.Context, args []string, out io.Writer) error {
+	flags := flag.NewFlagSet("healthload", flag.ContinueOnError)
+	target := flags.String("target", "", "base URL of the health server, such as http://localhost:8080")
+	service := flags.String("service", "", "service to check and watch (empty for the whole process)")
+	watchers := flags.Int("watchers", 100, "number of concurrent Watch streams")
+	qps := flags.Float64("qps", 10, "Check requests per second")
+	duration := flags.Duration("duration", 30*time.Second, "how long to run")
+	timeout := flags.Duration("timeout", time.Second, "timeout for each Check")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *target == "" {
+		return errors.New("-target is required")
+	}
+	client := grpchealth.NewClient(*target)
+	defer client.Close()
+	ctx, cancel := context.WithTimeout(ctx, *duration)
+	defer cancel()
+
+	var (
+		wg          sync.WaitGroup
+		checks      latencies
+		propagation transitionTracker
+	)
+	req := &grpchealth.CheckRequest{Service: *service}
+	for i := 0; i < *watchers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_ = client.Watch(ctx, req, func(res *grpchealth.CheckResponse) error {
+				propagation.observe(res.Status, time.Now())
+				return nil
+			})
+		}()
+	}
+	if *qps > 0 {
+		ticker := time.NewTicker(time.Duration(float64(time.Second) / *qps))
+		defer ticker.Stop()
+	loop:
+		for {
+			select {
+			case <-ctx.Done():
+				break loop
+			case <-ticker.C:
+			}
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				checkCtx, cancel := context.WithTimeout(ctx, *timeout)
+				defer cancel()
+				start := time.Now()
+				_, err := client.Check(checkCtx, req)
+				if ctx.Err() == nil {
+					checks.add(time.Since(start), err)
+				}
+			}()
+		}
+	} else {
+		<-ctx.Done()
+	}
+	wg.Wait()
+
+	fmt.Fprintf(out, "checks: %s\n", checks.summary())
+	fmt.Fprintf(out, "watch streams: %d\n", *watchers)
+	fmt.Fprintf(out, "transitions: %d\n", propagation.transitions())
+	fmt.Fprintf(out, "propagation spread: %s\n", propagation.delays.summary())
+	return nil
+}
+
+// latencies collects durations and errors concurrently.
+type latencies struct {
+	mu      sync.Mutex
+	samples []time.Duration
+	errors  int
+}
+
+func (l *latencies) add(latency time.Duration, err error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if err != nil {
+		l.errors++
+		return
+	}
+	l.samples = append(l.samples, latency)
+}
+
+func (l *latencies) summary() string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if len(l.samples) == 0 {
+		return fmt.Sprintf("n=0 errors=%d", l.errors)
+	}
+	sorted := append([]time.Duration(nil), l.samples...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	return fmt.Sprintf(
+		"n=%d errors=%d p50=%v p90=%v p99=%v max=%v",
+		len(sorted),
+		l.errors,
+		percentile(sorted, 0.5),
+		percentile(sorted, 0.9),
+		percentile(sorted, 0.99),
+		sorted[len(sorted)-1],
+	)
+}
+
+// percentile returns the nearest-rank percentile of sorted samples.
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	rank := int(p*float64(len(sorted))+0.5) - 1
+	rank = max(0, min(rank, len(sorted)-1))
+	return sorted[rank]
+}
+
+// transitionTracker measures how long each status transition takes to reach
+// every watcher after the first one sees it. Watchers report every status
+// they receive, starting with the initial one.
+type transitionTracker struct {
+	mu        sync.Mutex
+	status    grpchealth.Status
+	firstSeen time.Time
+	count     int
+	delays    latencies
+}
+
+func (t *transitionTracker) observe(status grpchealth.Status, at time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.firstSeen.IsZero() {
+		// The initial status isn't a transition.
+		t.status, t.firstSeen = status, at
+		return
+	}
+	if status != t.status {
+		t.status, t.firstSeen = status, at
+		t.count++
+	}
+	t.delays.add(at.Sub(t.firstSeen), nil)
+}
+
+func (t *transitionTracker) transitions() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.count
+}
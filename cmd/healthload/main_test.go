@@ -0,0 +1,70 @@
+// Copyright 2022-2024 The Connect Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"connectrpc.com/grpchealth"
+)
+
+func TestTransitionTracker(t *testing.T) {
+	t.Parallel()
+	var tracker transitionTracker
+	start := time.Now()
+	tracker.observe(grpchealth.StatusServing, start)
+	tracker.observe(grpchealth.StatusServing, start)
+	tracker.observe(grpchealth.StatusNotServing, start.Add(time.Second))
+	tracker.observe(grpchealth.StatusNotServing, start.Add(time.Second+10*time.Millisecond))
+	if got := tracker.transitions(); got != 1 {
+		t.Fatalf("got %d transitions, expected 1", got)
+	}
+	if got := tracker.delays.summary(); !strings.Contains(got, "max=10ms") {
+		t.Fatalf("got propagation %q, expected max=10ms", got)
+	}
+}
+
+func TestRun(t *testing.T) {
+	t.Parallel()
+	checker := grpchealth.NewStaticChecker()
+	mux := http.NewServeMux()
+	mux.Handle(grpchealth.NewHandler(checker))
+	server := httptest.NewServer(grpchealth.NewH2CHandler(mux))
+	t.Cleanup(server.Close)
+
+	go func() {
+		time.Sleep(200 * time.Millisecond)
+		checker.SetStatus("", grpchealth.StatusNotServing)
+	}()
+	var out bytes.Buffer
+	args := []string{"-target", server.URL, "-watchers", "5", "-qps", "50", "-duration", "500ms"}
+	if err := run(context.Background(), args, &out); err != nil {
+		t.Fatal(err)
+	}
+	for _, expect := range []string{"checks: n=", "errors=0", "watch streams: 5", "transitions: 1"} {
+		if !strings.Contains(out.String(), expect) {
+			t.Errorf("output missing %q:\n%s", expect, out.String())
+		}
+	}
+	if err := run(context.Background(), nil, &out); err == nil {
+		t.Error("expected error without -target")
+	}
+}
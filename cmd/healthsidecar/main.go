@@ -0,0 +1,211 @@
+// Copyright 2022-2024 The Connect Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Command healthsidecar serves gRPC health checks on behalf of another
+// process. It runs next to an application that doesn't speak gRPC's health
+// protocol, periodically probes it over HTTP, TCP, or by executing a command,
+// and reports the results through connectrpc.com/grpchealth.
+//
+// Each probe is named after the service it reports on:
+//
+//	healthsidecar \
+//	  -probe acme.user.v1.UserService=http://localhost:8000/ready \
+//	  -probe acme.cache.v1.CacheService=tcp://localhost:6379 \
+//	  -probe acme.batch.v1.BatchService='exec:/usr/local/bin/check-batch --quick'
+//
+// The status of the whole process is the worst status of all probes.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"connectrpc.com/grpchealth"
+)
+
+func main() {
+	if err := run(os.Args[1:]); err != nil && !errors.Is(err, flag.ErrHelp) {
+		fmt.Fprintln(os.Stderr, "healthsidecar:", err)
+		os.Exit(1)
+	}
+}
+
+func run(args []string) error {
+	flags := flag.NewFlagSet("healthsidecar", flag.ContinueOnError)
+	addr := flags.String("addr", ":8080", "address to serve health checks on")
+	httpPath := flags.String("http-path", "/healthz", "path for plain HTTP health checks (empty to disable)")
+	interval := flags.Duration("interval", 5*time.Second, "time between probes")
+	timeout := flags.Duration("timeout", time.Second, "timeout for each probe")
+	var probes probeFlag
+	flags.Var(&probes, "probe", "service=target probe, where target is an http(s)://, tcp://, or exec: URL (repeatable)")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if len(probes) == 0 {
+		return errors.New("at least one -probe is required")
+	}
+
+	services := make([]string, len(probes))
+	for i, p := range probes {
+		services[i] = p.service
+	}
+	checker := grpchealth.NewStaticCheckerWithOptions(
+		services,
+		grpchealth.WithAggregatedProcessStatus(),
+	)
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	runProbes(ctx, checker, probes, *timeout)
+	go func() {
+		ticker := time.NewTicker(*interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				runProbes(ctx, checker, probes, *timeout)
+			}
+		}
+	}()
+
+	mux := http.NewServeMux()
+	mux.Handle(grpchealth.NewHandler(checker))
+	if *httpPath != "" {
+		mux.Handle(*httpPath, grpchealth.NewHTTPHandler(checker))
+	}
+	server := &http.Server{
+		Addr:              *addr,
+		Handler:           grpchealth.NewH2CHandler(mux),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	serveErr := make(chan error, 1)
+	go func() { serveErr <- server.ListenAndServe() }()
+	select {
+	case err := <-serveErr:
+		return err
+	case <-ctx.Done():
+	}
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	return server.Shutdown(shutdownCtx)
+}
+
+func runProbes(ctx context.Context, checker *grpchealth.StaticChecker, probes []*probe, timeout time.Duration) {
+	for _, p := range probes {
+		probeCtx, cancel := context.WithTimeout(ctx, timeout)
+		err := p.check(probeCtx)
+		cancel()
+		if ctx.Err() != nil {
+			return
+		}
+		status := grpchealth.StatusServing
+		if err != nil {
+			status = grpchealth.StatusNotServing
+		}
+		checker.SetStatus(p.service, status)
+	}
+}
+
+type probe struct {
+	service string
+	check   func(context.Context) error
+}
+
+// parseProbe parses a "service=target" probe specification.
+func parseProbe(spec string) (*probe, error) {
+	service, target, ok := strings.Cut(spec, "=")
+	if !ok || service == "" || target == "" {
+		return nil, fmt.Errorf("probe %q: expected service=target", spec)
+	}
+	if command, isExec := strings.CutPrefix(target, "exec:"); isExec {
+		argv := strings.Fields(command)
+		if len(argv) == 0 {
+			return nil, fmt.Errorf("probe %q: missing command", spec)
+		}
+		return &probe{service: service, check: func(ctx context.Context) error {
+			return exec.CommandContext(ctx, argv[0], argv[1:]...).Run() //nolint:gosec // commands come from the operator
+		}}, nil
+	}
+	parsed, err := url.Parse(target)
+	if err != nil {
+		return nil, fmt.Errorf("probe %q: %w", spec, err)
+	}
+	switch parsed.Scheme {
+	case "http", "https":
+		return &probe{service: service, check: func(ctx context.Context) error {
+			return checkHTTP(ctx, target)
+		}}, nil
+	case "tcp":
+		if parsed.Host == "" {
+			return nil, fmt.Errorf("probe %q: missing host", spec)
+		}
+		return &probe{service: service, check: func(ctx context.Context) error {
+			var dialer net.Dialer
+			conn, err := dialer.DialContext(ctx, "tcp", parsed.Host)
+			if err != nil {
+				return err
+			}
+			return conn.Close()
+		}}, nil
+	default:
+		return nil, fmt.Errorf("probe %q: unsupported target %q", spec, target)
+	}
+}
+
+func checkHTTP(ctx context.Context, target string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, http.NoBody)
+	if err != nil {
+		return err
+	}
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	res.Body.Close()
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return fmt.Errorf("HTTP %d", res.StatusCode)
+	}
+	return nil
+}
+
+type probeFlag []*probe
+
+func (f *probeFlag) String() string {
+	services := make([]string, len(*f))
+	for i, p := range *f {
+		services[i] = p.service
+	}
+	return strings.Join(services, ",")
+}
+
+func (f *probeFlag) Set(spec string) error {
+	p, err := parseProbe(spec)
+	if err != nil {
+		return err
+	}
+	*f = append(*f, p)
+	return nil
+}
@@ -0,0 +1,96 @@
+// Copyright 2022-2024 The Connect Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"connectrpc.com/grpchealth"
+)
+
+func TestParseProbe(t *testing.T) {
+	t.Parallel()
+	for _, spec := range []string{
+		"",
+		"acme.user.v1.UserService",
+		"=http://localhost",
+		"acme.user.v1.UserService=",
+		"acme.user.v1.UserService=exec:",
+		"acme.user.v1.UserService=tcp://",
+		"acme.user.v1.UserService=ftp://localhost",
+	} {
+		if _, err := parseProbe(spec); err == nil {
+			t.Errorf("parseProbe(%q): expected error", spec)
+		}
+	}
+}
+
+func TestRunProbes(t *testing.T) {
+	const (
+		healthy   = "acme.healthy.v1.HealthyService"
+		unhealthy = "acme.unhealthy.v1.UnhealthyService"
+		listening = "acme.listening.v1.ListeningService"
+	)
+	t.Parallel()
+	ok := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	t.Cleanup(ok.Close)
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	t.Cleanup(failing.Close)
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	var probes probeFlag
+	for _, spec := range []string{
+		healthy + "=" + ok.URL,
+		unhealthy + "=" + failing.URL,
+		listening + "=tcp://" + listener.Addr().String(),
+	} {
+		if err := probes.Set(spec); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := probes.String(); got != strings.Join([]string{healthy, unhealthy, listening}, ",") {
+		t.Fatalf("got flag value %q", got)
+	}
+	checker := grpchealth.NewStaticChecker(healthy, unhealthy, listening)
+	runProbes(context.Background(), checker, probes, time.Second)
+
+	for service, expect := range map[string]grpchealth.Status{
+		healthy:   grpchealth.StatusServing,
+		unhealthy: grpchealth.StatusNotServing,
+		listening: grpchealth.StatusServing,
+	} {
+		res, err := checker.Check(context.Background(), &grpchealth.CheckRequest{Service: service})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.Status != expect {
+			t.Errorf("%s: got status %v, expected %v", service, res.Status, expect)
+		}
+	}
+}
@@ -0,0 +1,140 @@
+// Copyright 2022-2024 The Connect Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package grpchealth
+
+import (
+	"errors"
+	"fmt"
+	"unicode/utf8"
+
+	"connectrpc.com/connect"
+	healthv1 "connectrpc.com/grpchealth/internal/gen/go/connectext/grpc/health/v1"
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+)
+
+// WithFastCodec returns an option that makes clients and handlers marshal the
+// Check and Watch messages with specialized, hand-written protobuf encoding
+// instead of reflection. It produces the same bytes as the standard codec
+// while allocating less, which matters on hosts that receive thousands of
+// probes per second. Other messages, such as List's, use the standard codec.
+//
+//	mux.Handle(grpchealth.NewHandler(checker, grpchealth.WithFastCodec()))
+func WithFastCodec() connect.Option {
+	return connect.WithCodec(&fastCodec{})
+}
+
+// fastCodec is a binary protobuf codec with fast paths for
+// HealthCheckRequest and HealthCheckResponse. Unknown fields are discarded.
+type fastCodec struct{}
+
+func (c *fastCodec) Name() string { return "proto" }
+
+func (c *fastCodec) Marshal(message any) ([]byte, error) {
+	return c.MarshalAppend(nil, message)
+}
+
+func (c *fastCodec) MarshalAppend(dst []byte, message any) ([]byte, error) {
+	switch msg := message.(type) {
+	case *healthv1.HealthCheckRequest:
+		if msg.Service != "" {
+			dst = protowire.AppendTag(dst, 1, protowire.BytesType)
+			dst = protowire.AppendString(dst, msg.Service)
+		}
+		return dst, nil
+	case *healthv1.HealthCheckResponse:
+		if msg.Status != 0 {
+			dst = protowire.AppendTag(dst, 1, protowire.VarintType)
+			dst = protowire.AppendVarint(dst, uint64(msg.Status))
+		}
+		return dst, nil
+	case proto.Message:
+		return proto.MarshalOptions{}.MarshalAppend(dst, msg)
+	default:
+		return nil, fmt.Errorf("%T doesn't implement proto.Message", message)
+	}
+}
+
+func (c *fastCodec) MarshalStable(message any) ([]byte, error) {
+	if msg, ok := message.(proto.Message); ok && !isHealthMessage(msg) {
+		return proto.MarshalOptions{Deterministic: true}.Marshal(msg)
+	}
+	return c.Marshal(message)
+}
+
+func (c *fastCodec) IsBinary() bool { return true }
+
+func (c *fastCodec) Unmarshal(data []byte, message any) error {
+	switch msg := message.(type) {
+	case *healthv1.HealthCheckRequest:
+		msg.Reset()
+		return unmarshalFields(data, func(num protowire.Number, typ protowire.Type, field []byte) (int, error) {
+			if num != 1 || typ != protowire.BytesType {
+				return protowire.ConsumeFieldValue(num, typ, field), nil
+			}
+			service, n := protowire.ConsumeString(field)
+			if n >= 0 && !utf8.ValidString(service) {
+				return 0, errors.New("service name isn't valid UTF-8")
+			}
+			msg.Service = service
+			return n, nil
+		})
+	case *healthv1.HealthCheckResponse:
+		msg.Reset()
+		return unmarshalFields(data, func(num protowire.Number, typ protowire.Type, field []byte) (int, error) {
+			if num != 1 || typ != protowire.VarintType {
+				return protowire.ConsumeFieldValue(num, typ, field), nil
+			}
+			status, n := protowire.ConsumeVarint(field)
+			msg.Status = healthv1.HealthCheckResponse_ServingStatus(int32(status))
+			return n, nil
+		})
+	case proto.Message:
+		return proto.Unmarshal(data, msg)
+	default:
+		return fmt.Errorf("%T doesn't implement proto.Message", message)
+	}
+}
+
+// unmarshalFields calls consume with the number, type, and remaining data of
+// each field in a message. Consume returns the length of the field's value,
+// or a negative length if it's malformed.
+func unmarshalFields(data []byte, consume func(protowire.Number, protowire.Type, []byte) (int, error)) error {
+	for len(data) > 0 {
+		num, typ, n := protowire.ConsumeTag(data)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		data = data[n:]
+		n, err := consume(num, typ, data)
+		if err != nil {
+			return err
+		}
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		data = data[n:]
+	}
+	return nil
+}
+
+func isHealthMessage(msg proto.Message) bool {
+	switch msg.(type) {
+	case *healthv1.HealthCheckRequest, *healthv1.HealthCheckResponse:
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,97 @@
+// Copyright 2022-2024 The Connect Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package grpchealth
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	healthv1 "connectrpc.com/grpchealth/internal/gen/go/connectext/grpc/health/v1"
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestFastCodec(t *testing.T) {
+	const userFQN = "acme.user.v1.UserService"
+	t.Parallel()
+	codec := &fastCodec{}
+	for _, msg := range []proto.Message{
+		&healthv1.HealthCheckRequest{},
+		&healthv1.HealthCheckRequest{Service: userFQN},
+		&healthv1.HealthCheckResponse{},
+		&healthv1.HealthCheckResponse{Status: healthv1.HealthCheckResponse_SERVING_STATUS_NOT_SERVING},
+		&healthv1.HealthListResponse{Statuses: map[string]*healthv1.HealthCheckResponse{
+			userFQN: {Status: healthv1.HealthCheckResponse_SERVING_STATUS_SERVING},
+		}},
+	} {
+		expect, err := proto.Marshal(msg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := codec.Marshal(msg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, expect) {
+			t.Fatalf("%T: got %x, expected %x", msg, got, expect)
+		}
+		// Prefix the encoding with an unknown field, which the fast paths skip
+		// and the standard codec preserves.
+		data := protowire.AppendTag(nil, 2, protowire.VarintType)
+		data = protowire.AppendVarint(data, 42)
+		roundTrip := msg.ProtoReflect().New().Interface()
+		if err := codec.Unmarshal(append(data, got...), roundTrip); err != nil {
+			t.Fatal(err)
+		}
+		roundTrip.ProtoReflect().SetUnknown(nil)
+		if !proto.Equal(roundTrip, msg) {
+			t.Fatalf("%T: got %v after round trip, expected %v", msg, roundTrip, msg)
+		}
+	}
+
+	invalid := protowire.AppendTag(nil, 1, protowire.BytesType)
+	if err := codec.Unmarshal(protowire.AppendString(invalid, "\xff"), &healthv1.HealthCheckRequest{}); err == nil {
+		t.Error("expected error for invalid UTF-8")
+	}
+	if err := codec.Unmarshal(protowire.AppendVarint(invalid, 10), &healthv1.HealthCheckRequest{}); err == nil {
+		t.Error("expected error for truncated message")
+	}
+	if _, err := codec.Marshal("not a message"); err == nil {
+		t.Error("expected error marshaling a non-message")
+	}
+}
+
+func TestFastCodecEndToEnd(t *testing.T) {
+	const userFQN = "acme.user.v1.UserService"
+	t.Parallel()
+	checker := NewStaticChecker(userFQN)
+	checker.SetStatus(userFQN, StatusNotServing)
+	mux := http.NewServeMux()
+	mux.Handle(NewHandler(checker, WithFastCodec()))
+	server := httptest.NewServer(NewH2CHandler(mux))
+	t.Cleanup(server.Close)
+	client := NewClient(server.URL, WithFastCodec())
+	t.Cleanup(client.Close)
+	res, err := client.Check(context.Background(), &CheckRequest{Service: userFQN})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Status != StatusNotServing {
+		t.Fatalf("got status %v, expected %v", res.Status, StatusNotServing)
+	}
+}
@@ -0,0 +1,112 @@
+// Copyright 2022-2024 The Connect Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package grpchealth
+
+import (
+	"context"
+	"sync"
+)
+
+// WithCheckConcurrency bounds how many checks of each service may run at once,
+// protecting fragile dependencies, such as databases with small connection
+// pools, from load caused by probes. Requests beyond the limit get the result
+// of the service's most recent check, if one finished while the service was
+// busy, and otherwise wait for a running check to finish. If limit isn't
+// positive, checks are unbounded.
+func WithCheckConcurrency(limit int) HandlerOption {
+	return newHandlerOption(func(config *handlerConfig) {
+		config.CheckLimiter = nil
+		if limit > 0 {
+			config.CheckLimiter = &checkLimiter{
+				limit:    limit,
+				services: make(map[detachedKey]*serviceLimit),
+			}
+		}
+	})
+}
+
+// checkLimiter bounds the concurrent checks of each service.
+type checkLimiter struct {
+	limit int
+
+	mu       sync.Mutex
+	services map[detachedKey]*serviceLimit
+}
+
+type serviceLimit struct {
+	slots    chan struct{}
+	users    int           // guarded by checkLimiter.mu
+	last     *CheckResult  // guarded by checkLimiter.mu
+	finished chan struct{} // closed and replaced whenever a check finishes
+}
+
+// run calls check if the service has a free slot. Otherwise, it returns the
+// service's most recent result or waits for a slot.
+func (l *checkLimiter) run(ctx context.Context, req *CheckRequest, check func() *CheckResult) *CheckResult {
+	key := detachedKey{channel: ChannelFromContext(ctx), service: req.Service}
+	l.mu.Lock()
+	service, ok := l.services[key]
+	if !ok {
+		service = &serviceLimit{
+			slots:    make(chan struct{}, l.limit),
+			finished: make(chan struct{}),
+		}
+		l.services[key] = service
+	}
+	service.users++
+	l.mu.Unlock()
+	defer l.release(key, service)
+
+	for {
+		select {
+		case service.slots <- struct{}{}:
+			result := check()
+			<-service.slots
+			l.mu.Lock()
+			service.last = result
+			close(service.finished)
+			service.finished = make(chan struct{})
+			l.mu.Unlock()
+			return result
+		default:
+		}
+		l.mu.Lock()
+		last, finished := service.last, service.finished
+		l.mu.Unlock()
+		if last != nil {
+			requestID, _ := RequestIDFromContext(ctx)
+			result := *last
+			result.RequestID = requestID
+			return &result
+		}
+		select {
+		case <-finished:
+		case <-ctx.Done():
+			requestID, _ := RequestIDFromContext(ctx)
+			return &CheckResult{Service: req.Service, Err: ctx.Err(), RequestID: requestID}
+		}
+	}
+}
+
+// release forgets a service once nothing uses it, so checks of many distinct
+// services can't grow the limiter without bound.
+func (l *checkLimiter) release(key detachedKey, service *serviceLimit) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	service.users--
+	if service.users == 0 {
+		delete(l.services, key)
+	}
+}
@@ -0,0 +1,118 @@
+// Copyright 2022-2024 The Connect Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package grpchealth
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"connectrpc.com/connect"
+)
+
+func TestCheckConcurrency(t *testing.T) {
+	t.Parallel()
+	var running, peak atomic.Int32
+	release := make(chan struct{})
+	checker := checkerFunc(func(context.Context, *CheckRequest) (*CheckResponse, error) {
+		n := running.Add(1)
+		defer running.Add(-1)
+		for {
+			old := peak.Load()
+			if n <= old || peak.CompareAndSwap(old, n) {
+				break
+			}
+		}
+		<-release
+		return &CheckResponse{Status: StatusServing}, nil
+	})
+	config := newHandlerConfig([]connect.HandlerOption{WithCheckConcurrency(2)})
+
+	// Without a previous result, excess checks wait for a slot.
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			result := config.runCheck(context.Background(), checker, &CheckRequest{Service: "db"})
+			if result.Err != nil || result.Status != StatusServing {
+				t.Errorf("got %v, %v, expected serving", result.Status, result.Err)
+			}
+		}()
+	}
+	for running.Load() < 2 {
+		time.Sleep(time.Millisecond)
+	}
+	close(release)
+	wg.Wait()
+	if got := peak.Load(); got != 2 {
+		t.Errorf("got %d concurrent checks, expected 2", got)
+	}
+
+	// Once a check finishes while the service is busy, excess checks reuse
+	// its result.
+	gates := make(chan chan struct{}, 3)
+	checker = checkerFunc(func(context.Context, *CheckRequest) (*CheckResponse, error) {
+		<-<-gates
+		return &CheckResponse{Status: StatusNotServing}, nil
+	})
+	// waitFor polls the service's limit until cond holds.
+	waitFor := func(cond func(*serviceLimit) bool) {
+		t.Helper()
+		for {
+			config.CheckLimiter.mu.Lock()
+			limit := config.CheckLimiter.services[detachedKey{service: "db"}]
+			done := limit != nil && cond(limit)
+			config.CheckLimiter.mu.Unlock()
+			if done {
+				return
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+	start := func() chan struct{} {
+		gate := make(chan struct{})
+		gates <- gate
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			config.runCheck(context.Background(), checker, &CheckRequest{Service: "db"})
+		}()
+		return gate
+	}
+	first, second := start(), start()
+	waitFor(func(limit *serviceLimit) bool { return len(limit.slots) == 2 })
+	close(first)
+	waitFor(func(limit *serviceLimit) bool { return limit.last != nil && len(limit.slots) < 2 })
+	third := start()
+	waitFor(func(limit *serviceLimit) bool { return len(limit.slots) == 2 })
+	result := config.runCheck(context.Background(), checker, &CheckRequest{Service: "db"})
+	if result.Status != StatusNotServing {
+		t.Errorf("got %v, expected the previous result", result.Status)
+	}
+	close(second)
+	close(third)
+	wg.Wait()
+
+	// Idle services are forgotten, so many distinct names can't grow the
+	// limiter without bound.
+	config.CheckLimiter.mu.Lock()
+	defer config.CheckLimiter.mu.Unlock()
+	if n := len(config.CheckLimiter.services); n != 0 {
+		t.Errorf("limiter remembered %d idle services", n)
+	}
+}
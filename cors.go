@@ -0,0 +1,139 @@
+// Copyright 2022-2024 The Connect Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package grpchealth
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CORSParams configure WithCORS.
+type CORSParams struct {
+	// AllowedOrigins are the origins allowed to make cross-origin requests,
+	// such as "https://dashboard.internal.example.com". The origin "*" allows
+	// any origin.
+	AllowedOrigins []string
+	// AllowedMethods are the HTTP methods allowed in cross-origin requests.
+	// The default is GET and POST, which covers Connect's unary and streaming
+	// calls, gRPC-Web, and the plain HTTP endpoints.
+	AllowedMethods []string
+	// AllowedHeaders are request headers allowed in cross-origin requests,
+	// in addition to those required by Connect and gRPC-Web.
+	AllowedHeaders []string
+	// MaxAge is how long browsers may cache the response to a preflight
+	// request. If it's zero, browsers use their own default.
+	MaxAge time.Duration
+}
+
+// WithCORS makes handlers answer cross-origin requests from the allowed
+// origins, so browser-based dashboards can call Check, Watch, and List with
+// Connect or gRPC-Web and query the endpoints built by NewHTTPHandler and
+// NewEnvoyHandler directly. Handlers answer preflight requests themselves, and
+// expose the response headers set by this package and by Connect and gRPC-Web
+// to scripts.
+//
+// Requests from other origins are served as usual, without CORS headers, so
+// browsers keep scripts from reading the responses.
+func WithCORS(params CORSParams) HandlerOption {
+	methods := params.AllowedMethods
+	if len(methods) == 0 {
+		methods = []string{http.MethodGet, http.MethodPost}
+	}
+	headers := append([]string{
+		"Content-Type",
+		"Connect-Protocol-Version",
+		"Connect-Timeout-Ms",
+		"Grpc-Timeout",
+		"X-Grpc-Web",
+		"X-User-Agent",
+	}, params.AllowedHeaders...)
+	cors := &corsPolicy{
+		origins: make(map[string]struct{}, len(params.AllowedOrigins)),
+		methods: strings.Join(methods, ", "),
+		headers: strings.Join(headers, ", "),
+	}
+	for _, origin := range params.AllowedOrigins {
+		cors.origins[origin] = struct{}{}
+	}
+	if params.MaxAge > 0 {
+		cors.maxAge = strconv.Itoa(int(params.MaxAge / time.Second))
+	}
+	return newHandlerOption(func(config *handlerConfig) {
+		config.CORS = cors
+	})
+}
+
+type corsPolicy struct {
+	origins map[string]struct{}
+	methods string
+	headers string
+	maxAge  string
+}
+
+func (p *corsPolicy) allows(origin string) bool {
+	if _, ok := p.origins["*"]; ok {
+		return true
+	}
+	_, ok := p.origins[origin]
+	return ok
+}
+
+// withCORS wraps a handler to apply the policy configured with WithCORS, if
+// any.
+func (c *handlerConfig) withCORS(handler http.Handler) http.Handler {
+	cors := c.CORS
+	if cors == nil {
+		return handler
+	}
+	exposed := []string{
+		"Grpc-Status",
+		"Grpc-Message",
+		"Grpc-Status-Details-Bin",
+		"Retry-After",
+		"ETag",
+	}
+	if c.RequestIDHeader != "" {
+		exposed = append(exposed, c.RequestIDHeader)
+	}
+	if c.BuildInfo != nil {
+		exposed = append(exposed, "Build-Version", "Build-Revision", "Process-Start-Time")
+	}
+	if c.StabilityHeaders {
+		exposed = append(exposed, "Process-Uptime", "Status-Last-Transition")
+	}
+	expose := strings.Join(exposed, ", ")
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		w.Header().Add("Vary", "Origin")
+		if origin == "" || !cors.allows(origin) {
+			handler.ServeHTTP(w, r)
+			return
+		}
+		w.Header().Set("Access-Control-Allow-Origin", origin)
+		if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+			w.Header().Set("Access-Control-Allow-Methods", cors.methods)
+			w.Header().Set("Access-Control-Allow-Headers", cors.headers)
+			if cors.maxAge != "" {
+				w.Header().Set("Access-Control-Max-Age", cors.maxAge)
+			}
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		w.Header().Set("Access-Control-Expose-Headers", expose)
+		handler.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,130 @@
+// Copyright 2022-2024 The Connect Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package grpchealth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCORS(t *testing.T) {
+	t.Parallel()
+	const origin = "https://dashboard.example.com"
+	option := WithCORS(CORSParams{
+		AllowedOrigins: []string{origin},
+		AllowedHeaders: []string{"Authorization"},
+		MaxAge:         time.Hour,
+	})
+	mux := http.NewServeMux()
+	mux.Handle(NewHandler(NewStaticChecker(), option, WithRequestIDHeader("X-Request-Id")))
+	mux.Handle("/status", NewHTTPHandler(NewStaticChecker(), option))
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	do := func(t *testing.T, method, path, origin string, header http.Header) *http.Response {
+		t.Helper()
+		req, err := http.NewRequest(method, server.URL+path, strings.NewReader("{}"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for key, values := range header {
+			req.Header[key] = values
+		}
+		req.Header.Set("Origin", origin)
+		res, err := server.Client().Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+		return res
+	}
+
+	t.Run("preflight", func(t *testing.T) {
+		t.Parallel()
+		res := do(t, http.MethodOptions, "/grpc.health.v1.Health/Check", origin, http.Header{
+			"Access-Control-Request-Method":  []string{http.MethodPost},
+			"Access-Control-Request-Headers": []string{"content-type,connect-protocol-version"},
+		})
+		if res.StatusCode != http.StatusNoContent {
+			t.Fatalf("got HTTP %d, expected %d", res.StatusCode, http.StatusNoContent)
+		}
+		for key, expect := range map[string]string{
+			"Access-Control-Allow-Origin":  origin,
+			"Access-Control-Allow-Methods": "GET, POST",
+			"Access-Control-Max-Age":       "3600",
+		} {
+			if got := res.Header.Get(key); got != expect {
+				t.Errorf("got %s %q, expected %q", key, got, expect)
+			}
+		}
+		allowed := res.Header.Get("Access-Control-Allow-Headers")
+		for _, header := range []string{"Connect-Protocol-Version", "X-Grpc-Web", "Authorization"} {
+			if !strings.Contains(allowed, header) {
+				t.Errorf("Access-Control-Allow-Headers %q doesn't include %s", allowed, header)
+			}
+		}
+	})
+	t.Run("connect", func(t *testing.T) {
+		t.Parallel()
+		res := do(t, http.MethodPost, "/grpc.health.v1.Health/Check", origin, http.Header{
+			"Content-Type": []string{"application/json"},
+		})
+		if res.StatusCode != http.StatusOK {
+			t.Fatalf("got HTTP %d, expected %d", res.StatusCode, http.StatusOK)
+		}
+		if got := res.Header.Get("Access-Control-Allow-Origin"); got != origin {
+			t.Errorf("got Access-Control-Allow-Origin %q, expected %q", got, origin)
+		}
+		if exposed := res.Header.Get("Access-Control-Expose-Headers"); !strings.Contains(exposed, "X-Request-Id") {
+			t.Errorf("Access-Control-Expose-Headers %q doesn't include the request ID header", exposed)
+		}
+	})
+	t.Run("http", func(t *testing.T) {
+		t.Parallel()
+		res := do(t, http.MethodGet, "/status", origin, nil)
+		if got := res.Header.Get("Access-Control-Allow-Origin"); got != origin {
+			t.Errorf("got Access-Control-Allow-Origin %q, expected %q", got, origin)
+		}
+	})
+	t.Run("disallowed_origin", func(t *testing.T) {
+		t.Parallel()
+		res := do(t, http.MethodOptions, "/status", "https://evil.example.com", http.Header{
+			"Access-Control-Request-Method": []string{http.MethodGet},
+		})
+		if got := res.Header.Get("Access-Control-Allow-Origin"); got != "" {
+			t.Errorf("got Access-Control-Allow-Origin %q, expected none", got)
+		}
+		if res.StatusCode != http.StatusMethodNotAllowed {
+			t.Errorf("got HTTP %d, expected %d", res.StatusCode, http.StatusMethodNotAllowed)
+		}
+	})
+}
+
+func TestCORSWildcard(t *testing.T) {
+	t.Parallel()
+	handler := NewHTTPHandler(NewStaticChecker(), WithCORS(CORSParams{AllowedOrigins: []string{"*"}}))
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Origin", "https://anywhere.example.com")
+	res := httptest.NewRecorder()
+	handler.ServeHTTP(res, req)
+	if got := res.Header().Get("Access-Control-Allow-Origin"); got != "https://anywhere.example.com" {
+		t.Errorf("got Access-Control-Allow-Origin %q, expected the request's origin", got)
+	}
+	if got := res.Header().Get("Vary"); !strings.Contains(got, "Origin") {
+		t.Errorf("got Vary %q, expected it to include Origin", got)
+	}
+}
@@ -0,0 +1,125 @@
+// Copyright 2022-2024 The Connect Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package grpchealth
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// DiskCheckerParams configure a DiskChecker. A zero limit disables the
+// corresponding check.
+type DiskCheckerParams struct {
+	// Dir is the data or spool directory the service writes to.
+	Dir string
+	// MinFreeBytes is the free space, in bytes, below which the service can't
+	// safely accept work.
+	MinFreeBytes uint64
+	// MinFreeFraction is the fraction of the filesystem, between 0 and 1,
+	// that must remain free.
+	MinFreeFraction float64
+	// Interval is the minimum time between probes. Checks made more often
+	// reuse the previous result, so frequent health checks don't each create
+	// and sync a file. A zero interval probes on every check.
+	Interval time.Duration
+	// Clock times probes. The default is the system clock.
+	Clock Clock
+}
+
+// DiskChecker is a Checker for stateful services and local spool directories.
+// It reports StatusNotServing when its directory isn't writable, typically
+// because the filesystem was remounted read-only or lost its backing volume,
+// or when free space falls below its limits. Free space can only be measured
+// on Linux and macOS; elsewhere, only writability is checked. The details of
+// the response include the error or the free space.
+//
+// DiskChecker reports the same status for every service.
+type DiskChecker struct {
+	params DiskCheckerParams
+
+	mu       sync.Mutex
+	measured time.Time
+	response *CheckResponse
+}
+
+// NewDiskChecker constructs a DiskChecker.
+func NewDiskChecker(params DiskCheckerParams) (*DiskChecker, error) {
+	if params.Dir == "" {
+		return nil, fmt.Errorf("disk checker requires a directory")
+	}
+	if params.Clock == nil {
+		params.Clock = systemClock{}
+	}
+	return &DiskChecker{params: params}, nil
+}
+
+// Check implements Checker.
+func (c *DiskChecker) Check(_ context.Context, _ *CheckRequest) (*CheckResponse, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.response != nil && c.params.Clock.Now().Sub(c.measured) < c.params.Interval {
+		return c.response, nil
+	}
+	c.measured = c.params.Clock.Now()
+	c.response = c.probe()
+	return c.response, nil
+}
+
+// probe measures the directory's writability and free space.
+func (c *DiskChecker) probe() *CheckResponse {
+	if err := probeWritable(c.params.Dir); err != nil {
+		return &CheckResponse{
+			Status:  StatusNotServing,
+			Details: map[string]string{"error": err.Error()},
+		}
+	}
+	free, total, ok := diskSpace(c.params.Dir)
+	if !ok {
+		return &CheckResponse{Status: StatusServing}
+	}
+	status := StatusServing
+	if free < c.params.MinFreeBytes {
+		status = StatusNotServing
+	}
+	if total > 0 && float64(free)/float64(total) < c.params.MinFreeFraction {
+		status = StatusNotServing
+	}
+	return &CheckResponse{
+		Status:  status,
+		Details: map[string]string{"free_bytes": strconv.FormatUint(free, 10)},
+	}
+}
+
+// probeWritable creates, syncs, and removes a small file in dir.
+func probeWritable(dir string) error {
+	file, err := os.CreateTemp(dir, ".grpchealth-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name())
+	if _, err := file.WriteString("ok"); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
@@ -0,0 +1,98 @@
+// Copyright 2022-2024 The Connect Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package grpchealth
+
+import (
+	"context"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestDiskChecker(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	newChecker := func(dir string, minFreeBytes uint64) *DiskChecker {
+		t.Helper()
+		checker, err := NewDiskChecker(DiskCheckerParams{
+			Dir:             dir,
+			MinFreeBytes:    minFreeBytes,
+			MinFreeFraction: 0,
+			Interval:        0,
+			Clock:           nil,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return checker
+	}
+	assertStatus := func(checker *DiskChecker, expect Status) {
+		t.Helper()
+		res, err := checker.Check(context.Background(), &CheckRequest{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.Status != expect {
+			t.Fatalf("got status %v, expected %v (details %v)", res.Status, expect, res.Details)
+		}
+	}
+	assertStatus(newChecker(dir, 1), StatusServing)
+	assertStatus(newChecker(filepath.Join(dir, "missing"), 0), StatusNotServing)
+	if _, _, ok := diskSpace(dir); ok {
+		assertStatus(newChecker(dir, math.MaxUint64), StatusNotServing)
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 0 {
+		t.Fatalf("probe left %d files behind", len(entries))
+	}
+}
+
+func TestDiskCheckerInterval(t *testing.T) {
+	t.Parallel()
+	dir := filepath.Join(t.TempDir(), "spool")
+	clock := &manualClock{now: time.Unix(0, 0)}
+	checker, err := NewDiskChecker(DiskCheckerParams{
+		Dir:             dir,
+		MinFreeBytes:    0,
+		MinFreeFraction: 0,
+		Interval:        time.Minute,
+		Clock:           clock,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	check := func(expect Status) {
+		t.Helper()
+		res, err := checker.Check(context.Background(), &CheckRequest{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.Status != expect {
+			t.Fatalf("got status %v, expected %v (details %v)", res.Status, expect, res.Details)
+		}
+	}
+	check(StatusNotServing)
+	if err := os.Mkdir(dir, 0o700); err != nil {
+		t.Fatal(err)
+	}
+	check(StatusNotServing) // within the interval, the previous result is reused
+	clock.Advance(time.Minute)
+	check(StatusServing)
+}
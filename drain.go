@@ -0,0 +1,163 @@
+// Copyright 2022-2024 The Connect Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package grpchealth
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// DrainGate coordinates graceful shutdown with load balancers. Its middleware
+// tracks in-flight requests; during shutdown, Drain marks the whole process
+// StatusNotServing and WaitForDrain blocks until load balancers have had time
+// to notice and all in-flight requests have finished. Only then should the
+// server close:
+//
+//	gate := grpchealth.NewDrainGate(checker, 10*time.Second)
+//	mux.Handle("/", gate.Middleware(app))
+//	mux.Handle(grpchealth.NewHandler(checker))
+//	// ... on SIGTERM:
+//	gate.Drain()
+//	_ = gate.WaitForDrain(ctx)
+//	_ = server.Shutdown(ctx)
+//
+// Don't wrap the health handler with the middleware: Watch streams stay open
+// until the server closes, so they would never drain.
+type DrainGate struct {
+	setter StatusSetter
+	grace  time.Duration
+	clock  Clock
+
+	mu         sync.Mutex
+	inFlight   int
+	idle       chan struct{} // closed when inFlight drops to zero
+	drainStart time.Time
+}
+
+// NewDrainGate constructs a DrainGate. The grace period is how long load
+// balancers need to observe StatusNotServing and stop sending new requests,
+// which is usually the probe interval multiplied by the failure threshold.
+func NewDrainGate(setter StatusSetter, grace time.Duration, options ...DrainGateOption) *DrainGate {
+	gate := &DrainGate{
+		setter: setter,
+		grace:  grace,
+		clock:  systemClock{},
+		idle:   make(chan struct{}),
+	}
+	for _, opt := range options {
+		opt.applyToDrainGate(gate)
+	}
+	return gate
+}
+
+// A DrainGateOption configures a DrainGate.
+type DrainGateOption interface {
+	applyToDrainGate(*DrainGate)
+}
+
+// WithDrainClock makes a DrainGate use a Clock to time the grace period.
+func WithDrainClock(clock Clock) DrainGateOption {
+	return &drainClockOption{clock: clock}
+}
+
+// Middleware wraps an HTTP handler, tracking its in-flight requests. Requests
+// are still served while draining, since load balancers may take a while to
+// stop sending them.
+func (g *DrainGate) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		g.mu.Lock()
+		g.inFlight++
+		g.mu.Unlock()
+		defer func() {
+			g.mu.Lock()
+			defer g.mu.Unlock()
+			g.inFlight--
+			if g.inFlight == 0 {
+				close(g.idle)
+				g.idle = make(chan struct{})
+			}
+		}()
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Drain starts draining: it marks the whole process StatusNotServing and
+// starts the grace period. Calling Drain more than once has no additional
+// effect.
+func (g *DrainGate) Drain() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if !g.drainStart.IsZero() {
+		return
+	}
+	g.drainStart = g.clock.Now()
+	g.setter.SetStatus("", StatusNotServing)
+}
+
+// Draining reports whether Drain has been called.
+func (g *DrainGate) Draining() bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return !g.drainStart.IsZero()
+}
+
+// InFlight returns the number of requests currently being served.
+func (g *DrainGate) InFlight() int {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.inFlight
+}
+
+// WaitForDrain blocks until the grace period has elapsed and no requests are
+// in flight, or until the context is done. It calls Drain if necessary.
+func (g *DrainGate) WaitForDrain(ctx context.Context) error {
+	g.Drain()
+	g.mu.Lock()
+	remaining := g.grace - g.clock.Now().Sub(g.drainStart)
+	g.mu.Unlock()
+	if remaining > 0 {
+		timer := g.clock.NewTimer(remaining)
+		defer timer.Stop()
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-timer.Chan():
+		}
+	}
+	for {
+		g.mu.Lock()
+		if g.inFlight == 0 {
+			g.mu.Unlock()
+			return nil
+		}
+		idle := g.idle
+		g.mu.Unlock()
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-idle:
+		}
+	}
+}
+
+type drainClockOption struct {
+	clock Clock
+}
+
+func (o *drainClockOption) applyToDrainGate(gate *DrainGate) {
+	gate.clock = o.clock
+}
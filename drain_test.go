@@ -0,0 +1,74 @@
+// Copyright 2022-2024 The Connect Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package grpchealth
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestDrainGate(t *testing.T) {
+	t.Parallel()
+	checker := NewStaticChecker()
+	gate := NewDrainGate(checker, 20*time.Millisecond)
+	release := make(chan struct{})
+	started := make(chan struct{})
+	server := httptest.NewServer(gate.Middleware(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {
+		close(started)
+		<-release
+	})))
+	t.Cleanup(server.Close)
+
+	go func() {
+		res, err := server.Client().Get(server.URL)
+		if err == nil {
+			res.Body.Close()
+		}
+	}()
+	<-started
+	if got := gate.InFlight(); got != 1 {
+		t.Fatalf("got %d in-flight requests, expected 1", got)
+	}
+
+	start := time.Now()
+	gate.Drain()
+	if !gate.Draining() {
+		t.Fatal("expected gate to be draining")
+	}
+	res, err := checker.Check(context.Background(), &CheckRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Status != StatusNotServing {
+		t.Fatalf("got status %v, expected %v", res.Status, StatusNotServing)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := gate.WaitForDrain(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("got error %v, expected %v", err, context.DeadlineExceeded)
+	}
+	close(release)
+	if err := gate.WaitForDrain(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed < 20*time.Millisecond {
+		t.Fatalf("drained after %v, before the grace period", elapsed)
+	}
+}
@@ -0,0 +1,151 @@
+// Copyright 2022-2024 The Connect Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package grpchealth
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+// EMFParams configure an EMFExporter.
+type EMFParams struct {
+	// Writer receives the log lines. The default is os.Stdout, which the
+	// CloudWatch Logs drivers of ECS and Lambda forward to CloudWatch.
+	Writer io.Writer
+	// Namespace is the CloudWatch namespace of the metrics. The default is
+	// "grpchealth".
+	Namespace string
+	// Dimensions are added to every metric, alongside the Service dimension.
+	// They can't reuse the names of the record's built-in fields: _aws,
+	// Service, Serving, Transitions, Status, and PreviousStatus.
+	Dimensions map[string]string
+	// OnError, if set, is called with errors writing log lines. Writing
+	// continues after errors.
+	OnError func(error)
+	// Clock timestamps transitions passed to Emit. The default is the system
+	// clock.
+	Clock Clock
+}
+
+// EMFExporter writes status transitions as CloudWatch Embedded Metric Format
+// log lines, so deployments on ECS, Lambda, and similar platforms get health
+// metrics in CloudWatch without running an agent. For each change in a
+// service's status, it records the Serving metric as 1 or 0 and the
+// Transitions metric as 1, dimensioned by service. Feed it a StaticChecker's
+// transitions with WithStatusEvents and Run.
+type EMFExporter struct {
+	params     EMFParams
+	dimensions []string
+
+	mu sync.Mutex // serializes writes
+}
+
+// NewEMFExporter constructs an EMFExporter. It returns an error if a dimension
+// reuses the name of a built-in field.
+func NewEMFExporter(params EMFParams) (*EMFExporter, error) {
+	for name := range params.Dimensions {
+		switch name {
+		case "_aws", "Service", "Serving", "Transitions", "Status", "PreviousStatus":
+			return nil, fmt.Errorf("EMF dimension %q conflicts with a built-in field", name)
+		}
+	}
+	if params.Writer == nil {
+		params.Writer = os.Stdout
+	}
+	if params.Namespace == "" {
+		params.Namespace = "grpchealth"
+	}
+	if params.Clock == nil {
+		params.Clock = systemClock{}
+	}
+	dimensions := []string{"Service"}
+	for name := range params.Dimensions {
+		dimensions = append(dimensions, name)
+	}
+	sort.Strings(dimensions[1:])
+	return &EMFExporter{params: params, dimensions: dimensions}, nil
+}
+
+// Run writes the transitions reported by an EventStream until ctx ends, and
+// then returns ctx's error. Events other than EventStatusChanged are ignored,
+// so Run should be the stream's only consumer. Run should be called once.
+func (e *EMFExporter) Run(ctx context.Context, stream *EventStream) error {
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case event := <-stream.Events():
+			if event.Kind == EventStatusChanged {
+				e.emit(event.Time, event.Service, event.Previous, event.Status)
+			}
+		}
+	}
+}
+
+// HandleStats implements StatsHandler, writing each transition. Register the
+// exporter with WithStatusStats as an alternative to Run.
+func (e *EMFExporter) HandleStats(_ context.Context, stats Stats) {
+	if transition, ok := stats.(*Transition); ok {
+		e.emit(transition.Time, transition.Service, transition.Previous, transition.Status)
+	}
+}
+
+// Emit writes a single transition.
+func (e *EMFExporter) Emit(service string, previous, status Status) {
+	e.emit(e.params.Clock.Now(), service, previous, status)
+}
+
+func (e *EMFExporter) emit(at time.Time, service string, previous, status Status) {
+	var serving int
+	if status == StatusServing {
+		serving = 1
+	}
+	record := map[string]any{
+		"_aws": map[string]any{
+			"Timestamp": at.UnixMilli(),
+			"CloudWatchMetrics": []any{map[string]any{
+				"Namespace":  e.params.Namespace,
+				"Dimensions": [][]string{e.dimensions},
+				"Metrics": []any{
+					map[string]string{"Name": "Serving", "Unit": "None"},
+					map[string]string{"Name": "Transitions", "Unit": "Count"},
+				},
+			}},
+		},
+		"Service":        metricServiceName(service),
+		"Serving":        serving,
+		"Transitions":    1,
+		"Status":         status.String(),
+		"PreviousStatus": previous.String(),
+	}
+	for name, value := range e.params.Dimensions {
+		record[name] = value
+	}
+	line, err := json.Marshal(record)
+	if err == nil {
+		e.mu.Lock()
+		_, err = e.params.Writer.Write(append(line, '\n'))
+		e.mu.Unlock()
+	}
+	if err != nil && e.params.OnError != nil {
+		e.params.OnError(err)
+	}
+}
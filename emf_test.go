@@ -0,0 +1,94 @@
+// Copyright 2022-2024 The Connect Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package grpchealth
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestEMFExporter(t *testing.T) {
+	const userFQN = "acme.user.v1.UserService"
+	t.Parallel()
+	var out bytes.Buffer
+	exporter, err := NewEMFExporter(EMFParams{
+		Writer:     &out,
+		Dimensions: map[string]string{"Cluster": "prod"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	at := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	exporter.emit(at, userFQN, StatusServing, StatusNotServing)
+
+	var got map[string]any
+	if err := json.Unmarshal(out.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	var expect map[string]any
+	if err := json.Unmarshal([]byte(`{
+		"_aws": {
+			"Timestamp": 1704164645000,
+			"CloudWatchMetrics": [{
+				"Namespace": "grpchealth",
+				"Dimensions": [["Service", "Cluster"]],
+				"Metrics": [
+					{"Name": "Serving", "Unit": "None"},
+					{"Name": "Transitions", "Unit": "Count"}
+				]
+			}]
+		},
+		"Service": "acme.user.v1.UserService",
+		"Cluster": "prod",
+		"Serving": 0,
+		"Transitions": 1,
+		"Status": "not_serving",
+		"PreviousStatus": "serving"
+	}`), &expect); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, expect) {
+		t.Fatalf("got %v, expected %v", got, expect)
+	}
+
+	out.Reset()
+	stream := NewEventStream(1)
+	checker := NewStaticCheckerWithOptions(nil, WithStatusEvents(stream))
+	ctx, cancel := context.WithCancel(context.Background())
+	checker.SetStatus(userFQN, StatusServing)
+	go func() {
+		for len(stream.Events()) > 0 {
+			time.Sleep(time.Millisecond)
+		}
+		cancel()
+	}()
+	_ = exporter.Run(ctx, stream)
+	if !bytes.Contains(out.Bytes(), []byte(`"Serving":1`)) {
+		t.Fatalf("Run didn't export the transition: %s", out.Bytes())
+	}
+}
+
+func TestEMFExporterReservedDimensions(t *testing.T) {
+	t.Parallel()
+	for _, name := range []string{"Service", "Serving", "Transitions", "Status", "PreviousStatus", "_aws"} {
+		if _, err := NewEMFExporter(EMFParams{Dimensions: map[string]string{name: "x"}}); err == nil {
+			t.Errorf("expected an error for dimension %q", name)
+		}
+	}
+}
@@ -0,0 +1,156 @@
+// Copyright 2022-2024 The Connect Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package grpchealth
+
+import (
+	"net/http"
+	"strings"
+
+	"connectrpc.com/connect"
+)
+
+// EnvoyHealthCheckParams configure NewEnvoyHandler.
+type EnvoyHealthCheckParams struct {
+	// Path is the path in Envoy's HTTP health check configuration. The default
+	// is "/healthcheck".
+	Path string
+	// Service is the service to report on. The empty string, the default,
+	// represents the whole process.
+	Service string
+	// ClusterName, if set, is sent in the X-Envoy-Upstream-Healthchecked-Cluster
+	// response header, which Envoy compares with the service_name_matcher of
+	// its health check. This lets Envoy detect that an address now belongs to
+	// a different cluster.
+	ClusterName string
+	// ImmediateFailure sets the X-Envoy-Immediate-Health-Check-Fail header on
+	// failing responses, so Envoy marks the host unhealthy immediately
+	// instead of waiting for its unhealthy threshold.
+	ImmediateFailure bool
+}
+
+// NewEnvoyHandler builds an HTTP handler that answers Envoy's active HTTP
+// health checks from the same Checker as the gRPC health API, so Envoy
+// sidecars and edge proxies can health-check the application without any
+// gRPC-specific configuration. It returns the path on which to mount the
+// handler and the HTTP handler itself.
+//
+// The handler follows the conventions of Envoy's health check filter: it
+// responds with HTTP 200 if the service is StatusServing and 503 otherwise,
+// and it optionally sets the cluster name and immediate-failure headers. It
+// accepts the same options as NewHandler, though only those that apply to
+// Check have any effect.
+func NewEnvoyHandler(checker Checker, params EnvoyHealthCheckParams, options ...connect.HandlerOption) (string, http.Handler) {
+	path := params.Path
+	if path == "" {
+		path = "/healthcheck"
+	}
+	config := newHandlerConfig(options)
+	return path, config.withCORS(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			w.Header().Set("Allow", "GET, HEAD")
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		}
+		ctx := config.withRequestID(r.Context(), r.Header, w.Header())
+		ctx = config.withChannel(ctx, r.Header)
+		ctx = withHTTPRequestInfo(ctx, r)
+		result := config.runCheck(ctx, checker, &CheckRequest{Service: params.Service})
+		code := config.httpStatusCode(result)
+		if params.ClusterName != "" {
+			w.Header().Set("X-Envoy-Upstream-Healthchecked-Cluster", params.ClusterName)
+		}
+		if params.ImmediateFailure && code != http.StatusOK {
+			w.Header().Set("X-Envoy-Immediate-Health-Check-Fail", "true")
+		}
+		config.setBuildHeaders(w.Header())
+		config.setRetryAfter(result, w.Header())
+		config.setStabilityHeaders(w.Header(), checker, result.Service)
+		config.setCacheHeaders(w.Header(), result)
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(code)
+		if r.Method == http.MethodGet {
+			_, _ = w.Write([]byte(result.Status.String() + "\n"))
+		}
+	}))
+}
+
+// EnvoyAdminParams configure NewEnvoyAdminHandler.
+type EnvoyAdminParams struct {
+	// Prefix is the path prefix of the admin endpoints. The default is
+	// "/healthcheck/", which serves "/healthcheck/fail" and
+	// "/healthcheck/ok".
+	Prefix string
+	// Authorize decides whether a request may change the process status,
+	// returning an error to refuse it. If it's nil, every request is refused.
+	// In meshes using mutual TLS, PeerIdentityFromRequest returns the
+	// caller's workload identity.
+	Authorize func(*http.Request) error
+}
+
+// NewEnvoyAdminHandler builds an HTTP handler for failure injection endpoints
+// mirroring Envoy's admin interface, which many runbooks already assume
+// exists: POST /healthcheck/fail sets the process status (the empty service
+// name) to StatusNotServing, draining traffic, and POST /healthcheck/ok sets
+// it back to StatusServing. It returns the path on which to mount the handler
+// and the HTTP handler itself.
+//
+// The endpoints change what every health check reports, so they must only be
+// reachable by operators:
+//
+//	mux.Handle(grpchealth.NewEnvoyAdminHandler(checker, grpchealth.EnvoyAdminParams{
+//		Authorize: func(r *http.Request) error {
+//			if r.Header.Get("Authorization") != "Bearer "+adminToken {
+//				return errors.New("invalid admin token")
+//			}
+//			return nil
+//		},
+//	}))
+func NewEnvoyAdminHandler(setter StatusSetter, params EnvoyAdminParams) (string, http.Handler) {
+	prefix := params.Prefix
+	if prefix == "" {
+		prefix = "/healthcheck/"
+	}
+	if !strings.HasSuffix(prefix, "/") {
+		prefix += "/"
+	}
+	return prefix, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var status Status
+		switch strings.TrimPrefix(r.URL.Path, prefix) {
+		case "fail":
+			status = StatusNotServing
+		case "ok":
+			status = StatusServing
+		default:
+			http.NotFound(w, r)
+			return
+		}
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		}
+		if params.Authorize == nil {
+			http.Error(w, "admin endpoints aren't authorized", http.StatusForbidden)
+			return
+		}
+		if err := params.Authorize(r); err != nil {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+		setter.SetStatus("", status)
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		_, _ = w.Write([]byte("OK\n"))
+	})
+}
@@ -0,0 +1,113 @@
+// Copyright 2022-2024 The Connect Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package grpchealth
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestEnvoyHandler(t *testing.T) {
+	const userFQN = "acme.user.v1.UserService"
+	t.Parallel()
+	checker := NewStaticChecker(userFQN)
+	path, handler := NewEnvoyHandler(checker, EnvoyHealthCheckParams{
+		Service:          userFQN,
+		ClusterName:      "acme-user",
+		ImmediateFailure: true,
+	})
+	if path != "/healthcheck" {
+		t.Fatalf("got path %q, expected default", path)
+	}
+	for _, testCase := range []struct {
+		status    Status
+		code      int
+		immediate string
+	}{
+		{status: StatusServing, code: http.StatusOK},
+		{status: StatusNotServing, code: http.StatusServiceUnavailable, immediate: "true"},
+	} {
+		checker.SetStatus(userFQN, testCase.status)
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set("User-Agent", "Envoy/HC")
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		if rec.Code != testCase.code {
+			t.Fatalf("%v: got HTTP %d, expected %d", testCase.status, rec.Code, testCase.code)
+		}
+		if got := rec.Header().Get("X-Envoy-Upstream-Healthchecked-Cluster"); got != "acme-user" {
+			t.Fatalf("%v: got cluster %q", testCase.status, got)
+		}
+		if got := rec.Header().Get("X-Envoy-Immediate-Health-Check-Fail"); got != testCase.immediate {
+			t.Fatalf("%v: got immediate failure header %q, expected %q", testCase.status, got, testCase.immediate)
+		}
+	}
+}
+
+func TestEnvoyAdminHandler(t *testing.T) {
+	t.Parallel()
+	checker := NewStaticChecker()
+	prefix, handler := NewEnvoyAdminHandler(checker, EnvoyAdminParams{
+		Authorize: func(r *http.Request) error {
+			if r.Header.Get("Authorization") != "Bearer admin" {
+				return errors.New("invalid admin token")
+			}
+			return nil
+		},
+	})
+	serve := func(method, path string, authorized bool) int {
+		req := httptest.NewRequest(method, path, nil)
+		if authorized {
+			req.Header.Set("Authorization", "Bearer admin")
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec.Code
+	}
+	for _, testCase := range []struct {
+		method     string
+		path       string
+		authorized bool
+		code       int
+		expect     Status
+	}{
+		{method: http.MethodPost, path: "fail", code: http.StatusForbidden, expect: StatusServing},
+		{method: http.MethodGet, path: "fail", authorized: true, code: http.StatusMethodNotAllowed, expect: StatusServing},
+		{method: http.MethodPost, path: "stats", authorized: true, code: http.StatusNotFound, expect: StatusServing},
+		{method: http.MethodPost, path: "fail", authorized: true, code: http.StatusOK, expect: StatusNotServing},
+		{method: http.MethodPost, path: "ok", authorized: true, code: http.StatusOK, expect: StatusServing},
+	} {
+		if code := serve(testCase.method, prefix+testCase.path, testCase.authorized); code != testCase.code {
+			t.Fatalf("%s %s: got HTTP %d, expected %d", testCase.method, testCase.path, code, testCase.code)
+		}
+		res, err := checker.Check(context.Background(), &CheckRequest{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.Status != testCase.expect {
+			t.Fatalf("%s %s: got status %v, expected %v", testCase.method, testCase.path, res.Status, testCase.expect)
+		}
+	}
+
+	_, unguarded := NewEnvoyAdminHandler(checker, EnvoyAdminParams{}) //nolint:exhaustruct // missing Authorize is under test
+	rec := httptest.NewRecorder()
+	unguarded.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/healthcheck/fail", nil))
+	if rec.Code != http.StatusForbidden {
+		t.Fatalf("got HTTP %d without Authorize, expected %d", rec.Code, http.StatusForbidden)
+	}
+}
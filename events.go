@@ -0,0 +1,139 @@
+// Copyright 2022-2024 The Connect Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package grpchealth
+
+import (
+	"sync/atomic"
+	"time"
+
+	"connectrpc.com/connect"
+)
+
+// EventKind identifies the kind of an Event.
+type EventKind uint8
+
+const (
+	// EventStatusChanged reports that SetStatus changed a service's status on
+	// a StaticChecker, including the first time a service is registered.
+	EventStatusChanged EventKind = iota + 1
+	// EventWatchStarted reports that a Watch stream started.
+	EventWatchStarted
+	// EventWatchEnded reports that a Watch stream ended.
+	EventWatchEnded
+	// EventCheckFailed reports that a Checker returned an error.
+	EventCheckFailed
+)
+
+// String implements fmt.Stringer.
+func (k EventKind) String() string {
+	switch k {
+	case EventStatusChanged:
+		return "status_changed"
+	case EventWatchStarted:
+		return "watch_started"
+	case EventWatchEnded:
+		return "watch_ended"
+	case EventCheckFailed:
+		return "check_failed"
+	default:
+		return "unknown"
+	}
+}
+
+// Event is a record of something that happened in the health subsystem.
+// Fields that don't apply to the event's kind are zero.
+type Event struct {
+	// Kind is what happened.
+	Kind EventKind
+	// Time is when it happened.
+	Time time.Time
+	// Service is the service involved. The empty string represents the whole
+	// process.
+	Service string
+	// Status is the new status, for EventStatusChanged.
+	Status Status
+	// Previous is the old status, for EventStatusChanged. It's StatusUnknown
+	// when a service is first registered.
+	Previous Status
+	// Err is the error that ended a Watch stream or failed a check.
+	Err error
+	// Peer describes the client, for Watch events.
+	Peer connect.Peer
+	// RequestID identifies the request, if a handler attached one with
+	// WithRequestIDHeader.
+	RequestID string
+}
+
+// EventStream collects events from handlers and StaticCheckers into a single
+// channel, so applications can audit the health subsystem without wiring many
+// individual hooks. Register it with WithHandlerEvents and WithStatusEvents.
+//
+// Sending never blocks the health subsystem: if the channel's buffer is full,
+// the event is dropped and counted instead.
+type EventStream struct {
+	events  chan Event
+	dropped atomic.Uint64
+}
+
+// NewEventStream constructs an EventStream whose channel buffers up to size
+// events.
+func NewEventStream(size int) *EventStream {
+	return &EventStream{events: make(chan Event, size)}
+}
+
+// Events returns the channel of events. It's never closed.
+func (s *EventStream) Events() <-chan Event {
+	return s.events
+}
+
+// Dropped returns the number of events dropped because the buffer was full.
+func (s *EventStream) Dropped() uint64 {
+	return s.dropped.Load()
+}
+
+// emit sends an event. Callers set its Time from their Clock.
+func (s *EventStream) emit(event Event) {
+	if s == nil {
+		return
+	}
+	select {
+	case s.events <- event:
+	default:
+		s.dropped.Add(1)
+	}
+}
+
+// WithHandlerEvents makes handlers report Watch streams starting and ending,
+// and Checkers returning errors, to the EventStream.
+func WithHandlerEvents(stream *EventStream) HandlerOption {
+	return newHandlerOption(func(config *handlerConfig) {
+		config.Events = stream
+	})
+}
+
+// WithStatusEvents makes a StaticChecker report status changes to the
+// EventStream. Changes in a service's status caused by its dependencies (see
+// StaticChecker.SetDependencies) aren't reported separately.
+func WithStatusEvents(stream *EventStream) StaticCheckerOption {
+	return &statusEventsOption{stream: stream}
+}
+
+type statusEventsOption struct {
+	stream *EventStream
+}
+
+func (o *statusEventsOption) applyToStaticChecker(checker *StaticChecker) {
+	checker.events = o.stream
+}
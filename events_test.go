@@ -0,0 +1,72 @@
+// Copyright 2022-2024 The Connect Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package grpchealth
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestEventStream(t *testing.T) {
+	const userFQN = "acme.user.v1.UserService"
+	t.Parallel()
+	stream := NewEventStream(16)
+	checker := NewStaticCheckerWithOptions(nil, WithStatusEvents(stream))
+	checker.SetStatus(userFQN, StatusServing)
+	checker.SetStatus(userFQN, StatusServing) // unchanged, so no event
+	checker.SetStatus(userFQN, StatusNotServing)
+
+	mux := http.NewServeMux()
+	mux.Handle(NewHandler(checker, WithHandlerEvents(stream)))
+	server := httptest.NewUnstartedServer(mux)
+	server.EnableHTTP2 = true
+	server.StartTLS()
+	t.Cleanup(server.Close)
+	receive := newTestWatch(t, server, userFQN)
+	receive(StatusNotServing)
+	client := NewClient(server.URL, WithHTTPClient(server.Client()))
+	if _, err := client.Check(context.Background(), &CheckRequest{Service: "unknown"}); err == nil {
+		t.Fatal("expected error for unknown service")
+	}
+
+	expect := []struct {
+		kind     EventKind
+		status   Status
+		previous Status
+	}{
+		{kind: EventStatusChanged, status: StatusServing, previous: StatusUnknown},
+		{kind: EventStatusChanged, status: StatusNotServing, previous: StatusServing},
+		{kind: EventWatchStarted},
+		{kind: EventCheckFailed},
+	}
+	for _, want := range expect {
+		event := <-stream.Events()
+		if event.Kind != want.kind || event.Status != want.status || event.Previous != want.previous {
+			t.Fatalf("got event %+v, expected %v from %v to %v", event, want.kind, want.previous, want.status)
+		}
+		if event.Time.IsZero() {
+			t.Fatalf("got event %v without time", event.Kind)
+		}
+	}
+
+	full := NewEventStream(1)
+	full.emit(Event{Kind: EventCheckFailed})
+	full.emit(Event{Kind: EventCheckFailed})
+	if got := full.Dropped(); got != 1 {
+		t.Fatalf("dropped %d events, expected 1", got)
+	}
+}
@@ -6,5 +6,9 @@ retract v1.1.1 // module cache poisoned, use v1.1.2
 
 require (
 	connectrpc.com/connect v1.11.0
+	golang.org/x/net v0.35.0
+	golang.org/x/sys v0.30.0
 	google.golang.org/protobuf v1.33.0
 )
+
+require golang.org/x/text v0.22.0 // indirect
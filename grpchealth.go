@@ -27,10 +27,15 @@ package grpchealth
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"net/http"
+	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"connectrpc.com/connect"
 	healthv1 "connectrpc.com/grpchealth/internal/gen/go/connectext/grpc/health/v1"
@@ -53,6 +58,11 @@ const (
 	// not accepting requests. For example, StatusNotServing is often appropriate
 	// when your primary database is down or unreachable.
 	StatusNotServing Status = 2
+
+	// StatusServiceUnknown indicates that the requested service isn't known to
+	// the Checker. Watch reports unknown services with this status, but Check
+	// usually reports them with a connect.CodeNotFound error instead.
+	StatusServiceUnknown Status = 3
 )
 
 // String representation of the status.
@@ -64,62 +74,287 @@ func (s Status) String() string {
 		return "serving"
 	case StatusNotServing:
 		return "not_serving"
+	case StatusServiceUnknown:
+		return "service_unknown"
 	}
 
 	return fmt.Sprintf("status_%d", s)
 }
 
+// ParseStatus parses a Status from its string representation. It also accepts
+// the names of gRPC's ServingStatus enum values (for example, "NOT_SERVING"),
+// ignoring case.
+func ParseStatus(text string) (Status, error) {
+	normalized := strings.ToLower(text)
+	switch normalized {
+	case "unknown":
+		return StatusUnknown, nil
+	case "serving":
+		return StatusServing, nil
+	case "not_serving":
+		return StatusNotServing, nil
+	case "service_unknown":
+		return StatusServiceUnknown, nil
+	}
+	if number, ok := strings.CutPrefix(normalized, "status_"); ok {
+		if parsed, err := strconv.ParseUint(number, 10, 8); err == nil {
+			return Status(parsed), nil
+		}
+	}
+	return StatusUnknown, fmt.Errorf("invalid status %q", text)
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (s Status) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler, using ParseStatus.
+func (s *Status) UnmarshalText(text []byte) error {
+	status, err := ParseStatus(string(text))
+	if err != nil {
+		return err
+	}
+	*s = status
+	return nil
+}
+
+// MarshalJSON implements json.Marshaler. Statuses are encoded as JSON strings.
+func (s Status) MarshalJSON() ([]byte, error) {
+	return json.Marshal(s.String())
+}
+
+// UnmarshalJSON implements json.Unmarshaler. It accepts strings understood by
+// ParseStatus and, like protobuf's JSON mapping, numbers.
+func (s *Status) UnmarshalJSON(data []byte) error {
+	var number uint8
+	if err := json.Unmarshal(data, &number); err == nil {
+		*s = Status(number)
+		return nil
+	}
+	var text string
+	if err := json.Unmarshal(data, &text); err != nil {
+		return fmt.Errorf("invalid status %s", data)
+	}
+	return s.UnmarshalText([]byte(text))
+}
+
 // NewHandler wraps the supplied Checker to build an HTTP handler for gRPC's
 // health-checking API. It returns the path on which to mount the handler and
 // the HTTP handler itself.
 //
-// Note that the returned handler only supports the unary Check method, not the
-// streaming Watch. As suggested in gRPC's health schema, it returns
-// connect.CodeUnimplemented for the Watch method.
+// If the Checker also implements Watcher, the handler supports the streaming
+// Watch method. Otherwise, as suggested in gRPC's health schema, it returns
+// connect.CodeUnimplemented for Watch. Similarly, the handler supports the
+// unary List method only if the Checker implements Lister.
+//
+// The options may include both connect.HandlerOptions and this package's
+// HandlerOptions.
 //
 // For more details on gRPC's health checking protocol, see
 // https://github.com/grpc/grpc/blob/master/doc/health-checking.md and
 // https://github.com/grpc/grpc/blob/master/src/proto/grpc/health/v1/health.proto.
 func NewHandler(checker Checker, options ...connect.HandlerOption) (string, http.Handler) {
-	const serviceName = "/grpc.health.v1.Health/"
+	config := newHandlerConfig(options)
 	mux := http.NewServeMux()
-	check := connect.NewUnaryHandler(
-		serviceName+"Check",
+	checkPath, check := NewCheckHandler(checker, options...)
+	watchPath, watch := NewWatchHandler(checker, options...)
+	listPath, list := NewListHandler(checker, options...)
+	mux.Handle(checkPath, check)
+	mux.Handle(watchPath, watch)
+	mux.Handle(listPath, list)
+	if config.PathPrefix != "" {
+		mux.Handle(config.PathPrefix+checkPath, check)
+		mux.Handle(config.PathPrefix+watchPath, watch)
+		mux.Handle(config.PathPrefix+listPath, list)
+	}
+	return "/" + HealthV1ServiceName + "/", mux
+}
+
+// NewCheckHandler builds an HTTP handler for only the unary Check method of
+// gRPC's health-checking API. It returns the path on which to mount the
+// handler and the HTTP handler itself.
+//
+// Check has no side effects, so the handler also supports Connect's GET
+// requests, which can be cached and issued by simple HTTP probes.
+//
+// Most users should prefer NewHandler. NewCheckHandler and NewWatchHandler are
+// useful with routers that can't mount a handler on a path prefix.
+func NewCheckHandler(checker Checker, options ...connect.HandlerOption) (string, http.Handler) {
+	const procedure = "/" + HealthV1ServiceName + "/Check"
+	config := newHandlerConfig(options)
+	var handler http.Handler = connect.NewUnaryHandler(
+		procedure,
 		func(
 			ctx context.Context,
 			req *connect.Request[healthv1.HealthCheckRequest],
 		) (*connect.Response[healthv1.HealthCheckResponse], error) {
-			var checkRequest CheckRequest
-			if req.Msg != nil {
-				checkRequest.Service = req.Msg.Service
+			var responseHeader http.Header
+			if config.RequestIDHeader != "" {
+				responseHeader = make(http.Header)
 			}
-			checkResponse, err := checker.Check(ctx, &checkRequest)
-			if err != nil {
-				return nil, err
+			ctx = config.withRequestID(ctx, req.Header(), responseHeader)
+			ctx = config.withChannel(ctx, req.Header())
+			ctx = withRequestInfo(ctx, req.Header(), req.Peer())
+			result := config.runCheck(ctx, checker, newCheckRequest(req))
+			if result.Err != nil {
+				return nil, config.echoRequestID(ctx, result.Err)
+			}
+			recordStatus(ctx, result.Status)
+			if config.NotServingCode != 0 && result.Status != StatusServing {
+				err := connect.NewError(config.NotServingCode, fmt.Errorf("service %q is %v", result.Service, result.Status))
+				config.setRetryAfter(result, err.Meta())
+				config.setStabilityHeaders(err.Meta(), checker, result.Service)
+				if req.HTTPMethod() == http.MethodGet {
+					config.setCacheHeaders(err.Meta(), result)
+				}
+				if detail := config.retryInfo(result); detail != nil {
+					err.AddDetail(detail)
+				}
+				return nil, config.echoRequestID(ctx, err)
+			}
+			res := connect.NewResponse(config.healthCheckResponse(result.Status))
+			for key, values := range responseHeader {
+				res.Header()[key] = values
+			}
+			config.setRetryAfter(result, res.Header())
+			config.setBuildHeaders(res.Header())
+			config.setStabilityHeaders(res.Header(), checker, result.Service)
+			if req.HTTPMethod() == http.MethodGet {
+				config.setCacheHeaders(res.Header(), result)
 			}
-			return connect.NewResponse(&healthv1.HealthCheckResponse{
-				Status: healthv1.HealthCheckResponse_ServingStatus(checkResponse.Status),
-			}), nil
+			return res, nil
 		},
-		options...,
+		append([]connect.HandlerOption{connect.WithIdempotency(connect.IdempotencyNoSideEffects)}, options...)...,
 	)
-	mux.Handle(serviceName+"Check", check)
-	watch := connect.NewServerStreamHandler(
-		serviceName+"Watch",
+	if len(config.HTTPStatusCodes) > 0 {
+		handler = config.mapGETStatusCodes(handler)
+	}
+	if config.EmptyCheckRequests {
+		handler = acceptEmptyRequests(handler)
+	}
+	return procedure, config.withCORS(config.restrictProtocols(attachPeerIdentity(handler)))
+}
+
+// NewWatchHandler builds an HTTP handler for only the streaming Watch method
+// of gRPC's health-checking API. It returns the path on which to mount the
+// handler and the HTTP handler itself. If the Checker doesn't implement
+// Watcher, the handler returns connect.CodeUnimplemented.
+func NewWatchHandler(checker Checker, options ...connect.HandlerOption) (string, http.Handler) {
+	const procedure = "/" + HealthV1ServiceName + "/Watch"
+	config := newHandlerConfig(options)
+	return procedure, config.withCORS(config.restrictProtocols(attachPeerIdentity(connect.NewServerStreamHandler(
+		procedure,
 		func(
-			_ context.Context,
-			_ *connect.Request[healthv1.HealthCheckRequest],
-			_ *connect.ServerStream[healthv1.HealthCheckResponse],
+			ctx context.Context,
+			req *connect.Request[healthv1.HealthCheckRequest],
+			stream *connect.ServerStream[healthv1.HealthCheckResponse],
 		) error {
-			return connect.NewError(
-				connect.CodeUnimplemented,
-				errors.New("connect doesn't support watching health state"),
-			)
+			watcher, ok := checker.(Watcher)
+			if !ok {
+				return connect.NewError(
+					connect.CodeUnimplemented,
+					errors.New("connect doesn't support watching health state"),
+				)
+			}
+			ctx = config.withRequestID(ctx, req.Header(), stream.ResponseHeader())
+			ctx = config.withChannel(ctx, req.Header())
+			ctx = withRequestInfo(ctx, req.Header(), req.Peer())
+			if config.WatchQuota != nil {
+				release, err := config.WatchQuota.acquire(req.Peer(), req.Header())
+				if err != nil {
+					return config.echoRequestID(ctx, err)
+				}
+				defer release()
+			}
+			checkRequest := newCheckRequest(req)
+			info := &WatchInfo{Service: checkRequest.Service, Peer: req.Peer()}
+			if hook := config.WatchHooks.OnWatchStart; hook != nil {
+				hook(ctx, info)
+			}
+			handleStats(ctx, config.StatsHandlers, &WatchBegin{Info: info, Time: config.Clock.Now()})
+			requestID, _ := RequestIDFromContext(ctx)
+			config.Events.emit(Event{
+				Kind:      EventWatchStarted,
+				Time:      config.Clock.Now(),
+				Service:   info.Service,
+				Peer:      info.Peer,
+				RequestID: requestID,
+			})
+			watchCtx, send, finish := config.queueWatchUpdates(ctx, func(res *CheckResponse) error {
+				if err := stream.Send(config.healthCheckResponse(res.Status)); err != nil {
+					return err
+				}
+				res.markSent()
+				return nil
+			})
+			settings := config.forWatch(checkRequest.Service)
+			send, stopHeartbeat := settings.heartbeatWatchUpdates(send)
+			send, stopDelay := settings.delayWatchUpdates(send)
+			err := watcher.Watch(withSendReports(watchCtx), checkRequest, send)
+			stopDelay()
+			stopHeartbeat()
+			err = finish(err)
+			if hook := config.WatchHooks.OnWatchEnd; hook != nil {
+				hook(ctx, info, err)
+			}
+			handleStats(ctx, config.StatsHandlers, &WatchEnd{Info: info, Err: err, Time: config.Clock.Now()})
+			config.Events.emit(Event{
+				Kind:      EventWatchEnded,
+				Time:      config.Clock.Now(),
+				Service:   info.Service,
+				Err:       err,
+				Peer:      info.Peer,
+				RequestID: requestID,
+			})
+			return err
 		},
 		options...,
-	)
-	mux.Handle(serviceName+"Watch", watch)
-	return serviceName, mux
+	))))
+}
+
+// NewListHandler builds an HTTP handler for only the unary List method of
+// gRPC's health-checking API. It returns the path on which to mount the
+// handler and the HTTP handler itself. If the Checker doesn't implement Lister,
+// the handler returns connect.CodeUnimplemented.
+func NewListHandler(checker Checker, options ...connect.HandlerOption) (string, http.Handler) {
+	const procedure = "/" + HealthV1ServiceName + "/List"
+	config := newHandlerConfig(options)
+	return procedure, config.withCORS(config.restrictProtocols(attachPeerIdentity(connect.NewUnaryHandler(
+		procedure,
+		func(
+			ctx context.Context,
+			req *connect.Request[healthv1.HealthListRequest],
+		) (*connect.Response[healthv1.HealthListResponse], error) {
+			responseHeader := make(http.Header)
+			ctx = config.withRequestID(ctx, req.Header(), responseHeader)
+			ctx = config.withChannel(ctx, req.Header())
+			ctx = withRequestInfo(ctx, req.Header(), req.Peer())
+			lister, ok := checker.(Lister)
+			if !ok {
+				return nil, connect.NewError(
+					connect.CodeUnimplemented,
+					errors.New("checker doesn't support listing services"),
+				)
+			}
+			statuses, err := lister.List(ctx)
+			if err != nil {
+				return nil, config.echoRequestID(ctx, err)
+			}
+			res := &healthv1.HealthListResponse{
+				Statuses: make(map[string]*healthv1.HealthCheckResponse, len(statuses)),
+			}
+			for service, status := range statuses {
+				res.Statuses[service] = newHealthCheckResponse(status)
+			}
+			response := connect.NewResponse(res)
+			for key, values := range responseHeader {
+				response.Header()[key] = values
+			}
+			return response, nil
+		},
+		options...,
+	))))
 }
 
 // CheckRequest is a request for the health of a service. When using protobuf,
@@ -132,14 +367,34 @@ type CheckRequest struct {
 
 // CheckResponse reports the health of a service (or of the whole process). The
 // only valid Status values are StatusUnknown, StatusServing, and
-// StatusNotServing. When asked to report on the status of an unknown service,
-// Checkers should return a connect.CodeNotFound error.
+// StatusNotServing; Watchers may also report StatusServiceUnknown. When asked
+// to report on the status of an unknown service, Checkers should return a
+// connect.CodeNotFound error.
 //
 // Often, systems monitoring health respond to errors by restarting the
 // process. They often respond to StatusNotServing by removing the process from
 // a load balancer pool.
+//
+// Details optionally describes what the Checker observed (for example, the
+// replication lag of a database). They're only exposed through this package's
+// local APIs, such as RunCheck and NewHTTPHandler, and aren't sent over the
+// wire by gRPC's health-checking API.
+//
+// RetryAfter optionally estimates how long a service that isn't serving needs
+// to recover, for example during a maintenance window. Handlers built with
+// WithRetryAfterHints pass it on to clients.
+//
+// Previous is set by Watchers: it's the status reported by the preceding
+// update of the same Watch call, or StatusUnknown in the first update, so
+// consumers can record transitions without caching the last status they saw.
+// Like Details, it isn't sent over the wire, and Checkers leave it unset.
 type CheckResponse struct {
-	Status Status
+	Status     Status
+	Details    map[string]string
+	RetryAfter time.Duration
+	Previous   Status
+
+	sent func() // see markSent
 }
 
 // A Checker reports the health of a service. It must be safe to call
@@ -148,16 +403,179 @@ type Checker interface {
 	Check(context.Context, *CheckRequest) (*CheckResponse, error)
 }
 
+// A StatusSetter sets the health status of services. StaticChecker is the
+// most common StatusSetter, but applications may supply their own to
+// components that drive health automatically. It must be safe to call
+// concurrently.
+type StatusSetter interface {
+	SetStatus(service string, status Status)
+}
+
+// A Watcher is a Checker that can also stream changes to a service's health.
+// Handlers built from a Watcher support gRPC's streaming Watch method.
+//
+// Watch should call update once with the current health of the requested
+// service, and again each time it changes. If the service is unknown, Watch
+// should report StatusServiceUnknown rather than returning an error, and keep
+// watching in case the service is registered later. Watch blocks until the
+// context is canceled or update returns an error, and it returns that error.
+type Watcher interface {
+	Checker
+
+	Watch(ctx context.Context, req *CheckRequest, update func(*CheckResponse) error) error
+}
+
+// A Lister is a Checker that can also report the health of every service it
+// knows about. Handlers built from a Lister support gRPC's List method.
+//
+// List returns a snapshot of the health of all services, keyed by service
+// name. The empty service name represents the whole process.
+type Lister interface {
+	Checker
+
+	List(context.Context) (map[string]Status, error)
+}
+
 // StaticChecker is a simple Checker implementation. It always returns
 // StatusServing for the process, and it returns a static value for each
 // service.
 //
+// StaticChecker also implements Watcher and Lister, so handlers built from it
+// support the streaming Watch method and the List method.
+//
 // If you have a dynamic list of services, want to ping a database as part of
 // your health check, or otherwise need something more specialized, you should
 // write a custom Checker implementation.
 type StaticChecker struct {
-	mu       sync.RWMutex
-	statuses map[string]Status
+	aggregate    bool
+	tenants      bool
+	validate     bool
+	invalidName  func(error)
+	unregistered UnregisteredPolicy
+	events       *EventStream
+	stats        []StatsHandler
+	store        StatusStore
+	storeErr     func(error)
+	storeTimeout time.Duration
+
+	maxWatchers int
+	sweepEvery  time.Duration
+	clock       Clock
+
+	saves        saveQueue
+	mu           sync.RWMutex
+	statuses     map[string]Status
+	dependencies map[string][]string
+	overrides    map[string]*StatusOverride
+	watchers     map[string]map[chan struct{}]context.Context
+	watcherCount int
+	lastSweep    time.Time
+	swept        uint64
+	rejected     uint64
+	sets         uint64 // calls to SetStatus; see LoadStore
+	counters     map[string]*serviceCounters
+	propagations map[string]*propagation
+	changes      chan struct{} // closed on the next change; see changed
+}
+
+// ServiceStats describe the activity of a service registered with a
+// StaticChecker.
+type ServiceStats struct {
+	// Status is the current status of the service.
+	Status Status
+	// ActiveWatchers is the number of open Watch streams for the service.
+	ActiveWatchers int
+	// Checks is the total number of times the service has been checked.
+	Checks uint64
+	// Transitions is the total number of times SetStatus has changed the
+	// service's status.
+	Transitions uint64
+	// LastTransition is when SetStatus last changed the service's status, or
+	// first set it. It's zero if SetStatus has never been called for the
+	// service.
+	LastTransition time.Time
+}
+
+// NotifierStats describe the state a StaticChecker keeps to notify watchers.
+type NotifierStats struct {
+	// Watchers is the number of Watch calls in progress, including swept
+	// calls that haven't yet returned.
+	Watchers int
+	// Services is the number of services with at least one registered Watch
+	// call.
+	Services int
+	// Swept is the total number of watchers removed because their context
+	// ended before Watch returned, typically because update was blocked
+	// writing to a dead stream.
+	Swept uint64
+	// Rejected is the total number of Watch calls rejected because the
+	// checker already had the maximum number of watchers.
+	Rejected uint64
+}
+
+// A StaticCheckerOption configures a StaticChecker.
+type StaticCheckerOption interface {
+	applyToStaticChecker(*StaticChecker)
+}
+
+// WithAggregatedProcessStatus makes the status of the whole process (the
+// empty service name) the worst status of all registered services, including
+// any status set explicitly for the process. StatusNotServing is worse than
+// StatusUnknown, which is worse than StatusServing.
+//
+// With aggregation enabled, Watch for the empty service name sends a new
+// status whenever the aggregate changes, so orchestration systems can
+// subscribe to the overall health of the process.
+func WithAggregatedProcessStatus() StaticCheckerOption {
+	return &aggregateOption{}
+}
+
+// UnregisteredPolicy controls how a StaticChecker reports the health of
+// services that haven't been registered.
+type UnregisteredPolicy uint8
+
+const (
+	// UnregisteredNotFound makes Check return a connect.CodeNotFound error for
+	// unregistered services, and Watch report StatusServiceUnknown. This is the
+	// default, and it matches gRPC's health-checking protocol.
+	UnregisteredNotFound UnregisteredPolicy = iota
+
+	// UnregisteredServiceUnknown makes both Check and Watch report
+	// StatusServiceUnknown for unregistered services.
+	UnregisteredServiceUnknown
+
+	// UnregisteredInheritProcess makes unregistered services report the
+	// status of the whole process. Multi-tenant gateways, which may not know
+	// every service name in advance, often prefer this to errors.
+	UnregisteredInheritProcess
+)
+
+// WithUnregisteredPolicy sets how the StaticChecker reports the health of
+// services that haven't been registered. The default is UnregisteredNotFound.
+func WithUnregisteredPolicy(policy UnregisteredPolicy) StaticCheckerOption {
+	return &unregisteredOption{policy: policy}
+}
+
+// WithMaxWatchers limits the number of concurrent Watch calls. Once the limit
+// is reached, Watch returns a connect.CodeResourceExhausted error, which
+// protects servers with churny or misbehaving probe clients from unbounded
+// memory growth. Calls count toward the limit until they return, even once
+// they've been swept (see WithWatcherSweepInterval). By default, the number
+// of watchers is unlimited.
+func WithMaxWatchers(limit int) StaticCheckerOption {
+	return &maxWatchersOption{limit: limit}
+}
+
+// WithWatcherSweepInterval sets how often the StaticChecker stops notifying
+// watchers whose context has ended but whose Watch call hasn't yet returned,
+// such as watchers blocked writing to a dead stream, so status changes no
+// longer wake them or wait on them to report propagation. Swept calls still
+// hold their goroutine, so they count toward WithMaxWatchers until they
+// return. Sweeps happen as new watchers register, so they cost nothing while
+// the set of watchers is stable. The default is one minute; a negative
+// interval disables sweeping.
+func WithWatcherSweepInterval(interval time.Duration) StaticCheckerOption {
+	return &sweepIntervalOption{interval: interval}
 }
 
 // NewStaticChecker constructs a StaticChecker. By default, each of the
@@ -167,38 +585,534 @@ type StaticChecker struct {
 // example, "acme.user.v1.UserService"). Generated Connect service files
 // have this declared as a constant.
 func NewStaticChecker(services ...string) *StaticChecker {
+	return NewStaticCheckerWithOptions(services)
+}
+
+// NewStaticCheckerWithOptions constructs a StaticChecker, like
+// NewStaticChecker, and applies the supplied options.
+func NewStaticCheckerWithOptions(services []string, options ...StaticCheckerOption) *StaticChecker {
 	statuses := make(map[string]Status, len(services))
+	counters := make(map[string]*serviceCounters, len(services)+1)
+	counters[""] = &serviceCounters{}
 	for _, service := range services {
 		statuses[service] = StatusServing
+		counters[service] = &serviceCounters{}
+	}
+	checker := &StaticChecker{
+		storeTimeout: 5 * time.Second,
+		sweepEvery:   time.Minute,
+		statuses:     statuses,
+		watchers:     make(map[string]map[chan struct{}]context.Context),
+		counters:     counters,
+		clock:        systemClock{},
 	}
-	return &StaticChecker{statuses: statuses}
+	for _, opt := range options {
+		opt.applyToStaticChecker(checker)
+	}
+	for _, service := range services {
+		if err := checker.validateService(service); err != nil {
+			panic(err) //nolint:forbidigo // a malformed service list is a programming error
+		}
+	}
+	checker.lastSweep = checker.clock.Now()
+	return checker
 }
 
 // SetStatus sets the health status of a service, registering a new service if
-// necessary. It's safe to call SetStatus and Check concurrently.
+// necessary. It's safe to call SetStatus, Check, and Watch concurrently.
 //
 // If the given service name is empty, it sets a server-wide status that is
 // returned to check requests that do not request a particular service. If no
 // such status is ever set, checks that do not request a particular service
 // will get a response of StatusServing.
+//
+// With WithServiceNameValidation, SetStatus ignores invalid service names and
+// reports them to the option's error handler.
 func (c *StaticChecker) SetStatus(service string, status Status) {
+	if err := c.validateService(service); err != nil {
+		if c.invalidName != nil {
+			c.invalidName(err)
+		}
+		return
+	}
 	c.mu.Lock()
-	defer c.mu.Unlock()
+	c.setStatus(service, status)
+	c.sets++
+	c.counters[service].lastSet = c.sets
+	if c.store != nil {
+		// Queue the save while holding mu, so the latest status queued for a
+		// service is the latest one applied.
+		c.saves.push(service, status, c.saveStatuses)
+	}
+	c.mu.Unlock()
+}
+
+// setStatus sets the status of a service and notifies its watchers. The caller
+// must hold c.mu for writing.
+func (c *StaticChecker) setStatus(service string, status Status) {
+	previous, registered := c.statuses[service]
+	if !registered && service == "" {
+		previous, registered = StatusServing, true
+	}
+	counters := c.counters[service]
+	if counters == nil {
+		counters = &serviceCounters{}
+		c.counters[service] = counters
+	}
+	if registered && previous != status {
+		counters.transitions++
+	}
+	if !registered || previous != status {
+		counters.lastTransition = c.clock.Now()
+		c.transition(service, previous, status)
+	}
+	before, _ := c.status(service)
 	c.statuses[service] = status
+	if after, _ := c.status(service); after != before {
+		c.startPropagation(service, after)
+	}
+	c.notifyChanged(service)
+}
+
+// transition reports a change in a service's status. The caller must hold c.mu.
+func (c *StaticChecker) transition(service string, previous, status Status) {
+	c.events.emit(Event{
+		Kind:     EventStatusChanged,
+		Time:     c.clock.Now(),
+		Service:  service,
+		Status:   status,
+		Previous: previous,
+	})
+	if len(c.stats) > 0 {
+		handleStats(context.Background(), c.stats, &Transition{
+			Service:  service,
+			Previous: previous,
+			Status:   status,
+			Time:     c.clock.Now(),
+		})
+	}
+}
+
+// SetDependencies declares that a service depends on others, replacing any
+// dependencies declared previously. Dependencies may be registered before or
+// after the service.
+//
+// A service with dependencies reports the worst of its own status and the
+// statuses of its registered dependencies, transitively: when a foundational
+// service becomes StatusNotServing, every service that depends on it does
+// too, in the same instant, and watchers of each are notified. Setting the
+// foundational service back to StatusServing restores the dependents' own
+// statuses.
+//
+// SetDependencies returns an error if the dependencies would form a cycle.
+func (c *StaticChecker) SetDependencies(service string, dependencies ...string) error {
+	for _, name := range append([]string{service}, dependencies...) {
+		if err := c.validateService(name); err != nil {
+			return err
+		}
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, dependency := range dependencies {
+		if dependency == service || c.dependsOn(dependency, service) {
+			return fmt.Errorf("dependency of %q on %q would form a cycle", service, dependency)
+		}
+	}
+	if c.dependencies == nil {
+		c.dependencies = make(map[string][]string)
+	}
+	if len(dependencies) == 0 {
+		delete(c.dependencies, service)
+	} else {
+		c.dependencies[service] = append([]string(nil), dependencies...)
+	}
+	c.notify(service)
+	c.notifyDependents(service)
+	if c.aggregate {
+		c.notify("")
+	}
+	c.signalChange()
+	return nil
 }
 
 // Check implements Checker. It's safe to call concurrently with SetStatus.
 func (c *StaticChecker) Check(_ context.Context, req *CheckRequest) (*CheckResponse, error) {
+	if err := c.validateService(req.Service); err != nil {
+		return nil, err
+	}
 	c.mu.RLock()
 	defer c.mu.RUnlock()
-	if status, registered := c.statuses[req.Service]; registered {
-		return &CheckResponse{Status: status}, nil
+	if counters := c.counters[req.Service]; counters != nil {
+		counters.checks.Add(1)
 	}
-	if req.Service == "" {
-		return &CheckResponse{Status: StatusServing}, nil
+	if status, known := c.status(req.Service); known {
+		return &CheckResponse{Status: status}, nil
 	}
 	return nil, connect.NewError(
 		connect.CodeNotFound,
 		fmt.Errorf("unknown service %s", req.Service),
 	)
 }
+
+// Watch implements Watcher. It's safe to call concurrently with SetStatus.
+//
+// Rapid changes are coalesced: if the status changes several times before
+// update returns, only the latest status is sent. If the checker was
+// constructed with WithMaxWatchers and already has that many watchers, Watch
+// returns a connect.CodeResourceExhausted error.
+func (c *StaticChecker) Watch(ctx context.Context, req *CheckRequest, update func(*CheckResponse) error) error {
+	if err := c.validateService(req.Service); err != nil {
+		return err
+	}
+	changed := make(chan struct{}, 1)
+	c.mu.Lock()
+	if c.sweepEvery >= 0 && c.clock.Now().Sub(c.lastSweep) >= c.sweepEvery {
+		c.sweep()
+	}
+	if c.maxWatchers > 0 && c.watcherCount >= c.maxWatchers {
+		c.rejected++
+		c.mu.Unlock()
+		return connect.NewError(
+			connect.CodeResourceExhausted,
+			fmt.Errorf("too many watchers (limit %d)", c.maxWatchers),
+		)
+	}
+	if c.watchers[req.Service] == nil {
+		c.watchers[req.Service] = make(map[chan struct{}]context.Context)
+	}
+	c.watchers[req.Service][changed] = ctx
+	c.watcherCount++
+	c.mu.Unlock()
+	defer func() {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		c.unregisterWatcher(req.Service, changed)
+		c.watcherCount--
+	}()
+
+	var (
+		sent bool
+		last Status
+	)
+	for {
+		c.mu.RLock()
+		status, known := c.status(req.Service)
+		c.mu.RUnlock()
+		if !known {
+			status = StatusServiceUnknown
+		}
+		if !sent || status != last {
+			res := &CheckResponse{Status: status, Previous: last}
+			// Handlers may delay the update, so they report when it's
+			// actually sent.
+			reported := len(c.stats) > 0 && reportsSends(ctx)
+			if reported {
+				delivered := status
+				res.sent = func() { c.delivered(req.Service, changed, delivered) }
+			}
+			if err := update(res); err != nil {
+				return err
+			}
+			sent, last = true, status
+			if !reported {
+				c.delivered(req.Service, changed, status)
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-changed:
+		}
+	}
+}
+
+// List implements Lister. The returned map includes every registered service
+// and the process as a whole.
+func (c *StaticChecker) List(_ context.Context) (map[string]Status, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	statuses := make(map[string]Status, len(c.statuses)+1)
+	for service := range c.statuses {
+		statuses[service], _ = c.status(service)
+	}
+	statuses[""], _ = c.status("")
+	return statuses, nil
+}
+
+// Registered reports whether a service is registered: whether it was passed
+// to the constructor or its status has been set. The process as a whole, the
+// empty service name, is always registered.
+func (c *StaticChecker) Registered(service string) bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	_, ok := c.statuses[service]
+	return ok || service == ""
+}
+
+// Stats reports the activity of the process, each registered service, and
+// each service with active watchers, keyed by service name.
+func (c *StaticChecker) Stats() map[string]ServiceStats {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	stats := make(map[string]ServiceStats, len(c.counters))
+	for service, counters := range c.counters {
+		status, _ := c.status(service)
+		stats[service] = ServiceStats{
+			Status:         status,
+			ActiveWatchers: len(c.watchers[service]),
+			Checks:         counters.checks.Load(),
+			Transitions:    counters.transitions,
+			LastTransition: counters.lastTransition,
+		}
+	}
+	for service, watchers := range c.watchers {
+		if _, ok := stats[service]; ok {
+			continue
+		}
+		status, known := c.status(service)
+		if !known {
+			status = StatusServiceUnknown
+		}
+		stats[service] = ServiceStats{Status: status, ActiveWatchers: len(watchers)}
+	}
+	return stats
+}
+
+// NotifierStats reports on the state the checker keeps to notify watchers.
+func (c *StaticChecker) NotifierStats() NotifierStats {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return NotifierStats{
+		Watchers: c.watcherCount,
+		Services: len(c.watchers),
+		Swept:    c.swept,
+		Rejected: c.rejected,
+	}
+}
+
+// status returns the current status of a service and whether the service is
+// known. The caller must hold c.mu.
+func (c *StaticChecker) status(service string) (Status, bool) {
+	if override, ok := c.activeOverride(service); ok {
+		return override.Status, true
+	}
+	return c.computedStatus(service)
+}
+
+// computedStatus returns the status of a service, ignoring any override of
+// the service itself, and whether the service is known. The caller must hold
+// c.mu.
+func (c *StaticChecker) computedStatus(service string) (Status, bool) {
+	if service == "" && c.aggregate {
+		aggregate := StatusServing
+		for service, status := range c.statuses {
+			if override, ok := c.activeOverride(service); ok {
+				status = override.Status
+			}
+			if severity(status) > severity(aggregate) {
+				aggregate = status
+			}
+		}
+		return aggregate, true
+	}
+	if c.tenants && isTenantAggregate(service) {
+		return c.tenantStatus(service)
+	}
+	if status, registered := c.statuses[service]; registered {
+		return c.degrade(service, status), true
+	}
+	if service == "" {
+		return c.degrade(service, StatusServing), true
+	}
+	switch c.unregistered {
+	case UnregisteredServiceUnknown:
+		return StatusServiceUnknown, true
+	case UnregisteredInheritProcess:
+		return c.status("")
+	default:
+		return StatusUnknown, false
+	}
+}
+
+// degrade returns the worse of a service's own status and the statuses of
+// its registered dependencies. The caller must hold c.mu.
+func (c *StaticChecker) degrade(service string, status Status) Status {
+	for _, dependency := range c.dependencies[service] {
+		if _, registered := c.statuses[dependency]; !registered && dependency != "" {
+			continue
+		}
+		dependencyStatus, _ := c.status(dependency)
+		if severity(dependencyStatus) > severity(status) {
+			status = dependencyStatus
+		}
+	}
+	return status
+}
+
+// dependsOn reports whether service depends on target, directly or
+// transitively. The caller must hold c.mu.
+func (c *StaticChecker) dependsOn(service, target string) bool {
+	for _, dependency := range c.dependencies[service] {
+		if dependency == target || c.dependsOn(dependency, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// notifyChanged wakes the watchers of a service whose own status changed, and
+// of every service whose status may depend on it. The caller must hold c.mu.
+func (c *StaticChecker) notifyChanged(service string) {
+	switch {
+	case c.unregistered == UnregisteredInheritProcess && (service == "" || c.aggregate):
+		// The process status may have changed, and with it the status of every
+		// unregistered service.
+		for watched := range c.watchers {
+			c.notify(watched)
+		}
+	case c.aggregate && service != "":
+		c.notify(service)
+		c.notify("")
+	default:
+		c.notify(service)
+	}
+	if tenant, ok := c.tenantOf(service); ok {
+		c.notify(tenant)
+		c.notifyDependents(tenant)
+	}
+	c.notifyDependents(service)
+	c.signalChange()
+}
+
+// notifyDependents wakes the watchers of every service that depends on the
+// given one, directly or transitively. The caller must hold c.mu.
+func (c *StaticChecker) notifyDependents(service string) {
+	for dependent := range c.dependencies {
+		if c.dependsOn(dependent, service) {
+			c.notify(dependent)
+		}
+	}
+}
+
+// notify wakes the watchers of a service. The caller must hold c.mu.
+func (c *StaticChecker) notify(service string) {
+	for changed := range c.watchers[service] {
+		select {
+		case changed <- struct{}{}:
+		default:
+			// Watcher already has a pending notification.
+		}
+	}
+}
+
+// changed returns a channel that's closed the next time the checker's state
+// changes.
+func (c *StaticChecker) changed() <-chan struct{} {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.changes == nil {
+		c.changes = make(chan struct{})
+	}
+	return c.changes
+}
+
+// signalChange closes the channel returned by changed, if any. The caller must
+// hold c.mu for writing.
+func (c *StaticChecker) signalChange() {
+	if c.changes != nil {
+		close(c.changes)
+		c.changes = nil
+	}
+}
+
+// sweep stops notifying watchers whose context has ended. They stay counted
+// in c.watcherCount until Watch returns. The caller must hold c.mu for
+// writing.
+func (c *StaticChecker) sweep() {
+	c.lastSweep = c.clock.Now()
+	for service, watchers := range c.watchers {
+		for changed, ctx := range watchers {
+			if ctx.Err() != nil && c.unregisterWatcher(service, changed) {
+				c.swept++
+			}
+		}
+	}
+}
+
+// unregisterWatcher removes a watcher, dropping the service's watcher set once
+// it's empty, and reports whether the watcher was registered. The caller must
+// hold c.mu for writing.
+func (c *StaticChecker) unregisterWatcher(service string, changed chan struct{}) bool {
+	if _, ok := c.watchers[service][changed]; !ok {
+		return false
+	}
+	delete(c.watchers[service], changed)
+	c.abandonPropagation(service, changed)
+	if len(c.watchers[service]) == 0 {
+		delete(c.watchers, service)
+	}
+	return true
+}
+
+type serviceCounters struct {
+	checks         atomic.Uint64
+	transitions    uint64    // guarded by StaticChecker.mu
+	lastTransition time.Time // guarded by StaticChecker.mu
+	lastSet        uint64    // StaticChecker.sets at the last SetStatus
+}
+
+type aggregateOption struct{}
+
+func (o *aggregateOption) applyToStaticChecker(checker *StaticChecker) {
+	checker.aggregate = true
+}
+
+type maxWatchersOption struct {
+	limit int
+}
+
+func (o *maxWatchersOption) applyToStaticChecker(checker *StaticChecker) {
+	checker.maxWatchers = o.limit
+}
+
+type sweepIntervalOption struct {
+	interval time.Duration
+}
+
+func (o *sweepIntervalOption) applyToStaticChecker(checker *StaticChecker) {
+	checker.sweepEvery = o.interval
+}
+
+type unregisteredOption struct {
+	policy UnregisteredPolicy
+}
+
+func (o *unregisteredOption) applyToStaticChecker(checker *StaticChecker) {
+	checker.unregistered = o.policy
+}
+
+// severity orders statuses from healthiest to least healthy.
+func severity(status Status) int {
+	switch status {
+	case StatusServing:
+		return 0
+	case StatusUnknown, StatusServiceUnknown:
+		return 1
+	default:
+		return 2
+	}
+}
+
+func newCheckRequest(req *connect.Request[healthv1.HealthCheckRequest]) *CheckRequest {
+	var checkRequest CheckRequest
+	if req.Msg != nil {
+		checkRequest.Service = req.Msg.Service
+	}
+	return &checkRequest
+}
+
+func newHealthCheckResponse(status Status) *healthv1.HealthCheckResponse {
+	return &healthv1.HealthCheckResponse{
+		Status: healthv1.HealthCheckResponse_ServingStatus(status),
+	}
+}
@@ -15,25 +15,31 @@
 package grpchealth
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
 	"errors"
 	"net/http"
 	"net/http/httptest"
 	"strings"
+	"sync"
 	"testing"
 	"testing/quick"
+	"time"
 
 	"connectrpc.com/connect"
 	healthv1 "connectrpc.com/grpchealth/internal/gen/go/connectext/grpc/health/v1"
+	"google.golang.org/protobuf/proto"
 )
 
 func TestCode(t *testing.T) {
 	t.Parallel()
 
 	knownStatuses := map[Status]struct{}{
-		StatusUnknown:    {},
-		StatusServing:    {},
-		StatusNotServing: {},
+		StatusUnknown:        {},
+		StatusServing:        {},
+		StatusNotServing:     {},
+		StatusServiceUnknown: {},
 	}
 	check := func(s Status) bool {
 		got := s.String()
@@ -52,6 +58,69 @@ func TestCode(t *testing.T) {
 	}
 }
 
+func TestStatusEncoding(t *testing.T) {
+	t.Parallel()
+
+	roundTrip := func(s Status) bool {
+		text, err := s.MarshalText()
+		if err != nil {
+			return false
+		}
+		var fromText Status
+		if err := fromText.UnmarshalText(text); err != nil || fromText != s {
+			return false
+		}
+		data, err := json.Marshal(s)
+		if err != nil {
+			return false
+		}
+		var fromJSON Status
+		if err := json.Unmarshal(data, &fromJSON); err != nil || fromJSON != s {
+			return false
+		}
+		return true
+	}
+	if err := quick.Check(roundTrip, nil /* config */); err != nil {
+		t.Fatal(err)
+	}
+
+	for text, expect := range map[string]Status{
+		"serving":         StatusServing,
+		"NOT_SERVING":     StatusNotServing,
+		"Unknown":         StatusUnknown,
+		"SERVICE_UNKNOWN": StatusServiceUnknown,
+		"status_42":       Status(42),
+	} {
+		got, err := ParseStatus(text)
+		if err != nil {
+			t.Fatalf("ParseStatus(%q): %v", text, err)
+		}
+		if got != expect {
+			t.Fatalf("ParseStatus(%q): got %v, expected %v", text, got, expect)
+		}
+	}
+	for _, text := range []string{"", "healthy", "status_", "status_256"} {
+		if _, err := ParseStatus(text); err == nil {
+			t.Fatalf("ParseStatus(%q): expected error", text)
+		}
+	}
+
+	var fromNumber Status
+	if err := json.Unmarshal([]byte("2"), &fromNumber); err != nil {
+		t.Fatal(err)
+	}
+	if fromNumber != StatusNotServing {
+		t.Fatalf("got %v from JSON number, expected %v", fromNumber, StatusNotServing)
+	}
+	data, err := json.Marshal(map[string]Status{"svc": StatusServing})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != `{"svc":"serving"}` {
+		t.Fatalf("got JSON %s", data)
+	}
+}
+
 func TestHealth(t *testing.T) {
 	const (
 		userFQN = "acme.user.v1.UserService"
@@ -123,6 +192,19 @@ func TestHealth(t *testing.T) {
 	assertUnknown(t, unknown)
 	checker.SetStatus(unknown, StatusServing)
 	assertStatus(t, unknown, StatusServing)
+}
+
+func TestWatchUnimplemented(t *testing.T) {
+	const userFQN = "acme.user.v1.UserService"
+	t.Parallel()
+	mux := http.NewServeMux()
+	// Hide StaticChecker's Watch method.
+	checker := struct{ Checker }{NewStaticChecker(userFQN)}
+	mux.Handle(NewHandler(checker))
+	server := httptest.NewUnstartedServer(mux)
+	server.EnableHTTP2 = true
+	server.StartTLS()
+	t.Cleanup(server.Close)
 
 	watcher := connect.NewClient[healthv1.HealthCheckRequest, healthv1.HealthCheckResponse](
 		server.Client(),
@@ -151,3 +233,379 @@ func TestHealth(t *testing.T) {
 		t.Fatalf("got code %v, expected CodeUnimplemented", code)
 	}
 }
+
+func TestWatch(t *testing.T) {
+	const (
+		userFQN = "acme.user.v1.UserService"
+		unknown = "foobar"
+	)
+	t.Parallel()
+	checker := NewStaticChecker(userFQN)
+	server := newTestServer(t, checker)
+
+	receive := newTestWatch(t, server, userFQN)
+	receive(StatusServing)
+	checker.SetStatus(userFQN, StatusNotServing)
+	receive(StatusNotServing)
+	checker.SetStatus(userFQN, StatusNotServing) // not a change
+	checker.SetStatus(userFQN, StatusServing)
+	receive(StatusServing)
+
+	receive = newTestWatch(t, server, unknown)
+	receive(StatusServiceUnknown)
+	checker.SetStatus(unknown, StatusNotServing)
+	receive(StatusNotServing)
+}
+
+func TestWatchPrevious(t *testing.T) {
+	const userFQN = "acme.user.v1.UserService"
+	t.Parallel()
+	checker := NewStaticChecker(userFQN)
+	updates := make(chan *CheckResponse)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		_ = checker.Watch(ctx, &CheckRequest{Service: userFQN}, func(res *CheckResponse) error {
+			updates <- res
+			return nil
+		})
+	}()
+	for _, expect := range []CheckResponse{
+		{Status: StatusServing, Previous: StatusUnknown},
+		{Status: StatusNotServing, Previous: StatusServing},
+		{Status: StatusServing, Previous: StatusNotServing},
+	} {
+		res := <-updates
+		if res.Status != expect.Status || res.Previous != expect.Previous {
+			t.Fatalf("got update %v (previously %v), expected %v (previously %v)", res.Status, res.Previous, expect.Status, expect.Previous)
+		}
+		next := StatusNotServing
+		if res.Status == StatusNotServing {
+			next = StatusServing
+		}
+		checker.SetStatus(userFQN, next)
+	}
+}
+
+func TestAggregatedWatch(t *testing.T) {
+	const (
+		userFQN  = "acme.user.v1.UserService"
+		groupFQN = "acme.group.v1.GroupService"
+	)
+	t.Parallel()
+	checker := NewStaticCheckerWithOptions(
+		[]string{userFQN, groupFQN},
+		WithAggregatedProcessStatus(),
+	)
+	server := newTestServer(t, checker)
+
+	receive := newTestWatch(t, server, "" /* process */)
+	receive(StatusServing)
+	checker.SetStatus(userFQN, StatusUnknown)
+	receive(StatusUnknown)
+	checker.SetStatus(groupFQN, StatusNotServing)
+	receive(StatusNotServing)
+	checker.SetStatus(userFQN, StatusServing) // group is still not serving
+	checker.SetStatus(groupFQN, StatusServing)
+	receive(StatusServing)
+	checker.SetStatus("", StatusNotServing)
+	receive(StatusNotServing)
+
+	res, err := checker.Check(context.Background(), &CheckRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Status != StatusNotServing {
+		t.Fatalf("got process status %v, expected %v", res.Status, StatusNotServing)
+	}
+}
+
+func TestUnregisteredPolicy(t *testing.T) {
+	const unknown = "foobar"
+	t.Parallel()
+
+	checker := NewStaticCheckerWithOptions(nil, WithUnregisteredPolicy(UnregisteredServiceUnknown))
+	res, err := checker.Check(context.Background(), &CheckRequest{Service: unknown})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Status != StatusServiceUnknown {
+		t.Fatalf("got status %v, expected %v", res.Status, StatusServiceUnknown)
+	}
+
+	checker = NewStaticCheckerWithOptions(nil, WithUnregisteredPolicy(UnregisteredInheritProcess))
+	server := newTestServer(t, checker)
+	receive := newTestWatch(t, server, unknown)
+	receive(StatusServing)
+	checker.SetStatus("", StatusNotServing)
+	receive(StatusNotServing)
+	res, err = checker.Check(context.Background(), &CheckRequest{Service: unknown})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Status != StatusNotServing {
+		t.Fatalf("got status %v, expected %v", res.Status, StatusNotServing)
+	}
+	checker.SetStatus(unknown, StatusServing) // registered now, so no longer inherits
+	receive(StatusServing)
+}
+
+func TestStats(t *testing.T) {
+	const (
+		userFQN = "acme.user.v1.UserService"
+		unknown = "foobar"
+	)
+	t.Parallel()
+	checker := NewStaticChecker(userFQN)
+	server := newTestServer(t, checker)
+	receive := newTestWatch(t, server, unknown)
+	receive(StatusServiceUnknown)
+
+	for i := 0; i < 3; i++ {
+		if _, err := checker.Check(context.Background(), &CheckRequest{Service: userFQN}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	checker.SetStatus(userFQN, StatusNotServing)
+	checker.SetStatus(userFQN, StatusNotServing)
+	checker.SetStatus(userFQN, StatusServing)
+	checker.SetStatus("", StatusNotServing)
+
+	stats := checker.Stats()
+	for _, service := range []string{userFQN, ""} {
+		got := stats[service]
+		if got.LastTransition.IsZero() {
+			t.Errorf("got no last transition for %q", service)
+		}
+		got.LastTransition = time.Time{}
+		stats[service] = got
+	}
+	if got := stats[userFQN]; got != (ServiceStats{Status: StatusServing, Checks: 3, Transitions: 2}) {
+		t.Fatalf("got user stats %+v", got)
+	}
+	if got := stats[""]; got != (ServiceStats{Status: StatusNotServing, Transitions: 1}) {
+		t.Fatalf("got process stats %+v", got)
+	}
+	if got := stats[unknown]; got != (ServiceStats{Status: StatusServiceUnknown, ActiveWatchers: 1}) {
+		t.Fatalf("got unknown stats %+v", got)
+	}
+}
+
+func TestNotifierLimits(t *testing.T) {
+	const userFQN = "acme.user.v1.UserService"
+	t.Parallel()
+	checker := NewStaticCheckerWithOptions(
+		[]string{userFQN},
+		WithMaxWatchers(2),
+		WithWatcherSweepInterval(0),
+	)
+	req := &CheckRequest{Service: userFQN}
+	watch := func(ctx context.Context, update func(*CheckResponse) error) (<-chan struct{}, <-chan error) {
+		started := make(chan struct{})
+		done := make(chan error, 1)
+		var once sync.Once
+		go func() {
+			done <- checker.Watch(ctx, req, func(res *CheckResponse) error {
+				once.Do(func() { close(started) })
+				return update(res)
+			})
+		}()
+		return started, done
+	}
+
+	// A watcher stuck writing to a dead stream is swept once its context
+	// ends, but it still counts toward the limit until Watch returns.
+	release := make(chan struct{})
+	stuckCtx, cancelStuck := context.WithCancel(context.Background())
+	started, stuckDone := watch(stuckCtx, func(*CheckResponse) error {
+		<-release
+		return nil
+	})
+	<-started
+	cancelStuck()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	var live []<-chan error
+	started, done := watch(ctx, func(*CheckResponse) error { return nil })
+	<-started
+	live = append(live, done)
+	err := checker.Watch(ctx, req, func(*CheckResponse) error { return nil })
+	if code := connect.CodeOf(err); code != connect.CodeResourceExhausted {
+		t.Fatalf("got code %v over the watcher limit, expected %v", code, connect.CodeResourceExhausted)
+	}
+	if got := checker.NotifierStats(); got != (NotifierStats{Watchers: 2, Services: 1, Swept: 1, Rejected: 1}) {
+		t.Fatalf("got notifier stats %+v", got)
+	}
+
+	// Once the stuck call returns, its slot is free.
+	close(release)
+	<-stuckDone
+	started, done = watch(ctx, func(*CheckResponse) error { return nil })
+	<-started
+	live = append(live, done)
+	if got := checker.NotifierStats(); got != (NotifierStats{Watchers: 2, Services: 1, Swept: 1, Rejected: 1}) {
+		t.Fatalf("got notifier stats %+v", got)
+	}
+
+	cancel()
+	for _, done := range live {
+		<-done
+	}
+	if got := checker.NotifierStats(); got.Watchers != 0 || got.Services != 0 {
+		t.Fatalf("got notifier stats %+v after watchers returned", got)
+	}
+}
+
+func TestDependencies(t *testing.T) {
+	const (
+		dbFQN    = "acme.db.v1.DBService"
+		userFQN  = "acme.user.v1.UserService"
+		adminFQN = "acme.admin.v1.AdminService"
+	)
+	t.Parallel()
+	checker := NewStaticChecker(dbFQN, userFQN, adminFQN)
+	if err := checker.SetDependencies(userFQN, dbFQN); err != nil {
+		t.Fatal(err)
+	}
+	if err := checker.SetDependencies(adminFQN, userFQN); err != nil {
+		t.Fatal(err)
+	}
+	if err := checker.SetDependencies(dbFQN, adminFQN); err == nil {
+		t.Fatal("expected error for dependency cycle")
+	}
+	server := newTestServer(t, checker)
+	receive := newTestWatch(t, server, adminFQN)
+	receive(StatusServing)
+
+	checker.SetStatus(dbFQN, StatusNotServing)
+	receive(StatusNotServing)
+	res, err := checker.Check(context.Background(), &CheckRequest{Service: userFQN})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Status != StatusNotServing {
+		t.Fatalf("got dependent status %v, expected %v", res.Status, StatusNotServing)
+	}
+
+	checker.SetStatus(dbFQN, StatusServing)
+	receive(StatusServing)
+	checker.SetStatus(userFQN, StatusNotServing)
+	receive(StatusNotServing)
+	if err := checker.SetDependencies(adminFQN); err != nil {
+		t.Fatal(err)
+	}
+	receive(StatusServing)
+}
+
+func BenchmarkCheckHandler(b *testing.B) {
+	body, err := proto.Marshal(&healthv1.HealthCheckRequest{})
+	if err != nil {
+		b.Fatal(err)
+	}
+	checker := NewStaticChecker()
+	for _, bench := range []struct {
+		name    string
+		options []connect.HandlerOption
+	}{
+		{name: "default"},
+		{name: "shared_responses", options: []connect.HandlerOption{WithSharedResponses()}},
+		{name: "low_allocation", options: []connect.HandlerOption{WithSharedResponses(), WithFastCodec()}},
+	} {
+		_, handler := NewCheckHandler(checker, bench.options...)
+		b.Run(bench.name, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				req := httptest.NewRequest(http.MethodPost, "/grpc.health.v1.Health/Check", bytes.NewReader(body))
+				req.Header.Set("Content-Type", "application/proto")
+				rec := httptest.NewRecorder()
+				handler.ServeHTTP(rec, req)
+				if rec.Code != http.StatusOK {
+					b.Fatalf("got HTTP status %d", rec.Code)
+				}
+			}
+		})
+	}
+}
+
+func newTestServer(t *testing.T, checker Checker) *httptest.Server {
+	t.Helper()
+	mux := http.NewServeMux()
+	mux.Handle(NewHandler(checker))
+	server := httptest.NewUnstartedServer(mux)
+	server.EnableHTTP2 = true
+	server.StartTLS()
+	t.Cleanup(server.Close)
+	return server
+}
+
+// newTestWatch starts watching a service and returns a function asserting on
+// the next status received.
+func newTestWatch(t *testing.T, server *httptest.Server, service string) func(Status) {
+	t.Helper()
+	watcher := connect.NewClient[healthv1.HealthCheckRequest, healthv1.HealthCheckResponse](
+		server.Client(),
+		server.URL+"/grpc.health.v1.Health/Watch",
+		connect.WithGRPC(),
+	)
+	ctx, cancel := context.WithCancel(context.Background())
+	stream, err := watcher.CallServerStream(
+		ctx,
+		connect.NewRequest(&healthv1.HealthCheckRequest{Service: service}),
+	)
+	if err != nil {
+		cancel()
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		cancel()
+		_ = stream.Close()
+	})
+	return func(expect Status) {
+		t.Helper()
+		if !stream.Receive() {
+			t.Fatalf("watch %q: stream ended: %v", service, stream.Err())
+		}
+		if got := Status(stream.Msg().Status); got != expect {
+			t.Fatalf("watch %q: got status %v, expected %v", service, got, expect)
+		}
+	}
+}
+
+func TestMethodHandlers(t *testing.T) {
+	const userFQN = "acme.user.v1.UserService"
+	t.Parallel()
+	checker := NewStaticChecker(userFQN)
+	mux := http.NewServeMux()
+	checkPath, checkHandler := NewCheckHandler(checker)
+	watchPath, watchHandler := NewWatchHandler(checker)
+	if checkPath != "/grpc.health.v1.Health/Check" {
+		t.Fatalf("got Check path %q", checkPath)
+	}
+	if watchPath != "/grpc.health.v1.Health/Watch" {
+		t.Fatalf("got Watch path %q", watchPath)
+	}
+	mux.Handle(checkPath, checkHandler)
+	mux.Handle(watchPath, watchHandler)
+	server := httptest.NewUnstartedServer(mux)
+	server.EnableHTTP2 = true
+	server.StartTLS()
+	t.Cleanup(server.Close)
+
+	client := connect.NewClient[healthv1.HealthCheckRequest, healthv1.HealthCheckResponse](
+		server.Client(),
+		server.URL+checkPath,
+		connect.WithGRPC(),
+	)
+	res, err := client.CallUnary(
+		context.Background(),
+		connect.NewRequest(&healthv1.HealthCheckRequest{Service: userFQN}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := Status(res.Msg.Status); got != StatusServing {
+		t.Fatalf("got status %v, expected %v", got, StatusServing)
+	}
+	receive := newTestWatch(t, server, userFQN)
+	receive(StatusServing)
+}
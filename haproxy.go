@@ -0,0 +1,120 @@
+// Copyright 2022-2024 The Connect Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package grpchealth
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// HAProxyAgentParams configure a HAProxyAgent.
+type HAProxyAgentParams struct {
+	// Service is the service to report on. The empty string, the default,
+	// represents the whole process.
+	Service string
+	// Weight, if set, reports the server's weight as a percentage of the
+	// weight configured in HAProxy, between 0 and 100. It lets applications
+	// shed load gradually, for example based on LoadChecker's measurements.
+	Weight func(context.Context) int
+	// Down is the state reported when the service isn't serving: "down" (the
+	// default), "drain", or "maint".
+	Down string
+	// Timeout bounds each check and each connection. The default is one
+	// second.
+	Timeout time.Duration
+}
+
+// HAProxyAgent answers HAProxy's agent checks, letting HAProxy consume the
+// health reported by a Checker without Lua scripting. Configure the backend
+// server with the agent-check and agent-port options:
+//
+//	server app1 10.0.0.1:8080 check agent-check agent-port 9999 agent-inter 2s
+//
+// For each connection, the agent replies with a single line: "up ready" while
+// the service is StatusServing, followed by the weight if configured, and the
+// configured down state otherwise, with the status or error as a comment.
+type HAProxyAgent struct {
+	checker Checker
+	params  HAProxyAgentParams
+}
+
+// NewHAProxyAgent constructs a HAProxyAgent. It returns an error if the down
+// state isn't one HAProxy understands.
+func NewHAProxyAgent(checker Checker, params HAProxyAgentParams) (*HAProxyAgent, error) {
+	switch params.Down {
+	case "":
+		params.Down = "down"
+	case "down", "drain", "maint":
+	default:
+		return nil, fmt.Errorf("unsupported HAProxy agent state %q", params.Down)
+	}
+	if params.Timeout <= 0 {
+		params.Timeout = time.Second
+	}
+	return &HAProxyAgent{checker: checker, params: params}, nil
+}
+
+// Serve accepts connections on the listener and answers each with the
+// current status. It returns the error from Accept, which is net.ErrClosed
+// once the listener is closed.
+func (a *HAProxyAgent) Serve(listener net.Listener) error {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return err
+		}
+		go a.serveConn(conn)
+	}
+}
+
+// Response returns the line the agent currently sends, including the
+// trailing newline.
+func (a *HAProxyAgent) Response(ctx context.Context) string {
+	ctx, cancel := context.WithTimeout(ctx, a.params.Timeout)
+	defer cancel()
+	res, err := a.checker.Check(ctx, &CheckRequest{Service: a.params.Service})
+	switch {
+	case err != nil:
+		return a.params.Down + " #" + sanitizeAgentComment(err.Error()) + "\n"
+	case res.Status != StatusServing:
+		return a.params.Down + " #" + res.Status.String() + "\n"
+	}
+	response := "up ready"
+	if a.params.Weight != nil {
+		weight := max(0, min(100, a.params.Weight(ctx)))
+		response += " " + strconv.Itoa(weight) + "%"
+	}
+	return response + "\n"
+}
+
+func (a *HAProxyAgent) serveConn(conn net.Conn) {
+	defer conn.Close()
+	_ = conn.SetDeadline(time.Now().Add(a.params.Timeout))
+	_, _ = conn.Write([]byte(a.Response(context.Background())))
+}
+
+// sanitizeAgentComment keeps a comment on the agent's single response line.
+func sanitizeAgentComment(comment string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '\n' || r == '\r' {
+			return ' '
+		}
+		return r
+	}, comment)
+}
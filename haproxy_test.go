@@ -0,0 +1,81 @@
+// Copyright 2022-2024 The Connect Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package grpchealth
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"testing"
+)
+
+func TestHAProxyAgent(t *testing.T) {
+	const userFQN = "acme.user.v1.UserService"
+	t.Parallel()
+	if _, err := NewHAProxyAgent(NewStaticChecker(), HAProxyAgentParams{Down: "stopped"}); err == nil { //nolint:exhaustruct // only Down is under test
+		t.Fatal("expected error for unsupported state")
+	}
+	checker := NewStaticChecker(userFQN)
+	agent, err := NewHAProxyAgent(checker, HAProxyAgentParams{
+		Service: userFQN,
+		Weight:  func(context.Context) int { return 150 },
+		Down:    "drain",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	served := make(chan error, 1)
+	go func() {
+		served <- agent.Serve(listener)
+	}()
+	for _, testCase := range []struct {
+		status Status
+		expect string
+	}{
+		{status: StatusServing, expect: "up ready 100%\n"},
+		{status: StatusNotServing, expect: "drain #not_serving\n"},
+	} {
+		checker.SetStatus(userFQN, testCase.status)
+		conn, err := net.Dial("tcp", listener.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := io.ReadAll(conn)
+		conn.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != testCase.expect {
+			t.Fatalf("%v: got %q, expected %q", testCase.status, got, testCase.expect)
+		}
+	}
+	listener.Close()
+	if err := <-served; !errors.Is(err, net.ErrClosed) {
+		t.Fatalf("got error %v, expected %v", err, net.ErrClosed)
+	}
+
+	unknown, err := NewHAProxyAgent(checker, HAProxyAgentParams{Service: "foobar"}) //nolint:exhaustruct // defaults are under test
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := unknown.Response(context.Background()); got != "down #not_found: unknown service foobar\n" {
+		t.Fatalf("got %q for unknown service", got)
+	}
+}
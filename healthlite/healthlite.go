@@ -0,0 +1,341 @@
+// Copyright 2022-2024 The Connect Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package healthlite serves the Check and Watch methods of gRPC's
+// health-checking API using only the standard library. It encodes the two
+// small health messages by hand, so binaries that import it don't link the
+// connectrpc.com/connect or google.golang.org/protobuf runtimes. It suits
+// CLIs, agents, and other embedders that only need to report health and care
+// about binary size; everyone else should use connectrpc.com/grpchealth.
+//
+// Handlers support the gRPC protocol, which requires HTTP/2, and unary
+// Connect requests using the binary protobuf codec, which work over any HTTP
+// version. Compression, gRPC-Web, and the List method aren't supported.
+package healthlite
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// Status describes the health of a service. Its values match those of
+// connectrpc.com/grpchealth.
+type Status uint8
+
+const (
+	// StatusUnknown indicates that the service's health state is indeterminate.
+	StatusUnknown Status = 0
+
+	// StatusServing indicates that the service is ready to accept requests.
+	StatusServing Status = 1
+
+	// StatusNotServing indicates that the process is healthy but the service is
+	// not accepting requests.
+	StatusNotServing Status = 2
+
+	// StatusServiceUnknown indicates that the requested service is unknown. It's
+	// only sent by Watch.
+	StatusServiceUnknown Status = 3
+)
+
+// String representation of the status.
+func (s Status) String() string {
+	switch s {
+	case StatusUnknown:
+		return "unknown"
+	case StatusServing:
+		return "serving"
+	case StatusNotServing:
+		return "not_serving"
+	case StatusServiceUnknown:
+		return "service_unknown"
+	}
+	return fmt.Sprintf("status_%d", s)
+}
+
+// Registry holds the health of a process and its services. It's safe to use
+// concurrently.
+type Registry struct {
+	mu       sync.Mutex
+	statuses map[string]Status
+	changed  chan struct{} // closed and replaced on every change
+}
+
+// NewRegistry constructs a Registry. Each of the supplied services, which
+// should be fully-qualified protobuf service names, starts with
+// StatusServing. The process as a whole, represented by the empty service
+// name, is always registered and starts with StatusServing.
+func NewRegistry(services ...string) *Registry {
+	statuses := make(map[string]Status, len(services)+1)
+	statuses[""] = StatusServing
+	for _, service := range services {
+		statuses[service] = StatusServing
+	}
+	return &Registry{
+		statuses: statuses,
+		changed:  make(chan struct{}),
+	}
+}
+
+// SetStatus sets the health of a service, registering it if necessary.
+func (r *Registry) SetStatus(service string, status Status) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if previous, ok := r.statuses[service]; ok && previous == status {
+		return
+	}
+	r.statuses[service] = status
+	close(r.changed)
+	r.changed = make(chan struct{})
+}
+
+// Status returns the health of a service and whether it's registered.
+func (r *Registry) Status(service string) (Status, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	status, ok := r.statuses[service]
+	return status, ok
+}
+
+// watch returns the status of a service and a channel closed when any status
+// changes. Unregistered services report StatusServiceUnknown.
+func (r *Registry) watch(service string) (Status, <-chan struct{}) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	status, ok := r.statuses[service]
+	if !ok {
+		status = StatusServiceUnknown
+	}
+	return status, r.changed
+}
+
+// The subset of gRPC status codes that handlers return.
+const (
+	codeInvalidArgument   = 3
+	codeNotFound          = 5
+	codeResourceExhausted = 8
+	codeUnimplemented     = 12
+)
+
+// maxRequestSize limits the size of request messages. Health requests carry a
+// single service name, so they're always tiny.
+const maxRequestSize = 64 * 1024
+
+// NewHandler builds an HTTP handler for the Check and Watch methods. It
+// returns the path on which to mount the handler and the HTTP handler itself.
+func NewHandler(registry *Registry) (string, http.Handler) {
+	const prefix = "/grpc.health.v1.Health/"
+	return prefix, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		method := strings.TrimPrefix(r.URL.Path, prefix)
+		contentType := r.Header.Get("Content-Type")
+		switch {
+		case r.Method != http.MethodPost:
+			w.Header().Set("Allow", http.MethodPost)
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		case contentType == "application/grpc" || contentType == "application/grpc+proto":
+			serveGRPC(w, r, registry, method)
+		case contentType == "application/proto" && method == "Check":
+			serveConnectCheck(w, r, registry)
+		default:
+			http.Error(w, http.StatusText(http.StatusUnsupportedMediaType), http.StatusUnsupportedMediaType)
+		}
+	})
+}
+
+func serveGRPC(w http.ResponseWriter, r *http.Request, registry *Registry, method string) {
+	w.Header().Set("Content-Type", "application/grpc")
+	if method != "Check" && method != "Watch" {
+		writeGRPCError(w, codeUnimplemented, "unknown method "+method)
+		return
+	}
+	service, code, err := readGRPCRequest(r.Body)
+	if err != nil {
+		writeGRPCError(w, code, err.Error())
+		return
+	}
+	if method == "Check" {
+		status, ok := registry.Status(service)
+		if !ok {
+			writeGRPCError(w, codeNotFound, "unknown service "+service)
+			return
+		}
+		_, _ = w.Write(appendGRPCFrame(nil, appendResponse(nil, status)))
+		w.Header().Set(http.TrailerPrefix+"Grpc-Status", "0")
+		return
+	}
+	flusher, _ := w.(http.Flusher)
+	var (
+		sent bool
+		last Status
+	)
+	for {
+		status, changed := registry.watch(service)
+		if !sent || status != last {
+			if _, err := w.Write(appendGRPCFrame(nil, appendResponse(nil, status))); err != nil {
+				return
+			}
+			if flusher != nil {
+				flusher.Flush()
+			}
+			sent, last = true, status
+		}
+		select {
+		case <-r.Context().Done():
+			return
+		case <-changed:
+		}
+	}
+}
+
+// readGRPCRequest reads a single length-prefixed, uncompressed request message.
+func readGRPCRequest(body io.Reader) (string, int, error) {
+	var prefix [5]byte
+	if _, err := io.ReadFull(body, prefix[:]); err != nil {
+		return "", codeInvalidArgument, fmt.Errorf("read request: %w", err)
+	}
+	if prefix[0] != 0 {
+		return "", codeUnimplemented, errors.New("compressed requests aren't supported")
+	}
+	size := binary.BigEndian.Uint32(prefix[1:])
+	if size > maxRequestSize {
+		return "", codeResourceExhausted, fmt.Errorf("request of %d bytes is too large", size)
+	}
+	message := make([]byte, size)
+	if _, err := io.ReadFull(body, message); err != nil {
+		return "", codeInvalidArgument, fmt.Errorf("read request: %w", err)
+	}
+	service, err := parseRequest(message)
+	if err != nil {
+		return "", codeInvalidArgument, err
+	}
+	return service, 0, nil
+}
+
+// writeGRPCError writes a trailers-only response with an error status.
+func writeGRPCError(w http.ResponseWriter, code int, message string) {
+	w.Header().Set("Grpc-Status", strconv.Itoa(code))
+	w.Header().Set("Grpc-Message", percentEncode(message))
+	w.WriteHeader(http.StatusOK)
+}
+
+func serveConnectCheck(w http.ResponseWriter, r *http.Request, registry *Registry) {
+	message, err := io.ReadAll(io.LimitReader(r.Body, maxRequestSize+1))
+	if err != nil {
+		writeConnectError(w, http.StatusBadRequest, "invalid_argument", "read request: "+err.Error())
+		return
+	}
+	if len(message) > maxRequestSize {
+		writeConnectError(w, http.StatusTooManyRequests, "resource_exhausted", "request is too large")
+		return
+	}
+	service, err := parseRequest(message)
+	if err != nil {
+		writeConnectError(w, http.StatusBadRequest, "invalid_argument", err.Error())
+		return
+	}
+	status, ok := registry.Status(service)
+	if !ok {
+		writeConnectError(w, http.StatusNotFound, "not_found", "unknown service "+service)
+		return
+	}
+	w.Header().Set("Content-Type", "application/proto")
+	_, _ = w.Write(appendResponse(nil, status))
+}
+
+func writeConnectError(w http.ResponseWriter, httpStatus int, code, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(httpStatus)
+	_, _ = fmt.Fprintf(w, `{"code":%q,"message":%s}`, code, strconv.QuoteToASCII(message))
+}
+
+// percentEncode encodes a gRPC status message as the protocol requires.
+func percentEncode(message string) string {
+	var encoded strings.Builder
+	for i := 0; i < len(message); i++ {
+		if c := message[i]; c < ' ' || c > '~' || c == '%' {
+			fmt.Fprintf(&encoded, "%%%02X", c)
+		} else {
+			encoded.WriteByte(c)
+		}
+	}
+	return encoded.String()
+}
+
+// parseRequest decodes a grpc.health.v1.HealthCheckRequest, returning its
+// service name. Unknown fields are skipped.
+func parseRequest(message []byte) (string, error) {
+	var service string
+	for len(message) > 0 {
+		tag, n := binary.Uvarint(message)
+		if n <= 0 {
+			return "", errors.New("malformed request")
+		}
+		message = message[n:]
+		field, wireType := tag>>3, tag&7
+		var value []byte
+		switch wireType {
+		case 0: // varint
+			_, n = binary.Uvarint(message)
+		case 1: // fixed64
+			n = 8
+		case 2: // length-delimited
+			var length uint64
+			length, n = binary.Uvarint(message)
+			if n > 0 && length <= uint64(len(message)-n) {
+				value = message[n : n+int(length)]
+				n += int(length)
+			} else {
+				n = -1
+			}
+		case 5: // fixed32
+			n = 4
+		default:
+			return "", fmt.Errorf("unsupported wire type %d", wireType)
+		}
+		if n <= 0 || n > len(message) {
+			return "", errors.New("malformed request")
+		}
+		message = message[n:]
+		if field == 1 && wireType == 2 {
+			service = string(value)
+		}
+	}
+	if !utf8.ValidString(service) {
+		return "", errors.New("service name isn't valid UTF-8")
+	}
+	return service, nil
+}
+
+// appendResponse appends an encoded grpc.health.v1.HealthCheckResponse.
+func appendResponse(dst []byte, status Status) []byte {
+	if status == 0 {
+		return dst
+	}
+	// Field 1, varint.
+	return binary.AppendUvarint(append(dst, 0x08), uint64(status))
+}
+
+// appendGRPCFrame appends a length-prefixed, uncompressed gRPC message.
+func appendGRPCFrame(dst, message []byte) []byte {
+	dst = append(dst, 0)
+	dst = binary.BigEndian.AppendUint32(dst, uint32(len(message)))
+	return append(dst, message...)
+}
@@ -0,0 +1,150 @@
+// Copyright 2022-2024 The Connect Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package healthlite
+
+import (
+	"context"
+	"encoding/binary"
+	"go/parser"
+	"go/token"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"connectrpc.com/connect"
+	"connectrpc.com/grpchealth"
+	healthv1 "connectrpc.com/grpchealth/internal/gen/go/connectext/grpc/health/v1"
+)
+
+func TestHandler(t *testing.T) {
+	const userFQN = "acme.user.v1.UserService"
+	t.Parallel()
+	registry := NewRegistry(userFQN)
+	mux := http.NewServeMux()
+	mux.Handle(NewHandler(registry))
+	server := httptest.NewServer(grpchealth.NewH2CHandler(mux))
+	t.Cleanup(server.Close)
+	client := grpchealth.NewClient(server.URL)
+	t.Cleanup(client.Close)
+	ctx := context.Background()
+
+	res, err := client.Check(ctx, &grpchealth.CheckRequest{Service: userFQN})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Status != grpchealth.StatusServing {
+		t.Fatalf("got status %v, expected %v", res.Status, grpchealth.StatusServing)
+	}
+	_, err = client.Check(ctx, &grpchealth.CheckRequest{Service: "foobar"})
+	if code := connect.CodeOf(err); code != connect.CodeNotFound {
+		t.Fatalf("got code %v, expected %v", code, connect.CodeNotFound)
+	}
+
+	connectClient := connect.NewClient[healthv1.HealthCheckRequest, healthv1.HealthCheckResponse](
+		server.Client(),
+		server.URL+"/grpc.health.v1.Health/Check",
+	)
+	registry.SetStatus(userFQN, StatusNotServing)
+	connectRes, err := connectClient.CallUnary(ctx, connect.NewRequest(&healthv1.HealthCheckRequest{Service: userFQN}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := Status(connectRes.Msg.Status); got != StatusNotServing {
+		t.Fatalf("got status %v over Connect, expected %v", got, StatusNotServing)
+	}
+
+	watchCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	updates := make(chan grpchealth.Status, 4)
+	go func() {
+		_ = client.Watch(watchCtx, &grpchealth.CheckRequest{Service: userFQN}, func(res *grpchealth.CheckResponse) error {
+			updates <- res.Status
+			return nil
+		})
+	}()
+	for _, expect := range []grpchealth.Status{grpchealth.StatusNotServing, grpchealth.StatusServing} {
+		select {
+		case status := <-updates:
+			if status != expect {
+				t.Fatalf("got watched status %v, expected %v", status, expect)
+			}
+		case <-watchCtx.Done():
+			t.Fatalf("timed out waiting for %v", expect)
+		}
+		registry.SetStatus(userFQN, StatusServing)
+	}
+}
+
+func TestParseRequest(t *testing.T) {
+	t.Parallel()
+	for _, testCase := range []struct {
+		message string
+		service string
+		valid   bool
+	}{
+		{message: "", valid: true},
+		{message: "\x0a\x03foo", service: "foo", valid: true},
+		{message: "\x10\x01\x0a\x03foo\x1d\x00\x00\x00\x00", service: "foo", valid: true}, // unknown fields
+		{message: "\x0a\x05foo"},
+		{message: "\x0a\x01\xff"},
+		{message: "\x0b"},
+	} {
+		service, err := parseRequest([]byte(testCase.message))
+		if testCase.valid != (err == nil) || service != testCase.service {
+			t.Errorf("parseRequest(%q) = %q, %v", testCase.message, service, err)
+		}
+	}
+}
+
+func TestAppendResponse(t *testing.T) {
+	t.Parallel()
+	for _, status := range []Status{StatusServing, 127, 128, 255} {
+		encoded := appendResponse(nil, status)
+		if len(encoded) == 0 || encoded[0] != 0x08 {
+			t.Fatalf("status %d: got %x, expected field 1 as a varint", status, encoded)
+		}
+		value, n := binary.Uvarint(encoded[1:])
+		if n != len(encoded)-1 || value != uint64(status) {
+			t.Errorf("status %d: got %x, which decodes to %d", status, encoded, value)
+		}
+	}
+}
+
+func TestStandardLibraryOnly(t *testing.T) {
+	t.Parallel()
+	files, err := filepath.Glob("*.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, file := range files {
+		if strings.HasSuffix(file, "_test.go") {
+			continue
+		}
+		parsed, err := parser.ParseFile(token.NewFileSet(), file, nil, parser.ImportsOnly)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, spec := range parsed.Imports {
+			path, _ := strconv.Unquote(spec.Path.Value)
+			if first, _, _ := strings.Cut(path, "/"); strings.Contains(first, ".") {
+				t.Errorf("%s imports %s, which isn't in the standard library", file, path)
+			}
+		}
+	}
+}
@@ -0,0 +1,162 @@
+// Copyright 2022-2024 The Connect Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package healthtest
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"connectrpc.com/grpchealth"
+)
+
+// FakeClock is a grpchealth.Clock whose time only moves when Advance is
+// called, so tests of heartbeats, TTLs, and other interval-based behavior run
+// instantly and deterministically.
+//
+// Unlike the system clock, FakeClock calls the functions of AfterFunc timers
+// synchronously from Advance, so their effects are visible once Advance
+// returns.
+type FakeClock struct {
+	mu      sync.Mutex
+	changed *sync.Cond
+	now     time.Time
+	timers  []*fakeTimer
+}
+
+// NewFakeClock constructs a FakeClock set to the given time.
+func NewFakeClock(now time.Time) *FakeClock {
+	clock := &FakeClock{now: now}
+	clock.changed = sync.NewCond(&clock.mu)
+	return clock
+}
+
+// Now implements grpchealth.Clock.
+func (c *FakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+// NewTimer implements grpchealth.Clock.
+func (c *FakeClock) NewTimer(d time.Duration) grpchealth.Timer {
+	timer := &fakeTimer{clock: c, ch: make(chan time.Time, 1)}
+	timer.Reset(d)
+	return timer
+}
+
+// AfterFunc implements grpchealth.Clock.
+func (c *FakeClock) AfterFunc(d time.Duration, f func()) grpchealth.Timer {
+	timer := &fakeTimer{clock: c, f: f}
+	timer.Reset(d)
+	return timer
+}
+
+// Advance moves the clock forward and fires every timer that comes due, in
+// order of their deadlines.
+func (c *FakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	end := c.now.Add(d)
+	for {
+		sort.SliceStable(c.timers, func(i, j int) bool {
+			return c.timers[i].deadline.Before(c.timers[j].deadline)
+		})
+		if len(c.timers) == 0 || c.timers[0].deadline.After(end) {
+			break
+		}
+		timer := c.timers[0]
+		c.timers = c.timers[1:]
+		if timer.deadline.After(c.now) {
+			c.now = timer.deadline
+		}
+		now := c.now
+		c.changed.Broadcast()
+		// Fire without the lock, so timer functions can use the clock.
+		c.mu.Unlock()
+		timer.fire(now)
+		c.mu.Lock()
+	}
+	c.now = end
+	c.changed.Broadcast()
+	c.mu.Unlock()
+}
+
+// BlockUntil blocks until at least n timers are waiting to fire. Use it to
+// wait for the code under test to schedule its timers before calling Advance.
+func (c *FakeClock) BlockUntil(n int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for len(c.timers) < n {
+		c.changed.Wait()
+	}
+}
+
+// Timers returns the number of timers waiting to fire.
+func (c *FakeClock) Timers() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.timers)
+}
+
+// remove unschedules a timer and reports whether it was scheduled. The caller
+// must hold c.mu.
+func (c *FakeClock) remove(timer *fakeTimer) bool {
+	for i, scheduled := range c.timers {
+		if scheduled == timer {
+			c.timers = append(c.timers[:i], c.timers[i+1:]...)
+			c.changed.Broadcast()
+			return true
+		}
+	}
+	return false
+}
+
+type fakeTimer struct {
+	clock    *FakeClock
+	ch       chan time.Time
+	f        func()
+	deadline time.Time // guarded by clock.mu
+}
+
+func (t *fakeTimer) Chan() <-chan time.Time {
+	return t.ch
+}
+
+func (t *fakeTimer) Stop() bool {
+	t.clock.mu.Lock()
+	defer t.clock.mu.Unlock()
+	return t.clock.remove(t)
+}
+
+func (t *fakeTimer) Reset(d time.Duration) bool {
+	t.clock.mu.Lock()
+	defer t.clock.mu.Unlock()
+	active := t.clock.remove(t)
+	t.deadline = t.clock.now.Add(d)
+	t.clock.timers = append(t.clock.timers, t)
+	t.clock.changed.Broadcast()
+	return active
+}
+
+func (t *fakeTimer) fire(now time.Time) {
+	if t.f != nil {
+		t.f()
+		return
+	}
+	select {
+	case t.ch <- now:
+	default:
+	}
+}
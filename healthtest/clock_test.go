@@ -0,0 +1,381 @@
+// Copyright 2022-2024 The Connect Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package healthtest
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"connectrpc.com/connect"
+	"connectrpc.com/grpchealth"
+)
+
+func TestFakeClock(t *testing.T) {
+	t.Parallel()
+	start := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	clock := NewFakeClock(start)
+	timer := clock.NewTimer(time.Second)
+	var fired []string
+	clock.AfterFunc(2*time.Second, func() { fired = append(fired, "func") })
+	stopped := clock.AfterFunc(time.Second, func() { fired = append(fired, "stopped") })
+	if !stopped.Stop() {
+		t.Fatal("Stop reported an inactive timer")
+	}
+	clock.BlockUntil(2)
+
+	clock.Advance(time.Second)
+	select {
+	case now := <-timer.Chan():
+		if !now.Equal(start.Add(time.Second)) {
+			t.Fatalf("timer fired at %v", now)
+		}
+	default:
+		t.Fatal("timer didn't fire")
+	}
+	clock.Advance(time.Second)
+	if len(fired) != 1 || fired[0] != "func" {
+		t.Fatalf("got fired functions %v", fired)
+	}
+	if got := clock.Now(); !got.Equal(start.Add(2 * time.Second)) {
+		t.Fatalf("got time %v after advancing two seconds", got)
+	}
+	if n := clock.Timers(); n != 0 {
+		t.Fatalf("got %d timers after all fired", n)
+	}
+}
+
+func TestFakeClockOverrides(t *testing.T) {
+	const userFQN = "acme.user.v1.UserService"
+	t.Parallel()
+	clock := NewFakeClock(time.Now())
+	checker := grpchealth.NewStaticCheckerWithOptions([]string{userFQN}, grpchealth.WithClock(clock))
+	if err := checker.SetOverride(userFQN, grpchealth.StatusNotServing, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	clock.Advance(time.Hour - time.Second)
+	if layers, _ := checker.StatusLayers(userFQN); layers.Override == nil {
+		t.Fatal("override expired early")
+	}
+	clock.Advance(time.Second)
+	if layers, _ := checker.StatusLayers(userFQN); layers.Override != nil || layers.Effective != grpchealth.StatusServing {
+		t.Fatalf("got layers %+v after the override expired", layers)
+	}
+}
+
+func TestFakeClockHeartbeats(t *testing.T) {
+	t.Parallel()
+	clock := NewFakeClock(time.Now())
+	server := StartServerWithParams(t, grpchealth.NewStaticChecker(), ServerParams{
+		HandlerOptions: []connect.HandlerOption{
+			grpchealth.WithWatchHeartbeat(time.Minute),
+			grpchealth.WithHandlerClock(clock),
+		},
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	updates := make(chan grpchealth.Status, 1)
+	go func() {
+		_ = server.Client.Watch(ctx, &grpchealth.CheckRequest{}, func(res *grpchealth.CheckResponse) error {
+			updates <- res.Status
+			return nil
+		})
+	}()
+	if status := <-updates; status != grpchealth.StatusServing {
+		t.Fatalf("got status %v", status)
+	}
+	for i := 0; i < 3; i++ {
+		clock.BlockUntil(1)
+		clock.Advance(time.Minute)
+		if status := <-updates; status != grpchealth.StatusServing {
+			t.Fatalf("got heartbeat status %v", status)
+		}
+	}
+}
+
+func TestFakeClockLatencySLO(t *testing.T) {
+	const userFQN = "acme.user.v1.UserService"
+	t.Parallel()
+	clock := NewFakeClock(time.Unix(0, 0))
+	checker := grpchealth.NewStaticChecker(userFQN)
+	slo, err := grpchealth.NewLatencySLO(grpchealth.LatencySLOParams{
+		Setter:     checker,
+		Service:    userFQN,
+		Percentile: 0.9,
+		Threshold:  100 * time.Millisecond,
+		Window:     time.Minute,
+		MinSamples: 5,
+		Clock:      clock,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 10; i++ {
+		slo.Observe(time.Second)
+	}
+	assertStatus(t, checker, userFQN, grpchealth.StatusNotServing)
+	// Traffic stops once the service is degraded. It recovers when the slow
+	// observations leave the window, without any new ones.
+	clock.Advance(30 * time.Second)
+	assertStatus(t, checker, userFQN, grpchealth.StatusNotServing)
+	clock.Advance(30 * time.Second)
+	assertStatus(t, checker, userFQN, grpchealth.StatusServing)
+	if n := clock.Timers(); n != 0 {
+		t.Fatalf("got %d timers after recovery, expected none", n)
+	}
+}
+
+func TestFakeClockErrorRateSLO(t *testing.T) {
+	const userFQN = "acme.user.v1.UserService"
+	t.Parallel()
+	clock := NewFakeClock(time.Unix(0, 0))
+	checker := grpchealth.NewStaticChecker(userFQN)
+	slo, err := grpchealth.NewErrorRateSLO(grpchealth.ErrorRateSLOParams{
+		Setter:      checker,
+		Service:     userFQN,
+		Threshold:   0.5,
+		Window:      time.Minute,
+		MinRequests: 5,
+		Clock:       clock,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 10; i++ {
+		slo.Observe(connect.NewError(connect.CodeUnavailable, errors.New("down")))
+	}
+	assertStatus(t, checker, userFQN, grpchealth.StatusNotServing)
+	// With no new requests, the service recovers once the burst of errors
+	// leaves the window.
+	clock.Advance(30 * time.Second)
+	assertStatus(t, checker, userFQN, grpchealth.StatusNotServing)
+	clock.Advance(30 * time.Second)
+	assertStatus(t, checker, userFQN, grpchealth.StatusServing)
+	if n := clock.Timers(); n != 0 {
+		t.Fatalf("got %d timers after recovery, expected none", n)
+	}
+}
+
+func TestFakeClockDrainGate(t *testing.T) {
+	t.Parallel()
+	clock := NewFakeClock(time.Now())
+	gate := grpchealth.NewDrainGate(grpchealth.NewStaticChecker(), time.Minute, grpchealth.WithDrainClock(clock))
+	done := make(chan error, 1)
+	go func() {
+		done <- gate.WaitForDrain(context.Background())
+	}()
+	clock.BlockUntil(1)
+	clock.Advance(time.Minute - time.Second)
+	select {
+	case err := <-done:
+		t.Fatalf("drained before the grace period elapsed: %v", err)
+	default:
+	}
+	clock.Advance(time.Second)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFakeClockSnapshotWriter(t *testing.T) {
+	const userFQN = "acme.user.v1.UserService"
+	t.Parallel()
+	clock := NewFakeClock(time.Now())
+	checker := grpchealth.NewStaticChecker(userFQN)
+	snapshots := make(chan string, 4)
+	writer, err := grpchealth.NewSnapshotWriter(grpchealth.SnapshotWriterParams{
+		Checker:  checker,
+		Writer:   writerFunc(func(p []byte) { snapshots <- string(p) }),
+		Interval: time.Minute,
+		Clock:    clock,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- writer.Run(ctx)
+	}()
+	first := <-snapshots
+	checker.SetStatus(userFQN, grpchealth.StatusNotServing)
+	clock.BlockUntil(1)
+	select {
+	case snap := <-snapshots:
+		t.Fatalf("got snapshot %q before the interval elapsed", snap)
+	default:
+	}
+	clock.Advance(time.Minute)
+	if snap := <-snapshots; snap == first {
+		t.Fatal("got an unchanged snapshot after the interval")
+	}
+	cancel()
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Fatalf("got error %v, expected %v", err, context.Canceled)
+	}
+}
+
+func TestFakeClockClientPolling(t *testing.T) {
+	const userFQN = "acme.user.v1.UserService"
+	t.Parallel()
+	clock := NewFakeClock(time.Now())
+	checker := grpchealth.NewStaticChecker(userFQN)
+	// Hiding Watch makes the client poll.
+	server := StartServerWithParams(t, struct{ grpchealth.Checker }{checker}, ServerParams{
+		ClientOptions: []connect.ClientOption{
+			grpchealth.WithPollInterval(time.Minute),
+			grpchealth.WithClientClock(clock),
+		},
+	})
+	transitions := make(chan grpchealth.Status, 4)
+	stop := server.Client.OnChange(userFQN, func(_, next grpchealth.Status) {
+		transitions <- next
+	})
+	defer stop()
+	if status := <-transitions; status != grpchealth.StatusServing {
+		t.Fatalf("got status %v", status)
+	}
+	checker.SetStatus(userFQN, grpchealth.StatusNotServing)
+	clock.BlockUntil(1)
+	clock.Advance(time.Minute)
+	if status := <-transitions; status != grpchealth.StatusNotServing {
+		t.Fatalf("got status %v after polling", status)
+	}
+}
+
+func TestFakeClockClientHeartbeatTimeout(t *testing.T) {
+	t.Parallel()
+	clock := NewFakeClock(time.Now())
+	streams := make(chan struct{}, 4)
+	server := StartServerWithParams(t, &silentWatcher{Checker: grpchealth.NewStaticChecker(), streams: streams}, ServerParams{
+		ClientOptions: []connect.ClientOption{
+			grpchealth.WithWatchHeartbeatTimeout(time.Minute),
+			grpchealth.WithClientClock(clock),
+		},
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		_ = server.Client.Watch(ctx, &grpchealth.CheckRequest{}, func(*grpchealth.CheckResponse) error {
+			return nil
+		})
+	}()
+	<-streams
+	clock.BlockUntil(1)
+	clock.Advance(time.Minute)
+	// The silent stream is abandoned, and the client reconnects after a
+	// backoff of about a second.
+	clock.BlockUntil(1)
+	clock.Advance(2 * time.Second)
+	<-streams
+}
+
+func TestFakeClockTransitionBatcherRetry(t *testing.T) {
+	t.Parallel()
+	clock := NewFakeClock(time.Now())
+	errUnavailable := errors.New("watcher unavailable")
+	var watches atomic.Int32
+	watcher := &flakyWatcher{Watcher: grpchealth.NewStaticChecker(), failures: 1, err: errUnavailable, calls: &watches}
+	reported := make(chan error, 1)
+	batches := make(chan map[string]grpchealth.Status, 1)
+	batcher, err := grpchealth.NewTransitionBatcher(grpchealth.TransitionBatcherParams{
+		Watcher: watcher,
+		Publish: func(_ context.Context, statuses map[string]grpchealth.Status) error {
+			batches <- statuses
+			return nil
+		},
+		Quiet:   time.Second,
+		OnError: func(err error) { reported <- err },
+		Clock:   clock,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() { _ = batcher.Run(ctx) }()
+	if err := <-reported; !errors.Is(err, errUnavailable) {
+		t.Fatalf("got error %v, expected %v", err, errUnavailable)
+	}
+	// The watch is retried after a backoff of about a second on the fake
+	// clock, and the batch is published after the quiet period.
+	clock.BlockUntil(1)
+	clock.Advance(2 * time.Second)
+	clock.BlockUntil(1)
+	clock.Advance(time.Second)
+	if got := <-batches; got[""] != grpchealth.StatusServing {
+		t.Fatalf("got batch %v after retrying", got)
+	}
+	if n := watches.Load(); n != 2 {
+		t.Fatalf("got %d watches, expected 2", n)
+	}
+}
+
+// flakyWatcher fails its first few Watch calls.
+type flakyWatcher struct {
+	grpchealth.Watcher
+
+	failures int32
+	err      error
+	calls    *atomic.Int32
+}
+
+func (w *flakyWatcher) Watch(ctx context.Context, req *grpchealth.CheckRequest, update func(*grpchealth.CheckResponse) error) error {
+	if w.calls.Add(1) <= w.failures {
+		return w.err
+	}
+	return w.Watcher.Watch(ctx, req, update)
+}
+
+// silentWatcher sends the current status and then nothing, like a server
+// that's stopped sending heartbeats.
+type silentWatcher struct {
+	grpchealth.Checker
+
+	streams chan<- struct{}
+}
+
+func (w *silentWatcher) Watch(ctx context.Context, req *grpchealth.CheckRequest, update func(*grpchealth.CheckResponse) error) error {
+	w.streams <- struct{}{}
+	res, err := w.Check(ctx, req)
+	if err != nil {
+		return err
+	}
+	if err := update(res); err != nil {
+		return err
+	}
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+type writerFunc func([]byte)
+
+func (f writerFunc) Write(p []byte) (int, error) {
+	f(p)
+	return len(p), nil
+}
+
+func assertStatus(t *testing.T, checker grpchealth.Checker, service string, expect grpchealth.Status) {
+	t.Helper()
+	res, err := checker.Check(context.Background(), &grpchealth.CheckRequest{Service: service})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Status != expect {
+		t.Fatalf("got status %v for %q, expected %v", res.Status, service, expect)
+	}
+}
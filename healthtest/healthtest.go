@@ -0,0 +1,238 @@
+// Copyright 2022-2024 The Connect Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package healthtest helps test Checker implementations and the code that
+// uses them.
+package healthtest
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"connectrpc.com/grpchealth"
+)
+
+// watchExitTimeout bounds how long a Watcher may take to return after its
+// context is canceled.
+const watchExitTimeout = 5 * time.Second
+
+// Fuzz registers seed inputs and a fuzz target that runs Exercise against
+// checkers built by newChecker, one per input. Call it from a fuzz test:
+//
+//	func FuzzChecker(f *testing.F) {
+//		healthtest.Fuzz(f, func() grpchealth.Checker {
+//			return NewMyChecker()
+//		})
+//	}
+//
+// Under plain go test, only the seeds run; use go test -fuzz to explore.
+// Run with -race to catch data races.
+func Fuzz(f *testing.F, newChecker func() grpchealth.Checker) {
+	f.Helper()
+	for _, seed := range [][]byte{
+		{},
+		{0, 1, 2, 3, 4, 5},
+		[]byte("\x00acme.user.v1.UserService\x01\x02\x03\x04"),
+		[]byte("\x03\x03\x03\x03\x00\xff\xfe\x01\x04\x04\x04"),
+		{2, 2, 2, 3, 3, 3, 0, 0, 0, 1, 1, 1, 4, 4, 4, 5, 5, 5},
+	} {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, input []byte) {
+		Exercise(t, newChecker(), input)
+	})
+}
+
+// Exercise interprets input as a program of concurrent operations against the
+// checker: SetStatus (if it implements grpchealth.StatusSetter), Check, Watch
+// (if it implements grpchealth.Watcher), List (if it implements
+// grpchealth.Lister), and storms of canceled requests. Service names are
+// drawn from the input, so they include empty, very long, and invalid UTF-8
+// strings.
+//
+// Exercise fails the test if the checker panics, returns a nil response
+// without an error, reports a status outside the health protocol, or keeps
+// watching after its context is canceled.
+func Exercise(tb testing.TB, checker grpchealth.Checker, input []byte) {
+	tb.Helper()
+	program := newProgram(input)
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	for worker := 0; worker < 4; worker++ {
+		wg.Add(1)
+		go func(worker int) {
+			defer wg.Done()
+			defer func() {
+				if r := recover(); r != nil {
+					tb.Errorf("checker panicked: %v", r)
+				}
+			}()
+			for i := worker; i < len(program); i += 4 {
+				runOperation(ctx, tb, checker, program[i])
+			}
+		}(worker)
+	}
+}
+
+type operationKind uint8
+
+const (
+	opSetStatus operationKind = iota
+	opCheck
+	opWatch
+	opList
+	opCancelStorm
+	opCheckCanceled
+	opCount
+)
+
+type operation struct {
+	kind    operationKind
+	service string
+	status  grpchealth.Status
+}
+
+// newProgram decodes fuzz input into operations. Each operation uses a kind
+// byte, a status byte, and a length-prefixed service name.
+func newProgram(input []byte) []operation {
+	var program []operation
+	for len(input) > 0 && len(program) < 256 {
+		op := operation{kind: operationKind(input[0] % byte(opCount))}
+		input = input[1:]
+		if len(input) > 0 {
+			op.status = grpchealth.Status(input[0] % 4)
+			input = input[1:]
+		}
+		if len(input) > 0 {
+			n := min(int(input[0]%64), len(input)-1)
+			op.service = string(input[1 : 1+n])
+			input = input[1+n:]
+		}
+		program = append(program, op)
+	}
+	return program
+}
+
+func runOperation(ctx context.Context, tb testing.TB, checker grpchealth.Checker, op operation) {
+	tb.Helper()
+	switch op.kind {
+	case opSetStatus:
+		if setter, ok := checker.(grpchealth.StatusSetter); ok {
+			setter.SetStatus(op.service, op.status)
+		}
+	case opCheck:
+		check(ctx, tb, checker, op.service)
+	case opCheckCanceled:
+		canceled, cancel := context.WithCancel(ctx)
+		cancel()
+		check(canceled, tb, checker, op.service)
+	case opWatch:
+		watch(ctx, tb, checker, op.service, int(op.status))
+	case opList:
+		if lister, ok := checker.(grpchealth.Lister); ok {
+			statuses, err := lister.List(ctx)
+			if err == nil && statuses == nil {
+				tb.Errorf("List returned nil map without error")
+			}
+			for service, status := range statuses {
+				validateStatus(tb, service, status)
+			}
+		}
+	case opCancelStorm:
+		var wg sync.WaitGroup
+		for i := 0; i < 16; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				stormCtx, cancel := context.WithCancel(ctx)
+				go cancel()
+				check(stormCtx, tb, checker, op.service)
+				watch(stormCtx, tb, checker, op.service, 0)
+			}()
+		}
+		wg.Wait()
+	}
+}
+
+func check(ctx context.Context, tb testing.TB, checker grpchealth.Checker, service string) {
+	tb.Helper()
+	res, err := checker.Check(ctx, &grpchealth.CheckRequest{Service: service})
+	if err != nil {
+		return
+	}
+	if res == nil {
+		tb.Errorf("Check(%q) returned nil response without error", service)
+		return
+	}
+	validateStatus(tb, service, res.Status)
+}
+
+// watch watches a service until it receives limit updates, then cancels and
+// verifies that the Watcher returns promptly.
+func watch(ctx context.Context, tb testing.TB, checker grpchealth.Checker, service string, limit int) {
+	tb.Helper()
+	watcher, ok := checker.(grpchealth.Watcher)
+	if !ok {
+		return
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	errDone := errors.New("done")
+	done := make(chan error, 1)
+	go func() {
+		var updates int
+		done <- watcher.Watch(ctx, &grpchealth.CheckRequest{Service: service}, func(res *grpchealth.CheckResponse) error {
+			if res == nil {
+				tb.Errorf("Watch(%q) sent nil response", service)
+				return errDone
+			}
+			validateStatus(tb, service, res.Status)
+			updates++
+			if updates > limit {
+				return errDone
+			}
+			return nil
+		})
+	}()
+	// Let the watch run briefly so it interleaves with other operations.
+	timer := time.NewTimer(time.Millisecond)
+	select {
+	case <-done:
+		timer.Stop()
+		return
+	case <-timer.C:
+	}
+	cancel()
+	exit := time.NewTimer(watchExitTimeout)
+	defer exit.Stop()
+	select {
+	case <-done:
+	case <-exit.C:
+		tb.Errorf("Watch(%q) didn't return within %v of cancellation", service, watchExitTimeout)
+	}
+}
+
+func validateStatus(tb testing.TB, service string, status grpchealth.Status) {
+	tb.Helper()
+	switch status {
+	case grpchealth.StatusUnknown, grpchealth.StatusServing, grpchealth.StatusNotServing, grpchealth.StatusServiceUnknown:
+	default:
+		tb.Errorf("service %q reported invalid status %v", service, status)
+	}
+}
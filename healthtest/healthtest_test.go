@@ -0,0 +1,37 @@
+// Copyright 2022-2024 The Connect Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package healthtest
+
+import (
+	"testing"
+
+	"connectrpc.com/grpchealth"
+)
+
+func FuzzStaticChecker(f *testing.F) {
+	Fuzz(f, func() grpchealth.Checker {
+		return grpchealth.NewStaticChecker("acme.user.v1.UserService")
+	})
+}
+
+func FuzzAggregatedStaticChecker(f *testing.F) {
+	Fuzz(f, func() grpchealth.Checker {
+		return grpchealth.NewStaticCheckerWithOptions(
+			nil,
+			grpchealth.WithAggregatedProcessStatus(),
+			grpchealth.WithUnregisteredPolicy(grpchealth.UnregisteredInheritProcess),
+		)
+	})
+}
@@ -0,0 +1,93 @@
+// Copyright 2022-2024 The Connect Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package healthtest
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"connectrpc.com/connect"
+	"connectrpc.com/grpchealth"
+)
+
+// ServerParams configure StartServerWithParams.
+type ServerParams struct {
+	// H2C serves HTTP/2 without TLS, as many service meshes expect, rather
+	// than HTTP/2 over TLS.
+	H2C bool
+	// HandlerOptions are passed to grpchealth.NewHandler.
+	HandlerOptions []connect.HandlerOption
+	// ClientOptions are passed to grpchealth.NewClient, for example
+	// grpchealth.WithConnectProtocol to test the Connect protocol rather than
+	// gRPC.
+	ClientOptions []connect.ClientOption
+}
+
+// Server is a running health server and a client connected to it.
+type Server struct {
+	// URL is the server's base URL.
+	URL string
+	// HTTPClient is configured to reach the server, for building other
+	// clients. With H2C, it uses HTTP/1.1.
+	HTTPClient *http.Client
+	// Client is connected to the server.
+	Client *grpchealth.Client
+
+	server *httptest.Server
+}
+
+// StartServer serves the checker's health API over HTTP/2 with TLS and
+// returns a Server whose Client uses gRPC. The server and client are closed
+// when the test ends.
+func StartServer(tb testing.TB, checker grpchealth.Checker) *Server {
+	tb.Helper()
+	return StartServerWithParams(tb, checker, ServerParams{})
+}
+
+// StartServerWithParams is like StartServer, but it accepts parameters
+// selecting the transport and configuring the handler and client.
+func StartServerWithParams(tb testing.TB, checker grpchealth.Checker, params ServerParams) *Server {
+	tb.Helper()
+	mux := http.NewServeMux()
+	mux.Handle(grpchealth.NewHandler(checker, params.HandlerOptions...))
+	var server *httptest.Server
+	clientOptions := params.ClientOptions
+	if params.H2C {
+		// The Client dials h2c for http URLs by default.
+		server = httptest.NewServer(grpchealth.NewH2CHandler(mux))
+	} else {
+		server = httptest.NewUnstartedServer(mux)
+		server.EnableHTTP2 = true
+		server.StartTLS()
+		clientOptions = append([]connect.ClientOption{grpchealth.WithHTTPClient(server.Client())}, clientOptions...)
+	}
+	client := grpchealth.NewClient(server.URL, clientOptions...)
+	s := &Server{
+		URL:        server.URL,
+		HTTPClient: server.Client(),
+		Client:     client,
+		server:     server,
+	}
+	tb.Cleanup(s.Close)
+	return s
+}
+
+// Close closes the client's idle connections and shuts down the server. It's
+// safe to call more than once.
+func (s *Server) Close() {
+	s.Client.Close()
+	s.server.Close()
+}
@@ -0,0 +1,66 @@
+// Copyright 2022-2024 The Connect Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package healthtest
+
+import (
+	"context"
+	"testing"
+
+	"connectrpc.com/connect"
+	"connectrpc.com/grpchealth"
+)
+
+func TestStartServer(t *testing.T) {
+	const userFQN = "acme.user.v1.UserService"
+	t.Parallel()
+	for name, params := range map[string]ServerParams{
+		"grpc_tls": {},
+		"grpc_h2c": {H2C: true},
+		"connect":  {ClientOptions: []connect.ClientOption{grpchealth.WithConnectProtocol()}},
+		"connect_h2c": {
+			H2C:           true,
+			ClientOptions: []connect.ClientOption{grpchealth.WithConnectProtocol()},
+		},
+	} {
+		params := params
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			checker := grpchealth.NewStaticChecker(userFQN)
+			server := StartServerWithParams(t, checker, params)
+			checker.SetStatus(userFQN, grpchealth.StatusNotServing)
+			res, err := server.Client.Check(context.Background(), &grpchealth.CheckRequest{Service: userFQN})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if res.Status != grpchealth.StatusNotServing {
+				t.Fatalf("got status %v, expected %v", res.Status, grpchealth.StatusNotServing)
+			}
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			err = server.Client.Watch(ctx, &grpchealth.CheckRequest{Service: userFQN}, func(res *grpchealth.CheckResponse) error {
+				if res.Status != grpchealth.StatusNotServing {
+					t.Errorf("got watched status %v", res.Status)
+				}
+				cancel()
+				return nil
+			})
+			if ctx.Err() == nil {
+				t.Fatalf("watch ended early: %v", err)
+			}
+		})
+	}
+	server := StartServer(t, grpchealth.NewStaticChecker())
+	server.Close() // Cleanup closes it again.
+}
@@ -0,0 +1,173 @@
+// Copyright 2022-2024 The Connect Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package healthtest
+
+import (
+	"context"
+	"math/rand"
+	"sync"
+	"testing"
+	"time"
+
+	"connectrpc.com/grpchealth"
+)
+
+// StressChecker is a Checker whose status can be set and watched, such as a
+// grpchealth.StaticChecker.
+type StressChecker interface {
+	grpchealth.StatusSetter
+	grpchealth.Watcher
+}
+
+// StressParams configure Stress.
+type StressParams struct {
+	// Services are the services to set and watch.
+	Services []string
+	// Setters is the number of goroutines calling SetStatus concurrently.
+	Setters int
+	// Churners is the number of goroutines repeatedly starting and canceling
+	// Watch calls.
+	Churners int
+	// Iterations is the number of operations each goroutine performs.
+	Iterations int
+	// Timeout bounds how long watchers may take to observe the final status,
+	// and how long Watch may take to return after cancellation.
+	Timeout time.Duration
+}
+
+// Stress hammers a checker with concurrent SetStatus calls, Watch
+// registrations, and cancellations, then verifies that the notifier logic
+// hasn't lost any updates: a long-lived watcher of each service must observe
+// the final status set for it, and every Watch must return promptly once its
+// context is canceled. Run it with -race to catch data races as well.
+func Stress(tb testing.TB, checker StressChecker, params StressParams) {
+	tb.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Long-lived watchers record the latest status they've seen.
+	sentinels := make(map[string]*sentinel, len(params.Services))
+	var sentinelsDone sync.WaitGroup
+	for _, service := range params.Services {
+		s := &sentinel{changed: make(chan struct{}, 1)}
+		sentinels[service] = s
+		sentinelsDone.Add(1)
+		go func(service string) {
+			defer sentinelsDone.Done()
+			_ = checker.Watch(ctx, &grpchealth.CheckRequest{Service: service}, s.update)
+		}(service)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < params.Setters; i++ {
+		wg.Add(1)
+		go func(seed int64) {
+			defer wg.Done()
+			rng := rand.New(rand.NewSource(seed)) //nolint:gosec // deterministic test load
+			for j := 0; j < params.Iterations; j++ {
+				service := params.Services[rng.Intn(len(params.Services))]
+				checker.SetStatus(service, grpchealth.Status(1+rng.Intn(2)))
+			}
+		}(int64(i))
+	}
+	for i := 0; i < params.Churners; i++ {
+		wg.Add(1)
+		go func(seed int64) {
+			defer wg.Done()
+			rng := rand.New(rand.NewSource(-seed - 1)) //nolint:gosec // deterministic test load
+			for j := 0; j < params.Iterations; j++ {
+				service := params.Services[rng.Intn(len(params.Services))]
+				// Churned watches end after a few updates, immediately, or after
+				// a moment, whichever comes first.
+				watchCtx, cancelWatch := context.WithTimeout(ctx, time.Duration(rng.Intn(100))*time.Microsecond)
+				limit := rng.Intn(3)
+				done := make(chan struct{})
+				go func() {
+					defer close(done)
+					var updates int
+					_ = checker.Watch(watchCtx, &grpchealth.CheckRequest{Service: service}, func(*grpchealth.CheckResponse) error {
+						updates++
+						if updates > limit {
+							cancelWatch()
+						}
+						return nil
+					})
+				}()
+				if rng.Intn(2) == 0 {
+					cancelWatch()
+				}
+				<-done
+				cancelWatch()
+			}
+		}(int64(i))
+	}
+	wg.Wait()
+
+	// Settle each service on a final status, then make sure every sentinel
+	// sees it.
+	final := make(map[string]grpchealth.Status, len(params.Services))
+	for i, service := range params.Services {
+		final[service] = grpchealth.Status(1 + i%2)
+		checker.SetStatus(service, final[service])
+	}
+	deadline := time.NewTimer(params.Timeout)
+	defer deadline.Stop()
+	for service, s := range sentinels {
+		for s.latest() != final[service] {
+			select {
+			case <-s.changed:
+			case <-deadline.C:
+				tb.Fatalf("watcher of %q saw %v, never the final %v", service, s.latest(), final[service])
+			}
+		}
+	}
+
+	cancel()
+	exited := make(chan struct{})
+	go func() {
+		sentinelsDone.Wait()
+		close(exited)
+	}()
+	exit := time.NewTimer(params.Timeout)
+	defer exit.Stop()
+	select {
+	case <-exited:
+	case <-exit.C:
+		tb.Fatalf("watchers didn't return within %v of cancellation", params.Timeout)
+	}
+}
+
+type sentinel struct {
+	mu      sync.Mutex
+	status  grpchealth.Status
+	changed chan struct{}
+}
+
+func (s *sentinel) update(res *grpchealth.CheckResponse) error {
+	s.mu.Lock()
+	s.status = res.Status
+	s.mu.Unlock()
+	select {
+	case s.changed <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+func (s *sentinel) latest() grpchealth.Status {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.status
+}
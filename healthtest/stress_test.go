@@ -0,0 +1,52 @@
+// Copyright 2022-2024 The Connect Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package healthtest
+
+import (
+	"testing"
+	"time"
+
+	"connectrpc.com/grpchealth"
+)
+
+func TestStressStaticChecker(t *testing.T) {
+	t.Parallel()
+	services := []string{"", "acme.user.v1.UserService", "acme.order.v1.OrderService"}
+	params := StressParams{
+		Services:   services,
+		Setters:    8,
+		Churners:   8,
+		Iterations: 500,
+		Timeout:    10 * time.Second,
+	}
+	if testing.Short() {
+		params.Iterations = 50
+	}
+	t.Run("default", func(t *testing.T) {
+		t.Parallel()
+		Stress(t, grpchealth.NewStaticChecker(services...), params)
+	})
+	t.Run("aggregated", func(t *testing.T) {
+		t.Parallel()
+		checker := grpchealth.NewStaticCheckerWithOptions(
+			services[1:],
+			grpchealth.WithAggregatedProcessStatus(),
+			grpchealth.WithUnregisteredPolicy(grpchealth.UnregisteredInheritProcess),
+		)
+		aggregatedParams := params
+		aggregatedParams.Services = services[1:]
+		Stress(t, checker, aggregatedParams)
+	})
+}
@@ -0,0 +1,163 @@
+// Copyright 2022-2024 The Connect Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package grpchealth
+
+import (
+	"context"
+	"errors"
+	"os"
+	"sync/atomic"
+	"time"
+)
+
+// HeartbeatFileParams configure a HeartbeatFile.
+type HeartbeatFileParams struct {
+	// Watcher reports the status of the service, such as a StaticChecker.
+	Watcher Watcher
+	// Service is the service whose status gates the heartbeat. The empty
+	// string, the default, represents the whole process.
+	Service string
+	// Path is the heartbeat file, such as "/run/app/heartbeat". It's created
+	// if it doesn't exist.
+	Path string
+	// Interval is how often the file is touched while the service is serving.
+	// The default is ten seconds. Watchdogs should allow a few intervals
+	// before declaring the process stuck.
+	Interval time.Duration
+	// OnError, if set, is called with errors watching the service and
+	// touching the file. Touching continues after errors.
+	OnError func(error)
+	// Clock schedules touches and sets the file's modification time. The
+	// default is the system clock.
+	Clock Clock
+}
+
+// HeartbeatFile touches a file at regular intervals while a service is
+// StatusServing, and pauses while it isn't. Cron jobs, watchdog scripts, and
+// supervisors that check a file's modification time, such as systemd's
+// tmpfiles cleanup or monit, can then monitor the process without network
+// access: a stale file means the process is unhealthy or stuck.
+type HeartbeatFile struct {
+	params  HeartbeatFileParams
+	serving atomic.Bool
+	changed chan struct{}
+}
+
+// NewHeartbeatFile constructs a HeartbeatFile. It returns an error if the
+// Watcher or Path is missing.
+func NewHeartbeatFile(params HeartbeatFileParams) (*HeartbeatFile, error) {
+	if params.Watcher == nil {
+		return nil, errors.New("heartbeat file requires a watcher")
+	}
+	if params.Path == "" {
+		return nil, errors.New("heartbeat file requires a path")
+	}
+	if params.Interval <= 0 {
+		params.Interval = 10 * time.Second
+	}
+	if params.Clock == nil {
+		params.Clock = systemClock{}
+	}
+	return &HeartbeatFile{
+		params:  params,
+		changed: make(chan struct{}, 1),
+	}, nil
+}
+
+// Run watches the service and touches the file while it's serving until ctx
+// ends, then returns ctx's error. The file is left in place, so its age keeps
+// reporting how long ago the process was last healthy. Run should be called
+// once.
+func (h *HeartbeatFile) Run(ctx context.Context) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		h.watch(ctx)
+	}()
+	defer func() { <-done }()
+	timer := h.params.Clock.NewTimer(h.params.Interval)
+	defer timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-h.changed:
+			if !timer.Stop() {
+				select {
+				case <-timer.Chan():
+				default:
+				}
+			}
+		case <-timer.Chan():
+		}
+		if h.serving.Load() {
+			h.report(h.touch())
+		}
+		timer.Reset(h.params.Interval)
+	}
+}
+
+// watch tracks whether the service is serving until ctx ends, watching again
+// after a backoff if the Watcher fails.
+func (h *HeartbeatFile) watch(ctx context.Context) {
+	retry := NewBackoff()
+	for attempt := 0; ; attempt++ {
+		err := h.params.Watcher.Watch(ctx, &CheckRequest{Service: h.params.Service}, func(res *CheckResponse) error {
+			attempt = 0
+			serving := res.Status == StatusServing
+			if h.serving.Swap(serving) != serving && serving {
+				// Touch right away rather than waiting for the next interval.
+				select {
+				case h.changed <- struct{}{}:
+				default:
+				}
+			}
+			return nil
+		})
+		h.serving.Store(false)
+		if ctx.Err() != nil {
+			return
+		}
+		h.report(err)
+		if retry.Wait(ctx, attempt) != nil {
+			return
+		}
+	}
+}
+
+// touch creates the file if necessary and sets its modification time.
+func (h *HeartbeatFile) touch() error {
+	now := h.params.Clock.Now()
+	err := os.Chtimes(h.params.Path, now, now)
+	if !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	file, err := os.OpenFile(h.params.Path, os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	return os.Chtimes(h.params.Path, now, now)
+}
+
+func (h *HeartbeatFile) report(err error) {
+	if err != nil && h.params.OnError != nil {
+		h.params.OnError(err)
+	}
+}
@@ -0,0 +1,87 @@
+// Copyright 2022-2024 The Connect Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package grpchealth
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestHeartbeatFile(t *testing.T) {
+	t.Parallel()
+	checker := NewStaticChecker()
+	clock := &manualClock{now: time.Unix(1_700_000_000, 0)}
+	path := filepath.Join(t.TempDir(), "heartbeat")
+	heartbeat, err := NewHeartbeatFile(HeartbeatFileParams{
+		Watcher:  checker,
+		Path:     path,
+		Interval: time.Millisecond,
+		OnError:  func(err error) { t.Error(err) },
+		Clock:    clock,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- heartbeat.Run(ctx) }()
+	waitForModTime := func(expect time.Time) {
+		t.Helper()
+		for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(time.Millisecond) {
+			if info, err := os.Stat(path); err == nil && info.ModTime().Equal(expect) {
+				return
+			}
+		}
+		t.Fatalf("heartbeat file never had modification time %v", expect)
+	}
+	waitForModTime(clock.Now())
+
+	checker.SetStatus("", StatusNotServing)
+	// Give the change time to reach the heartbeat, then move the clock: any
+	// later touch would record the new time.
+	stale := clock.Now()
+	time.Sleep(10 * time.Millisecond)
+	clock.Advance(time.Minute)
+	time.Sleep(10 * time.Millisecond)
+	if info, err := os.Stat(path); err != nil {
+		t.Fatal(err)
+	} else if !info.ModTime().Equal(stale) {
+		t.Errorf("heartbeat file touched at %v while not serving", info.ModTime())
+	}
+
+	checker.SetStatus("", StatusServing)
+	waitForModTime(clock.Now())
+	cancel()
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Errorf("got error %v, expected %v", err, context.Canceled)
+	}
+	if _, err := os.Stat(path); err != nil {
+		t.Errorf("heartbeat file removed on exit: %v", err)
+	}
+}
+
+func TestNewHeartbeatFile(t *testing.T) {
+	t.Parallel()
+	if _, err := NewHeartbeatFile(HeartbeatFileParams{Path: "heartbeat"}); err == nil {
+		t.Error("expected an error without a watcher")
+	}
+	if _, err := NewHeartbeatFile(HeartbeatFileParams{Watcher: NewStaticChecker()}); err == nil {
+		t.Error("expected an error without a path")
+	}
+}
@@ -0,0 +1,155 @@
+// Copyright 2022-2024 The Connect Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package grpchealth
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"connectrpc.com/connect"
+)
+
+// NewHTTPHandler builds a plain HTTP handler reporting the health of the
+// process, for probes that can't speak gRPC or Connect. Clients may ask about
+// a particular service with the "service" query parameter.
+//
+// The handler uses HTTP 200 for StatusServing, 503 for any other status, 404
+// for unknown services, and 500 for other errors. Use WithHTTPStatusCodes to
+// change the codes used for each status. By default, it responds
+// with the status as text. Clients that accept "application/json" instead get
+// the CheckResult as JSON, including any details reported by the Checker.
+//
+// The handler accepts the same options as NewHandler, though only those that
+// apply to Check have any effect.
+func NewHTTPHandler(checker Checker, options ...connect.HandlerOption) http.Handler {
+	config := newHandlerConfig(options)
+	return config.withCORS(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			w.Header().Set("Allow", "GET, HEAD")
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		}
+		ctx := config.withRequestID(r.Context(), r.Header, w.Header())
+		ctx = config.withChannel(ctx, r.Header)
+		ctx = withHTTPRequestInfo(ctx, r)
+		result := config.runCheck(ctx, checker, &CheckRequest{
+			Service: r.URL.Query().Get("service"),
+		})
+		code := config.httpStatusCode(result)
+		config.setBuildHeaders(w.Header())
+		config.setRetryAfter(result, w.Header())
+		config.setStabilityHeaders(w.Header(), checker, result.Service)
+		config.setCacheHeaders(w.Header(), result)
+		w.Header().Add("Vary", "Accept")
+		if config.notModified(r, result) {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		if strings.Contains(r.Header.Get("Accept"), "application/json") {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(code)
+			_ = json.NewEncoder(w).Encode(result)
+			return
+		}
+		if result.Err != nil {
+			http.Error(w, http.StatusText(code), code)
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(code)
+		_, _ = w.Write([]byte(result.Status.String() + "\n"))
+	}))
+}
+
+// httpStatusCode returns the HTTP status code for the outcome of a check,
+// applying any mapping configured with WithHTTPStatusCodes.
+func (c *handlerConfig) httpStatusCode(result *CheckResult) int {
+	switch {
+	case connect.CodeOf(result.Err) == connect.CodeNotFound:
+		return http.StatusNotFound
+	case result.Err != nil:
+		return http.StatusInternalServerError
+	}
+	if code, ok := c.HTTPStatusCodes[result.Status]; ok {
+		return code
+	}
+	if result.Status == StatusServing {
+		return http.StatusOK
+	}
+	return http.StatusServiceUnavailable
+}
+
+// mapGETStatusCodes wraps a Check handler so that successful Connect GET
+// responses use the HTTP status codes configured with WithHTTPStatusCodes.
+// The handler records the checked status in the slot attached to the request
+// context.
+func (c *handlerConfig) mapGETStatusCodes(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			handler.ServeHTTP(w, r)
+			return
+		}
+		writer := &statusCodeWriter{ResponseWriter: w, config: c}
+		ctx := context.WithValue(r.Context(), statusSlotKey{}, &writer.status)
+		handler.ServeHTTP(writer, r.WithContext(ctx))
+	})
+}
+
+// recordStatus stores a checked status in the slot attached by
+// mapGETStatusCodes, if any.
+func recordStatus(ctx context.Context, status Status) {
+	if slot, ok := ctx.Value(statusSlotKey{}).(*statusSlot); ok {
+		slot.status, slot.set = status, true
+	}
+}
+
+type statusSlotKey struct{}
+
+type statusSlot struct {
+	status Status
+	set    bool
+}
+
+// statusCodeWriter replaces the HTTP 200 of a successful Check with the
+// configured code for the checked status.
+type statusCodeWriter struct {
+	http.ResponseWriter
+
+	config      *handlerConfig
+	status      statusSlot
+	wroteHeader bool
+}
+
+func (w *statusCodeWriter) WriteHeader(code int) {
+	if w.wroteHeader {
+		return
+	}
+	w.wroteHeader = true
+	if code == http.StatusOK && w.status.set {
+		code = w.config.httpStatusCode(&CheckResult{Status: w.status.status})
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *statusCodeWriter) Write(data []byte) (int, error) {
+	w.WriteHeader(http.StatusOK)
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *statusCodeWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
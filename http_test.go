@@ -0,0 +1,134 @@
+// Copyright 2022-2024 The Connect Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package grpchealth
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"connectrpc.com/connect"
+)
+
+func TestHTTPHandler(t *testing.T) {
+	const userFQN = "acme.user.v1.UserService"
+	t.Parallel()
+	checker := NewStaticChecker(userFQN)
+	checker.SetStatus(userFQN, StatusNotServing)
+	server := httptest.NewServer(NewHTTPHandler(checker))
+	t.Cleanup(server.Close)
+
+	assertResponse := func(t *testing.T, query string, code int, body string) {
+		t.Helper()
+		res, err := server.Client().Get(server.URL + query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer res.Body.Close()
+		if res.StatusCode != code {
+			t.Fatalf("%q: got HTTP %d, expected %d", query, res.StatusCode, code)
+		}
+		if body == "" {
+			return
+		}
+		got, err := io.ReadAll(res.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != body {
+			t.Fatalf("%q: got body %q, expected %q", query, got, body)
+		}
+	}
+	assertResponse(t, "", http.StatusOK, "serving\n")
+	assertResponse(t, "?service="+userFQN, http.StatusServiceUnavailable, "not_serving\n")
+	assertResponse(t, "?service=foobar", http.StatusNotFound, "")
+
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodGet, server.URL+"?service="+userFQN, http.NoBody)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Accept", "application/json")
+	res, err := server.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var result struct {
+		Service string `json:"service"`
+		Status  Status `json:"status"`
+	}
+	err = json.NewDecoder(res.Body).Decode(&result)
+	res.Body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.StatusCode != http.StatusServiceUnavailable || result.Service != userFQN || result.Status != StatusNotServing {
+		t.Fatalf("got HTTP %d and JSON %+v", res.StatusCode, result)
+	}
+
+	res, err = server.Client().Post(server.URL, "text/plain", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusMethodNotAllowed {
+		t.Fatalf("POST: got HTTP %d, expected %d", res.StatusCode, http.StatusMethodNotAllowed)
+	}
+}
+
+func TestHTTPStatusCodes(t *testing.T) {
+	const userFQN = "acme.user.v1.UserService"
+	t.Parallel()
+	checker := NewStaticChecker(userFQN)
+	options := []connect.HandlerOption{WithHTTPStatusCodes(map[Status]int{
+		StatusServing:    http.StatusNoContent,
+		StatusNotServing: http.StatusTooManyRequests,
+	})}
+	mux := http.NewServeMux()
+	mux.Handle(NewHandler(checker, options...))
+	mux.Handle("/healthz", NewHTTPHandler(checker, options...))
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	query := url.Values{
+		"encoding": {"json"},
+		"message":  {`{"service":"` + userFQN + `"}`},
+	}
+	for _, testCase := range []struct {
+		status Status
+		code   int
+	}{
+		{status: StatusServing, code: http.StatusNoContent},
+		{status: StatusNotServing, code: http.StatusTooManyRequests},
+	} {
+		checker.SetStatus(userFQN, testCase.status)
+		for _, target := range []string{
+			"/healthz?service=" + userFQN,
+			"/grpc.health.v1.Health/Check?" + query.Encode(),
+		} {
+			res, err := server.Client().Get(server.URL + target)
+			if err != nil {
+				t.Fatal(err)
+			}
+			res.Body.Close()
+			if res.StatusCode != testCase.code {
+				t.Fatalf("%v: got HTTP %d from %s, expected %d", testCase.status, res.StatusCode, target, testCase.code)
+			}
+		}
+	}
+}
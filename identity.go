@@ -0,0 +1,84 @@
+// Copyright 2022-2024 The Connect Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package grpchealth
+
+import (
+	"context"
+	"crypto/x509"
+	"net/http"
+	"net/url"
+)
+
+// PeerIdentity is the verified TLS identity of a client, for mesh deployments
+// that report different statuses to, or refuse, particular workloads.
+type PeerIdentity struct {
+	// Certificates is the client's verified certificate chain, leaf first.
+	Certificates []*x509.Certificate
+	// SPIFFEID is the SPIFFE ID in the leaf certificate's URI SANs, such as
+	// spiffe://example.org/ns/prod/sa/probe, if any.
+	SPIFFEID *url.URL
+}
+
+type peerIdentityKey struct{}
+
+// PeerIdentityFromContext returns the verified TLS identity of the client of
+// the health check request being served. Every handler in this package
+// attaches it to the context passed to Checkers. It returns false if the
+// client didn't present a certificate the server verified, for example
+// because the server's tls.Config doesn't set ClientAuth to
+// tls.VerifyClientCertIfGiven or tls.RequireAndVerifyClientCert.
+func PeerIdentityFromContext(ctx context.Context) (*PeerIdentity, bool) {
+	identity, ok := ctx.Value(peerIdentityKey{}).(*PeerIdentity)
+	return identity, ok
+}
+
+// PeerIdentityFromRequest returns the verified TLS identity of the client
+// that sent a request, for authorizers such as EnvoyAdminParams.Authorize.
+// Like PeerIdentityFromContext, it returns false unless the server verified
+// the client's certificate.
+func PeerIdentityFromRequest(r *http.Request) (*PeerIdentity, bool) {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.VerifiedChains[0]) == 0 {
+		return nil, false
+	}
+	chain := r.TLS.VerifiedChains[0]
+	identity := &PeerIdentity{Certificates: chain}
+	for _, uri := range chain[0].URIs {
+		if uri.Scheme == "spiffe" {
+			identity.SPIFFEID = uri
+			break
+		}
+	}
+	return identity, true
+}
+
+// withPeerIdentity attaches the verified TLS identity of the client, if any,
+// to the request context.
+func withPeerIdentity(ctx context.Context, r *http.Request) context.Context {
+	if identity, ok := PeerIdentityFromRequest(r); ok {
+		return context.WithValue(ctx, peerIdentityKey{}, identity)
+	}
+	return ctx
+}
+
+// attachPeerIdentity wraps an RPC handler to attach the client's verified TLS
+// identity to the context Connect passes to the handler.
+func attachPeerIdentity(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.TLS != nil {
+			r = r.WithContext(withPeerIdentity(r.Context(), r))
+		}
+		handler.ServeHTTP(w, r)
+	})
+}
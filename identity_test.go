@@ -0,0 +1,158 @@
+// Copyright 2022-2024 The Connect Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package grpchealth
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"connectrpc.com/connect"
+	healthv1 "connectrpc.com/grpchealth/internal/gen/go/connectext/grpc/health/v1"
+)
+
+func TestPeerIdentity(t *testing.T) {
+	const (
+		probeID = "spiffe://example.org/ns/prod/sa/probe"
+		userFQN = "acme.user.v1.UserService"
+	)
+	t.Parallel()
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, &caKey.PublicKey, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca, err := x509.ParseCertificate(caDER)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clientKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	spiffeID, err := url.Parse(probeID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clientDER, err := x509.CreateCertificate(rand.Reader, &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		URIs:         []*url.URL{spiffeID},
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}, ca, &clientKey.PublicKey, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Only the probe's workload sees the user service as serving.
+	checker := checkerFunc(func(ctx context.Context, req *CheckRequest) (*CheckResponse, error) {
+		if identity, ok := PeerIdentityFromContext(ctx); ok && identity.SPIFFEID.String() == probeID {
+			return &CheckResponse{Status: StatusServing}, nil
+		}
+		return &CheckResponse{Status: StatusNotServing}, nil
+	})
+	mux := http.NewServeMux()
+	mux.Handle(NewHandler(checker))
+	mux.Handle("/status", NewHTTPHandler(checker))
+	server := httptest.NewUnstartedServer(mux)
+	server.EnableHTTP2 = true
+	server.TLS = &tls.Config{
+		ClientAuth: tls.VerifyClientCertIfGiven,
+		ClientCAs:  x509.NewCertPool(),
+		MinVersion: tls.VersionTLS12,
+	}
+	server.TLS.ClientCAs.AddCert(ca)
+	server.StartTLS()
+	t.Cleanup(server.Close)
+
+	newHTTPClient := func(certificates ...tls.Certificate) *http.Client {
+		client := server.Client()
+		transport, _ := client.Transport.(*http.Transport)
+		transport = transport.Clone()
+		transport.TLSClientConfig.Certificates = certificates
+		return &http.Client{Transport: transport}
+	}
+	probe := newHTTPClient(tls.Certificate{Certificate: [][]byte{clientDER}, PrivateKey: clientKey})
+	anonymous := newHTTPClient()
+	for name, test := range map[string]struct {
+		client *http.Client
+		expect Status
+	}{
+		"probe":     {client: probe, expect: StatusServing},
+		"anonymous": {client: anonymous, expect: StatusNotServing},
+	} {
+		client := connect.NewClient[healthv1.HealthCheckRequest, healthv1.HealthCheckResponse](
+			test.client,
+			server.URL+"/grpc.health.v1.Health/Check",
+			connect.WithGRPC(),
+		)
+		res, err := client.CallUnary(context.Background(), connect.NewRequest(&healthv1.HealthCheckRequest{Service: userFQN}))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := Status(res.Msg.Status); got != test.expect {
+			t.Errorf("%s: got status %v over gRPC, expected %v", name, got, test.expect)
+		}
+		httpRes, err := test.client.Get(server.URL + "/status")
+		if err != nil {
+			t.Fatal(err)
+		}
+		httpRes.Body.Close()
+		if serving := httpRes.StatusCode == http.StatusOK; serving != (test.expect == StatusServing) {
+			t.Errorf("%s: got HTTP %d, expected %v", name, httpRes.StatusCode, test.expect)
+		}
+	}
+}
+
+func TestPeerIdentityFromRequest(t *testing.T) {
+	t.Parallel()
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	if _, ok := PeerIdentityFromRequest(req); ok {
+		t.Error("found identity without TLS")
+	}
+	req.TLS = &tls.ConnectionState{PeerCertificates: []*x509.Certificate{{}}}
+	if _, ok := PeerIdentityFromRequest(req); ok {
+		t.Error("found identity for an unverified certificate")
+	}
+	leaf := &x509.Certificate{URIs: []*url.URL{{Scheme: "https", Host: "example.org"}}}
+	req.TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{leaf}}}
+	identity, ok := PeerIdentityFromRequest(req)
+	if !ok || identity.Certificates[0] != leaf || identity.SPIFFEID != nil {
+		t.Errorf("got identity %+v, %v, expected the leaf without a SPIFFE ID", identity, ok)
+	}
+}
@@ -0,0 +1,101 @@
+// Copyright 2022-2024 The Connect Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package grpchealth
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// Pinger is implemented by clients that can verify their connection to a
+// remote system. The franz-go *kgo.Client implements Pinger directly; other
+// clients need a small adapter. For example, a sarama client can refresh its
+// metadata, which requires reaching a broker:
+//
+//	type saramaPinger struct{ client sarama.Client }
+//
+//	func (p saramaPinger) Ping(context.Context) error {
+//		return p.client.RefreshMetadata()
+//	}
+type Pinger interface {
+	Ping(ctx context.Context) error
+}
+
+// KafkaCheckerParams configure a KafkaChecker.
+type KafkaCheckerParams struct {
+	// Pinger verifies that at least one broker is reachable.
+	Pinger Pinger
+	// Lag optionally reports the total lag of the service's consumer group,
+	// in messages. If nil, lag isn't checked.
+	Lag func(ctx context.Context) (int64, error)
+	// MaxLag is the consumer group lag above which the service is too far
+	// behind to serve. Zero disables the lag check.
+	MaxLag int64
+	// Timeout bounds each check. Zero means no timeout beyond the context's.
+	Timeout time.Duration
+}
+
+// KafkaChecker is a Checker for services driven by Kafka. It reports
+// StatusNotServing when no broker is reachable or when the service's consumer
+// group has fallen too far behind. The details of the response include the
+// error or measured lag.
+//
+// KafkaChecker reports the same status for every service.
+type KafkaChecker struct {
+	params KafkaCheckerParams
+}
+
+// NewKafkaChecker constructs a KafkaChecker. The Pinger is required.
+func NewKafkaChecker(params KafkaCheckerParams) (*KafkaChecker, error) {
+	if params.Pinger == nil {
+		return nil, fmt.Errorf("kafka checker requires a Pinger")
+	}
+	return &KafkaChecker{params: params}, nil
+}
+
+// Check implements Checker.
+func (c *KafkaChecker) Check(ctx context.Context, _ *CheckRequest) (*CheckResponse, error) {
+	if c.params.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.params.Timeout)
+		defer cancel()
+	}
+	if err := c.params.Pinger.Ping(ctx); err != nil {
+		return &CheckResponse{
+			Status:  StatusNotServing,
+			Details: map[string]string{"error": err.Error()},
+		}, nil
+	}
+	if c.params.Lag == nil {
+		return &CheckResponse{Status: StatusServing}, nil
+	}
+	lag, err := c.params.Lag(ctx)
+	if err != nil {
+		return &CheckResponse{
+			Status:  StatusNotServing,
+			Details: map[string]string{"error": err.Error()},
+		}, nil
+	}
+	status := StatusServing
+	if c.params.MaxLag > 0 && lag > c.params.MaxLag {
+		status = StatusNotServing
+	}
+	return &CheckResponse{
+		Status:  status,
+		Details: map[string]string{"lag": strconv.FormatInt(lag, 10)},
+	}, nil
+}
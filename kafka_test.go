@@ -0,0 +1,63 @@
+// Copyright 2022-2024 The Connect Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package grpchealth
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+type pingerFunc func(context.Context) error
+
+func (f pingerFunc) Ping(ctx context.Context) error { return f(ctx) }
+
+func TestKafkaChecker(t *testing.T) {
+	t.Parallel()
+	if _, err := NewKafkaChecker(KafkaCheckerParams{}); err == nil { //nolint:exhaustruct // missing Pinger is under test
+		t.Fatal("expected error without Pinger")
+	}
+	var pingErr error
+	var lag int64
+	checker, err := NewKafkaChecker(KafkaCheckerParams{
+		Pinger:  pingerFunc(func(context.Context) error { return pingErr }),
+		Lag:     func(context.Context) (int64, error) { return lag, nil },
+		MaxLag:  100,
+		Timeout: time.Second,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, testCase := range []struct {
+		name    string
+		pingErr error
+		lag     int64
+		expect  Status
+	}{
+		{name: "healthy", lag: 10, expect: StatusServing},
+		{name: "lagging", lag: 101, expect: StatusNotServing},
+		{name: "unreachable", pingErr: errors.New("no brokers"), expect: StatusNotServing},
+	} {
+		pingErr, lag = testCase.pingErr, testCase.lag
+		res, err := checker.Check(context.Background(), &CheckRequest{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.Status != testCase.expect {
+			t.Fatalf("%s: got status %v, expected %v (details %v)", testCase.name, res.Status, testCase.expect, res.Details)
+		}
+	}
+}
@@ -0,0 +1,334 @@
+// Copyright 2022-2024 The Connect Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build kubernetes
+
+package grpchealth
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// serviceAccountDir holds the credentials Kubernetes mounts into every pod.
+const serviceAccountDir = "/var/run/secrets/kubernetes.io/serviceaccount"
+
+// EndpointSliceWatcherParams configure an EndpointSliceWatcher. Only Monitor
+// and Service are required; the defaults suit a controller running in the
+// cluster with a service account allowed to list and watch EndpointSlices.
+type EndpointSliceWatcherParams struct {
+	// Monitor receives the Service's targets.
+	Monitor *Monitor
+	// Namespace is the namespace of the Service. The default is the pod's own
+	// namespace.
+	Namespace string
+	// Service is the name of the Kubernetes Service to follow.
+	Service string
+	// Port is the name of the EndpointSlice port serving health checks. If
+	// it's empty, each slice's first port is used.
+	Port string
+	// Scheme is the scheme of target URLs. The default is "http".
+	Scheme string
+	// APIServer is the base URL of the Kubernetes API. The default is
+	// "https://kubernetes.default.svc".
+	APIServer string
+	// HTTPClient calls the Kubernetes API. The default trusts the service
+	// account's CA bundle.
+	HTTPClient *http.Client
+	// TokenFile holds the bearer token for the Kubernetes API. It's read
+	// before each request, so rotated tokens are picked up. The default is the
+	// service account's token.
+	TokenFile string
+	// OnError, if set, is called with errors listing or watching
+	// EndpointSlices. The watcher retries after errors.
+	OnError func(error)
+	// Clock schedules retries. The default is the system clock.
+	Clock Clock
+}
+
+// EndpointSliceWatcher feeds the addresses of the pods backing a Kubernetes
+// Service into a Monitor, so a controller can follow the health of every pod
+// without maintaining a list of addresses. It watches the Service's
+// EndpointSlices through the Kubernetes API and sets the Monitor's targets to
+// the URLs of the ready endpoints.
+//
+// EndpointSliceWatcher is only built with the kubernetes build tag.
+type EndpointSliceWatcher struct {
+	params  EndpointSliceWatcherParams
+	backoff *Backoff
+	slices  map[string][]string // slice name -> targets
+}
+
+// NewEndpointSliceWatcher constructs an EndpointSliceWatcher. It returns an
+// error if the monitor or service is missing, or if a default namespace or
+// CA bundle is needed and can't be read.
+func NewEndpointSliceWatcher(params EndpointSliceWatcherParams) (*EndpointSliceWatcher, error) {
+	if params.Monitor == nil {
+		return nil, errors.New("endpoint slice watcher requires a monitor")
+	}
+	if params.Service == "" {
+		return nil, errors.New("endpoint slice watcher requires a service")
+	}
+	if params.Namespace == "" {
+		namespace, err := os.ReadFile(serviceAccountDir + "/namespace")
+		if err != nil {
+			return nil, fmt.Errorf("read pod namespace: %w", err)
+		}
+		params.Namespace = strings.TrimSpace(string(namespace))
+	}
+	if params.Scheme == "" {
+		params.Scheme = "http"
+	}
+	if params.APIServer == "" {
+		params.APIServer = "https://kubernetes.default.svc"
+	}
+	params.APIServer = strings.TrimSuffix(params.APIServer, "/")
+	if params.HTTPClient == nil {
+		bundle, err := os.ReadFile(serviceAccountDir + "/ca.crt")
+		if err != nil {
+			return nil, fmt.Errorf("read kubernetes CA bundle: %w", err)
+		}
+		roots := x509.NewCertPool()
+		if !roots.AppendCertsFromPEM(bundle) {
+			return nil, errors.New("kubernetes CA bundle has no certificates")
+		}
+		params.HTTPClient = &http.Client{
+			Transport: &http.Transport{
+				Proxy:           http.ProxyFromEnvironment,
+				TLSClientConfig: &tls.Config{RootCAs: roots, MinVersion: tls.VersionTLS12},
+			},
+		}
+	}
+	if params.TokenFile == "" {
+		params.TokenFile = serviceAccountDir + "/token"
+	}
+	if params.Clock == nil {
+		params.Clock = systemClock{}
+	}
+	backoff := NewBackoff()
+	backoff.Clock = params.Clock
+	return &EndpointSliceWatcher{params: params, backoff: backoff}, nil
+}
+
+// Run lists the Service's EndpointSlices, then watches them for changes,
+// updating the Monitor's targets after each change until ctx ends. It then
+// returns ctx's error, leaving the Monitor's targets as they were. Run
+// should be called once.
+func (w *EndpointSliceWatcher) Run(ctx context.Context) error {
+	var (
+		version string
+		attempt int
+	)
+	for {
+		var err error
+		if version == "" {
+			version, err = w.list(ctx)
+		}
+		if err == nil {
+			attempt = 0
+			version, err = w.watch(ctx, version)
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err == nil {
+			// The API server ends watches periodically; resume from the last
+			// version seen.
+			continue
+		}
+		// Relist after any error, since watch events may have been missed.
+		version = ""
+		if w.params.OnError != nil {
+			w.params.OnError(err)
+		}
+		if err := w.backoff.Wait(ctx, attempt); err != nil {
+			return err
+		}
+		attempt++
+	}
+}
+
+// list replaces the known slices with the current ones and returns their
+// resource version.
+func (w *EndpointSliceWatcher) list(ctx context.Context) (string, error) {
+	body, err := w.get(ctx, nil)
+	if err != nil {
+		return "", err
+	}
+	defer body.Close()
+	var list struct {
+		Metadata struct {
+			ResourceVersion string `json:"resourceVersion"`
+		} `json:"metadata"`
+		Items []endpointSlice `json:"items"`
+	}
+	if err := json.NewDecoder(body).Decode(&list); err != nil {
+		return "", fmt.Errorf("decode endpoint slices: %w", err)
+	}
+	w.slices = make(map[string][]string, len(list.Items))
+	for _, slice := range list.Items {
+		w.slices[slice.Metadata.Name] = w.targets(&slice)
+	}
+	w.apply()
+	return list.Metadata.ResourceVersion, nil
+}
+
+// watch applies changes after version until the API server ends the watch,
+// and returns the last resource version seen.
+func (w *EndpointSliceWatcher) watch(ctx context.Context, version string) (string, error) {
+	body, err := w.get(ctx, url.Values{
+		"watch":               {"true"},
+		"resourceVersion":     {version},
+		"allowWatchBookmarks": {"true"},
+	})
+	if err != nil {
+		return version, err
+	}
+	defer body.Close()
+	decoder := json.NewDecoder(body)
+	for {
+		var event struct {
+			Type   string          `json:"type"`
+			Object json.RawMessage `json:"object"`
+		}
+		if err := decoder.Decode(&event); err != nil {
+			if errors.Is(err, io.EOF) {
+				return version, nil
+			}
+			return version, fmt.Errorf("decode endpoint slice event: %w", err)
+		}
+		if event.Type == "ERROR" {
+			var status struct {
+				Message string `json:"message"`
+			}
+			_ = json.Unmarshal(event.Object, &status)
+			return version, fmt.Errorf("watch endpoint slices: %s", status.Message)
+		}
+		var slice endpointSlice
+		if err := json.Unmarshal(event.Object, &slice); err != nil {
+			return version, fmt.Errorf("decode endpoint slice: %w", err)
+		}
+		version = slice.Metadata.ResourceVersion
+		switch event.Type {
+		case "ADDED", "MODIFIED":
+			w.slices[slice.Metadata.Name] = w.targets(&slice)
+		case "DELETED":
+			delete(w.slices, slice.Metadata.Name)
+		default: // BOOKMARK only advances the version.
+			continue
+		}
+		w.apply()
+	}
+}
+
+// get requests the Service's EndpointSlices with additional query
+// parameters, and returns the response body if the request succeeded.
+func (w *EndpointSliceWatcher) get(ctx context.Context, query url.Values) (io.ReadCloser, error) {
+	if query == nil {
+		query = url.Values{}
+	}
+	query.Set("labelSelector", "kubernetes.io/service-name="+w.params.Service)
+	endpoint := fmt.Sprintf(
+		"%s/apis/discovery.k8s.io/v1/namespaces/%s/endpointslices?%s",
+		w.params.APIServer,
+		url.PathEscape(w.params.Namespace),
+		query.Encode(),
+	)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, http.NoBody)
+	if err != nil {
+		return nil, err
+	}
+	token, err := os.ReadFile(w.params.TokenFile)
+	if err != nil {
+		return nil, fmt.Errorf("read kubernetes token: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+strings.TrimSpace(string(token)))
+	req.Header.Set("Accept", "application/json")
+	res, err := w.params.HTTPClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode != http.StatusOK {
+		res.Body.Close()
+		return nil, fmt.Errorf("kubernetes API: unexpected status %s", res.Status)
+	}
+	return res.Body, nil
+}
+
+// apply sets the Monitor's targets to those of every known slice.
+func (w *EndpointSliceWatcher) apply() {
+	var targets []string
+	for _, slice := range w.slices {
+		targets = append(targets, slice...)
+	}
+	sort.Strings(targets)
+	w.params.Monitor.SetTargets(targets)
+}
+
+// targets returns the URLs of a slice's ready endpoints.
+func (w *EndpointSliceWatcher) targets(slice *endpointSlice) []string {
+	var port *int32
+	for _, candidate := range slice.Ports {
+		if w.params.Port == "" || candidate.Name == w.params.Port {
+			port = candidate.Port
+			break
+		}
+	}
+	if port == nil {
+		return nil
+	}
+	var targets []string
+	for _, endpoint := range slice.Endpoints {
+		// Unset conditions mean the endpoint is ready.
+		if endpoint.Conditions.Ready != nil && !*endpoint.Conditions.Ready {
+			continue
+		}
+		for _, address := range endpoint.Addresses {
+			host := net.JoinHostPort(address, strconv.Itoa(int(*port)))
+			targets = append(targets, w.params.Scheme+"://"+host)
+		}
+	}
+	return targets
+}
+
+// endpointSlice is the subset of a discovery.k8s.io/v1 EndpointSlice used to
+// find targets.
+type endpointSlice struct {
+	Metadata struct {
+		Name            string `json:"name"`
+		ResourceVersion string `json:"resourceVersion"`
+	} `json:"metadata"`
+	Ports []struct {
+		Name string `json:"name"`
+		Port *int32 `json:"port"`
+	} `json:"ports"`
+	Endpoints []struct {
+		Addresses  []string `json:"addresses"`
+		Conditions struct {
+			Ready *bool `json:"ready"`
+		} `json:"conditions"`
+	} `json:"endpoints"`
+}
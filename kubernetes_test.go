@@ -0,0 +1,156 @@
+// Copyright 2022-2024 The Connect Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build kubernetes
+
+package grpchealth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestEndpointSliceWatcher(t *testing.T) {
+	t.Parallel()
+	const sliceA = `{
+		"metadata": {"name": "users-a", "resourceVersion": "1"},
+		"ports": [{"name": "metrics", "port": 9090}, {"name": "grpc", "port": 8080}],
+		"endpoints": [
+			{"addresses": ["127.0.0.1"], "conditions": {"ready": true}},
+			{"addresses": ["127.0.0.2"], "conditions": {"ready": false}},
+			{"addresses": ["::1"], "conditions": {}}
+		]
+	}`
+	const sliceB = `{
+		"metadata": {"name": "users-b", "resourceVersion": "2"},
+		"ports": [{"name": "grpc", "port": 8080}],
+		"endpoints": [{"addresses": ["127.0.0.3"]}]
+	}`
+	events := make(chan string)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/apis/discovery.k8s.io/v1/namespaces/prod/endpointslices" ||
+			r.URL.Query().Get("labelSelector") != "kubernetes.io/service-name=users" ||
+			r.Header.Get("Authorization") != "Bearer secret" {
+			http.Error(w, "unexpected request "+r.URL.String(), http.StatusForbidden)
+			return
+		}
+		if r.URL.Query().Get("watch") == "" {
+			fmt.Fprintf(w, `{"metadata": {"resourceVersion": "1"}, "items": [%s]}`, sliceA)
+			return
+		}
+		if r.URL.Query().Get("resourceVersion") == "" {
+			http.Error(w, "watch without a resource version", http.StatusBadRequest)
+			return
+		}
+		w.(http.Flusher).Flush()
+		for {
+			select {
+			case <-r.Context().Done():
+				return
+			case event := <-events:
+				fmt.Fprintln(w, event)
+				w.(http.Flusher).Flush()
+			}
+		}
+	}))
+	t.Cleanup(server.Close)
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	if err := os.WriteFile(tokenFile, []byte("secret\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	monitor := NewMonitor(MonitorParams{Service: "", NewClient: nil, OnChange: nil})
+	defer monitor.Close()
+	watcher, err := NewEndpointSliceWatcher(EndpointSliceWatcherParams{
+		Monitor:    monitor,
+		Namespace:  "prod",
+		Service:    "users",
+		Port:       "grpc",
+		Scheme:     "",
+		APIServer:  server.URL,
+		HTTPClient: server.Client(),
+		TokenFile:  tokenFile,
+		OnError:    func(err error) { t.Error(err) },
+		Clock:      nil,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- watcher.Run(ctx) }()
+	expectTargets := func(expect ...string) {
+		t.Helper()
+		deadline := time.Now().Add(5 * time.Second)
+		for {
+			got := monitor.Targets()
+			if reflect.DeepEqual(got, expect) {
+				return
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("got targets %v, expected %v", got, expect)
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+
+	expectTargets("http://127.0.0.1:8080", "http://[::1]:8080")
+	events <- `{"type": "ADDED", "object": ` + sliceB + `}`
+	expectTargets("http://127.0.0.1:8080", "http://127.0.0.3:8080", "http://[::1]:8080")
+	events <- `{"type": "BOOKMARK", "object": {"metadata": {"resourceVersion": "3"}}}`
+	events <- `{"type": "DELETED", "object": ` + sliceA + `}`
+	expectTargets("http://127.0.0.3:8080")
+
+	cancel()
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Fatalf("got error %v, expected %v", err, context.Canceled)
+	}
+}
+
+func TestEndpointSliceWatcherParams(t *testing.T) {
+	t.Parallel()
+	monitor := NewMonitor(MonitorParams{Service: "", NewClient: nil, OnChange: nil})
+	defer monitor.Close()
+	params := EndpointSliceWatcherParams{
+		Monitor:    nil,
+		Namespace:  "prod",
+		Service:    "users",
+		Port:       "",
+		Scheme:     "",
+		APIServer:  "",
+		HTTPClient: http.DefaultClient,
+		TokenFile:  "",
+		OnError:    nil,
+		Clock:      nil,
+	}
+	if _, err := NewEndpointSliceWatcher(params); err == nil {
+		t.Fatal("expected an error without a monitor")
+	}
+	params.Monitor = monitor
+	params.Service = ""
+	if _, err := NewEndpointSliceWatcher(params); err == nil {
+		t.Fatal("expected an error without a service")
+	}
+	params.Service = "users"
+	if _, err := NewEndpointSliceWatcher(params); err != nil {
+		t.Fatal(err)
+	}
+}
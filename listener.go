@@ -0,0 +1,188 @@
+// Copyright 2022-2024 The Connect Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package grpchealth
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// ListenerMonitorParams configure a ListenerMonitor.
+type ListenerMonitorParams struct {
+	// Setter receives the status of Service, such as a StaticChecker.
+	Setter StatusSetter
+	// Service is the service to degrade. The empty string, the default,
+	// represents the whole process.
+	Service string
+	// MaxAcceptErrors is how many accept errors may occur within Window
+	// before the service is degraded. The default is 10.
+	MaxAcceptErrors int
+	// Window is the period over which accept errors are counted. The default
+	// is a minute.
+	Window time.Duration
+	// Clock measures the window. The default is the system clock.
+	Clock Clock
+}
+
+// ListenerMonitor degrades a service to StatusNotServing when the server in
+// front of it stops accepting connections: when its listener dies, or when
+// accept errors spike, for example because the process ran out of file
+// descriptors. These failures leave the application alive, and its health
+// checks may even pass over existing connections, while it no longer
+// actually serves.
+//
+//	monitor, err := grpchealth.NewListenerMonitor(grpchealth.ListenerMonitorParams{Setter: checker})
+//	listener, err := net.Listen("tcp", addr)
+//	err = server.Serve(monitor.Listener(listener))
+//	monitor.ServeExited(err)
+//
+// Once accept errors subside and a connection is accepted after a quiet
+// window, the service is restored to StatusServing. A dead listener is never
+// restored. The monitor only sets the service's status when its own
+// assessment changes, so other components can still manage the service.
+type ListenerMonitor struct {
+	params ListenerMonitorParams
+
+	setMu    sync.Mutex // orders calls to the Setter
+	mu       sync.Mutex
+	errors   []time.Time
+	degraded bool
+	dead     bool
+}
+
+// NewListenerMonitor constructs a ListenerMonitor. It returns an error if the
+// Setter is missing.
+func NewListenerMonitor(params ListenerMonitorParams) (*ListenerMonitor, error) {
+	if params.Setter == nil {
+		return nil, errors.New("listener monitor requires a status setter")
+	}
+	if params.MaxAcceptErrors <= 0 {
+		params.MaxAcceptErrors = 10
+	}
+	if params.Window <= 0 {
+		params.Window = time.Minute
+	}
+	if params.Clock == nil {
+		params.Clock = systemClock{}
+	}
+	return &ListenerMonitor{params: params}, nil
+}
+
+// Listener wraps a listener to watch its accepted connections and accept
+// errors. Serve the server from the wrapped listener.
+func (m *ListenerMonitor) Listener(listener net.Listener) net.Listener {
+	return &monitoredListener{Listener: listener, monitor: m}
+}
+
+// ServeExited reports that the server's Serve method returned. Unless the
+// server was shut down deliberately, its listener is dead, and the service
+// is degraded for good.
+func (m *ListenerMonitor) ServeExited(err error) {
+	if err == nil || errors.Is(err, http.ErrServerClosed) {
+		return
+	}
+	m.mu.Lock()
+	m.dead = true
+	m.setDegraded(true)
+}
+
+// Degraded reports whether the monitor has degraded the service.
+func (m *ListenerMonitor) Degraded() bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.degraded
+}
+
+// acceptFailed records an accept error, degrading the service if errors have
+// spiked.
+func (m *ListenerMonitor) acceptFailed() {
+	m.mu.Lock()
+	now := m.params.Clock.Now()
+	m.errors = append(m.prune(now), now)
+	if len(m.errors) <= m.params.MaxAcceptErrors {
+		m.mu.Unlock()
+		return
+	}
+	m.setDegraded(true)
+}
+
+// accepted records an accepted connection, restoring the service if it was
+// degraded and no errors occurred within the window.
+func (m *ListenerMonitor) accepted() {
+	m.mu.Lock()
+	if !m.degraded || m.dead {
+		m.mu.Unlock()
+		return
+	}
+	if m.errors = m.prune(m.params.Clock.Now()); len(m.errors) != 0 {
+		m.mu.Unlock()
+		return
+	}
+	m.setDegraded(false)
+}
+
+// prune drops accept errors older than the window. The caller must hold m.mu.
+func (m *ListenerMonitor) prune(now time.Time) []time.Time {
+	cutoff := now.Add(-m.params.Window)
+	kept := m.errors[:0]
+	for _, at := range m.errors {
+		if at.After(cutoff) {
+			kept = append(kept, at)
+		}
+	}
+	return kept
+}
+
+// setDegraded updates the service's status if the monitor's assessment
+// changed. The caller must hold m.mu, which setDegraded releases before
+// calling the Setter, so a slow Setter doesn't hold up Accept or Degraded.
+func (m *ListenerMonitor) setDegraded(degraded bool) {
+	if m.degraded == degraded {
+		m.mu.Unlock()
+		return
+	}
+	m.degraded = degraded
+	status := StatusServing
+	if degraded {
+		status = StatusNotServing
+	}
+	// Hold setMu before releasing mu, so statuses are set in the order the
+	// assessment changed.
+	m.setMu.Lock()
+	m.mu.Unlock()
+	defer m.setMu.Unlock()
+	m.params.Setter.SetStatus(m.params.Service, status)
+}
+
+type monitoredListener struct {
+	net.Listener
+
+	monitor *ListenerMonitor
+}
+
+func (l *monitoredListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		if !errors.Is(err, net.ErrClosed) {
+			l.monitor.acceptFailed()
+		}
+		return nil, err
+	}
+	l.monitor.accepted()
+	return conn, nil
+}
@@ -0,0 +1,140 @@
+// Copyright 2022-2024 The Connect Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package grpchealth
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestListenerMonitor(t *testing.T) {
+	t.Parallel()
+	checker := NewStaticChecker()
+	clock := &manualClock{now: time.Unix(0, 0)}
+	monitor, err := NewListenerMonitor(ListenerMonitorParams{
+		Setter:          checker,
+		MaxAcceptErrors: 2,
+		Window:          time.Minute,
+		Clock:           clock,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	accepts := make(chan error, 8)
+	listener := monitor.Listener(&scriptedListener{accepts: accepts})
+	accept := func(err error) {
+		t.Helper()
+		accepts <- err
+		if conn, err := listener.Accept(); err == nil {
+			conn.Close()
+		}
+	}
+	assertStatus := func(expect Status) {
+		t.Helper()
+		res, err := checker.Check(context.Background(), &CheckRequest{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.Status != expect {
+			t.Fatalf("got status %v, expected %v", res.Status, expect)
+		}
+	}
+
+	tooManyFiles := errors.New("accept: too many open files")
+	accept(tooManyFiles)
+	accept(tooManyFiles)
+	assertStatus(StatusServing)
+	accept(tooManyFiles)
+	assertStatus(StatusNotServing)
+	// Connections accepted while errors are recent don't restore the service.
+	accept(nil)
+	assertStatus(StatusNotServing)
+	clock.Advance(time.Minute)
+	accept(nil)
+	assertStatus(StatusServing)
+	if monitor.Degraded() {
+		t.Error("monitor still degraded after recovering")
+	}
+
+	// Shutting down deliberately isn't a failure, but a dead listener is, for
+	// good.
+	monitor.ServeExited(http.ErrServerClosed)
+	assertStatus(StatusServing)
+	monitor.ServeExited(errors.New("accept: use of closed network connection"))
+	assertStatus(StatusNotServing)
+	clock.Advance(time.Hour)
+	accept(nil)
+	assertStatus(StatusNotServing)
+}
+
+func TestListenerMonitorSetterUnlocked(t *testing.T) {
+	t.Parallel()
+	var monitor *ListenerMonitor
+	var degraded []bool
+	// A Setter that inspects the monitor would deadlock if it were called
+	// with the monitor's lock held.
+	setter := setterFunc(func(string, Status) {
+		degraded = append(degraded, monitor.Degraded())
+	})
+	monitor, err := NewListenerMonitor(ListenerMonitorParams{Setter: setter, MaxAcceptErrors: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	accepts := make(chan error, 2)
+	listener := monitor.Listener(&scriptedListener{accepts: accepts})
+	for i := 0; i < 2; i++ {
+		accepts <- errors.New("accept: too many open files")
+		if _, err := listener.Accept(); err == nil {
+			t.Fatal("expected an accept error")
+		}
+	}
+	if len(degraded) != 1 || !degraded[0] {
+		t.Fatalf("Setter saw degraded states %v", degraded)
+	}
+	if _, err := NewListenerMonitor(ListenerMonitorParams{}); err == nil {
+		t.Error("expected an error without a Setter")
+	}
+}
+
+type setterFunc func(service string, status Status)
+
+func (f setterFunc) SetStatus(service string, status Status) {
+	f(service, status)
+}
+
+// scriptedListener returns the errors it's sent from Accept, or a connection
+// for nil errors.
+type scriptedListener struct {
+	accepts chan error
+}
+
+func (l *scriptedListener) Accept() (net.Conn, error) {
+	if err := <-l.accepts; err != nil {
+		return nil, err
+	}
+	server, client := net.Pipe()
+	go func() {
+		_, _ = io.Copy(io.Discard, client)
+	}()
+	return server, nil
+}
+
+func (l *scriptedListener) Close() error   { return nil }
+func (l *scriptedListener) Addr() net.Addr { return &net.TCPAddr{} }
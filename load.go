@@ -0,0 +1,178 @@
+// Copyright 2022-2024 The Connect Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package grpchealth
+
+import (
+	"context"
+	"math"
+	"runtime"
+	"runtime/metrics"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// LoadCheckerParams configure a LoadChecker. A zero limit disables the
+// corresponding check.
+type LoadCheckerParams struct {
+	// MaxCPU is the fraction of available CPU, between 0 and 1, above which
+	// the process is overloaded. Available CPU is GOMAXPROCS cores. Process CPU
+	// usage can only be measured on Unix-like systems; elsewhere, MaxCPU is
+	// ignored.
+	MaxCPU float64
+	// MaxSchedulingLatency is the 99th percentile of the time goroutines spend
+	// waiting to run above which the process is overloaded. It's a good proxy
+	// for the length of the scheduler's run queue.
+	MaxSchedulingLatency time.Duration
+	// MaxGCPause is the 99th percentile of stop-the-world garbage collection
+	// pauses above which the process is overloaded.
+	MaxGCPause time.Duration
+	// Interval is the minimum time between samples. Checks made more often
+	// reuse the previous result.
+	Interval time.Duration
+	// Clock times samples. The default is the system clock.
+	Clock Clock
+}
+
+// LoadChecker is a Checker that sheds load from overloaded processes. It
+// samples process CPU usage, scheduling latency, and garbage collection
+// pauses, and it reports StatusNotServing while any of them exceeds its limit
+// so that load balancers send traffic elsewhere. Each sample covers the period
+// since the previous one. The details of the response include the measured
+// values.
+//
+// LoadChecker reports the same status for every service.
+type LoadChecker struct {
+	params LoadCheckerParams
+
+	mu       sync.Mutex
+	last     loadSample
+	response *CheckResponse
+}
+
+// NewLoadChecker constructs a LoadChecker. The first sample covers the period
+// since construction.
+func NewLoadChecker(params LoadCheckerParams) *LoadChecker {
+	if params.Clock == nil {
+		params.Clock = systemClock{}
+	}
+	return &LoadChecker{
+		params:   params,
+		last:     takeLoadSample(params.Clock.Now()),
+		response: &CheckResponse{Status: StatusServing},
+	}
+}
+
+// Check implements Checker.
+func (c *LoadChecker) Check(_ context.Context, _ *CheckRequest) (*CheckResponse, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := c.params.Clock.Now()
+	if now.Sub(c.last.at) < c.params.Interval {
+		return c.response, nil
+	}
+	sample := takeLoadSample(now)
+	status := StatusServing
+	details := make(map[string]string, 3)
+	if cpu, ok := sample.cpuFraction(&c.last); ok {
+		details["cpu"] = strconv.FormatFloat(cpu, 'f', 3, 64)
+		if c.params.MaxCPU > 0 && cpu > c.params.MaxCPU {
+			status = StatusNotServing
+		}
+	}
+	if latency, ok := histogramPercentile(c.last.schedLatencies, sample.schedLatencies, 0.99); ok {
+		details["scheduling_latency_p99"] = latency.String()
+		if c.params.MaxSchedulingLatency > 0 && latency > c.params.MaxSchedulingLatency {
+			status = StatusNotServing
+		}
+	}
+	if pause, ok := histogramPercentile(c.last.gcPauses, sample.gcPauses, 0.99); ok {
+		details["gc_pause_p99"] = pause.String()
+		if c.params.MaxGCPause > 0 && pause > c.params.MaxGCPause {
+			status = StatusNotServing
+		}
+	}
+	c.last = sample
+	c.response = &CheckResponse{Status: status, Details: details}
+	return c.response, nil
+}
+
+type loadSample struct {
+	at             time.Time
+	cpuTime        time.Duration // negative if unavailable
+	schedLatencies *metrics.Float64Histogram
+	gcPauses       *metrics.Float64Histogram
+}
+
+func takeLoadSample(now time.Time) loadSample {
+	samples := []metrics.Sample{
+		{Name: "/sched/latencies:seconds"},
+		{Name: "/gc/pauses:seconds"},
+	}
+	metrics.Read(samples)
+	sample := loadSample{
+		at:      now,
+		cpuTime: processCPUTime(),
+	}
+	if samples[0].Value.Kind() == metrics.KindFloat64Histogram {
+		sample.schedLatencies = samples[0].Value.Float64Histogram()
+	}
+	if samples[1].Value.Kind() == metrics.KindFloat64Histogram {
+		sample.gcPauses = samples[1].Value.Float64Histogram()
+	}
+	return sample
+}
+
+// cpuFraction returns the fraction of available CPU used since the previous
+// sample.
+func (s *loadSample) cpuFraction(previous *loadSample) (float64, bool) {
+	elapsed := s.at.Sub(previous.at)
+	if s.cpuTime < 0 || previous.cpuTime < 0 || elapsed <= 0 {
+		return 0, false
+	}
+	available := float64(elapsed) * float64(runtime.GOMAXPROCS(0))
+	return float64(s.cpuTime-previous.cpuTime) / available, true
+}
+
+// histogramPercentile estimates a percentile of the values added to a
+// cumulative histogram between two readings. It reports false if no values
+// were added.
+func histogramPercentile(before, after *metrics.Float64Histogram, percentile float64) (time.Duration, bool) {
+	if before == nil || after == nil || len(before.Counts) != len(after.Counts) {
+		return 0, false
+	}
+	var total uint64
+	for i := range after.Counts {
+		total += after.Counts[i] - before.Counts[i]
+	}
+	if total == 0 {
+		return 0, false
+	}
+	target := uint64(math.Ceil(percentile * float64(total)))
+	var seen uint64
+	for i := range after.Counts {
+		seen += after.Counts[i] - before.Counts[i]
+		if seen < target {
+			continue
+		}
+		// Use the bucket's upper bound, unless it's unbounded.
+		bound := after.Buckets[i+1]
+		if math.IsInf(bound, 1) {
+			bound = after.Buckets[i]
+		}
+		return time.Duration(bound * float64(time.Second)), true
+	}
+	return 0, false
+}
@@ -0,0 +1,106 @@
+// Copyright 2022-2024 The Connect Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package grpchealth
+
+import (
+	"context"
+	"math"
+	"runtime/metrics"
+	"testing"
+	"time"
+)
+
+func TestLoadChecker(t *testing.T) {
+	t.Parallel()
+	checker := NewLoadChecker(LoadCheckerParams{
+		MaxCPU:               0,
+		MaxSchedulingLatency: time.Hour,
+		MaxGCPause:           time.Hour,
+		Interval:             0,
+	})
+	res, err := checker.Check(context.Background(), &CheckRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Status != StatusServing {
+		t.Fatalf("got status %v, expected %v", res.Status, StatusServing)
+	}
+
+	cached := NewLoadChecker(LoadCheckerParams{
+		MaxCPU:               0,
+		MaxSchedulingLatency: 0,
+		MaxGCPause:           0,
+		Interval:             time.Hour,
+	})
+	first, err := cached.Check(context.Background(), &CheckRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := cached.Check(context.Background(), &CheckRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first != second {
+		t.Fatal("expected second check within interval to reuse the first result")
+	}
+}
+
+func TestLoadCheckerCPU(t *testing.T) {
+	t.Parallel()
+	if processCPUTime() < 0 {
+		t.Skip("process CPU time unavailable on this platform")
+	}
+	checker := NewLoadChecker(LoadCheckerParams{
+		MaxCPU:               math.SmallestNonzeroFloat64,
+		MaxSchedulingLatency: 0,
+		MaxGCPause:           0,
+		Interval:             0,
+	})
+	// Burn some CPU.
+	deadline := time.Now().Add(20 * time.Millisecond)
+	for time.Now().Before(deadline) { //nolint:revive // busy loop is deliberate
+	}
+	res, err := checker.Check(context.Background(), &CheckRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Status != StatusNotServing {
+		t.Fatalf("got status %v, expected %v", res.Status, StatusNotServing)
+	}
+	if res.Details["cpu"] == "" {
+		t.Fatalf("expected CPU usage in details, got %v", res.Details)
+	}
+}
+
+func TestHistogramPercentile(t *testing.T) {
+	t.Parallel()
+	before := &metrics.Float64Histogram{
+		Counts:  []uint64{5, 5, 5},
+		Buckets: []float64{0, 0.001, 0.01, math.Inf(1)},
+	}
+	after := &metrics.Float64Histogram{
+		Counts:  []uint64{95, 14, 6},
+		Buckets: before.Buckets,
+	}
+	if got, ok := histogramPercentile(before, after, 0.5); !ok || got != time.Millisecond {
+		t.Fatalf("got p50 %v, expected %v", got, time.Millisecond)
+	}
+	if got, ok := histogramPercentile(before, after, 0.99); !ok || got != 10*time.Millisecond {
+		t.Fatalf("got p99 %v, expected %v", got, 10*time.Millisecond)
+	}
+	if _, ok := histogramPercentile(before, before, 0.99); ok {
+		t.Fatal("expected no percentile without new values")
+	}
+}
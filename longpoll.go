@@ -0,0 +1,134 @@
+// Copyright 2022-2024 The Connect Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package grpchealth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"connectrpc.com/connect"
+)
+
+const (
+	defaultLongPollTimeout = 30 * time.Second
+	maxLongPollTimeout     = 5 * time.Minute
+)
+
+// NewLongPollHandler builds a plain HTTP handler that blocks until a service's
+// status differs from the status the client last saw, or a timeout elapses,
+// and then responds with the current status. Clients that can't hold gRPC
+// streams open, such as those behind old proxies or running in serverless
+// functions, get change notifications by polling in a loop.
+//
+// Clients name the service with the "service" query parameter, the status
+// they last saw with "last" (for example, "serving"), and how long to wait
+// with "timeout", a Go duration such as "45s". The timeout defaults to 30
+// seconds and is capped at five minutes. Without "last", the handler responds
+// immediately. On timeout, the handler responds with the unchanged status, so
+// the client simply polls again.
+//
+// Responses look like those of NewHTTPHandler: the status as text, or as JSON
+// for clients that accept "application/json", with the HTTP status code for
+// the service's status. The handler accepts the same options as NewHandler;
+// those that apply to Watch, such as WithWatchQuota, limit the number of open
+// long polls.
+func NewLongPollHandler(watcher Watcher, options ...connect.HandlerOption) http.Handler {
+	config := newHandlerConfig(options)
+	return config.withCORS(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.Header().Set("Allow", http.MethodGet)
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		}
+		query := r.URL.Query()
+		var (
+			last    Status
+			hasLast bool
+		)
+		if text := query.Get("last"); text != "" {
+			status, err := ParseStatus(text)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			last, hasLast = status, true
+		}
+		timeout := defaultLongPollTimeout
+		if text := query.Get("timeout"); text != "" {
+			parsed, err := time.ParseDuration(text)
+			if err != nil || parsed <= 0 {
+				http.Error(w, "invalid timeout "+text, http.StatusBadRequest)
+				return
+			}
+			timeout = min(parsed, maxLongPollTimeout)
+		}
+		ctx := config.withRequestID(r.Context(), r.Header, w.Header())
+		ctx = config.withChannel(ctx, r.Header)
+		ctx = withHTTPRequestInfo(ctx, r)
+		if config.WatchQuota != nil {
+			release, err := config.WatchQuota.acquire(connect.Peer{Addr: r.RemoteAddr}, r.Header)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusTooManyRequests)
+				return
+			}
+			defer release()
+		}
+		result := &CheckResult{Service: query.Get("service")}
+		pollCtx, cancel := context.WithTimeout(ctx, timeout)
+		defer cancel()
+		var current *CheckResponse
+		errStatusChanged := errors.New("status changed")
+		err := watcher.Watch(pollCtx, &CheckRequest{Service: result.Service}, func(res *CheckResponse) error {
+			current = res
+			if !hasLast || res.Status != last {
+				return errStatusChanged
+			}
+			return nil
+		})
+		switch {
+		case current != nil && (errors.Is(err, errStatusChanged) || pollCtx.Err() != nil):
+			result.Status = current.Status
+		case ctx.Err() != nil:
+			// The client went away.
+			return
+		case err == nil:
+			// The Watcher returned without a status; report it as a failure.
+			result.Err = connect.NewError(connect.CodeInternal, errors.New("watch ended without a status"))
+		default:
+			result.Err = err
+		}
+		code := config.httpStatusCode(result)
+		config.setBuildHeaders(w.Header())
+		config.setCacheHeaders(w.Header(), result)
+		w.Header().Add("Vary", "Accept")
+		if strings.Contains(r.Header.Get("Accept"), "application/json") {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(code)
+			_ = json.NewEncoder(w).Encode(result)
+			return
+		}
+		if result.Err != nil {
+			http.Error(w, http.StatusText(code), code)
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(code)
+		_, _ = w.Write([]byte(result.Status.String() + "\n"))
+	}))
+}
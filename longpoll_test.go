@@ -0,0 +1,117 @@
+// Copyright 2022-2024 The Connect Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package grpchealth
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLongPollHandler(t *testing.T) {
+	const userFQN = "acme.user.v1.UserService"
+	t.Parallel()
+	checker := NewStaticChecker(userFQN)
+	server := httptest.NewServer(NewLongPollHandler(checker))
+	t.Cleanup(server.Close)
+	poll := func(t *testing.T, query string) (int, string) {
+		t.Helper()
+		res, err := server.Client().Get(server.URL + "?" + query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer res.Body.Close()
+		body, err := io.ReadAll(res.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return res.StatusCode, strings.TrimSpace(string(body))
+	}
+
+	t.Run("immediate", func(t *testing.T) {
+		t.Parallel()
+		if code, body := poll(t, "service="+userFQN); code != http.StatusOK || body != "serving" {
+			t.Errorf("got HTTP %d %q, expected 200 serving", code, body)
+		}
+		if code, body := poll(t, "service="+userFQN+"&last=not_serving"); code != http.StatusOK || body != "serving" {
+			t.Errorf("got HTTP %d %q for a stale status, expected 200 serving", code, body)
+		}
+	})
+	t.Run("timeout", func(t *testing.T) {
+		t.Parallel()
+		start := time.Now()
+		if code, body := poll(t, "service="+userFQN+"&last=serving&timeout=20ms"); code != http.StatusOK || body != "serving" {
+			t.Errorf("got HTTP %d %q, expected 200 serving", code, body)
+		}
+		if elapsed := time.Since(start); elapsed < 20*time.Millisecond {
+			t.Errorf("responded after %v, before the timeout", elapsed)
+		}
+	})
+	t.Run("invalid", func(t *testing.T) {
+		t.Parallel()
+		for _, query := range []string{"last=sleepy", "timeout=soon", "timeout=-1s"} {
+			if code, _ := poll(t, query); code != http.StatusBadRequest {
+				t.Errorf("got HTTP %d for %q, expected %d", code, query, http.StatusBadRequest)
+			}
+		}
+	})
+}
+
+func TestLongPollHandlerChange(t *testing.T) {
+	t.Parallel()
+	checker := NewStaticChecker()
+	server := httptest.NewServer(NewLongPollHandler(checker))
+	t.Cleanup(server.Close)
+	type response struct {
+		code   int
+		result CheckResult
+	}
+	responses := make(chan response, 1)
+	go func() {
+		req, _ := http.NewRequest(http.MethodGet, server.URL+"?last=serving&timeout=1m", http.NoBody)
+		req.Header.Set("Accept", "application/json")
+		res, err := server.Client().Do(req)
+		if err != nil {
+			t.Error(err)
+			close(responses)
+			return
+		}
+		defer res.Body.Close()
+		var result CheckResult
+		if err := json.NewDecoder(res.Body).Decode(&result); err != nil {
+			t.Error(err)
+		}
+		responses <- response{code: res.StatusCode, result: result}
+	}()
+	// Wait for the poll to start watching before changing the status.
+	for deadline := time.Now().Add(5 * time.Second); checker.Stats()[""].ActiveWatchers == 0; time.Sleep(time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("long poll never started watching")
+		}
+	}
+	checker.SetStatus("", StatusNotServing)
+	select {
+	case res := <-responses:
+		if res.code != http.StatusServiceUnavailable || res.result.Status != StatusNotServing {
+			t.Errorf("got HTTP %d with status %v, expected 503 with %v", res.code, res.result.Status, StatusNotServing)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("long poll didn't respond to a change")
+	}
+}
@@ -0,0 +1,449 @@
+// Copyright 2022-2024 The Connect Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package grpchealth
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"connectrpc.com/connect"
+)
+
+// LatencyHistogram is a snapshot of the distribution of check durations for
+// one service.
+type LatencyHistogram struct {
+	// Buckets are the upper bounds of the histogram's buckets, in ascending
+	// order.
+	Buckets []time.Duration
+	// Counts holds the number of checks that took at most the corresponding
+	// bucket's bound, so the counts are cumulative, as in Prometheus. Checks
+	// slower than every bound are only counted in Count.
+	Counts []uint64
+	// Count is the total number of checks.
+	Count uint64
+	// Sum is the total duration of all checks.
+	Sum time.Duration
+	// Exemplars holds the most recent traced check that fell into each
+	// bucket, followed by one for checks slower than every bound. It's nil
+	// unless the recorder was built with WithExemplars, and an element is nil
+	// if no traced check has fallen into its bucket.
+	Exemplars []*Exemplar
+}
+
+// Exemplar links a histogram bucket to the trace of a check that fell into
+// it, so dashboards can jump from a slow bucket straight to a slow probe's
+// trace.
+type Exemplar struct {
+	// TraceID identifies the check's trace.
+	TraceID string
+	// Duration is how long the check took.
+	Duration time.Duration
+	// Time is when the check was observed.
+	Time time.Time
+}
+
+// A LatencyRecorderOption configures a CheckLatencyRecorder.
+type LatencyRecorderOption interface {
+	applyToLatencyRecorder(*CheckLatencyRecorder)
+}
+
+// WithExemplars makes a CheckLatencyRecorder keep exemplars for each bucket,
+// using traceID to find the trace of each check from its context. Checks
+// without a trace aren't used as exemplars. The otelhealth package's TraceID
+// function reads OpenTelemetry traces.
+func WithExemplars(traceID func(context.Context) (string, bool)) LatencyRecorderOption {
+	return &exemplarsOption{traceID: traceID}
+}
+
+// WithRegisteredServices makes a CheckLatencyRecorder record checks of
+// services for which registered returns false under
+// UnregisteredServiceLabel, rather than under their own names. Use it with
+// StaticChecker.Registered when the checker's UnregisteredPolicy is
+// UnregisteredInheritProcess, since those checks otherwise look like checks
+// of registered services.
+func WithRegisteredServices(registered func(service string) bool) LatencyRecorderOption {
+	return &registeredServicesOption{registered: registered}
+}
+
+// UnregisteredServiceLabel is the name under which a CheckLatencyRecorder
+// records checks of unregistered services. It isn't a valid service name, so
+// it can't collide with one.
+const UnregisteredServiceLabel = "(unregistered)"
+
+// CheckLatencyRecorder records the duration of each check per service, so
+// operators can see dependency probes creeping toward probe timeouts before
+// they start failing. Register its Observe method with WithCheckObserver, and
+// export its Snapshot to your metrics system.
+//
+// Checks of unknown services, which fail with connect.CodeNotFound, aren't
+// recorded, so callers can't grow the set of histograms without bound. For the
+// same reason, checks reporting StatusServiceUnknown, and checks of services
+// excluded by WithRegisteredServices, are all recorded under
+// UnregisteredServiceLabel.
+type CheckLatencyRecorder struct {
+	buckets    []time.Duration
+	traceID    func(context.Context) (string, bool)
+	registered func(string) bool
+
+	mu         sync.Mutex
+	histograms map[string]*LatencyHistogram
+}
+
+// NewCheckLatencyRecorder constructs a CheckLatencyRecorder with the supplied
+// bucket bounds. If there are none, the buckets span 1ms to 5s, covering
+// typical dependency probes and the one-second timeouts common in load
+// balancer health checks.
+func NewCheckLatencyRecorder(buckets ...time.Duration) *CheckLatencyRecorder {
+	return NewCheckLatencyRecorderWithOptions(buckets)
+}
+
+// NewCheckLatencyRecorderWithOptions constructs a CheckLatencyRecorder with
+// the supplied bucket bounds, defaulting like NewCheckLatencyRecorder, and
+// options.
+func NewCheckLatencyRecorderWithOptions(buckets []time.Duration, options ...LatencyRecorderOption) *CheckLatencyRecorder {
+	if len(buckets) == 0 {
+		buckets = []time.Duration{
+			time.Millisecond,
+			5 * time.Millisecond,
+			10 * time.Millisecond,
+			25 * time.Millisecond,
+			50 * time.Millisecond,
+			100 * time.Millisecond,
+			250 * time.Millisecond,
+			500 * time.Millisecond,
+			time.Second,
+			2500 * time.Millisecond,
+			5 * time.Second,
+		}
+	}
+	buckets = append([]time.Duration(nil), buckets...)
+	sort.Slice(buckets, func(i, j int) bool { return buckets[i] < buckets[j] })
+	recorder := &CheckLatencyRecorder{
+		buckets:    buckets,
+		histograms: make(map[string]*LatencyHistogram),
+	}
+	for _, opt := range options {
+		opt.applyToLatencyRecorder(recorder)
+	}
+	return recorder
+}
+
+// HandleStats implements StatsHandler, recording the duration of each check.
+func (r *CheckLatencyRecorder) HandleStats(ctx context.Context, stats Stats) {
+	if end, ok := stats.(*CheckEnd); ok {
+		r.Observe(ctx, end.Result)
+	}
+}
+
+// Observe records the duration of a check. Its signature matches
+// WithCheckObserver.
+func (r *CheckLatencyRecorder) Observe(ctx context.Context, result *CheckResult) {
+	if connect.CodeOf(result.Err) == connect.CodeNotFound {
+		return
+	}
+	var exemplar *Exemplar
+	if r.traceID != nil {
+		if traceID, ok := r.traceID(ctx); ok {
+			exemplar = &Exemplar{TraceID: traceID, Duration: result.Duration, Time: result.ObservedAt}
+		}
+	}
+	service := result.Service
+	if (result.Err == nil && result.Status == StatusServiceUnknown) ||
+		(r.registered != nil && !r.registered(service)) {
+		service = UnregisteredServiceLabel
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	histogram := r.histograms[service]
+	if histogram == nil {
+		histogram = &LatencyHistogram{
+			Buckets: r.buckets,
+			Counts:  make([]uint64, len(r.buckets)),
+		}
+		if r.traceID != nil {
+			histogram.Exemplars = make([]*Exemplar, len(r.buckets)+1)
+		}
+		r.histograms[service] = histogram
+	}
+	bucket := len(r.buckets)
+	for i := len(r.buckets) - 1; i >= 0 && result.Duration <= r.buckets[i]; i-- {
+		histogram.Counts[i]++
+		bucket = i
+	}
+	if exemplar != nil {
+		histogram.Exemplars[bucket] = exemplar
+	}
+	histogram.Count++
+	histogram.Sum += result.Duration
+}
+
+// Snapshot returns a copy of the recorded histograms, keyed by service name.
+// The empty service name represents the whole process.
+func (r *CheckLatencyRecorder) Snapshot() map[string]LatencyHistogram {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	snapshot := make(map[string]LatencyHistogram, len(r.histograms))
+	for service, histogram := range r.histograms {
+		copied := LatencyHistogram{
+			Buckets: histogram.Buckets,
+			Counts:  append([]uint64(nil), histogram.Counts...),
+			Count:   histogram.Count,
+			Sum:     histogram.Sum,
+		}
+		if histogram.Exemplars != nil {
+			copied.Exemplars = make([]*Exemplar, len(histogram.Exemplars))
+			for i, exemplar := range histogram.Exemplars {
+				if exemplar != nil {
+					copied.Exemplars[i] = &Exemplar{TraceID: exemplar.TraceID, Duration: exemplar.Duration, Time: exemplar.Time}
+				}
+			}
+		}
+		snapshot[service] = copied
+	}
+	return snapshot
+}
+
+// A MetricsOption configures NewMetricsHandler.
+type MetricsOption interface {
+	applyToMetrics(*metricsConfig)
+}
+
+// WithLatencyHistograms makes NewMetricsHandler export the check durations
+// recorded by a CheckLatencyRecorder as the grpchealth_check_duration_seconds
+// histogram.
+func WithLatencyHistograms(recorder *CheckLatencyRecorder) MetricsOption {
+	return &latencyHistogramsOption{recorder: recorder}
+}
+
+// NewMetricsHandler returns an http.Handler that exposes health in the
+// Prometheus text format, for small services that don't already run a metrics
+// registry. Mount it at /metrics.
+//
+// The handler reports the grpchealth_status gauge, which is 1 for each
+// service's current status and 0 for the others. If the checker is a Lister,
+// every service is included; otherwise, only the whole process is. For
+// checkers that report ServiceStats, such as StaticChecker, it also reports
+// the grpchealth_checks_total and grpchealth_transitions_total counters and
+// the grpchealth_watchers gauge. If the checker fails, the handler responds
+// with 500 Internal Server Error, so Prometheus marks the scrape as failed.
+//
+// Scrapers that accept the OpenMetrics text format, as Prometheus does when
+// exemplar storage is enabled, receive it instead, including the exemplars
+// of latency histograms recorded with WithExemplars.
+func NewMetricsHandler(checker Checker, options ...MetricsOption) http.Handler {
+	var config metricsConfig
+	for _, opt := range options {
+		opt.applyToMetrics(&config)
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			w.Header().Set("Allow", "GET, HEAD")
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		}
+		statuses, err := listStatuses(r.Context(), checker)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		out := metricsWriter{openMetrics: acceptsOpenMetrics(r.Header.Get("Accept"))}
+		out.writeStatuses(statuses)
+		if reporter, ok := checker.(statsReporter); ok {
+			out.writeStats(reporter.Stats())
+		}
+		if config.Latency != nil {
+			out.writeLatency(config.Latency.Snapshot())
+		}
+		if config.Propagation != nil {
+			out.writeHistograms(
+				"grpchealth_propagation_seconds",
+				"Time for status changes of each service to reach every watcher.",
+				config.Propagation.Snapshot(),
+			)
+		}
+		if out.openMetrics {
+			out.WriteString("# EOF\n")
+			w.Header().Set("Content-Type", "application/openmetrics-text; version=1.0.0; charset=utf-8")
+		} else {
+			w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		}
+		_, _ = w.Write(out.Bytes())
+	})
+}
+
+type exemplarsOption struct {
+	traceID func(context.Context) (string, bool)
+}
+
+func (o *exemplarsOption) applyToLatencyRecorder(recorder *CheckLatencyRecorder) {
+	recorder.traceID = o.traceID
+}
+
+type registeredServicesOption struct {
+	registered func(string) bool
+}
+
+func (o *registeredServicesOption) applyToLatencyRecorder(recorder *CheckLatencyRecorder) {
+	recorder.registered = o.registered
+}
+
+type metricsConfig struct {
+	Latency     *CheckLatencyRecorder
+	Propagation *PropagationRecorder
+}
+
+type latencyHistogramsOption struct {
+	recorder *CheckLatencyRecorder
+}
+
+func (o *latencyHistogramsOption) applyToMetrics(config *metricsConfig) {
+	config.Latency = o.recorder
+}
+
+// statsReporter is implemented by checkers that track per-service activity,
+// such as StaticChecker.
+type statsReporter interface {
+	Stats() map[string]ServiceStats
+}
+
+// listStatuses reports the status of every service the checker knows about,
+// or of the whole process if it can't list services.
+func listStatuses(ctx context.Context, checker Checker) (map[string]Status, error) {
+	if lister, ok := checker.(Lister); ok {
+		return lister.List(ctx)
+	}
+	res, err := checker.Check(ctx, &CheckRequest{})
+	if err != nil {
+		return nil, err
+	}
+	return map[string]Status{"": res.Status}, nil
+}
+
+// metricsWriter renders metrics in the Prometheus text format or, for
+// scrapers that accept it, OpenMetrics, which adds exemplars.
+type metricsWriter struct {
+	bytes.Buffer
+
+	openMetrics bool
+}
+
+// family starts a metric family. OpenMetrics names counter families without
+// their samples' _total suffix.
+func (w *metricsWriter) family(name, kind, help string) {
+	if w.openMetrics && kind == "counter" {
+		name = strings.TrimSuffix(name, "_total")
+	}
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+}
+
+func (w *metricsWriter) writeStatuses(statuses map[string]Status) {
+	w.family("grpchealth_status", "gauge", "Current health status of each service.")
+	for _, service := range sortedKeys(statuses) {
+		for _, status := range []Status{StatusUnknown, StatusServing, StatusNotServing, StatusServiceUnknown} {
+			var value int
+			if statuses[service] == status {
+				value = 1
+			}
+			fmt.Fprintf(w, "grpchealth_status{service=%s,status=%q} %d\n", quoteLabel(service), status, value)
+		}
+	}
+}
+
+func (w *metricsWriter) writeStats(stats map[string]ServiceStats) {
+	services := sortedKeys(stats)
+	w.family("grpchealth_checks_total", "counter", "Number of checks of each service.")
+	for _, service := range services {
+		fmt.Fprintf(w, "grpchealth_checks_total{service=%s} %d\n", quoteLabel(service), stats[service].Checks)
+	}
+	w.family("grpchealth_transitions_total", "counter", "Number of status changes of each service.")
+	for _, service := range services {
+		fmt.Fprintf(w, "grpchealth_transitions_total{service=%s} %d\n", quoteLabel(service), stats[service].Transitions)
+	}
+	w.family("grpchealth_watchers", "gauge", "Number of open Watch streams for each service.")
+	for _, service := range services {
+		fmt.Fprintf(w, "grpchealth_watchers{service=%s} %d\n", quoteLabel(service), stats[service].ActiveWatchers)
+	}
+}
+
+func (w *metricsWriter) writeLatency(histograms map[string]LatencyHistogram) {
+	w.writeHistograms("grpchealth_check_duration_seconds", "Duration of checks of each service.", histograms)
+}
+
+func (w *metricsWriter) writeHistograms(name, help string, histograms map[string]LatencyHistogram) {
+	w.family(name, "histogram", help)
+	for _, service := range sortedKeys(histograms) {
+		histogram := histograms[service]
+		label := quoteLabel(service)
+		for i, bound := range histogram.Buckets {
+			fmt.Fprintf(w, "%s_bucket{service=%s,le=\"%s\"} %d", name, label, formatSeconds(bound), histogram.Counts[i])
+			w.writeExemplar(histogram.Exemplars, i)
+		}
+		fmt.Fprintf(w, "%s_bucket{service=%s,le=\"+Inf\"} %d", name, label, histogram.Count)
+		w.writeExemplar(histogram.Exemplars, len(histogram.Buckets))
+		fmt.Fprintf(w, "%s_sum{service=%s} %s\n", name, label, formatSeconds(histogram.Sum))
+		fmt.Fprintf(w, "%s_count{service=%s} %d\n", name, label, histogram.Count)
+	}
+}
+
+// writeExemplar ends a bucket's line, with the bucket's exemplar if there is
+// one and the format supports it.
+func (w *metricsWriter) writeExemplar(exemplars []*Exemplar, bucket int) {
+	if w.openMetrics && bucket < len(exemplars) && exemplars[bucket] != nil {
+		exemplar := exemplars[bucket]
+		fmt.Fprintf(w, " # {trace_id=%s} %s", quoteLabel(exemplar.TraceID), formatSeconds(exemplar.Duration))
+		if !exemplar.Time.IsZero() {
+			fmt.Fprintf(w, " %s", strconv.FormatFloat(float64(exemplar.Time.UnixMilli())/1e3, 'f', 3, 64))
+		}
+	}
+	w.WriteByte('\n')
+}
+
+// acceptsOpenMetrics reports whether a scraper's Accept header allows the
+// OpenMetrics text format.
+func acceptsOpenMetrics(accept string) bool {
+	for _, mediaType := range strings.Split(accept, ",") {
+		mediaType, _, _ = strings.Cut(mediaType, ";")
+		if strings.TrimSpace(mediaType) == "application/openmetrics-text" {
+			return true
+		}
+	}
+	return false
+}
+
+// quoteLabel quotes a Prometheus label value, escaping backslashes, double
+// quotes, and newlines.
+func quoteLabel(value string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value) + `"`
+}
+
+func formatSeconds(d time.Duration) string {
+	return strconv.FormatFloat(d.Seconds(), 'g', -1, 64)
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
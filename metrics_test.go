@@ -0,0 +1,215 @@
+// Copyright 2022-2024 The Connect Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package grpchealth
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCheckLatencyRecorder(t *testing.T) {
+	const userFQN = "acme.user.v1.UserService"
+	t.Parallel()
+	recorder := NewCheckLatencyRecorder(100*time.Millisecond, 10*time.Millisecond)
+	slow := checkerFunc(func(ctx context.Context, req *CheckRequest) (*CheckResponse, error) {
+		if req.Service == userFQN {
+			time.Sleep(20 * time.Millisecond)
+		}
+		return NewStaticChecker(userFQN).Check(ctx, req)
+	})
+	mux := http.NewServeMux()
+	mux.Handle("/healthz", NewHTTPHandler(slow, WithCheckObserver(recorder.Observe)))
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	for _, service := range []string{"", userFQN, "unknown"} {
+		res, err := server.Client().Get(server.URL + "/healthz?service=" + service)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+	}
+
+	snapshot := recorder.Snapshot()
+	if len(snapshot) != 2 {
+		t.Fatalf("got histograms for %d services, expected 2", len(snapshot))
+	}
+	process := snapshot[""]
+	if process.Count != 1 || process.Counts[0] != 1 || process.Counts[1] != 1 {
+		t.Fatalf("got process histogram %+v", process)
+	}
+	user := snapshot[userFQN]
+	if user.Count != 1 || user.Counts[0] != 0 || user.Counts[1] != 1 || user.Sum < 20*time.Millisecond {
+		t.Fatalf("got user histogram %+v", user)
+	}
+	if user.Buckets[0] != 10*time.Millisecond {
+		t.Fatalf("got buckets %v, expected ascending order", user.Buckets)
+	}
+}
+
+func TestCheckLatencyRecorderUnregistered(t *testing.T) {
+	const userFQN = "acme.user.v1.UserService"
+	t.Parallel()
+	for name, policy := range map[string]UnregisteredPolicy{
+		"service unknown": UnregisteredServiceUnknown,
+		"inherit process": UnregisteredInheritProcess,
+	} {
+		policy := policy
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			checker := NewStaticCheckerWithOptions([]string{userFQN}, WithUnregisteredPolicy(policy))
+			recorder := NewCheckLatencyRecorderWithOptions(nil, WithRegisteredServices(checker.Registered))
+			for _, service := range []string{"", userFQN, "acme.a.v1.A", "acme.b.v1.B", "acme.c.v1.C"} {
+				recorder.Observe(context.Background(), RunCheck(context.Background(), checker, &CheckRequest{Service: service}))
+			}
+			snapshot := recorder.Snapshot()
+			if len(snapshot) != 3 {
+				t.Fatalf("got histograms for %d services, expected 3", len(snapshot))
+			}
+			if got := snapshot[UnregisteredServiceLabel].Count; got != 3 {
+				t.Fatalf("got %d unregistered checks, expected 3", got)
+			}
+		})
+	}
+}
+
+func TestExemplars(t *testing.T) {
+	const userFQN = "acme.user.v1.UserService"
+	t.Parallel()
+	type traceKey struct{}
+	recorder := NewCheckLatencyRecorderWithOptions(
+		[]time.Duration{time.Second},
+		WithExemplars(func(ctx context.Context) (string, bool) {
+			traceID, ok := ctx.Value(traceKey{}).(string)
+			return traceID, ok
+		}),
+	)
+	at := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	traced := context.WithValue(context.Background(), traceKey{}, "4bf92f3577b34da6a3ce929d0e0e4736")
+	recorder.Observe(traced, &CheckResult{Service: userFQN, Duration: 2 * time.Second, ObservedAt: at})
+	recorder.Observe(context.Background(), &CheckResult{Service: userFQN, Duration: 5 * time.Millisecond})
+
+	histogram := recorder.Snapshot()[userFQN]
+	if len(histogram.Exemplars) != 2 || histogram.Exemplars[0] != nil {
+		t.Fatalf("got exemplars %v, expected only one for the +Inf bucket", histogram.Exemplars)
+	}
+	if got := histogram.Exemplars[1]; got.TraceID != "4bf92f3577b34da6a3ce929d0e0e4736" || got.Duration != 2*time.Second {
+		t.Fatalf("got exemplar %+v", got)
+	}
+
+	server := httptest.NewServer(NewMetricsHandler(NewStaticChecker(userFQN), WithLatencyHistograms(recorder)))
+	t.Cleanup(server.Close)
+	scrape := func(accept string) (string, string) {
+		t.Helper()
+		req, err := http.NewRequest(http.MethodGet, server.URL, http.NoBody)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Accept", accept)
+		res, err := server.Client().Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer res.Body.Close()
+		body, err := io.ReadAll(res.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return res.Header.Get("Content-Type"), string(body)
+	}
+	const bucket = `grpchealth_check_duration_seconds_bucket{service="acme.user.v1.UserService",le="+Inf"} 2`
+	contentType, body := scrape("application/openmetrics-text;version=1.0.0,text/plain;q=0.5")
+	if !strings.HasPrefix(contentType, "application/openmetrics-text") {
+		t.Fatalf("got content type %q", contentType)
+	}
+	for _, line := range []string{
+		bucket + ` # {trace_id="4bf92f3577b34da6a3ce929d0e0e4736"} 2 1704164645.000`,
+		"# TYPE grpchealth_checks counter",
+		"# EOF",
+	} {
+		if !strings.Contains(body, line+"\n") {
+			t.Errorf("OpenMetrics lack %s:\n%s", line, body)
+		}
+	}
+	_, body = scrape("text/plain")
+	if !strings.Contains(body, bucket+"\n") || strings.Contains(body, "trace_id") {
+		t.Fatalf("Prometheus text format should omit exemplars:\n%s", body)
+	}
+}
+
+func TestMetricsHandler(t *testing.T) {
+	const userFQN = "acme.user.v1.UserService"
+	t.Parallel()
+	checker := NewStaticChecker(userFQN)
+	checker.SetStatus(userFQN, StatusNotServing)
+	recorder := NewCheckLatencyRecorder(time.Second)
+	recorder.Observe(context.Background(), &CheckResult{Service: userFQN, Duration: 10 * time.Millisecond})
+	if _, err := checker.Check(context.Background(), &CheckRequest{Service: userFQN}); err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(NewMetricsHandler(checker, WithLatencyHistograms(recorder)))
+	t.Cleanup(server.Close)
+	res, err := server.Client().Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("got HTTP status %d: %s", res.StatusCode, body)
+	}
+	for _, line := range []string{
+		`grpchealth_status{service="",status="serving"} 1`,
+		`grpchealth_status{service="acme.user.v1.UserService",status="serving"} 0`,
+		`grpchealth_status{service="acme.user.v1.UserService",status="not_serving"} 1`,
+		`grpchealth_checks_total{service="acme.user.v1.UserService"} 1`,
+		`grpchealth_transitions_total{service="acme.user.v1.UserService"} 1`,
+		`grpchealth_watchers{service="acme.user.v1.UserService"} 0`,
+		`grpchealth_check_duration_seconds_bucket{service="acme.user.v1.UserService",le="1"} 1`,
+		`grpchealth_check_duration_seconds_sum{service="acme.user.v1.UserService"} 0.01`,
+	} {
+		if !strings.Contains(string(body), line+"\n") {
+			t.Errorf("metrics lack %s:\n%s", line, body)
+		}
+	}
+
+	failing := httptest.NewServer(NewMetricsHandler(checkerFunc(func(context.Context, *CheckRequest) (*CheckResponse, error) {
+		return nil, errors.New("oops")
+	})))
+	t.Cleanup(failing.Close)
+	res, err = failing.Client().Get(failing.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusInternalServerError {
+		t.Fatalf("got HTTP status %d from failing checker", res.StatusCode)
+	}
+}
+
+func TestQuoteLabel(t *testing.T) {
+	t.Parallel()
+	if got, expect := quoteLabel("a\"b\\c\nd"), `"a\"b\\c\nd"`; got != expect {
+		t.Fatalf("got %s, expected %s", got, expect)
+	}
+}
@@ -0,0 +1,158 @@
+// Copyright 2022-2024 The Connect Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package grpchealth
+
+import (
+	"sort"
+	"sync"
+)
+
+// MonitorParams configure a Monitor.
+type MonitorParams struct {
+	// Service is the service to follow on every target. The empty string
+	// represents the whole process.
+	Service string
+	// NewClient constructs the Client for a target's base URL. The default
+	// calls NewClient without options.
+	NewClient func(target string) *Client
+	// OnChange, if non-nil, is called with each target's transitions. Calls
+	// for one target are sequential, but calls for different targets may be
+	// concurrent. OnChange must not call the Monitor's SetTargets or Close.
+	OnChange func(target string, prev, next Status)
+}
+
+// Monitor follows the health of a changing set of servers, such as the pods
+// backing a load-balanced service. Each target is the base URL of a server,
+// as passed to NewClient, and is followed with Client.OnChange, so targets
+// are watched where the server supports it and polled otherwise.
+//
+// Targets start with StatusUnknown. Like Client.OnChange, a Monitor doesn't
+// report transitions while a target is unreachable; remove targets that have
+// gone away instead.
+type Monitor struct {
+	params MonitorParams
+
+	mu      sync.Mutex
+	closed  bool
+	targets map[string]*monitorTarget
+}
+
+// NewMonitor constructs a Monitor with no targets.
+func NewMonitor(params MonitorParams) *Monitor {
+	if params.NewClient == nil {
+		params.NewClient = func(target string) *Client {
+			return NewClient(target)
+		}
+	}
+	return &Monitor{params: params, targets: make(map[string]*monitorTarget)}
+}
+
+// SetTargets replaces the monitored targets. Targets that were already
+// monitored keep their status; targets that are no longer listed stop being
+// followed and are forgotten. SetTargets has no effect after Close.
+func (m *Monitor) SetTargets(targets []string) {
+	wanted := make(map[string]struct{}, len(targets))
+	for _, target := range targets {
+		wanted[target] = struct{}{}
+	}
+	m.mu.Lock()
+	if m.closed {
+		m.mu.Unlock()
+		return
+	}
+	var removed []*monitorTarget
+	for target, follower := range m.targets {
+		if _, ok := wanted[target]; !ok {
+			delete(m.targets, target)
+			removed = append(removed, follower)
+		}
+	}
+	for target := range wanted {
+		if _, ok := m.targets[target]; !ok {
+			m.targets[target] = m.follow(target)
+		}
+	}
+	m.mu.Unlock()
+	// Stopping waits for OnChange calls in progress, which take m.mu.
+	for _, follower := range removed {
+		follower.close()
+	}
+}
+
+// Targets returns the monitored targets, sorted.
+func (m *Monitor) Targets() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	targets := make([]string, 0, len(m.targets))
+	for target := range m.targets {
+		targets = append(targets, target)
+	}
+	sort.Strings(targets)
+	return targets
+}
+
+// Statuses returns the latest status of every target, keyed by target.
+func (m *Monitor) Statuses() map[string]Status {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	statuses := make(map[string]Status, len(m.targets))
+	for target, follower := range m.targets {
+		statuses[target] = follower.status
+	}
+	return statuses
+}
+
+// Close stops following every target. It waits for any OnChange calls in
+// progress to return, so it must not be called from OnChange.
+func (m *Monitor) Close() {
+	m.mu.Lock()
+	m.closed = true
+	targets := m.targets
+	m.targets = make(map[string]*monitorTarget)
+	m.mu.Unlock()
+	for _, follower := range targets {
+		follower.close()
+	}
+}
+
+// follow starts following a target. It must be called with m.mu held.
+func (m *Monitor) follow(target string) *monitorTarget {
+	follower := &monitorTarget{client: m.params.NewClient(target)}
+	follower.stop = follower.client.OnChange(m.params.Service, func(prev, next Status) {
+		m.mu.Lock()
+		current := m.targets[target] == follower
+		if current {
+			follower.status = next
+		}
+		m.mu.Unlock()
+		if current && m.params.OnChange != nil {
+			m.params.OnChange(target, prev, next)
+		}
+	})
+	return follower
+}
+
+// monitorTarget is a target followed by a Monitor. Its status is guarded by
+// the Monitor's mutex.
+type monitorTarget struct {
+	client *Client
+	stop   func()
+	status Status
+}
+
+func (t *monitorTarget) close() {
+	t.stop()
+	t.client.Close()
+}
@@ -0,0 +1,100 @@
+// Copyright 2022-2024 The Connect Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package grpchealth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestMonitor(t *testing.T) {
+	t.Parallel()
+	type transition struct {
+		target     string
+		prev, next Status
+	}
+	newServer := func(checker Checker) string {
+		mux := http.NewServeMux()
+		mux.Handle(NewHandler(checker))
+		server := httptest.NewServer(NewH2CHandler(mux))
+		t.Cleanup(server.Close)
+		return server.URL
+	}
+	first, second := NewStaticChecker(), NewStaticChecker()
+	firstURL, secondURL := newServer(first), newServer(second)
+	transitions := make(chan transition, 16)
+	monitor := NewMonitor(MonitorParams{
+		Service:   "",
+		NewClient: nil,
+		OnChange: func(target string, prev, next Status) {
+			transitions <- transition{target, prev, next}
+		},
+	})
+	defer monitor.Close()
+	expect := func(expected ...transition) {
+		t.Helper()
+		pending := make(map[transition]bool, len(expected))
+		for _, want := range expected {
+			pending[want] = true
+		}
+		for len(pending) > 0 {
+			select {
+			case got := <-transitions:
+				if !pending[got] {
+					t.Fatalf("got unexpected transition %v", got)
+				}
+				delete(pending, got)
+			case <-time.After(5 * time.Second):
+				t.Fatalf("timed out waiting for transitions %v", pending)
+			}
+		}
+	}
+
+	monitor.SetTargets([]string{secondURL, firstURL, firstURL})
+	expect(
+		transition{firstURL, StatusUnknown, StatusServing},
+		transition{secondURL, StatusUnknown, StatusServing},
+	)
+	second.SetStatus("", StatusNotServing)
+	expect(transition{secondURL, StatusServing, StatusNotServing})
+	if got, want := monitor.Statuses(), map[string]Status{
+		firstURL:  StatusServing,
+		secondURL: StatusNotServing,
+	}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("got statuses %v, expected %v", got, want)
+	}
+
+	// Removed targets are forgotten, and their transitions aren't reported.
+	monitor.SetTargets([]string{firstURL})
+	second.SetStatus("", StatusServing)
+	if got := monitor.Targets(); !reflect.DeepEqual(got, []string{firstURL}) {
+		t.Fatalf("got targets %v, expected only %v", got, firstURL)
+	}
+	first.SetStatus("", StatusNotServing)
+	expect(transition{firstURL, StatusServing, StatusNotServing})
+
+	monitor.Close()
+	monitor.SetTargets([]string{secondURL})
+	if got := monitor.Statuses(); len(got) != 0 {
+		t.Fatalf("got statuses %v after Close", got)
+	}
+	close(transitions)
+	for got := range transitions {
+		t.Errorf("got unexpected transition %v", got)
+	}
+}
@@ -0,0 +1,180 @@
+// Copyright 2022-2024 The Connect Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package grpchealth
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// ObjectStoreCheckerParams configure an ObjectStoreChecker.
+type ObjectStoreCheckerParams struct {
+	// Endpoint is the base URL of the S3-compatible service, such as
+	// "https://s3.us-east-1.amazonaws.com" or "http://minio:9000".
+	Endpoint string
+	// Bucket is the bucket the service depends on. It's addressed path-style.
+	Bucket string
+	// HTTPClient sends the request. If nil, http.DefaultClient is used.
+	HTTPClient *http.Client
+	// Sign optionally authenticates the request before it's sent, typically
+	// with AWS Signature Version 4. Anonymous requests usually fail with 403
+	// unless the bucket is public.
+	Sign func(*http.Request) error
+	// Timeout bounds each request. Zero means no timeout beyond the context's.
+	Timeout time.Duration
+	// CacheTTL is how long a result is reused before the bucket is checked
+	// again. It keeps frequent probes from becoming a request storm against
+	// the object store.
+	CacheTTL time.Duration
+	// NegativeCacheTTL is how long a StatusNotServing result is reused, so
+	// recovery can be detected sooner than CacheTTL allows. If it's zero,
+	// CacheTTL applies to every result; if it's negative, StatusNotServing
+	// results aren't reused.
+	NegativeCacheTTL time.Duration
+	// Clock timestamps cached results. The default is the system clock.
+	Clock Clock
+}
+
+// ObjectStoreChecker is a Checker that verifies an S3-compatible bucket
+// exists and is accessible with a cheap HEAD request. It reports
+// StatusNotServing if the endpoint is unreachable or responds with anything
+// other than success. The details of the response include the HTTP status or
+// error.
+//
+// Concurrent checks share a single request rather than each sending their own.
+//
+// ObjectStoreChecker reports the same status for every service.
+type ObjectStoreChecker struct {
+	params ObjectStoreCheckerParams
+	url    string
+
+	mu       sync.Mutex
+	checked  time.Time
+	response *CheckResponse
+	inflight chan struct{} // closed when the request in flight, if any, ends
+}
+
+// NewObjectStoreChecker constructs an ObjectStoreChecker.
+func NewObjectStoreChecker(params ObjectStoreCheckerParams) (*ObjectStoreChecker, error) {
+	if params.Bucket == "" {
+		return nil, fmt.Errorf("object store checker requires a bucket")
+	}
+	endpoint, err := url.Parse(params.Endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("invalid endpoint %q: %w", params.Endpoint, err)
+	}
+	if endpoint.Scheme != "http" && endpoint.Scheme != "https" {
+		return nil, fmt.Errorf("invalid endpoint %q: scheme must be http or https", params.Endpoint)
+	}
+	if params.HTTPClient == nil {
+		params.HTTPClient = http.DefaultClient
+	}
+	if params.Clock == nil {
+		params.Clock = systemClock{}
+	}
+	return &ObjectStoreChecker{
+		params: params,
+		url:    endpoint.JoinPath(params.Bucket).String(),
+	}, nil
+}
+
+// Check implements Checker.
+func (c *ObjectStoreChecker) Check(ctx context.Context, _ *CheckRequest) (*CheckResponse, error) {
+	for {
+		c.mu.Lock()
+		if c.response != nil && c.params.Clock.Now().Sub(c.checked) < cacheTTL(c.response.Status, nil, c.params.CacheTTL, c.params.NegativeCacheTTL) {
+			res := c.response
+			c.mu.Unlock()
+			return res, nil
+		}
+		if inflight := c.inflight; inflight != nil {
+			c.mu.Unlock()
+			// Once the request in flight ends, its result is cached, unless its
+			// caller gave up, in which case this check sends another.
+			select {
+			case <-inflight:
+				continue
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+		}
+		inflight := make(chan struct{})
+		c.inflight = inflight
+		c.mu.Unlock()
+
+		res, err := c.check(ctx)
+		c.mu.Lock()
+		c.inflight = nil
+		if err == nil {
+			c.checked = c.params.Clock.Now()
+			c.response = res
+		}
+		c.mu.Unlock()
+		close(inflight)
+		return res, err
+	}
+}
+
+// check sends a request, returning an error only if ctx ended first.
+func (c *ObjectStoreChecker) check(ctx context.Context) (*CheckResponse, error) {
+	headCtx := ctx
+	if c.params.Timeout > 0 {
+		var cancel context.CancelFunc
+		headCtx, cancel = context.WithTimeout(ctx, c.params.Timeout)
+		defer cancel()
+	}
+	res, err := c.head(headCtx)
+	if err != nil {
+		if ctx.Err() != nil {
+			// The caller gave up; don't cache a result it caused.
+			return nil, err
+		}
+		res = &CheckResponse{
+			Status:  StatusNotServing,
+			Details: map[string]string{"error": err.Error()},
+		}
+	}
+	return res, nil
+}
+
+func (c *ObjectStoreChecker) head(ctx context.Context) (*CheckResponse, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, c.url, http.NoBody)
+	if err != nil {
+		return nil, err
+	}
+	if c.params.Sign != nil {
+		if err := c.params.Sign(req); err != nil {
+			return nil, fmt.Errorf("sign request: %w", err)
+		}
+	}
+	res, err := c.params.HTTPClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	res.Body.Close()
+	status := StatusNotServing
+	if res.StatusCode >= 200 && res.StatusCode < 300 {
+		status = StatusServing
+	}
+	return &CheckResponse{
+		Status:  status,
+		Details: map[string]string{"http_status": strconv.Itoa(res.StatusCode)},
+	}, nil
+}
@@ -0,0 +1,183 @@
+// Copyright 2022-2024 The Connect Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package grpchealth
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestObjectStoreChecker(t *testing.T) {
+	t.Parallel()
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		if r.Method != http.MethodHead || r.Header.Get("Authorization") != "signed" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		if r.URL.Path != "/blobs" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	newChecker := func(bucket string, ttl time.Duration) *ObjectStoreChecker {
+		t.Helper()
+		checker, err := NewObjectStoreChecker(ObjectStoreCheckerParams{
+			Endpoint:   server.URL,
+			Bucket:     bucket,
+			HTTPClient: server.Client(),
+			Sign: func(r *http.Request) error {
+				r.Header.Set("Authorization", "signed")
+				return nil
+			},
+			Timeout:  time.Second,
+			CacheTTL: ttl,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return checker
+	}
+	checker := newChecker("blobs", time.Hour)
+	for i := 0; i < 3; i++ {
+		res, err := checker.Check(context.Background(), &CheckRequest{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.Status != StatusServing {
+			t.Fatalf("got status %v (details %v)", res.Status, res.Details)
+		}
+	}
+	if got := requests.Load(); got != 1 {
+		t.Fatalf("got %d requests, expected 1 with caching", got)
+	}
+
+	// Failures aren't reused beyond the negative TTL.
+	missing := newChecker("missing", time.Hour)
+	missing.params.NegativeCacheTTL = -1
+	before := requests.Load()
+	for i := 0; i < 2; i++ {
+		if _, err := missing.Check(context.Background(), &CheckRequest{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := requests.Load() - before; got != 2 {
+		t.Fatalf("got %d requests, expected 2 without negative caching", got)
+	}
+
+	res, err := newChecker("missing", 0).Check(context.Background(), &CheckRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Status != StatusNotServing || res.Details["http_status"] != "404" {
+		t.Fatalf("got status %v (details %v)", res.Status, res.Details)
+	}
+
+	if _, err := NewObjectStoreChecker(ObjectStoreCheckerParams{Endpoint: "s3://bucket", Bucket: "blobs"}); err == nil { //nolint:exhaustruct // invalid endpoint is under test
+		t.Fatal("expected error for invalid endpoint")
+	}
+}
+
+func TestObjectStoreCheckerTimeouts(t *testing.T) {
+	t.Parallel()
+	var requests atomic.Int32
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	t.Cleanup(server.Close)
+	checker, err := NewObjectStoreChecker(ObjectStoreCheckerParams{
+		Endpoint:   server.URL,
+		Bucket:     "blobs",
+		HTTPClient: server.Client(),
+		Timeout:    time.Hour,
+		CacheTTL:   time.Hour,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A caller that gives up gets an error, and nothing is cached.
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := checker.Check(ctx, &CheckRequest{}); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("got error %v, expected %v", err, context.DeadlineExceeded)
+	}
+
+	// Concurrent checks share one request.
+	before := requests.Load()
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			res, err := checker.Check(context.Background(), &CheckRequest{})
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			if res.Status != StatusServing {
+				t.Errorf("got status %v (details %v)", res.Status, res.Details)
+			}
+		}()
+	}
+	for requests.Load() == before {
+		time.Sleep(time.Millisecond)
+	}
+	close(release)
+	wg.Wait()
+	if got := requests.Load() - before; got != 1 {
+		t.Fatalf("got %d requests for concurrent checks, expected 1", got)
+	}
+
+	// The checker's own timeout is a failure of the object store, so it's
+	// reported and cached.
+	hung := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}))
+	t.Cleanup(hung.Close)
+	checker, err = NewObjectStoreChecker(ObjectStoreCheckerParams{
+		Endpoint:   hung.URL,
+		Bucket:     "blobs",
+		HTTPClient: hung.Client(),
+		Timeout:    10 * time.Millisecond,
+		CacheTTL:   time.Hour,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel = context.WithTimeout(context.Background(), time.Hour)
+	defer cancel()
+	res, err := checker.Check(ctx, &CheckRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Status != StatusNotServing {
+		t.Fatalf("got status %v after the checker's timeout, expected %v", res.Status, StatusNotServing)
+	}
+}
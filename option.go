@@ -0,0 +1,759 @@
+// Copyright 2022-2024 The Connect Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package grpchealth
+
+import (
+	"context"
+	cryptorand "crypto/rand"
+	"encoding/hex"
+	"errors"
+	"math/rand"
+	"net/http"
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"connectrpc.com/connect"
+	healthv1 "connectrpc.com/grpchealth/internal/gen/go/connectext/grpc/health/v1"
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/anypb"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+// A HandlerOption configures the handlers built by NewHandler,
+// NewCheckHandler, NewWatchHandler, and NewHTTPHandler.
+//
+// Every HandlerOption is also a connect.HandlerOption, so they can be passed
+// alongside options from the connect package. Connect ignores them.
+type HandlerOption interface {
+	connect.HandlerOption
+
+	applyToHealthHandler(*handlerConfig)
+}
+
+// WithPathPrefix serves the health API under an additional path prefix (for
+// example, "/internal") as well as the canonical
+// "/grpc.health.v1.Health/" path. This helps when edge routing rules reserve
+// a prefix for infrastructure endpoints.
+//
+// NewHandler still returns the canonical path, so mount the handler on the
+// prefixed path too:
+//
+//	path, handler := grpchealth.NewHandler(checker, grpchealth.WithPathPrefix("/internal"))
+//	mux.Handle(path, handler)
+//	mux.Handle("/internal"+path, handler)
+func WithPathPrefix(prefix string) HandlerOption {
+	prefix = strings.TrimSuffix(prefix, "/")
+	if prefix != "" && !strings.HasPrefix(prefix, "/") {
+		prefix = "/" + prefix
+	}
+	return newHandlerOption(func(config *handlerConfig) {
+		config.PathPrefix = prefix
+	})
+}
+
+// WithWatchInitialDelay delays the first status sent on each Watch stream. It
+// spreads out the burst of notifications when many watchers reconnect to a
+// restarted server at once.
+func WithWatchInitialDelay(delay time.Duration) HandlerOption {
+	return newHandlerOption(func(config *handlerConfig) {
+		config.WatchInitialDelay = delay
+	})
+}
+
+// WithWatchJitter delays each status sent on a Watch stream by a random
+// duration up to max, so that watchers of the same service don't all receive
+// (and react to) a change at the same instant. Changes made during the delay
+// are coalesced: the latest status is sent once the delay ends, and nothing
+// is sent if the status has returned to the one the client last received.
+func WithWatchJitter(max time.Duration) HandlerOption {
+	return newHandlerOption(func(config *handlerConfig) {
+		config.WatchJitter = max
+	})
+}
+
+// WithWatchHoldTime makes Watch streams send a changed status only once it has
+// stayed unchanged for hold, so clients aren't notified of every transition of
+// a flapping service. Each change restarts the hold, and a change that's
+// undone within it isn't sent at all. The first status on each stream isn't
+// held.
+func WithWatchHoldTime(hold time.Duration) HandlerOption {
+	return newHandlerOption(func(config *handlerConfig) {
+		config.WatchHoldTime = hold
+	})
+}
+
+// WithWatchHeartbeat makes Watch streams resend the current status whenever
+// the interval passes without an update. Clients can then treat prolonged
+// silence as a failed connection rather than an unchanged status; see
+// WithWatchHeartbeatTimeout.
+func WithWatchHeartbeat(interval time.Duration) HandlerOption {
+	return newHandlerOption(func(config *handlerConfig) {
+		config.WatchHeartbeat = interval
+	})
+}
+
+// WatchBackpressure selects what a Watch stream does when its client can't
+// keep up with status changes.
+type WatchBackpressure uint8
+
+const (
+	// WatchCoalesce sends only the latest status once the client catches up,
+	// skipping intermediate changes. This is the default.
+	WatchCoalesce WatchBackpressure = iota
+
+	// WatchDropOldest queues changes for the client, discarding the oldest
+	// queued change when the queue is full. Clients that keep up see every
+	// change, in order.
+	WatchDropOldest
+
+	// WatchTerminate queues changes for the client, and ends the stream with
+	// connect.CodeResourceExhausted when the queue is full. Clients never
+	// silently miss a change, but must reconnect if they fall behind.
+	WatchTerminate
+)
+
+// WithWatchBackpressure sets what Watch streams do when a client can't keep up
+// with status changes. The queue size applies to WatchDropOldest and
+// WatchTerminate; if it's not positive, streams queue up to 16 changes.
+func WithWatchBackpressure(policy WatchBackpressure, queueSize int) HandlerOption {
+	return newHandlerOption(func(config *handlerConfig) {
+		config.WatchBackpressure = policy
+		config.WatchQueueSize = queueSize
+	})
+}
+
+// WithNotServingAsError makes Check return an error with the supplied code
+// (for example, connect.CodeUnavailable) instead of a successful response
+// whenever the service isn't StatusServing. Some load balancers only examine
+// the gRPC status code and treat any successful response as healthy, even one
+// carrying StatusNotServing. Watch, List, and NewHTTPHandler are unaffected.
+func WithNotServingAsError(code connect.Code) HandlerOption {
+	return newHandlerOption(func(config *handlerConfig) {
+		config.NotServingCode = code
+	})
+}
+
+// WithHTTPStatusCodes sets the HTTP status codes used to report each Status,
+// since different load balancers expect different codes for "remove me from
+// rotation". For example, a load balancer that distinguishes errors from
+// planned maintenance might need:
+//
+//	grpchealth.WithHTTPStatusCodes(map[grpchealth.Status]int{
+//		grpchealth.StatusNotServing: http.StatusServiceUnavailable,
+//		grpchealth.StatusUnknown:    http.StatusInternalServerError,
+//	})
+//
+// Statuses missing from the map keep the defaults: HTTP 200 for StatusServing
+// and 503 otherwise. The codes apply to NewHTTPHandler, NewEnvoyHandler, and
+// Check requests made with Connect's GET support. Connect clients treat any
+// code other than 200 as an error, so only remap GET responses for probes
+// that don't parse them.
+func WithHTTPStatusCodes(codes map[Status]int) HandlerOption {
+	return newHandlerOption(func(config *handlerConfig) {
+		config.HTTPStatusCodes = make(map[Status]int, len(codes))
+		for status, code := range codes {
+			config.HTTPStatusCodes[status] = code
+		}
+	})
+}
+
+// WithRetryAfterHints makes handlers tell clients when a service that isn't
+// serving expects to recover, so polite clients and some proxies back off
+// appropriately. When a Checker reports a RetryAfter estimate with a status
+// other than StatusServing, responses include a Retry-After header in whole
+// seconds. Errors returned because of WithNotServingAsError also carry a
+// google.rpc.RetryInfo error detail.
+func WithRetryAfterHints() HandlerOption {
+	return newHandlerOption(func(config *handlerConfig) {
+		config.RetryAfterHints = true
+	})
+}
+
+// WithSharedResponses makes the Check and Watch handlers reuse one immutable
+// response message per status instead of allocating a message for every
+// response, as part of a low-allocation mode for very high probe volumes.
+// Connect only reads response messages, so this is safe unless interceptors
+// modify them: with this option, interceptors must treat health responses as
+// read-only.
+func WithSharedResponses() HandlerOption {
+	return newHandlerOption(func(config *handlerConfig) {
+		config.SharedResponses = make([]*healthv1.HealthCheckResponse, StatusServiceUnknown+1)
+		for status := range config.SharedResponses {
+			config.SharedResponses[status] = newHealthCheckResponse(Status(status))
+		}
+	})
+}
+
+// WithCheckObserver registers a function called with the outcome of every
+// Check, including its duration, from both the Check method and
+// NewHTTPHandler. It must be safe to call concurrently. CheckLatencyRecorder
+// is one such observer.
+func WithCheckObserver(observer func(context.Context, *CheckResult)) HandlerOption {
+	return newHandlerOption(func(config *handlerConfig) {
+		config.CheckObservers = append(config.CheckObservers, observer)
+	})
+}
+
+// BuildInfo describes the running build of an application.
+type BuildInfo struct {
+	// Version is the application's release version, such as "v1.4.2".
+	Version string
+	// Revision identifies the source it was built from, typically a git SHA.
+	Revision string
+	// StartTime is when the process started.
+	StartTime time.Time
+}
+
+// ReadBuildInfo returns the version of the main module and the VCS revision
+// embedded by the Go toolchain, if any. StartTime is the current time, so call
+// ReadBuildInfo during startup.
+func ReadBuildInfo() BuildInfo {
+	info := BuildInfo{StartTime: time.Now()}
+	build, ok := debug.ReadBuildInfo()
+	if !ok {
+		return info
+	}
+	if version := build.Main.Version; version != "(devel)" {
+		info.Version = version
+	}
+	for _, setting := range build.Settings {
+		if setting.Key == "vcs.revision" {
+			info.Revision = setting.Value
+		}
+	}
+	return info
+}
+
+// WithBuildInfo attaches build metadata to the responses of Check and
+// NewHTTPHandler as the Build-Version, Build-Revision, and
+// Process-Start-Time headers, so fleets can be audited for version skew using
+// the health checks they already run. Empty fields are omitted, and the start
+// time is formatted as RFC 3339.
+func WithBuildInfo(info BuildInfo) HandlerOption {
+	return newHandlerOption(func(config *handlerConfig) {
+		config.BuildInfo = &info
+	})
+}
+
+// WithRequestIDHeader makes handlers correlate health checks across load
+// balancer, application, and dependency logs. Each handler reads a request ID
+// from the named header (for example, "X-Request-Id"), or generates one if
+// it's missing, and echoes it in the response headers. The ID is available to
+// Checkers and Watchers through RequestIDFromContext, and it's recorded in
+// the CheckResults passed to observers.
+func WithRequestIDHeader(header string) HandlerOption {
+	return newHandlerOption(func(config *handlerConfig) {
+		config.RequestIDHeader = header
+	})
+}
+
+// RequestIDFromContext returns the request ID attached by a handler built with
+// WithRequestIDHeader, if any.
+func RequestIDFromContext(ctx context.Context) (string, bool) {
+	id, ok := ctx.Value(requestIDKey{}).(string)
+	return id, ok
+}
+
+// WatchInfo describes a Watch stream.
+type WatchInfo struct {
+	// Service is the watched service. The empty string represents the whole
+	// process.
+	Service string
+	// Peer describes the client that opened the stream.
+	Peer connect.Peer
+}
+
+// WatchHooks observe the lifecycle of Watch streams. Applications can use them
+// to count, log, or attribute watchers. Either hook may be nil, and both must
+// be safe to call concurrently.
+type WatchHooks struct {
+	// OnWatchStart is called when a Watch stream starts.
+	OnWatchStart func(context.Context, *WatchInfo)
+	// OnWatchEnd is called when a Watch stream ends, with the error that ended
+	// it. Streams ended by the client usually end with context.Canceled.
+	OnWatchEnd func(context.Context, *WatchInfo, error)
+}
+
+// WithWatchHooks registers hooks called when Watch streams start and end.
+// They're only called if the Checker implements Watcher.
+func WithWatchHooks(hooks WatchHooks) HandlerOption {
+	return newHandlerOption(func(config *handlerConfig) {
+		config.WatchHooks = hooks
+	})
+}
+
+type handlerConfig struct {
+	PathPrefix         string
+	WatchInitialDelay  time.Duration
+	WatchJitter        time.Duration
+	WatchHoldTime      time.Duration
+	WatchHeartbeat     time.Duration
+	WatchBackpressure  WatchBackpressure
+	WatchQueueSize     int
+	WatchHooks         WatchHooks
+	CheckObservers     []func(context.Context, *CheckResult)
+	BuildInfo          *BuildInfo
+	RequestIDHeader    string
+	ChannelHeader      string
+	Channel            string
+	Events             *EventStream
+	SharedResponses    []*healthv1.HealthCheckResponse // indexed by Status
+	NotServingCode     connect.Code
+	EmptyCheckRequests bool
+	HTTPStatusCodes    map[Status]int
+	RetryAfterHints    bool
+	Clock              Clock
+	DetachedChecks     *detachedChecks
+	WatchQuota         *watchQuota
+	CacheControl       string
+	ETags              bool
+	CORS               *corsPolicy
+	Protocols          map[string]struct{}
+	SelfHealth         *SelfHealth
+	StabilityHeaders   bool
+	Started            time.Time
+	WatchOverrides     map[string]WatchSettings
+	StatsHandlers      []StatsHandler
+	NegativeCacheTTL   time.Duration
+	CheckLimiter       *checkLimiter
+}
+
+type requestIDKey struct{}
+
+func newHandlerConfig(options []connect.HandlerOption) *handlerConfig {
+	config := handlerConfig{
+		Clock:        systemClock{},
+		CacheControl: "no-store",
+	}
+	for _, opt := range options {
+		if healthOpt, ok := opt.(HandlerOption); ok {
+			healthOpt.applyToHealthHandler(&config)
+		}
+	}
+	if config.DetachedChecks != nil {
+		config.DetachedChecks.negativeTTL = config.NegativeCacheTTL
+	}
+	config.Started = config.Clock.Now()
+	return &config
+}
+
+// runCheck runs a check and reports its outcome to any observers.
+func (c *handlerConfig) runCheck(ctx context.Context, checker Checker, req *CheckRequest) *CheckResult {
+	if len(c.StatsHandlers) > 0 {
+		handleStats(ctx, c.StatsHandlers, &CheckBegin{Service: req.Service, Time: c.Clock.Now()})
+	}
+	run := func() *CheckResult {
+		if c.DetachedChecks != nil {
+			return c.DetachedChecks.run(ctx, c.Clock, checker, req)
+		}
+		return runCheck(ctx, c.Clock, checker, req)
+	}
+	var result *CheckResult
+	if c.CheckLimiter != nil {
+		result = c.CheckLimiter.run(ctx, req, run)
+	} else {
+		result = run()
+	}
+	if result.Err != nil {
+		c.Events.emit(Event{
+			Kind:      EventCheckFailed,
+			Time:      result.ObservedAt,
+			Service:   result.Service,
+			Err:       result.Err,
+			RequestID: result.RequestID,
+		})
+	}
+	for _, observe := range c.CheckObservers {
+		observe(ctx, result)
+	}
+	if len(c.StatsHandlers) > 0 {
+		handleStats(ctx, c.StatsHandlers, &CheckEnd{Result: result})
+	}
+	return result
+}
+
+// healthCheckResponse returns the response message for a status, reusing a
+// shared message if WithSharedResponses is enabled.
+func (c *handlerConfig) healthCheckResponse(status Status) *healthv1.HealthCheckResponse {
+	if int(status) < len(c.SharedResponses) {
+		return c.SharedResponses[status]
+	}
+	return newHealthCheckResponse(status)
+}
+
+// withRequestID reads or generates a request ID, attaches it to the context,
+// and echoes it in the response headers. Without a configured header, it
+// returns the context unchanged.
+func (c *handlerConfig) withRequestID(ctx context.Context, request, response http.Header) context.Context {
+	if c.RequestIDHeader == "" {
+		return ctx
+	}
+	id := request.Get(c.RequestIDHeader)
+	if id == "" {
+		var random [8]byte
+		_, _ = cryptorand.Read(random[:])
+		id = hex.EncodeToString(random[:])
+	}
+	response.Set(c.RequestIDHeader, id)
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// echoRequestID adds the request ID to the metadata of an error, so it's
+// echoed even when a handler fails.
+func (c *handlerConfig) echoRequestID(ctx context.Context, err error) error {
+	id, ok := RequestIDFromContext(ctx)
+	if !ok {
+		return err
+	}
+	var connectErr *connect.Error
+	if !errors.As(err, &connectErr) {
+		connectErr = connect.NewError(connect.CodeOf(err), err)
+		err = connectErr
+	}
+	connectErr.Meta().Set(c.RequestIDHeader, id)
+	return err
+}
+
+// setBuildHeaders adds the configured build metadata to response headers.
+func (c *handlerConfig) setBuildHeaders(header http.Header) {
+	if c.BuildInfo == nil {
+		return
+	}
+	if c.BuildInfo.Version != "" {
+		header.Set("Build-Version", c.BuildInfo.Version)
+	}
+	if c.BuildInfo.Revision != "" {
+		header.Set("Build-Revision", c.BuildInfo.Revision)
+	}
+	if !c.BuildInfo.StartTime.IsZero() {
+		header.Set("Process-Start-Time", c.BuildInfo.StartTime.UTC().Format(time.RFC3339))
+	}
+}
+
+// retryAfter returns the recovery estimate to send to clients, if any.
+func (c *handlerConfig) retryAfter(result *CheckResult) (time.Duration, bool) {
+	if !c.RetryAfterHints || result.Err != nil || result.Status == StatusServing || result.RetryAfter <= 0 {
+		return 0, false
+	}
+	return result.RetryAfter, true
+}
+
+// setRetryAfter adds a Retry-After header with the recovery estimate, rounded
+// up to whole seconds.
+func (c *handlerConfig) setRetryAfter(result *CheckResult, header http.Header) {
+	if delay, ok := c.retryAfter(result); ok {
+		seconds := (delay + time.Second - 1) / time.Second
+		header.Set("Retry-After", strconv.FormatInt(int64(seconds), 10))
+	}
+}
+
+// retryInfo returns a google.rpc.RetryInfo error detail with the recovery
+// estimate, or nil if there isn't one. To avoid depending on the generated
+// types, the message is encoded by hand.
+func (c *handlerConfig) retryInfo(result *CheckResult) *connect.ErrorDetail {
+	delay, ok := c.retryAfter(result)
+	if !ok {
+		return nil
+	}
+	duration, err := proto.Marshal(durationpb.New(delay))
+	if err != nil {
+		return nil
+	}
+	value := protowire.AppendTag(nil, 1, protowire.BytesType) // retry_delay
+	value = protowire.AppendBytes(value, duration)
+	detail, err := connect.NewErrorDetail(&anypb.Any{
+		TypeUrl: "type.googleapis.com/google.rpc.RetryInfo",
+		Value:   value,
+	})
+	if err != nil {
+		return nil
+	}
+	return detail
+}
+
+// delayWatchUpdates wraps a Watch callback to apply the configured initial
+// delay, jitter, and hold time. Statuses are sent from a timer, so the Watcher isn't
+// blocked during the delay and changes made meanwhile replace the pending
+// status; a change that's undone before the timer fires isn't sent at all.
+// Errors mean the stream is broken, and the Watcher sees them on its next
+// update. The returned stop function must be called before the Watch handler
+// returns.
+func (c *handlerConfig) delayWatchUpdates(
+	update func(*CheckResponse) error,
+) (func(*CheckResponse) error, func()) {
+	if c.WatchInitialDelay <= 0 && c.WatchJitter <= 0 && c.WatchHoldTime <= 0 {
+		return update, func() {}
+	}
+	var (
+		mu      sync.Mutex
+		first   = true
+		sent    bool
+		last    Status // the status the client last saw, once sent
+		pending *CheckResponse
+		timer   Timer
+		gen     uint64 // identifies the current timer
+		failed  error
+		stopped bool
+	)
+	// Holding the lock while sending serializes sends, and makes stop wait
+	// for one in progress. Timers that were stopped too late to keep them
+	// from firing find that they're no longer current.
+	flush := func(timerGen uint64) {
+		mu.Lock()
+		defer mu.Unlock()
+		if timerGen != gen {
+			return
+		}
+		res := pending
+		pending, timer = nil, nil
+		if stopped || res == nil || failed != nil {
+			return
+		}
+		if err := update(res); err != nil {
+			failed = err
+			return
+		}
+		sent, last = true, res.Status
+	}
+	delayed := func(res *CheckResponse) error {
+		mu.Lock()
+		defer mu.Unlock()
+		if failed != nil {
+			return failed
+		}
+		if stopped {
+			return nil
+		}
+		switch {
+		case sent:
+			// The client's previous status is the last one sent, whatever the
+			// Watcher reports.
+			merged := *res
+			merged.Previous = last
+			res = &merged
+		case pending != nil:
+			// Coalesce with the pending status, which the client hasn't seen.
+			merged := *res
+			merged.Previous = pending.Previous
+			res = &merged
+		}
+		pending = res
+		if sent && res.Status == last {
+			pending = nil
+			if timer != nil {
+				timer.Stop()
+				timer = nil
+				gen++
+			}
+			return nil
+		}
+		if timer != nil {
+			if !sent || c.WatchHoldTime <= 0 {
+				return nil
+			}
+			// The status hasn't been stable for the hold time, so start over.
+			timer.Stop()
+		}
+		var delay time.Duration
+		if first {
+			delay = c.WatchInitialDelay
+			first = false
+		} else {
+			delay = c.WatchHoldTime
+		}
+		if c.WatchJitter > 0 {
+			delay += time.Duration(rand.Int63n(int64(c.WatchJitter))) //nolint:gosec // jitter doesn't need a secure source
+		}
+		gen++
+		timerGen := gen
+		timer = c.Clock.AfterFunc(delay, func() { flush(timerGen) })
+		return nil
+	}
+	stop := func() {
+		mu.Lock()
+		defer mu.Unlock()
+		stopped = true
+		if timer != nil {
+			timer.Stop()
+		}
+	}
+	return delayed, stop
+}
+
+// heartbeatWatchUpdates wraps a Watch callback to resend the latest status
+// whenever the configured heartbeat interval passes without an update. The
+// returned stop function must be called before the Watch handler returns.
+func (c *handlerConfig) heartbeatWatchUpdates(
+	update func(*CheckResponse) error,
+) (func(*CheckResponse) error, func()) {
+	if c.WatchHeartbeat <= 0 {
+		return update, func() {}
+	}
+	var (
+		mu      sync.Mutex
+		last    *CheckResponse
+		stopped bool
+		timer   Timer
+	)
+	// Hold the lock while creating the timer, so the callback can't observe
+	// it unset.
+	mu.Lock()
+	timer = c.Clock.AfterFunc(c.WatchHeartbeat, func() {
+		mu.Lock()
+		defer mu.Unlock()
+		if stopped {
+			return
+		}
+		if last != nil {
+			// Errors mean the stream is broken, and the Watcher sees them on
+			// its next update.
+			_ = update(last)
+		}
+		timer.Reset(c.WatchHeartbeat)
+	})
+	mu.Unlock()
+	send := func(res *CheckResponse) error {
+		mu.Lock()
+		defer mu.Unlock()
+		last = res
+		timer.Reset(c.WatchHeartbeat)
+		return update(res)
+	}
+	stop := func() {
+		mu.Lock()
+		defer mu.Unlock()
+		stopped = true
+		timer.Stop()
+	}
+	return send, stop
+}
+
+// queueWatchUpdates decouples a Watch callback from the client according to
+// the configured backpressure policy. Queued updates are sent from a separate
+// goroutine, and the returned context is canceled if sending fails or the
+// queue overflows under WatchTerminate. The returned finish function must be
+// called with the Watcher's error before the Watch handler returns; it stops
+// sending and returns the error that ended the stream.
+func (c *handlerConfig) queueWatchUpdates(
+	ctx context.Context,
+	update func(*CheckResponse) error,
+) (context.Context, func(*CheckResponse) error, func(error) error) {
+	if c.WatchBackpressure == WatchCoalesce {
+		return ctx, update, func(err error) error { return err }
+	}
+	size := c.WatchQueueSize
+	if size <= 0 {
+		size = 16
+	}
+	ctx, cancel := context.WithCancelCause(ctx)
+	var (
+		mu     sync.Mutex
+		queue  []*CheckResponse
+		failed error
+	)
+	// fail records the first error to end the stream. The caller must hold mu.
+	fail := func(err error) {
+		if failed == nil {
+			failed = err
+			cancel(err)
+		}
+	}
+	ready := make(chan struct{}, 1)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ready:
+			}
+			for {
+				mu.Lock()
+				if len(queue) == 0 {
+					mu.Unlock()
+					break
+				}
+				res := queue[0]
+				queue = queue[1:]
+				mu.Unlock()
+				if err := update(res); err != nil {
+					mu.Lock()
+					fail(err)
+					mu.Unlock()
+					return
+				}
+			}
+		}
+	}()
+	send := func(res *CheckResponse) error {
+		mu.Lock()
+		defer mu.Unlock()
+		if failed != nil {
+			return failed
+		}
+		if len(queue) >= size {
+			if c.SelfHealth != nil {
+				c.SelfHealth.ReportDropped(1)
+			}
+			if c.WatchBackpressure == WatchTerminate {
+				fail(connect.NewError(
+					connect.CodeResourceExhausted,
+					errors.New("watch client can't keep up with status changes"),
+				))
+				return failed
+			}
+			queue = queue[1:]
+		}
+		queue = append(queue, res)
+		select {
+		case ready <- struct{}{}:
+		default:
+		}
+		return nil
+	}
+	finish := func(err error) error {
+		cancel(nil)
+		<-done
+		mu.Lock()
+		defer mu.Unlock()
+		if failed != nil {
+			return failed
+		}
+		return err
+	}
+	return ctx, send, finish
+}
+
+type handlerOption struct {
+	connect.HandlerOption // no-op
+
+	apply func(*handlerConfig)
+}
+
+func newHandlerOption(apply func(*handlerConfig)) *handlerOption {
+	return &handlerOption{
+		HandlerOption: connect.WithHandlerOptions(),
+		apply:         apply,
+	}
+}
+
+func (o *handlerOption) applyToHealthHandler(config *handlerConfig) {
+	o.apply(config)
+}
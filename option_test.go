@@ -0,0 +1,474 @@
+// Copyright 2022-2024 The Connect Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package grpchealth
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"connectrpc.com/connect"
+	healthv1 "connectrpc.com/grpchealth/internal/gen/go/connectext/grpc/health/v1"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+func TestPathPrefix(t *testing.T) {
+	t.Parallel()
+	mux := http.NewServeMux()
+	path, handler := NewHandler(
+		NewStaticChecker(),
+		WithPathPrefix("internal/"),
+		connect.WithCompressMinBytes(1024),
+	)
+	mux.Handle(path, handler)
+	mux.Handle("/internal"+path, handler)
+	server := httptest.NewUnstartedServer(mux)
+	server.EnableHTTP2 = true
+	server.StartTLS()
+	t.Cleanup(server.Close)
+
+	for _, prefix := range []string{"", "/internal"} {
+		client := connect.NewClient[healthv1.HealthCheckRequest, healthv1.HealthCheckResponse](
+			server.Client(),
+			server.URL+prefix+"/grpc.health.v1.Health/Check",
+			connect.WithGRPC(),
+		)
+		res, err := client.CallUnary(
+			context.Background(),
+			connect.NewRequest(&healthv1.HealthCheckRequest{}),
+		)
+		if err != nil {
+			t.Fatalf("prefix %q: %v", prefix, err)
+		}
+		if got := Status(res.Msg.Status); got != StatusServing {
+			t.Fatalf("prefix %q: got status %v, expected %v", prefix, got, StatusServing)
+		}
+	}
+}
+
+func TestWatchDelay(t *testing.T) {
+	t.Parallel()
+	config := newHandlerConfig(nil)
+	WithWatchInitialDelay(20 * time.Millisecond).applyToHealthHandler(config)
+	WithWatchJitter(10 * time.Millisecond).applyToHealthHandler(config)
+
+	sent := make(chan *CheckResponse, 10)
+	update, stop := config.delayWatchUpdates(func(res *CheckResponse) error {
+		sent <- res
+		return nil
+	})
+	expectNone := func() {
+		t.Helper()
+		select {
+		case res := <-sent:
+			t.Fatalf("got unexpected update %+v", res)
+		case <-time.After(50 * time.Millisecond):
+		}
+	}
+
+	// Changes during the delay are coalesced, and the latest status is sent.
+	start := time.Now()
+	if err := update(&CheckResponse{Status: StatusServing}); err != nil {
+		t.Fatal(err)
+	}
+	if err := update(&CheckResponse{Status: StatusNotServing, Previous: StatusServing}); err != nil {
+		t.Fatal(err)
+	}
+	res := <-sent
+	if elapsed := time.Since(start); elapsed < 20*time.Millisecond {
+		t.Fatalf("first update after %v, expected at least 20ms", elapsed)
+	}
+	if res.Status != StatusNotServing || res.Previous != StatusUnknown {
+		t.Fatalf("got update %+v, expected the latest status", res)
+	}
+	expectNone()
+
+	if err := update(&CheckResponse{Status: StatusServing, Previous: StatusNotServing}); err != nil {
+		t.Fatal(err)
+	}
+	if res := <-sent; res.Status != StatusServing || res.Previous != StatusNotServing {
+		t.Fatalf("got update %+v", res)
+	}
+
+	// A change undone during the delay isn't sent.
+	if err := update(&CheckResponse{Status: StatusNotServing, Previous: StatusServing}); err != nil {
+		t.Fatal(err)
+	}
+	if err := update(&CheckResponse{Status: StatusServing, Previous: StatusNotServing}); err != nil {
+		t.Fatal(err)
+	}
+	expectNone()
+
+	// Duplicates are judged against the status the client last saw, not the
+	// Previous status the Watcher reports.
+	if err := update(&CheckResponse{Status: StatusServing, Previous: StatusNotServing}); err != nil {
+		t.Fatal(err)
+	}
+	expectNone()
+	if err := update(&CheckResponse{Status: StatusNotServing, Previous: StatusNotServing}); err != nil {
+		t.Fatal(err)
+	}
+	if res := <-sent; res.Status != StatusNotServing || res.Previous != StatusServing {
+		t.Fatalf("got update %+v", res)
+	}
+
+	// Nothing is sent once the stream is stopped.
+	if err := update(&CheckResponse{Status: StatusServing, Previous: StatusNotServing}); err != nil {
+		t.Fatal(err)
+	}
+	stop()
+	expectNone()
+}
+
+func TestWatchHooks(t *testing.T) {
+	const userFQN = "acme.user.v1.UserService"
+	t.Parallel()
+	started := make(chan *WatchInfo, 1)
+	ended := make(chan error, 1)
+	mux := http.NewServeMux()
+	mux.Handle(NewHandler(
+		NewStaticChecker(userFQN),
+		WithWatchHooks(WatchHooks{
+			OnWatchStart: func(_ context.Context, info *WatchInfo) {
+				started <- info
+			},
+			OnWatchEnd: func(_ context.Context, _ *WatchInfo, err error) {
+				ended <- err
+			},
+		}),
+	))
+	server := httptest.NewUnstartedServer(mux)
+	server.EnableHTTP2 = true
+	server.StartTLS()
+	t.Cleanup(server.Close)
+
+	client := connect.NewClient[healthv1.HealthCheckRequest, healthv1.HealthCheckResponse](
+		server.Client(),
+		server.URL+"/grpc.health.v1.Health/Watch",
+		connect.WithGRPC(),
+	)
+	ctx, cancel := context.WithCancel(context.Background())
+	stream, err := client.CallServerStream(
+		ctx,
+		connect.NewRequest(&healthv1.HealthCheckRequest{Service: userFQN}),
+	)
+	if err != nil {
+		cancel()
+		t.Fatal(err)
+	}
+	if !stream.Receive() {
+		cancel()
+		t.Fatal(stream.Err())
+	}
+	info := <-started
+	if info.Service != userFQN || info.Peer.Addr == "" || info.Peer.Protocol != connect.ProtocolGRPC {
+		t.Fatalf("got watch info %+v", info)
+	}
+	cancel()
+	_ = stream.Close()
+	if err := <-ended; err == nil {
+		t.Fatal("expected error at end of watch")
+	}
+}
+
+func TestWatchHeartbeat(t *testing.T) {
+	t.Parallel()
+	config := newHandlerConfig(nil)
+	WithWatchHeartbeat(5 * time.Millisecond).applyToHealthHandler(config)
+	sent := make(chan Status, 16)
+	update, stop := config.heartbeatWatchUpdates(func(res *CheckResponse) error {
+		select {
+		case sent <- res.Status:
+		default:
+		}
+		return nil
+	})
+	if err := update(&CheckResponse{Status: StatusNotServing}); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		if status := <-sent; status != StatusNotServing {
+			t.Fatalf("got status %v, expected %v", status, StatusNotServing)
+		}
+	}
+	stop()
+	for len(sent) > 0 {
+		<-sent
+	}
+	time.Sleep(20 * time.Millisecond)
+	if len(sent) != 0 {
+		t.Fatal("heartbeat sent after stop")
+	}
+}
+
+func TestWatchBackpressure(t *testing.T) {
+	t.Parallel()
+	statuses := []Status{StatusServing, StatusNotServing, StatusServing, StatusNotServing, StatusServiceUnknown}
+	// queue starts a stream whose client blocks after receiving the first
+	// status, then sends the rest.
+	queue := func(policy WatchBackpressure) (chan Status, chan struct{}, context.Context, func(error) error, error) {
+		config := newHandlerConfig(nil)
+		WithWatchBackpressure(policy, 2).applyToHealthHandler(config)
+		received := make(chan Status, len(statuses))
+		release := make(chan struct{})
+		ctx, send, finish := config.queueWatchUpdates(context.Background(), func(res *CheckResponse) error {
+			if len(received) == 0 {
+				defer func() { <-release }()
+			}
+			received <- res.Status
+			return nil
+		})
+		if err := send(&CheckResponse{Status: statuses[0]}); err != nil {
+			t.Fatal(err)
+		}
+		<-received
+		var err error
+		for _, status := range statuses[1:] {
+			if err = send(&CheckResponse{Status: status}); err != nil {
+				break
+			}
+		}
+		return received, release, ctx, finish, err
+	}
+
+	received, release, _, finish, err := queue(WatchDropOldest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	close(release)
+	for _, expect := range statuses[3:] {
+		if status := <-received; status != expect {
+			t.Fatalf("got status %v, expected %v", status, expect)
+		}
+	}
+	if err := finish(context.Canceled); !errors.Is(err, context.Canceled) {
+		t.Fatalf("got error %v, expected %v", err, context.Canceled)
+	}
+
+	_, release, ctx, finish, err := queue(WatchTerminate)
+	if code := connect.CodeOf(err); code != connect.CodeResourceExhausted {
+		t.Fatalf("got code %v on overflow, expected %v", code, connect.CodeResourceExhausted)
+	}
+	<-ctx.Done()
+	close(release)
+	if code := connect.CodeOf(finish(ctx.Err())); code != connect.CodeResourceExhausted {
+		t.Fatalf("got code %v from finish, expected %v", code, connect.CodeResourceExhausted)
+	}
+}
+
+func TestNotServingAsError(t *testing.T) {
+	const userFQN = "acme.user.v1.UserService"
+	t.Parallel()
+	checker := NewStaticChecker(userFQN)
+	mux := http.NewServeMux()
+	mux.Handle(NewHandler(checker, WithNotServingAsError(connect.CodeUnavailable)))
+	server := httptest.NewServer(NewH2CHandler(mux))
+	t.Cleanup(server.Close)
+	client := NewClient(server.URL)
+	t.Cleanup(client.Close)
+
+	res, err := client.Check(context.Background(), &CheckRequest{Service: userFQN})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Status != StatusServing {
+		t.Fatalf("got status %v, expected %v", res.Status, StatusServing)
+	}
+	checker.SetStatus(userFQN, StatusNotServing)
+	_, err = client.Check(context.Background(), &CheckRequest{Service: userFQN})
+	if code := connect.CodeOf(err); code != connect.CodeUnavailable {
+		t.Fatalf("got code %v, expected %v", code, connect.CodeUnavailable)
+	}
+	_, err = client.Check(context.Background(), &CheckRequest{Service: "foobar"})
+	if code := connect.CodeOf(err); code != connect.CodeNotFound {
+		t.Fatalf("got code %v for unknown service, expected %v", code, connect.CodeNotFound)
+	}
+}
+
+func TestRetryAfterHints(t *testing.T) {
+	t.Parallel()
+	checker := checkerFunc(func(context.Context, *CheckRequest) (*CheckResponse, error) {
+		return &CheckResponse{Status: StatusNotServing, RetryAfter: 1500 * time.Millisecond}, nil
+	})
+	hints := WithRetryAfterHints()
+	mux := http.NewServeMux()
+	mux.Handle(NewHandler(checker, hints, WithNotServingAsError(connect.CodeUnavailable)))
+	mux.Handle("/healthz", NewHTTPHandler(checker, hints))
+	server := httptest.NewServer(NewH2CHandler(mux))
+	t.Cleanup(server.Close)
+
+	res, err := server.Client().Get(server.URL + "/healthz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if got := res.Header.Get("Retry-After"); got != "2" {
+		t.Fatalf("got Retry-After %q from HTTP handler, expected 2", got)
+	}
+
+	client := NewClient(server.URL)
+	t.Cleanup(client.Close)
+	_, err = client.Check(context.Background(), &CheckRequest{})
+	var connectErr *connect.Error
+	if !errors.As(err, &connectErr) {
+		t.Fatalf("got error %v, expected a connect error", err)
+	}
+	if got := connectErr.Meta().Get("Retry-After"); got != "2" {
+		t.Fatalf("got Retry-After %q from Check, expected 2", got)
+	}
+	details := connectErr.Details()
+	if len(details) != 1 || details[0].Type() != "google.rpc.RetryInfo" {
+		t.Fatalf("got error details %v, expected RetryInfo", details)
+	}
+	var duration durationpb.Duration
+	if err := proto.Unmarshal(details[0].Bytes()[2:], &duration); err != nil {
+		t.Fatal(err)
+	}
+	if got := duration.AsDuration(); got != 1500*time.Millisecond {
+		t.Fatalf("got retry delay %v, expected 1.5s", got)
+	}
+}
+
+func TestSharedResponses(t *testing.T) {
+	t.Parallel()
+	config := newHandlerConfig(nil)
+	WithSharedResponses().applyToHealthHandler(config)
+	for _, status := range []Status{StatusUnknown, StatusServing, StatusNotServing, StatusServiceUnknown} {
+		res := config.healthCheckResponse(status)
+		if res != config.healthCheckResponse(status) {
+			t.Fatalf("%v: expected a shared response", status)
+		}
+		if got := Status(res.Status); got != status {
+			t.Fatalf("got status %v, expected %v", got, status)
+		}
+	}
+	if config.healthCheckResponse(Status(42)) == config.healthCheckResponse(Status(42)) {
+		t.Fatal("expected a new response for an unrecognized status")
+	}
+}
+
+func TestBuildInfo(t *testing.T) {
+	t.Parallel()
+	start := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	options := []connect.HandlerOption{WithBuildInfo(BuildInfo{
+		Version:   "v1.4.2",
+		Revision:  "0123abcd",
+		StartTime: start,
+	})}
+	mux := http.NewServeMux()
+	mux.Handle(NewHandler(NewStaticChecker(), options...))
+	mux.Handle("/healthz", NewHTTPHandler(NewStaticChecker(), options...))
+	server := httptest.NewUnstartedServer(mux)
+	server.EnableHTTP2 = true
+	server.StartTLS()
+	t.Cleanup(server.Close)
+
+	client := connect.NewClient[healthv1.HealthCheckRequest, healthv1.HealthCheckResponse](
+		server.Client(),
+		server.URL+"/grpc.health.v1.Health/Check",
+		connect.WithGRPC(),
+	)
+	res, err := client.CallUnary(context.Background(), connect.NewRequest(&healthv1.HealthCheckRequest{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	httpRes, err := server.Client().Get(server.URL + "/healthz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	httpRes.Body.Close()
+	for _, header := range []http.Header{res.Header(), httpRes.Header} {
+		if got := header.Get("Build-Version"); got != "v1.4.2" {
+			t.Fatalf("got version %q", got)
+		}
+		if got := header.Get("Build-Revision"); got != "0123abcd" {
+			t.Fatalf("got revision %q", got)
+		}
+		if got := header.Get("Process-Start-Time"); got != "2024-03-01T12:00:00Z" {
+			t.Fatalf("got start time %q", got)
+		}
+	}
+}
+
+func TestRequestID(t *testing.T) {
+	const header = "X-Request-Id"
+	t.Parallel()
+	seen := make(chan string, 4)
+	checker := checkerFunc(func(ctx context.Context, req *CheckRequest) (*CheckResponse, error) {
+		id, _ := RequestIDFromContext(ctx)
+		seen <- id
+		return NewStaticChecker().Check(ctx, req)
+	})
+	observed := make(chan *CheckResult, 4)
+	options := []connect.HandlerOption{
+		WithRequestIDHeader(header),
+		WithCheckObserver(func(_ context.Context, result *CheckResult) { observed <- result }),
+	}
+	mux := http.NewServeMux()
+	mux.Handle(NewHandler(checker, options...))
+	mux.Handle("/healthz", NewHTTPHandler(checker, options...))
+	server := httptest.NewUnstartedServer(mux)
+	server.EnableHTTP2 = true
+	server.StartTLS()
+	t.Cleanup(server.Close)
+
+	client := connect.NewClient[healthv1.HealthCheckRequest, healthv1.HealthCheckResponse](
+		server.Client(),
+		server.URL+"/grpc.health.v1.Health/Check",
+		connect.WithGRPC(),
+	)
+	req := connect.NewRequest(&healthv1.HealthCheckRequest{})
+	req.Header().Set(header, "abc123")
+	res, err := client.CallUnary(context.Background(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := res.Header().Get(header); got != "abc123" {
+		t.Fatalf("got echoed request ID %q", got)
+	}
+	if got := <-seen; got != "abc123" {
+		t.Fatalf("checker saw request ID %q", got)
+	}
+	if got := (<-observed).RequestID; got != "abc123" {
+		t.Fatalf("observer saw request ID %q", got)
+	}
+
+	req = connect.NewRequest(&healthv1.HealthCheckRequest{Service: "unknown"})
+	req.Header().Set(header, "def456")
+	_, err = client.CallUnary(context.Background(), req)
+	var connectErr *connect.Error
+	if !errors.As(err, &connectErr) || connectErr.Meta().Get(header) != "def456" {
+		t.Fatalf("got error %v without echoed request ID", err)
+	}
+	<-seen
+	<-observed
+
+	httpRes, err := server.Client().Get(server.URL + "/healthz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	httpRes.Body.Close()
+	generated := httpRes.Header.Get(header)
+	if len(generated) != 16 {
+		t.Fatalf("got generated request ID %q", generated)
+	}
+	if got := <-seen; got != generated {
+		t.Fatalf("checker saw request ID %q, expected %q", got, generated)
+	}
+}
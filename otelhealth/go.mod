@@ -0,0 +1,25 @@
+module connectrpc.com/grpchealth/otelhealth
+
+go 1.21
+
+require (
+	connectrpc.com/connect v1.16.2
+	connectrpc.com/grpchealth v0.0.0
+	connectrpc.com/otelconnect v0.7.1
+	go.opentelemetry.io/otel v1.19.0
+	go.opentelemetry.io/otel/metric v1.19.0
+	go.opentelemetry.io/otel/sdk/metric v1.19.0
+	go.opentelemetry.io/otel/trace v1.19.0
+)
+
+require (
+	github.com/go-logr/logr v1.2.4 // indirect
+	github.com/go-logr/stdr v1.2.2 // indirect
+	go.opentelemetry.io/otel/sdk v1.19.0 // indirect
+	golang.org/x/net v0.35.0 // indirect
+	golang.org/x/sys v0.30.0 // indirect
+	golang.org/x/text v0.22.0 // indirect
+	google.golang.org/protobuf v1.33.0 // indirect
+)
+
+replace connectrpc.com/grpchealth => ../
@@ -0,0 +1,183 @@
+// Copyright 2022-2024 The Connect Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package otelhealth instruments gRPC health-checking handlers with
+// OpenTelemetry. It's a separate module so that applications not using
+// OpenTelemetry don't depend on it.
+package otelhealth
+
+import (
+	"context"
+	"net/http"
+
+	"connectrpc.com/connect"
+	"connectrpc.com/grpchealth"
+	"connectrpc.com/otelconnect"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// NewObservableHandler wraps grpchealth.NewHandler with otelconnect's tracing
+// and RPC metrics, and registers a "grpchealth.serving" gauge that reports 1
+// for each service with grpchealth.StatusServing and 0 otherwise. If the
+// Checker implements grpchealth.Lister, the gauge covers every listed service;
+// otherwise, it covers only the whole process, reported as the empty service
+// name.
+//
+// Additional options are passed to grpchealth.NewHandler.
+func NewObservableHandler(
+	checker grpchealth.Checker,
+	tracerProvider trace.TracerProvider,
+	meterProvider metric.MeterProvider,
+	options ...connect.HandlerOption,
+) (string, http.Handler, error) {
+	interceptor, err := otelconnect.NewInterceptor(
+		otelconnect.WithTracerProvider(tracerProvider),
+		otelconnect.WithMeterProvider(meterProvider),
+	)
+	if err != nil {
+		return "", nil, err
+	}
+	meter := meterProvider.Meter("connectrpc.com/grpchealth/otelhealth")
+	_, err = meter.Int64ObservableGauge(
+		"grpchealth.serving",
+		metric.WithDescription("Whether each service is serving (1) or not (0)."),
+		metric.WithInt64Callback(func(ctx context.Context, observer metric.Int64Observer) error {
+			statuses, err := currentStatuses(ctx, checker)
+			if err != nil {
+				return err
+			}
+			for service, status := range statuses {
+				var serving int64
+				if status == grpchealth.StatusServing {
+					serving = 1
+				}
+				observer.Observe(serving, metric.WithAttributes(attribute.String("grpc.health.service", service)))
+			}
+			return nil
+		}),
+	)
+	if err != nil {
+		return "", nil, err
+	}
+	options = append([]connect.HandlerOption{connect.WithInterceptors(interceptor)}, options...)
+	path, handler := grpchealth.NewHandler(checker, options...)
+	return path, handler, nil
+}
+
+func currentStatuses(ctx context.Context, checker grpchealth.Checker) (map[string]grpchealth.Status, error) {
+	if lister, ok := checker.(grpchealth.Lister); ok {
+		return lister.List(ctx)
+	}
+	res, err := checker.Check(ctx, &grpchealth.CheckRequest{})
+	if err != nil {
+		return nil, err
+	}
+	return map[string]grpchealth.Status{"": res.Status}, nil
+}
+
+// NewStatsHandler returns a grpchealth.StatsHandler recording OpenTelemetry
+// metrics: a "grpchealth.check.duration" histogram of check durations, a
+// "grpchealth.watch.active" count of open Watch streams, a
+// "grpchealth.transitions" counter of status changes, and a
+// "grpchealth.propagation.duration" histogram of the time status changes take
+// to reach every watcher. Each is attributed by service; check durations are
+// also attributed by status, or by error code for failed checks. Register it
+// with grpchealth.WithHandlerStats and grpchealth.WithStatusStats.
+func NewStatsHandler(meterProvider metric.MeterProvider) (grpchealth.StatsHandler, error) {
+	meter := meterProvider.Meter("connectrpc.com/grpchealth/otelhealth")
+	duration, err := meter.Float64Histogram(
+		"grpchealth.check.duration",
+		metric.WithDescription("Duration of health checks."),
+		metric.WithUnit("s"),
+	)
+	if err != nil {
+		return nil, err
+	}
+	watches, err := meter.Int64UpDownCounter(
+		"grpchealth.watch.active",
+		metric.WithDescription("Number of open Watch streams."),
+	)
+	if err != nil {
+		return nil, err
+	}
+	transitions, err := meter.Int64Counter(
+		"grpchealth.transitions",
+		metric.WithDescription("Number of service status changes."),
+	)
+	if err != nil {
+		return nil, err
+	}
+	propagation, err := meter.Float64Histogram(
+		"grpchealth.propagation.duration",
+		metric.WithDescription("Time for status changes to reach every watcher."),
+		metric.WithUnit("s"),
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &statsHandler{
+		duration:    duration,
+		watches:     watches,
+		transitions: transitions,
+		propagation: propagation,
+	}, nil
+}
+
+type statsHandler struct {
+	duration    metric.Float64Histogram
+	watches     metric.Int64UpDownCounter
+	transitions metric.Int64Counter
+	propagation metric.Float64Histogram
+}
+
+func (h *statsHandler) HandleStats(ctx context.Context, stats grpchealth.Stats) {
+	switch stats := stats.(type) {
+	case *grpchealth.CheckEnd:
+		result := stats.Result
+		outcome := attribute.String("grpc.health.status", result.Status.String())
+		if result.Err != nil {
+			outcome = attribute.String("rpc.connect_rpc.error_code", connect.CodeOf(result.Err).String())
+		}
+		h.duration.Record(ctx, result.Duration.Seconds(), metric.WithAttributes(
+			attribute.String("grpc.health.service", result.Service),
+			outcome,
+		))
+	case *grpchealth.WatchBegin:
+		h.watches.Add(ctx, 1, metric.WithAttributes(attribute.String("grpc.health.service", stats.Info.Service)))
+	case *grpchealth.WatchEnd:
+		h.watches.Add(ctx, -1, metric.WithAttributes(attribute.String("grpc.health.service", stats.Info.Service)))
+	case *grpchealth.Transition:
+		h.transitions.Add(ctx, 1, metric.WithAttributes(
+			attribute.String("grpc.health.service", stats.Service),
+			attribute.String("grpc.health.status", stats.Status.String()),
+		))
+	case *grpchealth.Propagation:
+		h.propagation.Record(ctx, stats.Latency.Seconds(), metric.WithAttributes(
+			attribute.String("grpc.health.service", stats.Service),
+		))
+	}
+}
+
+// TraceID returns the ID of the OpenTelemetry trace in ctx, if it's valid and
+// sampled. Pass it to grpchealth.WithExemplars to link latency histograms to
+// traces.
+func TraceID(ctx context.Context) (string, bool) {
+	spanContext := trace.SpanContextFromContext(ctx)
+	if !spanContext.IsValid() || !spanContext.IsSampled() {
+		return "", false
+	}
+	return spanContext.TraceID().String(), true
+}
@@ -0,0 +1,155 @@
+// Copyright 2022-2024 The Connect Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package otelhealth
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"connectrpc.com/grpchealth"
+	"go.opentelemetry.io/otel/attribute"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestNewObservableHandler(t *testing.T) {
+	const userFQN = "acme.user.v1.UserService"
+	t.Parallel()
+	checker := grpchealth.NewStaticChecker(userFQN)
+	checker.SetStatus(userFQN, grpchealth.StatusNotServing)
+	reader := sdkmetric.NewManualReader()
+	meterProvider := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))
+	path, handler, err := NewObservableHandler(checker, trace.NewNoopTracerProvider(), meterProvider)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mux := http.NewServeMux()
+	mux.Handle(path, handler)
+	server := httptest.NewUnstartedServer(mux)
+	server.EnableHTTP2 = true
+	server.StartTLS()
+	t.Cleanup(server.Close)
+	client := grpchealth.NewClient(server.URL, grpchealth.WithHTTPClient(server.Client()))
+	if _, err := client.Check(context.Background(), &grpchealth.CheckRequest{}); err != nil {
+		t.Fatal(err)
+	}
+
+	var metrics metricdata.ResourceMetrics
+	if err := reader.Collect(context.Background(), &metrics); err != nil {
+		t.Fatal(err)
+	}
+	serving := make(map[string]int64)
+	var sawRPC bool
+	for _, scope := range metrics.ScopeMetrics {
+		for _, m := range scope.Metrics {
+			if m.Name == "rpc.server.duration" {
+				sawRPC = true
+			}
+			gauge, ok := m.Data.(metricdata.Gauge[int64])
+			if m.Name != "grpchealth.serving" || !ok {
+				continue
+			}
+			for _, point := range gauge.DataPoints {
+				service, _ := point.Attributes.Value(attribute.Key("grpc.health.service"))
+				serving[service.AsString()] = point.Value
+			}
+		}
+	}
+	if !sawRPC {
+		t.Fatal("missing otelconnect RPC metrics")
+	}
+	if len(serving) != 2 || serving[""] != 1 || serving[userFQN] != 0 {
+		t.Fatalf("got serving gauge %v", serving)
+	}
+}
+
+func TestNewStatsHandler(t *testing.T) {
+	const userFQN = "acme.user.v1.UserService"
+	t.Parallel()
+	reader := sdkmetric.NewManualReader()
+	stats, err := NewStatsHandler(sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	checker := grpchealth.NewStaticCheckerWithOptions([]string{userFQN}, grpchealth.WithStatusStats(stats))
+	checker.SetStatus(userFQN, grpchealth.StatusNotServing)
+	handler := grpchealth.NewHTTPHandler(checker, grpchealth.WithHandlerStats(stats))
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/?service="+userFQN, nil))
+	stats.HandleStats(context.Background(), &grpchealth.Propagation{
+		Service:  userFQN,
+		Status:   grpchealth.StatusNotServing,
+		Watchers: 1,
+		Latency:  time.Millisecond,
+	})
+
+	var metrics metricdata.ResourceMetrics
+	if err := reader.Collect(context.Background(), &metrics); err != nil {
+		t.Fatal(err)
+	}
+	var checks, propagations uint64
+	transitions := make(map[string]int64)
+	for _, scope := range metrics.ScopeMetrics {
+		for _, m := range scope.Metrics {
+			switch data := m.Data.(type) {
+			case metricdata.Histogram[float64]:
+				for _, point := range data.DataPoints {
+					switch m.Name {
+					case "grpchealth.check.duration":
+						checks += point.Count
+					case "grpchealth.propagation.duration":
+						propagations += point.Count
+					}
+				}
+			case metricdata.Sum[int64]:
+				if m.Name == "grpchealth.transitions" {
+					for _, point := range data.DataPoints {
+						status, _ := point.Attributes.Value(attribute.Key("grpc.health.status"))
+						transitions[status.AsString()] += point.Value
+					}
+				}
+			}
+		}
+	}
+	if checks != 1 {
+		t.Errorf("got %d checks, expected 1", checks)
+	}
+	if propagations != 1 {
+		t.Errorf("got %d propagations, expected 1", propagations)
+	}
+	if len(transitions) != 1 || transitions["not_serving"] != 1 {
+		t.Errorf("got transitions %v", transitions)
+	}
+}
+
+func TestTraceID(t *testing.T) {
+	t.Parallel()
+	if _, ok := TraceID(context.Background()); ok {
+		t.Fatal("got trace ID without a span")
+	}
+	traceID := trace.TraceID{0x4b, 0xf9, 0x2f, 0x35, 0x77, 0xb3, 0x4d, 0xa6, 0xa3, 0xce, 0x92, 0x9d, 0x0e, 0x0e, 0x47, 0x36}
+	ctx := trace.ContextWithSpanContext(context.Background(), trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    traceID,
+		SpanID:     trace.SpanID{1},
+		TraceFlags: trace.FlagsSampled,
+	}))
+	got, ok := TraceID(ctx)
+	if !ok || got != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Fatalf("got trace ID %q, %v", got, ok)
+	}
+}
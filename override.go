@@ -0,0 +1,154 @@
+// Copyright 2022-2024 The Connect Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package grpchealth
+
+import "time"
+
+// StatusOverride is a status set by an operator, which takes precedence over
+// the status set by the application.
+type StatusOverride struct {
+	// Status is the overriding status.
+	Status Status
+	// Expires is when the override ends. It's zero if the override lasts until
+	// it's cleared.
+	Expires time.Time
+
+	timer Timer
+}
+
+// StatusLayers describe how a StaticChecker arrives at a service's status.
+type StatusLayers struct {
+	// Effective is the status reported to clients.
+	Effective Status
+	// Computed is the status the service would have without an override,
+	// based on SetStatus, dependencies, and aggregation.
+	Computed Status
+	// Override is the active operator override, if any.
+	Override *StatusOverride
+}
+
+// SetOverride forces a service to report a status, regardless of the status
+// set by SetStatus, until the TTL elapses or ClearOverride is called. A
+// non-positive TTL makes the override last until it's cleared. Overrides let
+// operators take a process out of rotation, or keep it in rotation despite a
+// failing dependency, without fighting the application's own health logic.
+//
+// The override replaces the service's status entirely: it's not degraded by
+// dependencies. Setting an override replaces any previous override of the
+// same service. Changes in the service's effective status, when the override
+// is set, cleared, or expires, are reported as transitions to events and
+// stats handlers. If the checker validates service names and the name is
+// invalid, SetOverride returns a connect.CodeInvalidArgument error and leaves
+// the service's status unchanged.
+func (c *StaticChecker) SetOverride(service string, status Status, ttl time.Duration) error {
+	if err := c.validateService(service); err != nil {
+		return err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var expires time.Time
+	if ttl > 0 {
+		expires = c.clock.Now().Add(ttl)
+	}
+	before, _ := c.status(service)
+	c.setOverride(service, status, expires)
+	c.reportOverride(service, before)
+	return nil
+}
+
+// ClearOverride removes any override of a service, so it reports its
+// computed status again.
+func (c *StaticChecker) ClearOverride(service string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	before, _ := c.status(service)
+	if c.clearOverride(service) {
+		c.reportOverride(service, before)
+		c.notifyChanged(service)
+	}
+}
+
+// StatusLayers reports the effective, computed, and override statuses of a
+// service, and whether the service is known.
+func (c *StaticChecker) StatusLayers(service string) (StatusLayers, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	computed, known := c.computedStatus(service)
+	layers := StatusLayers{Effective: computed, Computed: computed}
+	if override, ok := c.activeOverride(service); ok {
+		layers.Effective = override.Status
+		layers.Override = &StatusOverride{Status: override.Status, Expires: override.Expires}
+		known = true
+	}
+	return layers, known
+}
+
+// activeOverride returns the override of a service, if it hasn't expired. The
+// caller must hold c.mu.
+func (c *StaticChecker) activeOverride(service string) (*StatusOverride, bool) {
+	override, ok := c.overrides[service]
+	if !ok || (!override.Expires.IsZero() && !c.clock.Now().Before(override.Expires)) {
+		return nil, false
+	}
+	return override, true
+}
+
+// setOverride replaces any override of a service with one that lasts until
+// expires, or until it's cleared if expires is zero. The caller must hold c.mu
+// for writing.
+func (c *StaticChecker) setOverride(service string, status Status, expires time.Time) {
+	c.clearOverride(service)
+	override := &StatusOverride{Status: status, Expires: expires}
+	if !expires.IsZero() {
+		override.timer = c.clock.AfterFunc(expires.Sub(c.clock.Now()), func() {
+			c.mu.Lock()
+			defer c.mu.Unlock()
+			if c.overrides[service] == override {
+				delete(c.overrides, service)
+				c.reportOverride(service, override.Status)
+				c.notifyChanged(service)
+			}
+		})
+	}
+	if c.overrides == nil {
+		c.overrides = make(map[string]*StatusOverride)
+	}
+	c.overrides[service] = override
+	c.notifyChanged(service)
+}
+
+// reportOverride reports a change in a service's effective status caused by
+// an override, given the status before the override changed. The caller must
+// hold c.mu for writing.
+func (c *StaticChecker) reportOverride(service string, before Status) {
+	if after, _ := c.status(service); after != before {
+		c.transition(service, before, after)
+		c.startPropagation(service, after)
+	}
+}
+
+// clearOverride removes any override of a service and reports whether there
+// was one. The caller must hold c.mu for writing.
+func (c *StaticChecker) clearOverride(service string) bool {
+	override, ok := c.overrides[service]
+	if !ok {
+		return false
+	}
+	if override.timer != nil {
+		override.timer.Stop()
+	}
+	delete(c.overrides, service)
+	return true
+}
@@ -0,0 +1,108 @@
+// Copyright 2022-2024 The Connect Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package grpchealth
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"connectrpc.com/connect"
+)
+
+func TestOverride(t *testing.T) {
+	const userFQN = "acme.user.v1.UserService"
+	t.Parallel()
+	checker := NewStaticCheckerWithOptions([]string{userFQN}, WithAggregatedProcessStatus())
+	checker.SetStatus(userFQN, StatusNotServing)
+	server := newTestServer(t, checker)
+	receive := newTestWatch(t, server, "")
+	receive(StatusNotServing)
+
+	if err := checker.SetOverride(userFQN, StatusServing, 50*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	receive(StatusServing)
+	layers, known := checker.StatusLayers(userFQN)
+	if !known || layers.Effective != StatusServing || layers.Computed != StatusNotServing || layers.Override == nil {
+		t.Fatalf("got layers %+v, known %v", layers, known)
+	}
+	// The override expires, restoring the computed status.
+	receive(StatusNotServing)
+	if layers, _ := checker.StatusLayers(userFQN); layers.Override != nil {
+		t.Fatalf("got override %+v after expiry", layers.Override)
+	}
+
+	if err := checker.SetOverride("", StatusServing, 0); err != nil {
+		t.Fatal(err)
+	}
+	receive(StatusServing)
+	checker.SetStatus(userFQN, StatusServing)
+	checker.SetStatus(userFQN, StatusNotServing)
+	res, err := checker.Check(context.Background(), &CheckRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Status != StatusServing {
+		t.Fatalf("got status %v despite override, expected %v", res.Status, StatusServing)
+	}
+	checker.ClearOverride("")
+	receive(StatusNotServing)
+}
+
+func TestOverrideTransitions(t *testing.T) {
+	const userFQN = "acme.user.v1.UserService"
+	t.Parallel()
+	events := NewEventStream(10)
+	checker := NewStaticCheckerWithOptions(
+		[]string{userFQN},
+		WithStatusEvents(events),
+		WithServiceNameValidation(nil),
+	)
+	expectTransition := func(previous, status Status) {
+		t.Helper()
+		select {
+		case event := <-events.Events():
+			if event.Kind != EventStatusChanged || event.Previous != previous || event.Status != status {
+				t.Fatalf("got event %+v, expected transition from %v to %v", event, previous, status)
+			}
+		default:
+			t.Fatalf("got no event, expected transition from %v to %v", previous, status)
+		}
+	}
+
+	if err := checker.SetOverride(userFQN, StatusNotServing, 0); err != nil {
+		t.Fatal(err)
+	}
+	expectTransition(StatusServing, StatusNotServing)
+	// Replacing the override without changing the effective status isn't a
+	// transition.
+	if err := checker.SetOverride(userFQN, StatusNotServing, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	checker.ClearOverride(userFQN)
+	expectTransition(StatusNotServing, StatusServing)
+	if len(events.Events()) != 0 {
+		t.Fatalf("got %d unexpected events", len(events.Events()))
+	}
+
+	err := checker.SetOverride("acme user", StatusServing, 0)
+	if code := connect.CodeOf(err); code != connect.CodeInvalidArgument {
+		t.Fatalf("got code %v for an invalid name, expected %v", code, connect.CodeInvalidArgument)
+	}
+	if len(events.Events()) != 0 {
+		t.Fatal("SetOverride with an invalid name reported a transition")
+	}
+}
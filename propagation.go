@@ -0,0 +1,210 @@
+// Copyright 2022-2024 The Connect Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package grpchealth
+
+import (
+	"context"
+	"time"
+)
+
+// Propagation is reported when a change in a StaticChecker service's status
+// has reached every watcher of the service that was active when the status
+// changed. Changes superseded by another change before reaching every watcher
+// aren't reported, and neither are changes with no watchers.
+type Propagation struct {
+	Service string
+	Status  Status
+	// Watchers is the number of watchers that received the change. Watchers
+	// that ended before receiving it aren't counted.
+	Watchers int
+	// Latency is the time from SetStatus to the last watcher receiving the
+	// change. For Watch streams served by this package's handlers, that's when
+	// the change was sent to the client, after any initial delay, jitter, hold
+	// time, or queueing. For other callers of Watch, it's when the update
+	// function returned. Operators can compare it with their drain windows.
+	Latency time.Duration
+	// Time is when the last watcher received the change.
+	Time time.Time
+}
+
+func (*Propagation) isStats() {}
+
+// PropagationRecorder records how long status changes take to reach every
+// watcher, per service, so operators can verify that their drain windows are
+// long enough. Register it with WithStatusStats, and export it with
+// WithPropagationHistograms or its Snapshot.
+type PropagationRecorder struct {
+	histograms *CheckLatencyRecorder
+}
+
+// NewPropagationRecorder constructs a PropagationRecorder with the supplied
+// bucket bounds. If there are none, the buckets span 1ms to 30s, covering
+// in-process delivery through the drain windows of typical load balancers.
+func NewPropagationRecorder(buckets ...time.Duration) *PropagationRecorder {
+	if len(buckets) == 0 {
+		buckets = []time.Duration{
+			time.Millisecond,
+			5 * time.Millisecond,
+			10 * time.Millisecond,
+			50 * time.Millisecond,
+			100 * time.Millisecond,
+			250 * time.Millisecond,
+			500 * time.Millisecond,
+			time.Second,
+			2500 * time.Millisecond,
+			5 * time.Second,
+			10 * time.Second,
+			30 * time.Second,
+		}
+	}
+	return &PropagationRecorder{histograms: NewCheckLatencyRecorder(buckets...)}
+}
+
+// HandleStats implements StatsHandler, recording each Propagation.
+func (r *PropagationRecorder) HandleStats(ctx context.Context, stats Stats) {
+	if propagation, ok := stats.(*Propagation); ok {
+		r.histograms.Observe(ctx, &CheckResult{
+			Service:  propagation.Service,
+			Duration: propagation.Latency,
+		})
+	}
+}
+
+// Snapshot returns a copy of the recorded histograms of propagation latency,
+// keyed by service name. The empty service name represents the whole process.
+func (r *PropagationRecorder) Snapshot() map[string]LatencyHistogram {
+	return r.histograms.Snapshot()
+}
+
+// WithPropagationHistograms makes NewMetricsHandler export the propagation
+// latencies recorded by a PropagationRecorder as the
+// grpchealth_propagation_seconds histogram.
+func WithPropagationHistograms(recorder *PropagationRecorder) MetricsOption {
+	return &propagationHistogramsOption{recorder: recorder}
+}
+
+type propagationHistogramsOption struct {
+	recorder *PropagationRecorder
+}
+
+func (o *propagationHistogramsOption) applyToMetrics(config *metricsConfig) {
+	config.Propagation = o.recorder
+}
+
+// propagation tracks a status change on its way to a service's watchers.
+type propagation struct {
+	status    Status
+	started   time.Time
+	pending   map[chan struct{}]struct{}
+	delivered int
+}
+
+// startPropagation begins measuring a change in a service's status, replacing
+// any measurement in progress. The caller must hold c.mu for writing.
+func (c *StaticChecker) startPropagation(service string, status Status) {
+	if len(c.stats) == 0 {
+		return
+	}
+	watchers := c.watchers[service]
+	if len(watchers) == 0 {
+		delete(c.propagations, service)
+		return
+	}
+	pending := make(map[chan struct{}]struct{}, len(watchers))
+	for changed := range watchers {
+		pending[changed] = struct{}{}
+	}
+	if c.propagations == nil {
+		c.propagations = make(map[string]*propagation)
+	}
+	c.propagations[service] = &propagation{
+		status:  status,
+		started: c.clock.Now(),
+		pending: pending,
+	}
+}
+
+// sendReportsKey marks the contexts of Watch calls made by handlers, which
+// call CheckResponse.markSent when they send an update to the client.
+type sendReportsKey struct{}
+
+// withSendReports marks a context passed to Watch by a handler that reports
+// sends.
+func withSendReports(ctx context.Context) context.Context {
+	return context.WithValue(ctx, sendReportsKey{}, true)
+}
+
+func reportsSends(ctx context.Context) bool {
+	reports, _ := ctx.Value(sendReportsKey{}).(bool)
+	return reports
+}
+
+// markSent reports that a Watch update was sent to the client. Handlers call
+// it after each send, including heartbeats, which are ignored.
+func (r *CheckResponse) markSent() {
+	if r.sent != nil {
+		r.sent()
+	}
+}
+
+// delivered records that a watcher received a status.
+func (c *StaticChecker) delivered(service string, changed chan struct{}, status Status) {
+	if len(c.stats) == 0 {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	p := c.propagations[service]
+	if p == nil || p.status != status {
+		return
+	}
+	if _, ok := p.pending[changed]; !ok {
+		return
+	}
+	delete(p.pending, changed)
+	p.delivered++
+	c.finishPropagation(service, p)
+}
+
+// abandonPropagation stops waiting for a watcher that ended. The caller must
+// hold c.mu for writing.
+func (c *StaticChecker) abandonPropagation(service string, changed chan struct{}) {
+	p := c.propagations[service]
+	if p == nil {
+		return
+	}
+	delete(p.pending, changed)
+	c.finishPropagation(service, p)
+}
+
+// finishPropagation reports a change once no watchers are pending. The
+// caller must hold c.mu for writing.
+func (c *StaticChecker) finishPropagation(service string, p *propagation) {
+	if len(p.pending) > 0 {
+		return
+	}
+	delete(c.propagations, service)
+	if p.delivered == 0 {
+		return
+	}
+	now := c.clock.Now()
+	handleStats(context.Background(), c.stats, &Propagation{
+		Service:  service,
+		Status:   p.status,
+		Watchers: p.delivered,
+		Latency:  now.Sub(p.started),
+		Time:     now,
+	})
+}
@@ -0,0 +1,122 @@
+// Copyright 2022-2024 The Connect Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package grpchealth
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPropagation(t *testing.T) {
+	t.Parallel()
+	recorder := NewPropagationRecorder()
+	propagations := make(chan *Propagation, 10)
+	checker := NewStaticCheckerWithOptions(nil, WithStatusStats(recorder, statsHandlerFunc(func(_ context.Context, stats Stats) {
+		if propagation, ok := stats.(*Propagation); ok {
+			propagations <- propagation
+		}
+	})))
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	// watch starts a watcher that takes delay to receive each change, and
+	// returns once it has received the current status.
+	watch := func(ctx context.Context, delay time.Duration) {
+		started := make(chan struct{})
+		go func() {
+			first := true
+			_ = checker.Watch(ctx, &CheckRequest{}, func(*CheckResponse) error {
+				if first {
+					first = false
+					close(started)
+					return nil
+				}
+				select {
+				case <-time.After(delay):
+					return nil
+				case <-ctx.Done():
+					return ctx.Err()
+				}
+			})
+		}()
+		<-started
+	}
+	watch(ctx, 0)
+	watch(ctx, 50*time.Millisecond)
+	checker.SetStatus("", StatusNotServing)
+	propagation := <-propagations
+	if propagation.Status != StatusNotServing || propagation.Watchers != 2 {
+		t.Fatalf("got propagation of %v to %d watchers", propagation.Status, propagation.Watchers)
+	}
+	if propagation.Latency < 50*time.Millisecond {
+		t.Fatalf("got latency %v, expected the slowest watcher's", propagation.Latency)
+	}
+
+	// Watchers that end before receiving a change aren't waited for.
+	abandoned, abandon := context.WithCancel(ctx)
+	watch(abandoned, time.Hour)
+	checker.SetStatus("", StatusServing)
+	time.Sleep(10 * time.Millisecond)
+	abandon()
+	if propagation := <-propagations; propagation.Watchers != 2 {
+		t.Fatalf("got propagation to %d watchers, expected 2", propagation.Watchers)
+	}
+
+	snapshot := recorder.Snapshot()
+	if snapshot[""].Count != 2 {
+		t.Fatalf("got %d recorded propagations, expected 2", snapshot[""].Count)
+	}
+	res := httptest.NewRecorder()
+	NewMetricsHandler(checker, WithPropagationHistograms(recorder)).ServeHTTP(res, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if body := res.Body.String(); !strings.Contains(body, "grpchealth_propagation_seconds_count{service=\"\"} 2\n") {
+		t.Fatalf("got metrics without propagation histogram:\n%s", body)
+	}
+}
+
+func TestPropagationHeldUpdates(t *testing.T) {
+	t.Parallel()
+	propagations := make(chan *Propagation, 10)
+	checker := NewStaticCheckerWithOptions(nil, WithStatusStats(statsHandlerFunc(func(_ context.Context, stats Stats) {
+		if propagation, ok := stats.(*Propagation); ok {
+			propagations <- propagation
+		}
+	})))
+	mux := http.NewServeMux()
+	mux.Handle(NewHandler(checker, WithWatchHoldTime(50*time.Millisecond)))
+	server := httptest.NewUnstartedServer(mux)
+	server.EnableHTTP2 = true
+	server.StartTLS()
+	t.Cleanup(server.Close)
+	receive := newTestWatch(t, server, "")
+	receive(StatusServing)
+
+	// The handler holds the change before sending it, and the propagation
+	// isn't complete until it's sent.
+	checker.SetStatus("", StatusNotServing)
+	receive(StatusNotServing)
+	propagation := <-propagations
+	if propagation.Watchers != 1 || propagation.Latency < 50*time.Millisecond {
+		t.Fatalf("got propagation to %d watchers after %v, expected to include the hold time", propagation.Watchers, propagation.Latency)
+	}
+}
+
+type statsHandlerFunc func(context.Context, Stats)
+
+func (f statsHandlerFunc) HandleStats(ctx context.Context, stats Stats) {
+	f(ctx, stats)
+}
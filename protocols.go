@@ -0,0 +1,95 @@
+// Copyright 2022-2024 The Connect Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package grpchealth
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"connectrpc.com/connect"
+)
+
+// WithProtocols restricts the wire protocols accepted by the handlers built by
+// NewHandler, NewCheckHandler, NewWatchHandler, and NewListHandler to those
+// listed: connect.ProtocolGRPC, connect.ProtocolGRPCWeb, or
+// connect.ProtocolConnect. By default, handlers accept all three. Deployments
+// that must not expose Connect's JSON and GET support on infrastructure
+// endpoints can accept only gRPC:
+//
+//	mux.Handle(grpchealth.NewHandler(checker, grpchealth.WithProtocols(connect.ProtocolGRPC)))
+//
+// Requests using any other protocol are rejected before they're decoded, with
+// connect.CodeUnimplemented and a message naming the accepted protocols, in
+// the protocol of the request.
+func WithProtocols(protocols ...string) HandlerOption {
+	allowed := make(map[string]struct{}, len(protocols))
+	for _, protocol := range protocols {
+		allowed[protocol] = struct{}{}
+	}
+	return newHandlerOption(func(config *handlerConfig) {
+		config.Protocols = allowed
+	})
+}
+
+// restrictProtocols wraps an RPC handler to reject requests using protocols
+// excluded by WithProtocols, if any.
+func (c *handlerConfig) restrictProtocols(handler http.Handler) http.Handler {
+	if c.Protocols == nil {
+		return handler
+	}
+	message := "no protocols are enabled for this endpoint"
+	if len(c.Protocols) > 0 {
+		message = "this endpoint only accepts " + strings.Join(sortedKeys(c.Protocols), ", ")
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		protocol := requestProtocol(r)
+		if _, ok := c.Protocols[protocol]; ok {
+			handler.ServeHTTP(w, r)
+			return
+		}
+		message := fmt.Sprintf("protocol %s isn't enabled: %s", protocol, message)
+		if protocol == connect.ProtocolConnect {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusNotFound)
+			_ = json.NewEncoder(w).Encode(map[string]string{
+				"code":    connect.CodeUnimplemented.String(),
+				"message": message,
+			})
+			return
+		}
+		// A trailers-only response, which gRPC and gRPC-Web clients read the
+		// same way.
+		w.Header().Set("Content-Type", r.Header.Get("Content-Type"))
+		w.Header().Set("Grpc-Status", fmt.Sprint(int(connect.CodeUnimplemented)))
+		w.Header().Set("Grpc-Message", message)
+		w.WriteHeader(http.StatusOK)
+	})
+}
+
+// requestProtocol identifies the protocol of an RPC request the way Connect
+// handlers do, by its Content-Type.
+func requestProtocol(r *http.Request) string {
+	contentType := r.Header.Get("Content-Type")
+	switch {
+	case strings.HasPrefix(contentType, "application/grpc-web"):
+		return connect.ProtocolGRPCWeb
+	case strings.HasPrefix(contentType, "application/grpc"):
+		return connect.ProtocolGRPC
+	default:
+		return connect.ProtocolConnect
+	}
+}
@@ -0,0 +1,96 @@
+// Copyright 2022-2024 The Connect Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package grpchealth
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"connectrpc.com/connect"
+	healthv1 "connectrpc.com/grpchealth/internal/gen/go/connectext/grpc/health/v1"
+)
+
+func TestWithProtocols(t *testing.T) {
+	t.Parallel()
+	mux := http.NewServeMux()
+	mux.Handle(NewHandler(NewStaticChecker(), WithProtocols(connect.ProtocolGRPC)))
+	server := httptest.NewUnstartedServer(mux)
+	server.EnableHTTP2 = true
+	server.StartTLS()
+	t.Cleanup(server.Close)
+	check := func(options ...connect.ClientOption) error {
+		client := connect.NewClient[healthv1.HealthCheckRequest, healthv1.HealthCheckResponse](
+			server.Client(),
+			server.URL+"/grpc.health.v1.Health/Check",
+			options...,
+		)
+		_, err := client.CallUnary(context.Background(), connect.NewRequest(&healthv1.HealthCheckRequest{}))
+		return err
+	}
+	if err := check(connect.WithGRPC()); err != nil {
+		t.Fatal(err)
+	}
+	for name, option := range map[string]connect.ClientOption{
+		connect.ProtocolGRPCWeb: connect.WithGRPCWeb(),
+		connect.ProtocolConnect: connect.WithProtoJSON(),
+	} {
+		err := check(option)
+		if connect.CodeOf(err) != connect.CodeUnimplemented {
+			t.Errorf("%s: got error %v, expected %v", name, err, connect.CodeUnimplemented)
+			continue
+		}
+		if !strings.Contains(err.Error(), "only accepts grpc") {
+			t.Errorf("%s: error %q doesn't name the accepted protocols", name, err)
+		}
+	}
+	// Streams are rejected too.
+	watch := connect.NewClient[healthv1.HealthCheckRequest, healthv1.HealthCheckResponse](
+		server.Client(),
+		server.URL+"/grpc.health.v1.Health/Watch",
+	)
+	stream, err := watch.CallServerStream(context.Background(), connect.NewRequest(&healthv1.HealthCheckRequest{}))
+	if err == nil {
+		for stream.Receive() {
+			t.Error("received a message from a rejected stream")
+		}
+		err = stream.Err()
+		stream.Close()
+	}
+	if connect.CodeOf(err) != connect.CodeUnimplemented {
+		t.Errorf("got error %v from Watch, expected %v", err, connect.CodeUnimplemented)
+	}
+}
+
+func TestRequestProtocol(t *testing.T) {
+	t.Parallel()
+	for contentType, expect := range map[string]string{
+		"application/grpc":           connect.ProtocolGRPC,
+		"application/grpc+proto":     connect.ProtocolGRPC,
+		"application/grpc-web+proto": connect.ProtocolGRPCWeb,
+		"application/grpc-web-text":  connect.ProtocolGRPCWeb,
+		"application/json":           connect.ProtocolConnect,
+		"application/connect+proto":  connect.ProtocolConnect,
+		"":                           connect.ProtocolConnect,
+	} {
+		req := httptest.NewRequest(http.MethodPost, "/", nil)
+		req.Header.Set("Content-Type", contentType)
+		if got := requestProtocol(req); got != expect {
+			t.Errorf("got protocol %q for %q, expected %q", got, contentType, expect)
+		}
+	}
+}
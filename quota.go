@@ -0,0 +1,92 @@
+// Copyright 2022-2024 The Connect Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package grpchealth
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+
+	"connectrpc.com/connect"
+)
+
+// WithWatchQuota limits the number of concurrent Watch streams per client, so
+// a single misbehaving monitor can't exhaust the watchers a server can afford
+// (see WithMaxWatchers). Streams beyond the limit fail with
+// connect.CodeResourceExhausted.
+//
+// The key function identifies a stream's client. If it's nil, clients are
+// identified by their IP address. Use the headers to key on an identity
+// instead, such as an authenticated principal set by a proxy; streams with an
+// empty key aren't limited.
+func WithWatchQuota(limit int, key func(peer connect.Peer, header http.Header) string) HandlerOption {
+	if key == nil {
+		key = peerHost
+	}
+	return newHandlerOption(func(config *handlerConfig) {
+		config.WatchQuota = nil
+		if limit > 0 {
+			config.WatchQuota = &watchQuota{
+				limit:   limit,
+				key:     key,
+				streams: make(map[string]int),
+			}
+		}
+	})
+}
+
+// watchQuota counts the Watch streams open for each client.
+type watchQuota struct {
+	limit int
+	key   func(connect.Peer, http.Header) string
+
+	mu      sync.Mutex
+	streams map[string]int
+}
+
+// acquire reserves a stream for a client. If the client is within its quota,
+// it returns a function releasing the stream.
+func (q *watchQuota) acquire(peer connect.Peer, header http.Header) (func(), error) {
+	key := q.key(peer, header)
+	if key == "" {
+		return func() {}, nil
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.streams[key] >= q.limit {
+		return nil, connect.NewError(
+			connect.CodeResourceExhausted,
+			fmt.Errorf("too many watchers from %s (limit %d)", key, q.limit),
+		)
+	}
+	q.streams[key]++
+	return func() {
+		q.mu.Lock()
+		defer q.mu.Unlock()
+		if q.streams[key]--; q.streams[key] == 0 {
+			delete(q.streams, key)
+		}
+	}, nil
+}
+
+// peerHost identifies a client by the host part of its address.
+func peerHost(peer connect.Peer, _ http.Header) string {
+	host, _, err := net.SplitHostPort(peer.Addr)
+	if err != nil {
+		return peer.Addr
+	}
+	return host
+}
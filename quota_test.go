@@ -0,0 +1,98 @@
+// Copyright 2022-2024 The Connect Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package grpchealth
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"connectrpc.com/connect"
+	healthv1 "connectrpc.com/grpchealth/internal/gen/go/connectext/grpc/health/v1"
+)
+
+func TestWatchQuota(t *testing.T) {
+	t.Parallel()
+	mux := http.NewServeMux()
+	mux.Handle(NewHandler(NewStaticChecker(), WithWatchQuota(2, func(peer connect.Peer, header http.Header) string {
+		if principal := header.Get("Principal"); principal != "" {
+			return principal
+		}
+		return peerHost(peer, header)
+	})))
+	server := httptest.NewUnstartedServer(mux)
+	server.EnableHTTP2 = true
+	server.StartTLS()
+	t.Cleanup(server.Close)
+	client := connect.NewClient[healthv1.HealthCheckRequest, healthv1.HealthCheckResponse](
+		server.Client(),
+		server.URL+"/grpc.health.v1.Health/Watch",
+		connect.WithGRPC(),
+	)
+	// watch opens a stream and returns the error, if any, before its first
+	// message. Calling the returned function ends the stream.
+	watch := func(principal string) (context.CancelFunc, error) {
+		ctx, cancel := context.WithCancel(context.Background())
+		t.Cleanup(cancel)
+		req := connect.NewRequest(&healthv1.HealthCheckRequest{})
+		req.Header().Set("Principal", principal)
+		stream, err := client.CallServerStream(ctx, req)
+		if err != nil {
+			return cancel, err
+		}
+		if !stream.Receive() {
+			return cancel, stream.Err()
+		}
+		return cancel, nil
+	}
+	endFirst, err := watch("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := watch(""); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := watch(""); connect.CodeOf(err) != connect.CodeResourceExhausted {
+		t.Fatalf("got error %v, expected %v", err, connect.CodeResourceExhausted)
+	}
+	// Other clients have their own quota.
+	if _, err := watch("monitor"); err != nil {
+		t.Fatal(err)
+	}
+	// Ending a stream frees its slot.
+	endFirst()
+	for {
+		if _, err = watch(""); connect.CodeOf(err) != connect.CodeResourceExhausted {
+			break
+		}
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPeerHost(t *testing.T) {
+	t.Parallel()
+	for addr, expect := range map[string]string{
+		"10.0.0.1:1234": "10.0.0.1",
+		"[::1]:1234":    "::1",
+		"pipe":          "pipe",
+	} {
+		if got := peerHost(connect.Peer{Addr: addr}, nil); got != expect {
+			t.Errorf("got host %q for %q, expected %q", got, addr, expect)
+		}
+	}
+}
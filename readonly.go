@@ -0,0 +1,86 @@
+// Copyright 2022-2024 The Connect Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package grpchealth
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"connectrpc.com/connect"
+)
+
+// ReadOnlyChecker is a view of a Checker, such as a StaticChecker, that only
+// exposes observation: checks, watches, listing, and statistics. Hand it to
+// subsystems that only observe health, like dashboards and metrics handlers,
+// so they can't change statuses by accident. Type assertions on it can't reach
+// the underlying checker's SetStatus or other mutators.
+type ReadOnlyChecker struct {
+	checker Checker
+}
+
+// NewReadOnlyChecker constructs a read-only view of the checker.
+func NewReadOnlyChecker(checker Checker) *ReadOnlyChecker {
+	return &ReadOnlyChecker{checker: checker}
+}
+
+// Check implements Checker.
+func (r *ReadOnlyChecker) Check(ctx context.Context, req *CheckRequest) (*CheckResponse, error) {
+	return r.checker.Check(ctx, req)
+}
+
+// Watch implements Watcher. It returns an error if the underlying Checker
+// isn't a Watcher.
+func (r *ReadOnlyChecker) Watch(ctx context.Context, req *CheckRequest, update func(*CheckResponse) error) error {
+	watcher, ok := r.checker.(Watcher)
+	if !ok {
+		return connect.NewError(
+			connect.CodeUnimplemented,
+			errors.New("read-only checker doesn't support watching health state"),
+		)
+	}
+	return watcher.Watch(ctx, req, update)
+}
+
+// List implements Lister. It returns an error if the underlying Checker isn't a
+// Lister.
+func (r *ReadOnlyChecker) List(ctx context.Context) (map[string]Status, error) {
+	lister, ok := r.checker.(Lister)
+	if !ok {
+		return nil, connect.NewError(
+			connect.CodeUnimplemented,
+			errors.New("read-only checker doesn't support listing services"),
+		)
+	}
+	return lister.List(ctx)
+}
+
+// Stats reports the activity of each service, if the underlying Checker
+// tracks it, as StaticChecker does. Otherwise, it returns nil.
+func (r *ReadOnlyChecker) Stats() map[string]ServiceStats {
+	if reporter, ok := r.checker.(statsReporter); ok {
+		return reporter.Stats()
+	}
+	return nil
+}
+
+// LastTransition returns when a service's status last changed, if the
+// underlying Checker tracks it, as StaticChecker does.
+func (r *ReadOnlyChecker) LastTransition(service string) (time.Time, bool) {
+	if reporter, ok := r.checker.(transitionReporter); ok {
+		return reporter.LastTransition(service)
+	}
+	return time.Time{}, false
+}
@@ -0,0 +1,80 @@
+// Copyright 2022-2024 The Connect Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package grpchealth
+
+import (
+	"context"
+	"testing"
+
+	"connectrpc.com/connect"
+)
+
+func TestReadOnlyChecker(t *testing.T) {
+	const userFQN = "acme.user.v1.UserService"
+	t.Parallel()
+	checker := NewStaticChecker(userFQN)
+	view := NewReadOnlyChecker(checker)
+	if _, ok := Checker(view).(StatusSetter); ok {
+		t.Fatal("read-only view exposes SetStatus")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	updates := make(chan Status, 2)
+	go func() {
+		_ = view.Watch(ctx, &CheckRequest{Service: userFQN}, func(res *CheckResponse) error {
+			updates <- res.Status
+			return nil
+		})
+	}()
+	<-updates
+	checker.SetStatus(userFQN, StatusNotServing)
+	if status := <-updates; status != StatusNotServing {
+		t.Fatalf("got watched status %v", status)
+	}
+	res, err := view.Check(ctx, &CheckRequest{Service: userFQN})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Status != StatusNotServing {
+		t.Fatalf("got status %v", res.Status)
+	}
+	statuses, err := view.List(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if statuses[userFQN] != StatusNotServing {
+		t.Fatalf("got statuses %v", statuses)
+	}
+	if view.Stats()[userFQN].Transitions != 1 {
+		t.Fatalf("got stats %v", view.Stats())
+	}
+	if _, ok := view.LastTransition(userFQN); !ok {
+		t.Fatal("expected the last transition")
+	}
+
+	// Capabilities the underlying checker lacks are unimplemented.
+	limited := NewReadOnlyChecker(struct{ Checker }{checker})
+	err = limited.Watch(ctx, &CheckRequest{}, func(*CheckResponse) error { return nil })
+	if code := connect.CodeOf(err); code != connect.CodeUnimplemented {
+		t.Fatalf("got code %v, expected %v", code, connect.CodeUnimplemented)
+	}
+	if _, err := limited.List(ctx); connect.CodeOf(err) != connect.CodeUnimplemented {
+		t.Fatalf("got error %v listing, expected %v", err, connect.CodeUnimplemented)
+	}
+	if limited.Stats() != nil {
+		t.Fatal("got stats from a checker without them")
+	}
+}
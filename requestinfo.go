@@ -0,0 +1,82 @@
+// Copyright 2022-2024 The Connect Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package grpchealth
+
+import (
+	"context"
+	"net/http"
+
+	"connectrpc.com/connect"
+)
+
+// ProtocolHTTP is the protocol reported by ProtocolFromContext for requests to
+// the plain HTTP endpoints, such as those built by NewHTTPHandler,
+// NewEnvoyHandler, and NewSSEHandler.
+const ProtocolHTTP = "http"
+
+type requestInfoKey struct{}
+
+type requestInfo struct {
+	header http.Header
+	peer   connect.Peer
+}
+
+// withRequestInfo attaches the request headers and peer to the context, for
+// the accessors below.
+func withRequestInfo(ctx context.Context, header http.Header, peer connect.Peer) context.Context {
+	return context.WithValue(ctx, requestInfoKey{}, &requestInfo{header: header, peer: peer})
+}
+
+// withHTTPRequestInfo attaches the request headers, peer, and verified TLS
+// identity of a request to a plain HTTP endpoint.
+func withHTTPRequestInfo(ctx context.Context, r *http.Request) context.Context {
+	ctx = withPeerIdentity(ctx, r)
+	return withRequestInfo(ctx, r.Header, connect.Peer{
+		Addr:     r.RemoteAddr,
+		Protocol: ProtocolHTTP,
+		Query:    r.URL.Query(),
+	})
+}
+
+// RequestHeaderFromContext returns the headers of the health check request
+// being served, if any. Every handler in this package attaches them to the
+// context passed to Checkers, so Checkers can vary their response by caller.
+// The headers must not be modified.
+func RequestHeaderFromContext(ctx context.Context) (http.Header, bool) {
+	info, ok := ctx.Value(requestInfoKey{}).(*requestInfo)
+	if !ok {
+		return nil, false
+	}
+	return info.header, true
+}
+
+// PeerFromContext returns the client of the health check request being
+// served, if any.
+func PeerFromContext(ctx context.Context) (connect.Peer, bool) {
+	info, ok := ctx.Value(requestInfoKey{}).(*requestInfo)
+	if !ok {
+		return connect.Peer{}, false
+	}
+	return info.peer, true
+}
+
+// ProtocolFromContext returns the protocol of the health check request being
+// served, if any: connect.ProtocolGRPC, connect.ProtocolGRPCWeb, or
+// connect.ProtocolConnect for RPCs, and ProtocolHTTP for the plain HTTP
+// endpoints.
+func ProtocolFromContext(ctx context.Context) (string, bool) {
+	peer, ok := PeerFromContext(ctx)
+	return peer.Protocol, ok
+}
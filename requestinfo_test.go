@@ -0,0 +1,93 @@
+// Copyright 2022-2024 The Connect Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package grpchealth
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"connectrpc.com/connect"
+	healthv1 "connectrpc.com/grpchealth/internal/gen/go/connectext/grpc/health/v1"
+)
+
+func TestRequestInfo(t *testing.T) {
+	t.Parallel()
+	type observed struct {
+		header   string
+		addr     string
+		protocol string
+	}
+	seen := make(chan observed, 1)
+	checker := checkerFunc(func(ctx context.Context, _ *CheckRequest) (*CheckResponse, error) {
+		header, ok := RequestHeaderFromContext(ctx)
+		if !ok {
+			t.Error("no request header in context")
+		}
+		peer, ok := PeerFromContext(ctx)
+		if !ok {
+			t.Error("no peer in context")
+		}
+		protocol, _ := ProtocolFromContext(ctx)
+		seen <- observed{header: header.Get("Probe"), addr: peer.Addr, protocol: protocol}
+		return &CheckResponse{Status: StatusServing}, nil
+	})
+	assertSeen := func(t *testing.T, protocol string) {
+		t.Helper()
+		got := <-seen
+		if got.header != "canary" || got.addr == "" || got.protocol != protocol {
+			t.Errorf("got %+v, expected the probe header, an address, and protocol %q", got, protocol)
+		}
+	}
+
+	server := newTestServer(t, checker)
+	for protocol, option := range map[string]connect.ClientOption{
+		connect.ProtocolGRPC:    connect.WithGRPC(),
+		connect.ProtocolGRPCWeb: connect.WithGRPCWeb(),
+		connect.ProtocolConnect: connect.WithProtoJSON(),
+	} {
+		client := connect.NewClient[healthv1.HealthCheckRequest, healthv1.HealthCheckResponse](
+			server.Client(),
+			server.URL+"/grpc.health.v1.Health/Check",
+			option,
+		)
+		req := connect.NewRequest(&healthv1.HealthCheckRequest{})
+		req.Header().Set("Probe", "canary")
+		if _, err := client.CallUnary(context.Background(), req); err != nil {
+			t.Fatal(err)
+		}
+		assertSeen(t, protocol)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Probe", "canary")
+	NewHTTPHandler(checker).ServeHTTP(httptest.NewRecorder(), req)
+	assertSeen(t, ProtocolHTTP)
+}
+
+func TestRequestInfoMissing(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	if _, ok := RequestHeaderFromContext(ctx); ok {
+		t.Error("found request header in empty context")
+	}
+	if _, ok := PeerFromContext(ctx); ok {
+		t.Error("found peer in empty context")
+	}
+	if protocol, ok := ProtocolFromContext(ctx); ok || protocol != "" {
+		t.Errorf("found protocol %q in empty context", protocol)
+	}
+}
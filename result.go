@@ -0,0 +1,98 @@
+// Copyright 2022-2024 The Connect Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package grpchealth
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+)
+
+// CheckResult is a detailed record of a single health check. It's richer than
+// CheckResponse, so it's useful for debugging, logging, and metrics, but it
+// isn't part of gRPC's health-checking API.
+type CheckResult struct {
+	// Service is the checked service. The empty string represents the whole
+	// process.
+	Service string
+	// Status is the status reported by the Checker. If the check failed, it's
+	// StatusUnknown.
+	Status Status
+	// Err is the error returned by the Checker, if any.
+	Err error
+	// Details are the details reported by the Checker, if any.
+	Details map[string]string
+	// ObservedAt is the time the check started.
+	ObservedAt time.Time
+	// Duration is how long the check took.
+	Duration time.Duration
+	// RequestID is the ID of the request that triggered the check, if it was
+	// attached to the context by a handler built with WithRequestIDHeader.
+	RequestID string
+	// RetryAfter is the Checker's estimate of how long the service needs to
+	// recover, if any.
+	RetryAfter time.Duration
+}
+
+// RunCheck calls the Checker and records the outcome as a CheckResult.
+func RunCheck(ctx context.Context, checker Checker, req *CheckRequest) *CheckResult {
+	return runCheck(ctx, systemClock{}, checker, req)
+}
+
+// runCheck is RunCheck with a Clock timing the check.
+func runCheck(ctx context.Context, clock Clock, checker Checker, req *CheckRequest) *CheckResult {
+	start := clock.Now()
+	res, err := checker.Check(ctx, req)
+	result := &CheckResult{
+		Service:    req.Service,
+		Err:        err,
+		ObservedAt: start,
+		Duration:   clock.Now().Sub(start),
+	}
+	result.RequestID, _ = RequestIDFromContext(ctx)
+	if err == nil {
+		result.Status = res.Status
+		result.Details = res.Details
+		result.RetryAfter = res.RetryAfter
+	}
+	return result
+}
+
+// MarshalJSON implements json.Marshaler. Errors are encoded as strings and
+// durations as fractional seconds.
+func (r *CheckResult) MarshalJSON() ([]byte, error) {
+	encoded := struct {
+		Service    string            `json:"service"`
+		Status     Status            `json:"status"`
+		Error      string            `json:"error,omitempty"`
+		Details    map[string]string `json:"details,omitempty"`
+		ObservedAt time.Time         `json:"observedAt"`
+		Duration   float64           `json:"durationSeconds"`
+		RequestID  string            `json:"requestId,omitempty"`
+		RetryAfter float64           `json:"retryAfterSeconds,omitempty"`
+	}{
+		Service:    r.Service,
+		Status:     r.Status,
+		Details:    r.Details,
+		ObservedAt: r.ObservedAt,
+		Duration:   r.Duration.Seconds(),
+		RequestID:  r.RequestID,
+		RetryAfter: r.RetryAfter.Seconds(),
+	}
+	if r.Err != nil {
+		encoded.Error = r.Err.Error()
+	}
+	return json.Marshal(encoded)
+}
@@ -0,0 +1,65 @@
+// Copyright 2022-2024 The Connect Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package grpchealth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestRunCheck(t *testing.T) {
+	t.Parallel()
+	checker := checkerFunc(func(_ context.Context, req *CheckRequest) (*CheckResponse, error) {
+		if req.Service != "" {
+			return nil, errors.New("oh no")
+		}
+		return &CheckResponse{
+			Status:  StatusNotServing,
+			Details: map[string]string{"lag": "42s"},
+		}, nil
+	})
+
+	result := RunCheck(context.Background(), checker, &CheckRequest{})
+	if result.Status != StatusNotServing || result.Err != nil || result.Details["lag"] != "42s" {
+		t.Fatalf("got result %+v", result)
+	}
+	if result.ObservedAt.IsZero() || result.Duration < 0 {
+		t.Fatalf("got timing %v/%v", result.ObservedAt, result.Duration)
+	}
+
+	result = RunCheck(context.Background(), checker, &CheckRequest{Service: "foobar"})
+	if result.Status != StatusUnknown || result.Err == nil {
+		t.Fatalf("got result %+v", result)
+	}
+	result.ObservedAt = time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	result.Duration = 1500 * time.Millisecond
+	data, err := json.Marshal(result)
+	if err != nil {
+		t.Fatal(err)
+	}
+	const expect = `{"service":"foobar","status":"unknown","error":"oh no","observedAt":"2024-01-02T03:04:05Z","durationSeconds":1.5}`
+	if string(data) != expect {
+		t.Fatalf("got JSON %s, expected %s", data, expect)
+	}
+}
+
+type checkerFunc func(context.Context, *CheckRequest) (*CheckResponse, error)
+
+func (f checkerFunc) Check(ctx context.Context, req *CheckRequest) (*CheckResponse, error) {
+	return f(ctx, req)
+}
@@ -0,0 +1,128 @@
+// Copyright 2022-2024 The Connect Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package grpchealth
+
+import (
+	"context"
+	"runtime/metrics"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// RuntimeCheckerParams configure a RuntimeChecker. A zero limit disables the
+// corresponding check.
+type RuntimeCheckerParams struct {
+	// MaxGoroutines is the number of goroutines above which the process is
+	// assumed to be leaking them or running away with concurrency.
+	MaxGoroutines uint64
+	// MaxHeapBytes is the heap memory occupied by objects, live or not yet
+	// collected, above which the process is assumed to be leaking memory.
+	MaxHeapBytes uint64
+	// MaxGCPause is the 99th percentile of stop-the-world garbage collection
+	// pauses, since the previous sample, above which the process is assumed
+	// to be thrashing.
+	MaxGCPause time.Duration
+	// Interval is the minimum time between samples. Checks made more often
+	// reuse the previous result.
+	Interval time.Duration
+	// Clock times samples. The default is the system clock.
+	Clock Clock
+}
+
+// RuntimeChecker is a Checker that catches goroutine leaks, memory leaks, and
+// garbage collection thrashing before the process becomes unresponsive. It
+// reads runtime/metrics and reports StatusNotServing while any of them
+// exceeds its limit. The details of the response include the measured values.
+//
+// RuntimeChecker reports the same status for every service.
+type RuntimeChecker struct {
+	params RuntimeCheckerParams
+
+	mu       sync.Mutex
+	sampled  time.Time
+	gcPauses *metrics.Float64Histogram
+	response *CheckResponse
+}
+
+// NewRuntimeChecker constructs a RuntimeChecker.
+func NewRuntimeChecker(params RuntimeCheckerParams) *RuntimeChecker {
+	if params.Clock == nil {
+		params.Clock = systemClock{}
+	}
+	return &RuntimeChecker{
+		params:   params,
+		gcPauses: readRuntimeMetrics().gcPauses,
+	}
+}
+
+// Check implements Checker.
+func (c *RuntimeChecker) Check(_ context.Context, _ *CheckRequest) (*CheckResponse, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.response != nil && c.params.Clock.Now().Sub(c.sampled) < c.params.Interval {
+		return c.response, nil
+	}
+	sample := readRuntimeMetrics()
+	status := StatusServing
+	details := make(map[string]string, 3)
+	if sample.goroutines.Kind() == metrics.KindUint64 {
+		goroutines := sample.goroutines.Uint64()
+		details["goroutines"] = strconv.FormatUint(goroutines, 10)
+		if c.params.MaxGoroutines > 0 && goroutines > c.params.MaxGoroutines {
+			status = StatusNotServing
+		}
+	}
+	if sample.heap.Kind() == metrics.KindUint64 {
+		heap := sample.heap.Uint64()
+		details["heap_bytes"] = strconv.FormatUint(heap, 10)
+		if c.params.MaxHeapBytes > 0 && heap > c.params.MaxHeapBytes {
+			status = StatusNotServing
+		}
+	}
+	if pause, ok := histogramPercentile(c.gcPauses, sample.gcPauses, 0.99); ok {
+		details["gc_pause_p99"] = pause.String()
+		if c.params.MaxGCPause > 0 && pause > c.params.MaxGCPause {
+			status = StatusNotServing
+		}
+	}
+	c.sampled = c.params.Clock.Now()
+	c.gcPauses = sample.gcPauses
+	c.response = &CheckResponse{Status: status, Details: details}
+	return c.response, nil
+}
+
+type runtimeSample struct {
+	goroutines metrics.Value
+	heap       metrics.Value
+	gcPauses   *metrics.Float64Histogram
+}
+
+func readRuntimeMetrics() runtimeSample {
+	samples := []metrics.Sample{
+		{Name: "/sched/goroutines:goroutines"},
+		{Name: "/memory/classes/heap/objects:bytes"},
+		{Name: "/gc/pauses:seconds"},
+	}
+	metrics.Read(samples)
+	sample := runtimeSample{
+		goroutines: samples[0].Value,
+		heap:       samples[1].Value,
+	}
+	if samples[2].Value.Kind() == metrics.KindFloat64Histogram {
+		sample.gcPauses = samples[2].Value.Float64Histogram()
+	}
+	return sample
+}
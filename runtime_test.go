@@ -0,0 +1,52 @@
+// Copyright 2022-2024 The Connect Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package grpchealth
+
+import (
+	"context"
+	"testing"
+)
+
+func TestRuntimeChecker(t *testing.T) {
+	t.Parallel()
+	res, err := NewRuntimeChecker(RuntimeCheckerParams{
+		MaxGoroutines: 1 << 20,
+		MaxHeapBytes:  1 << 40,
+		MaxGCPause:    0,
+		Interval:      0,
+	}).Check(context.Background(), &CheckRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Status != StatusServing {
+		t.Fatalf("got status %v (details %v)", res.Status, res.Details)
+	}
+	if res.Details["goroutines"] == "" || res.Details["heap_bytes"] == "" {
+		t.Fatalf("got details %v", res.Details)
+	}
+
+	res, err = NewRuntimeChecker(RuntimeCheckerParams{
+		MaxGoroutines: 1,
+		MaxHeapBytes:  0,
+		MaxGCPause:    0,
+		Interval:      0,
+	}).Check(context.Background(), &CheckRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Status != StatusNotServing {
+		t.Fatalf("got status %v with more goroutines than allowed", res.Status)
+	}
+}
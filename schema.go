@@ -0,0 +1,101 @@
+// Copyright 2022-2024 The Connect Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package grpchealth
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// SchemaCheckerParams configure a SchemaChecker.
+type SchemaCheckerParams struct {
+	// Expected is the schema version the application was built against.
+	Expected string
+	// Current queries the database for its schema version. For example, with
+	// golang-migrate's table:
+	//
+	//	func(ctx context.Context) (string, error) {
+	//		var version string
+	//		err := db.QueryRowContext(ctx, "SELECT version FROM schema_migrations").Scan(&version)
+	//		return version, err
+	//	}
+	Current func(ctx context.Context) (string, error)
+	// Interval is the minimum time between queries. Checks made more often
+	// reuse the previous result. Once the versions match, the database is
+	// queried no more than once per interval.
+	Interval time.Duration
+	// Clock times queries. The default is the system clock.
+	Clock Clock
+}
+
+// SchemaChecker is a Checker that reports StatusNotServing until the
+// database's schema version matches the one the application expects, so
+// instances running against un-migrated databases never receive traffic. If
+// the query fails, it also reports StatusNotServing. The details of the
+// response include both versions or the error.
+//
+// SchemaChecker reports the same status for every service.
+type SchemaChecker struct {
+	params SchemaCheckerParams
+
+	mu       sync.Mutex
+	queried  time.Time
+	response *CheckResponse
+}
+
+// NewSchemaChecker constructs a SchemaChecker.
+func NewSchemaChecker(params SchemaCheckerParams) (*SchemaChecker, error) {
+	if params.Expected == "" {
+		return nil, errors.New("schema checker requires an expected version")
+	}
+	if params.Current == nil {
+		return nil, errors.New("schema checker requires a version query")
+	}
+	if params.Clock == nil {
+		params.Clock = systemClock{}
+	}
+	return &SchemaChecker{params: params}, nil
+}
+
+// Check implements Checker.
+func (c *SchemaChecker) Check(ctx context.Context, _ *CheckRequest) (*CheckResponse, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.response != nil && c.params.Clock.Now().Sub(c.queried) < c.params.Interval {
+		return c.response, nil
+	}
+	current, err := c.params.Current(ctx)
+	if err != nil {
+		return &CheckResponse{
+			Status:  StatusNotServing,
+			Details: map[string]string{"error": err.Error()},
+		}, nil
+	}
+	status := StatusServing
+	if current != c.params.Expected {
+		status = StatusNotServing
+	}
+	c.queried = c.params.Clock.Now()
+	c.response = &CheckResponse{
+		Status: status,
+		Details: map[string]string{
+			"expected": c.params.Expected,
+			"current":  current,
+		},
+	}
+	return c.response, nil
+}
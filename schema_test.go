@@ -0,0 +1,90 @@
+// Copyright 2022-2024 The Connect Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package grpchealth
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestSchemaChecker(t *testing.T) {
+	t.Parallel()
+	var current string
+	var queryErr error
+	checker, err := NewSchemaChecker(SchemaCheckerParams{
+		Expected: "42",
+		Current:  func(context.Context) (string, error) { return current, queryErr },
+		Interval: 0,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, testCase := range []struct {
+		name     string
+		current  string
+		queryErr error
+		expect   Status
+	}{
+		{name: "unmigrated", current: "41", expect: StatusNotServing},
+		{name: "migrated", current: "42", expect: StatusServing},
+		{name: "unreachable", queryErr: errors.New("connection refused"), expect: StatusNotServing},
+	} {
+		current, queryErr = testCase.current, testCase.queryErr
+		res, err := checker.Check(context.Background(), &CheckRequest{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.Status != testCase.expect {
+			t.Fatalf("%s: got status %v, expected %v (details %v)", testCase.name, res.Status, testCase.expect, res.Details)
+		}
+	}
+}
+
+func TestSchemaCheckerInterval(t *testing.T) {
+	t.Parallel()
+	clock := &manualClock{now: time.Unix(0, 0)}
+	var queries int
+	checker, err := NewSchemaChecker(SchemaCheckerParams{
+		Expected: "42",
+		Current: func(context.Context) (string, error) {
+			queries++
+			return "42", nil
+		},
+		Interval: time.Minute,
+		Clock:    clock,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	check := func() {
+		t.Helper()
+		if _, err := checker.Check(context.Background(), &CheckRequest{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	check()
+	clock.Advance(time.Minute - time.Nanosecond)
+	check()
+	if queries != 1 {
+		t.Fatalf("got %d queries within the interval, expected 1", queries)
+	}
+	clock.Advance(time.Nanosecond)
+	check()
+	if queries != 2 {
+		t.Fatalf("got %d queries once the interval passed, expected 2", queries)
+	}
+}
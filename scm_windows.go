@@ -0,0 +1,148 @@
+// Copyright 2022-2024 The Connect Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build windows
+
+package grpchealth
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"golang.org/x/sys/windows/svc"
+)
+
+// WindowsServiceParams configure RunWindowsService.
+type WindowsServiceParams struct {
+	// Name is the name the service is registered under.
+	Name string
+	// Checker reports the health of the process. The service reports
+	// SERVICE_START_PENDING until the process (the empty service name) is
+	// StatusServing, and SERVICE_RUNNING afterwards.
+	Checker Checker
+	// PollInterval is the time between checks if the Checker doesn't implement
+	// Watcher. The default is one second.
+	PollInterval time.Duration
+	// StopTimeout is how long the service expects to take to stop, which it
+	// reports to the Service Control Manager with SERVICE_STOP_PENDING.
+	StopTimeout time.Duration
+}
+
+// RunWindowsService runs the process under the Windows Service Control
+// Manager, giving Windows deployments native supervision. It calls run with a
+// context that's canceled when the SCM asks the service to stop or the system
+// shuts down, and reports the service's state as it starts and stops:
+// SERVICE_START_PENDING until the Checker reports that the process is
+// serving, SERVICE_RUNNING until a stop is requested, and
+// SERVICE_STOP_PENDING until run returns.
+//
+// RunWindowsService returns run's error, or an error if the process isn't
+// running as a Windows service; use svc.IsWindowsService to check first.
+func RunWindowsService(params WindowsServiceParams, run func(context.Context) error) error {
+	if params.PollInterval <= 0 {
+		params.PollInterval = time.Second
+	}
+	service := &windowsService{params: params, run: run}
+	if err := svc.Run(params.Name, service); err != nil {
+		return err
+	}
+	return service.err
+}
+
+// windowsService adapts a run function to svc.Handler.
+type windowsService struct {
+	params WindowsServiceParams
+	run    func(context.Context) error
+	err    error
+}
+
+// Execute implements svc.Handler.
+func (s *windowsService) Execute(_ []string, requests <-chan svc.ChangeRequest, changes chan<- svc.Status) (bool, uint32) {
+	changes <- svc.Status{State: svc.StartPending}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan error, 1)
+	go func() {
+		done <- s.run(ctx)
+	}()
+	serving := make(chan struct{})
+	go waitForServing(ctx, s.params, serving)
+	for {
+		select {
+		case <-serving:
+			serving = nil
+			changes <- svc.Status{State: svc.Running, Accepts: svc.AcceptStop | svc.AcceptShutdown}
+		case req := <-requests:
+			switch req.Cmd { //nolint:exhaustive // other commands aren't accepted
+			case svc.Interrogate:
+				changes <- req.CurrentStatus
+			case svc.Stop, svc.Shutdown:
+				changes <- svc.Status{
+					State:    svc.StopPending,
+					WaitHint: uint32(s.params.StopTimeout / time.Millisecond),
+				}
+				cancel()
+				return s.exit(<-done)
+			}
+		case err := <-done:
+			changes <- svc.Status{State: svc.StopPending}
+			return s.exit(err)
+		}
+	}
+}
+
+// exit records run's error and converts it to a service-specific exit code.
+func (s *windowsService) exit(err error) (bool, uint32) {
+	if errors.Is(err, context.Canceled) {
+		err = nil
+	}
+	s.err = err
+	if err != nil {
+		return true, 1
+	}
+	return false, 0
+}
+
+// waitForServing closes serving once the Checker reports that the process is
+// serving.
+func waitForServing(ctx context.Context, params WindowsServiceParams, serving chan<- struct{}) {
+	req := &CheckRequest{}
+	if watcher, ok := params.Checker.(Watcher); ok {
+		errServing := errors.New("serving")
+		err := watcher.Watch(ctx, req, func(res *CheckResponse) error {
+			if res.Status == StatusServing {
+				return errServing
+			}
+			return nil
+		})
+		if errors.Is(err, errServing) {
+			close(serving)
+		}
+		return
+	}
+	ticker := time.NewTicker(params.PollInterval)
+	defer ticker.Stop()
+	for {
+		if res, err := params.Checker.Check(ctx, req); err == nil && res.Status == StatusServing {
+			close(serving)
+			return
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,83 @@
+// Copyright 2022-2024 The Connect Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build windows
+
+package grpchealth
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"golang.org/x/sys/windows/svc"
+)
+
+func TestWindowsService(t *testing.T) {
+	t.Parallel()
+	checker := NewStaticChecker()
+	checker.SetStatus("", StatusNotServing)
+	stopped := make(chan struct{})
+	service := &windowsService{
+		params: WindowsServiceParams{Checker: checker, StopTimeout: time.Second},
+		run: func(ctx context.Context) error {
+			<-ctx.Done()
+			close(stopped)
+			return ctx.Err()
+		},
+	}
+	requests := make(chan svc.ChangeRequest)
+	changes := make(chan svc.Status, 8)
+	type exit struct {
+		specific bool
+		code     uint32
+	}
+	exited := make(chan exit, 1)
+	go func() {
+		specific, code := service.Execute(nil, requests, changes)
+		exited <- exit{specific, code}
+	}()
+
+	expect := func(state svc.State) {
+		t.Helper()
+		select {
+		case change := <-changes:
+			if change.State != state {
+				t.Fatalf("got state %v, expected %v", change.State, state)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timed out waiting for state %v", state)
+		}
+	}
+	expect(svc.StartPending)
+	checker.SetStatus("", StatusServing)
+	expect(svc.Running)
+	requests <- svc.ChangeRequest{Cmd: svc.Stop}
+	expect(svc.StopPending)
+	<-stopped
+	if got := <-exited; got != (exit{}) {
+		t.Fatalf("got exit %+v after a clean stop", got)
+	}
+	if service.err != nil {
+		t.Fatal(service.err)
+	}
+
+	failure := errors.New("listener closed")
+	service.run = func(context.Context) error { return failure }
+	specific, code := service.Execute(nil, make(chan svc.ChangeRequest), make(chan svc.Status, 8))
+	if !specific || code != 1 || !errors.Is(service.err, failure) {
+		t.Fatalf("got exit %v/%d and error %v after run failed", specific, code, service.err)
+	}
+}
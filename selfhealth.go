@@ -0,0 +1,207 @@
+// Copyright 2022-2024 The Connect Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package grpchealth
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// SelfHealthService is the reserved service name under which a SelfHealth
+// reports the health of the health subsystem itself.
+const SelfHealthService = HealthV1ServiceName
+
+// SelfHealthParams configure a SelfHealth.
+type SelfHealthParams struct {
+	// Setter receives the status of SelfHealthService, such as a
+	// StaticChecker.
+	Setter StatusSetter
+	// Events, if set, is watched for backlog and dropped events.
+	Events *EventStream
+	// MaxBacklog is the fraction of the EventStream's buffer that may be full
+	// before the health subsystem is considered unhealthy. The default is 0.9.
+	MaxBacklog float64
+	// Window is how long a dropped update or a failure keeps the health
+	// subsystem NotServing. The default is a minute.
+	Window time.Duration
+	// Interval is how often the health subsystem is evaluated, in addition to
+	// whenever a problem is reported. The default is five seconds.
+	Interval time.Duration
+	// Clock is used to measure the window and interval. The default is the
+	// system clock.
+	Clock Clock
+}
+
+// SelfHealth reports whether the health subsystem itself is working, as the
+// status of SelfHealthService, so monitoring can tell an application that's
+// down from health reporting that's broken. The service is NotServing while
+// the EventStream's buffer is nearly full, and for a while after events or
+// Watch updates are dropped or a failure is reported, such as a
+// SnapshotWriter failing to persist statuses:
+//
+//	self, err := grpchealth.NewSelfHealth(grpchealth.SelfHealthParams{
+//		Setter: checker,
+//		Events: events,
+//	})
+//	go self.Run(ctx)
+//	writer, err := grpchealth.NewSnapshotWriter(grpchealth.SnapshotWriterParams{
+//		Checker: checker,
+//		Path:    "/var/lib/app/health.json",
+//		OnError: self.ReportFailure,
+//	})
+//
+// Register it with WithSelfHealth to count updates dropped by Watch streams.
+type SelfHealth struct {
+	params SelfHealthParams
+	wake   chan struct{}
+
+	mu           sync.Mutex
+	lastProblem  time.Time
+	lastErr      error
+	eventsDrops  uint64
+	droppedTotal uint64
+}
+
+// NewSelfHealth constructs a SelfHealth. It returns an error if the Setter is
+// missing.
+func NewSelfHealth(params SelfHealthParams) (*SelfHealth, error) {
+	if params.Setter == nil {
+		return nil, errors.New("self health requires a status setter")
+	}
+	if params.MaxBacklog <= 0 {
+		params.MaxBacklog = 0.9
+	}
+	if params.Window <= 0 {
+		params.Window = time.Minute
+	}
+	if params.Interval <= 0 {
+		params.Interval = 5 * time.Second
+	}
+	if params.Clock == nil {
+		params.Clock = systemClock{}
+	}
+	return &SelfHealth{
+		params: params,
+		wake:   make(chan struct{}, 1),
+	}, nil
+}
+
+// ReportFailure records a failure of the health subsystem, such as an error
+// persisting statuses. It's safe to call concurrently and never blocks, so
+// it's suitable as an OnError callback. Nil errors are ignored.
+func (s *SelfHealth) ReportFailure(err error) {
+	if err == nil {
+		return
+	}
+	s.mu.Lock()
+	s.lastProblem = s.params.Clock.Now()
+	s.lastErr = err
+	s.mu.Unlock()
+	s.signal()
+}
+
+// ReportDropped records that status updates were dropped before reaching
+// their destination.
+func (s *SelfHealth) ReportDropped(count int) {
+	if count <= 0 {
+		return
+	}
+	s.mu.Lock()
+	s.lastProblem = s.params.Clock.Now()
+	s.droppedTotal += uint64(count)
+	s.mu.Unlock()
+	s.signal()
+}
+
+// Dropped returns the number of updates reported dropped, including events
+// dropped by the EventStream.
+func (s *SelfHealth) Dropped() uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.droppedTotal
+}
+
+// Err returns the most recent failure reported within the window, if any.
+func (s *SelfHealth) Err() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.lastErr != nil && s.params.Clock.Now().Sub(s.lastProblem) < s.params.Window {
+		return s.lastErr
+	}
+	return nil
+}
+
+// Status evaluates the health subsystem.
+func (s *SelfHealth) Status() Status {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.params.Clock.Now()
+	if events := s.params.Events; events != nil {
+		if dropped := events.Dropped(); dropped > s.eventsDrops {
+			s.droppedTotal += dropped - s.eventsDrops
+			s.eventsDrops = dropped
+			s.lastProblem = now
+		}
+		if size := cap(events.events); size > 0 && float64(len(events.events)) >= s.params.MaxBacklog*float64(size) {
+			return StatusNotServing
+		}
+	}
+	if !s.lastProblem.IsZero() && now.Sub(s.lastProblem) < s.params.Window {
+		return StatusNotServing
+	}
+	return StatusServing
+}
+
+// Run sets the status of SelfHealthService whenever a problem is reported and
+// at every interval until ctx ends, then returns ctx's error. Run should be
+// called once.
+func (s *SelfHealth) Run(ctx context.Context) error {
+	timer := s.params.Clock.NewTimer(s.params.Interval)
+	defer timer.Stop()
+	for {
+		s.params.Setter.SetStatus(SelfHealthService, s.Status())
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-s.wake:
+			if !timer.Stop() {
+				select {
+				case <-timer.Chan():
+				default:
+				}
+			}
+		case <-timer.Chan():
+		}
+		timer.Reset(s.params.Interval)
+	}
+}
+
+func (s *SelfHealth) signal() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// WithSelfHealth makes handlers report status updates dropped by Watch streams
+// under WatchDropOldest, and streams ended under WatchTerminate, to the
+// SelfHealth.
+func WithSelfHealth(self *SelfHealth) HandlerOption {
+	return newHandlerOption(func(config *handlerConfig) {
+		config.SelfHealth = self
+	})
+}
@@ -0,0 +1,163 @@
+// Copyright 2022-2024 The Connect Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package grpchealth
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"connectrpc.com/connect"
+)
+
+func TestSelfHealth(t *testing.T) {
+	t.Parallel()
+	clock := &manualClock{now: time.Unix(0, 0)}
+	events := NewEventStream(2)
+	self, err := NewSelfHealth(SelfHealthParams{
+		Setter: NewStaticChecker(),
+		Events: events,
+		Window: time.Minute,
+		Clock:  clock,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewSelfHealth(SelfHealthParams{}); err == nil {
+		t.Error("expected an error without a Setter")
+	}
+	assertStatus := func(t *testing.T, expect Status) {
+		t.Helper()
+		if got := self.Status(); got != expect {
+			t.Errorf("got status %v, expected %v", got, expect)
+		}
+	}
+	assertStatus(t, StatusServing)
+
+	failure := errors.New("disk full")
+	self.ReportFailure(failure)
+	assertStatus(t, StatusNotServing)
+	if err := self.Err(); !errors.Is(err, failure) {
+		t.Errorf("got error %v, expected %v", err, failure)
+	}
+	clock.Advance(time.Minute)
+	assertStatus(t, StatusServing)
+	if err := self.Err(); err != nil {
+		t.Errorf("got error %v after the window, expected none", err)
+	}
+
+	// A full buffer is unhealthy, and dropping events keeps the subsystem
+	// unhealthy after the buffer drains.
+	for i := 0; i < 3; i++ {
+		events.emit(Event{Kind: EventStatusChanged})
+	}
+	assertStatus(t, StatusNotServing)
+	<-events.Events()
+	<-events.Events()
+	assertStatus(t, StatusNotServing)
+	if got := self.Dropped(); got != 1 {
+		t.Errorf("got %d dropped updates, expected 1", got)
+	}
+	clock.Advance(time.Minute)
+	assertStatus(t, StatusServing)
+
+	self.ReportDropped(2)
+	assertStatus(t, StatusNotServing)
+	if got := self.Dropped(); got != 3 {
+		t.Errorf("got %d dropped updates, expected 3", got)
+	}
+}
+
+func TestSelfHealthRun(t *testing.T) {
+	t.Parallel()
+	checker := NewStaticChecker()
+	self, err := NewSelfHealth(SelfHealthParams{Setter: checker, Interval: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- self.Run(ctx) }()
+	waitForStatus := func(expect Status) {
+		t.Helper()
+		for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(time.Millisecond) {
+			res, err := checker.Check(context.Background(), &CheckRequest{Service: SelfHealthService})
+			if err == nil && res.Status == expect {
+				return
+			}
+		}
+		t.Fatalf("%s never became %v", SelfHealthService, expect)
+	}
+	waitForStatus(StatusServing)
+	// Reports are applied immediately, not at the next interval.
+	self.ReportFailure(errors.New("persistence failed"))
+	waitForStatus(StatusNotServing)
+	cancel()
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Errorf("got error %v, expected %v", err, context.Canceled)
+	}
+}
+
+func TestWithSelfHealth(t *testing.T) {
+	t.Parallel()
+	self, err := NewSelfHealth(SelfHealthParams{Setter: NewStaticChecker()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := newHandlerConfig([]connect.HandlerOption{
+		WithSelfHealth(self),
+		WithWatchBackpressure(WatchDropOldest, 1),
+	})
+	blocked := make(chan struct{})
+	ctx, send, finish := config.queueWatchUpdates(context.Background(), func(*CheckResponse) error {
+		<-blocked
+		return nil
+	})
+	for i := 0; i < 4; i++ {
+		if err := send(&CheckResponse{Status: StatusServing}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	close(blocked)
+	if err := finish(ctx.Err()); err != nil {
+		t.Fatal(err)
+	}
+	if self.Dropped() == 0 {
+		t.Error("dropped Watch updates weren't reported")
+	}
+}
+
+// manualClock is a Clock whose time only moves when advanced. Its timers use
+// the system clock.
+type manualClock struct {
+	systemClock
+
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (c *manualClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *manualClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
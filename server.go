@@ -0,0 +1,111 @@
+// Copyright 2022-2024 The Connect Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package grpchealth
+
+import (
+	"net/http"
+	"time"
+
+	"connectrpc.com/connect"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+)
+
+// A ServerOption configures ListenAndServeHealth.
+type ServerOption interface {
+	applyToServer(*serverConfig)
+}
+
+// WithServerHandlerOptions configures the health handler served by
+// ListenAndServeHealth.
+func WithServerHandlerOptions(options ...connect.HandlerOption) ServerOption {
+	return &serverOption{apply: func(config *serverConfig) {
+		config.HandlerOptions = append(config.HandlerOptions, options...)
+	}}
+}
+
+// WithHTTPHealthPath also serves NewHTTPHandler on the supplied path (for
+// example, "/healthz"), for probes that only speak plain HTTP.
+func WithHTTPHealthPath(path string) ServerOption {
+	return &serverOption{apply: func(config *serverConfig) {
+		config.HTTPHealthPath = path
+	}}
+}
+
+// WithEnvoyHealthCheck also serves NewEnvoyHandler, for Envoy proxies
+// configured with active HTTP health checks.
+func WithEnvoyHealthCheck(params EnvoyHealthCheckParams) ServerOption {
+	return &serverOption{apply: func(config *serverConfig) {
+		config.EnvoyHealthCheck = &params
+	}}
+}
+
+// NewH2CHandler wraps an HTTP handler so that it serves HTTP/2 without TLS
+// (h2c) as well as HTTP/1.1. gRPC health probes, including Kubernetes gRPC
+// probes and grpc-health-probe, usually connect over h2c.
+//
+// Wrap the server's root handler, not the handler returned by NewHandler:
+// clients with prior knowledge of h2c start the connection with a request that
+// never reaches the routes of an http.ServeMux.
+//
+//	mux := http.NewServeMux()
+//	mux.Handle(grpchealth.NewHandler(checker))
+//	http.ListenAndServe(":8080", grpchealth.NewH2CHandler(mux))
+func NewH2CHandler(handler http.Handler) http.Handler {
+	return h2c.NewHandler(handler, &http2.Server{})
+}
+
+// ListenAndServeHealth listens on the TCP network address addr and serves only
+// the health API, using both HTTP/2 without TLS (h2c) and HTTP/1.1. It lets
+// applications expose health on a separate, firewalled port from their main
+// traffic. Like http.ListenAndServe, it always returns a non-nil error.
+func ListenAndServeHealth(addr string, checker Checker, options ...ServerOption) error {
+	var config serverConfig
+	for _, opt := range options {
+		opt.applyToServer(&config)
+	}
+	server := &http.Server{
+		Addr:              addr,
+		Handler:           newServerHandler(checker, &config),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	return server.ListenAndServe()
+}
+
+type serverConfig struct {
+	HandlerOptions   []connect.HandlerOption
+	HTTPHealthPath   string
+	EnvoyHealthCheck *EnvoyHealthCheckParams
+}
+
+type serverOption struct {
+	apply func(*serverConfig)
+}
+
+func (o *serverOption) applyToServer(config *serverConfig) {
+	o.apply(config)
+}
+
+func newServerHandler(checker Checker, config *serverConfig) http.Handler {
+	mux := http.NewServeMux()
+	mux.Handle(NewHandler(checker, config.HandlerOptions...))
+	if config.HTTPHealthPath != "" {
+		mux.Handle(config.HTTPHealthPath, NewHTTPHandler(checker, config.HandlerOptions...))
+	}
+	if config.EnvoyHealthCheck != nil {
+		mux.Handle(NewEnvoyHandler(checker, *config.EnvoyHealthCheck, config.HandlerOptions...))
+	}
+	return NewH2CHandler(mux)
+}
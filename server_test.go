@@ -0,0 +1,103 @@
+// Copyright 2022-2024 The Connect Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package grpchealth
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"connectrpc.com/connect"
+	healthv1 "connectrpc.com/grpchealth/internal/gen/go/connectext/grpc/health/v1"
+	"golang.org/x/net/http2"
+)
+
+func TestServerHandler(t *testing.T) {
+	t.Parallel()
+	config := serverConfig{
+		HTTPHealthPath:   "/healthz",
+		EnvoyHealthCheck: &EnvoyHealthCheckParams{Path: "/envoy"},
+	}
+	server := httptest.NewServer(newServerHandler(NewStaticChecker(), &config))
+	t.Cleanup(server.Close)
+
+	client := connect.NewClient[healthv1.HealthCheckRequest, healthv1.HealthCheckResponse](
+		newH2CClient(),
+		server.URL+"/grpc.health.v1.Health/Check",
+		connect.WithGRPC(),
+	)
+	res, err := client.CallUnary(
+		context.Background(),
+		connect.NewRequest(&healthv1.HealthCheckRequest{}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := Status(res.Msg.Status); got != StatusServing {
+		t.Fatalf("got status %v, expected %v", got, StatusServing)
+	}
+
+	httpRes, err := server.Client().Get(server.URL + "/healthz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	httpRes.Body.Close()
+	if httpRes.StatusCode != http.StatusOK {
+		t.Fatalf("got HTTP %d from /healthz, expected %d", httpRes.StatusCode, http.StatusOK)
+	}
+	envoyRes, err := server.Client().Get(server.URL + "/envoy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	envoyRes.Body.Close()
+	if envoyRes.StatusCode != http.StatusOK {
+		t.Fatalf("got HTTP %d from /envoy, expected %d", envoyRes.StatusCode, http.StatusOK)
+	}
+}
+
+func TestH2CHandler(t *testing.T) {
+	t.Parallel()
+	mux := http.NewServeMux()
+	mux.Handle(NewHandler(NewStaticChecker()))
+	server := httptest.NewServer(NewH2CHandler(mux))
+	t.Cleanup(server.Close)
+
+	client := connect.NewClient[healthv1.HealthCheckRequest, healthv1.HealthCheckResponse](
+		newH2CClient(),
+		server.URL+"/grpc.health.v1.Health/Check",
+		connect.WithGRPC(),
+	)
+	if _, err := client.CallUnary(
+		context.Background(),
+		connect.NewRequest(&healthv1.HealthCheckRequest{}),
+	); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func newH2CClient() *http.Client {
+	return &http.Client{
+		Transport: &http2.Transport{
+			AllowHTTP: true,
+			DialTLSContext: func(ctx context.Context, network, addr string, _ *tls.Config) (net.Conn, error) {
+				var dialer net.Dialer
+				return dialer.DialContext(ctx, network, addr)
+			},
+		},
+	}
+}
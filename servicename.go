@@ -0,0 +1,145 @@
+// Copyright 2022-2024 The Connect Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package grpchealth
+
+import (
+	"fmt"
+	"strings"
+
+	"connectrpc.com/connect"
+)
+
+// ServiceName is the name of a service whose health is reported: a
+// fully-qualified protobuf service name, such as "acme.user.v1.UserService",
+// or the empty string, which represents the whole process.
+//
+// APIs in this package take service names as strings, so a ServiceName can be
+// passed to them with a conversion. Parse names with ParseServiceName, or
+// derive them from the procedure constants of generated Connect code with
+// ServiceNameFromProcedure, to catch typos early instead of as
+// connect.CodeNotFound errors from a remote server.
+type ServiceName string
+
+// ParseServiceName validates a service name. It returns an error unless name
+// is empty or a sequence of protobuf identifiers separated by dots.
+func ParseServiceName(name string) (ServiceName, error) {
+	if err := ServiceName(name).Validate(); err != nil {
+		return "", err
+	}
+	return ServiceName(name), nil
+}
+
+// ServiceNameFromProcedure derives a service name from a Connect procedure,
+// such as the "/acme.user.v1.UserService/GetUser" constants in generated
+// Connect code.
+func ServiceNameFromProcedure(procedure string) (ServiceName, error) {
+	service, method, ok := strings.Cut(strings.TrimPrefix(procedure, "/"), "/")
+	if !ok || method == "" || strings.Contains(method, "/") {
+		return "", fmt.Errorf("invalid procedure %q", procedure)
+	}
+	return ParseServiceName(service)
+}
+
+// Validate returns an error unless the name is empty or a sequence of
+// protobuf identifiers separated by dots.
+func (n ServiceName) Validate() error {
+	if n == "" {
+		return nil
+	}
+	for _, part := range strings.Split(string(n), ".") {
+		if !isProtoIdentifier(part) {
+			return fmt.Errorf("invalid service name %q: want a fully-qualified protobuf name, such as %q", string(n), "acme.user.v1.UserService")
+		}
+	}
+	return nil
+}
+
+// String implements fmt.Stringer.
+func (n ServiceName) String() string {
+	return string(n)
+}
+
+// WithServiceNameValidation makes a StaticChecker reject service names that
+// aren't valid ServiceNames. NewStaticCheckerWithOptions panics on invalid
+// names, since they're programming errors. SetStatus ignores them, calling
+// onError (if it's non-nil) with the error. SetDependencies returns an error,
+// and Check and Watch return a connect.CodeInvalidArgument error instead of
+// connect.CodeNotFound. With WithTenants, the part of a name after the tenant
+// is validated.
+func WithServiceNameValidation(onError func(error)) StaticCheckerOption {
+	return &serviceNameValidationOption{onError: onError}
+}
+
+// WithClientServiceNameValidation makes a Client reject service names that
+// aren't valid ServiceNames with a connect.CodeInvalidArgument error, without
+// contacting the server.
+func WithClientServiceNameValidation() ClientOption {
+	return newClientOption(func(config *clientConfig) {
+		config.ValidateServices = true
+	})
+}
+
+type serviceNameValidationOption struct {
+	onError func(error)
+}
+
+func (o *serviceNameValidationOption) applyToStaticChecker(checker *StaticChecker) {
+	checker.validate = true
+	checker.invalidName = o.onError
+}
+
+// validateService checks a service name if the checker was constructed with
+// WithServiceNameValidation.
+func (c *StaticChecker) validateService(service string) error {
+	if !c.validate {
+		return nil
+	}
+	if c.tenants {
+		if _, name, ok := strings.Cut(service, "/"); ok {
+			service = name
+		}
+	}
+	if err := ServiceName(service).Validate(); err != nil {
+		return connect.NewError(connect.CodeInvalidArgument, err)
+	}
+	return nil
+}
+
+// validateService checks a service name if the Client was built with
+// WithClientServiceNameValidation.
+func (c *Client) validateService(service string) error {
+	if !c.validate {
+		return nil
+	}
+	if err := ServiceName(service).Validate(); err != nil {
+		return connect.NewError(connect.CodeInvalidArgument, err)
+	}
+	return nil
+}
+
+func isProtoIdentifier(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i, r := range s {
+		switch {
+		case r == '_', 'a' <= r && r <= 'z', 'A' <= r && r <= 'Z':
+		case '0' <= r && r <= '9' && i > 0:
+		default:
+			return false
+		}
+	}
+	return true
+}
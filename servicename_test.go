@@ -0,0 +1,97 @@
+// Copyright 2022-2024 The Connect Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package grpchealth
+
+import (
+	"context"
+	"testing"
+
+	"connectrpc.com/connect"
+)
+
+func TestServiceName(t *testing.T) {
+	t.Parallel()
+	for name, valid := range map[string]bool{
+		"":                          true,
+		"acme.user.v1.UserService":  true,
+		"Health":                    true,
+		"_internal.v1.Service":      true,
+		"acme.user.v1.":             false,
+		".acme.UserService":         false,
+		"acme..UserService":         false,
+		"acme.1user.UserService":    false,
+		"acme.user-v1.UserService":  false,
+		"acme.user.v1.UserService ": false,
+		"/acme.user.v1.UserService": false,
+	} {
+		_, err := ParseServiceName(name)
+		if got := err == nil; got != valid {
+			t.Errorf("%q: got valid %v, expected %v (%v)", name, got, valid, err)
+		}
+	}
+
+	service, err := ServiceNameFromProcedure("/acme.user.v1.UserService/GetUser")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if service != "acme.user.v1.UserService" {
+		t.Fatalf("got service %q", service)
+	}
+	for _, procedure := range []string{"acme.user.v1.UserService", "/acme.user.v1.UserService/", "/acme/user/GetUser"} {
+		if _, err := ServiceNameFromProcedure(procedure); err == nil {
+			t.Errorf("%q: expected an error", procedure)
+		}
+	}
+}
+
+func TestServiceNameValidation(t *testing.T) {
+	t.Parallel()
+	var invalid []error
+	checker := NewStaticCheckerWithOptions(
+		[]string{"acme.user.v1.UserService"},
+		WithServiceNameValidation(func(err error) { invalid = append(invalid, err) }),
+		WithTenants(),
+	)
+	_, err := checker.Check(context.Background(), &CheckRequest{Service: "acme.user.v1.UserServce"})
+	if code := connect.CodeOf(err); code != connect.CodeNotFound {
+		t.Errorf("got code %v for a well-formed typo, expected %v", code, connect.CodeNotFound)
+	}
+	_, err = checker.Check(context.Background(), &CheckRequest{Service: "acme.user-v1.UserService"})
+	if code := connect.CodeOf(err); code != connect.CodeInvalidArgument {
+		t.Errorf("got code %v, expected %v", code, connect.CodeInvalidArgument)
+	}
+	err = checker.Watch(context.Background(), &CheckRequest{Service: "UserService "}, func(*CheckResponse) error { return nil })
+	if code := connect.CodeOf(err); code != connect.CodeInvalidArgument {
+		t.Errorf("got code %v from Watch, expected %v", code, connect.CodeInvalidArgument)
+	}
+	if err := checker.SetDependencies("acme.user.v1.UserService", "postgres-primary"); err == nil {
+		t.Error("expected an error from an invalid dependency")
+	}
+	// Tenant-qualified names are validated after the tenant.
+	checker.SetTenantStatus("tenant-a", "acme.user.v1.UserService", StatusNotServing)
+	checker.SetStatus("acme user", StatusServing)
+	if len(invalid) != 1 || connect.CodeOf(invalid[0]) != connect.CodeInvalidArgument {
+		t.Errorf("got errors %v for an invalid name, expected one %v error", invalid, connect.CodeInvalidArgument)
+	}
+	if _, err := checker.Check(context.Background(), &CheckRequest{Service: "acme user"}); err == nil {
+		t.Error("SetStatus registered an invalid name")
+	}
+
+	client := newTestClient(t, NewStaticChecker(), WithClientServiceNameValidation())
+	_, err = client.Check(context.Background(), &CheckRequest{Service: "acme..UserService"})
+	if code := connect.CodeOf(err); code != connect.CodeInvalidArgument {
+		t.Errorf("got code %v from the client, expected %v", code, connect.CodeInvalidArgument)
+	}
+}
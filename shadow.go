@@ -0,0 +1,110 @@
+// Copyright 2022-2024 The Connect Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package grpchealth
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"time"
+)
+
+// ShadowCheckerParams configure a ShadowChecker.
+type ShadowCheckerParams struct {
+	// Active is the Checker whose results are served.
+	Active Checker
+	// Shadow is the Checker under evaluation. Its results are recorded but
+	// never served.
+	Shadow Checker
+	// Observe, if set, is called with the results of both Checkers once the
+	// shadow check finishes, for logging or metrics. It must be safe to call
+	// concurrently.
+	Observe func(ctx context.Context, active, shadow *CheckResult)
+	// Timeout bounds each shadow check. The default is five seconds.
+	Timeout time.Duration
+}
+
+// ShadowStats summarize how a shadow Checker's verdicts compare with the
+// active Checker's.
+type ShadowStats struct {
+	// Compared is the number of checks evaluated by both Checkers.
+	Compared uint64
+	// Disagreed is the number of those checks where the Checkers reported
+	// different statuses, or where only one of them failed.
+	Disagreed uint64
+}
+
+// ShadowChecker evaluates a new Checker in parallel with the active one
+// without serving its verdicts, so teams can validate stricter readiness
+// logic in production before enabling it. Each Check runs both Checkers,
+// returns the active Checker's result as soon as it's ready, and compares the
+// shadow's result in the background.
+type ShadowChecker struct {
+	params    ShadowCheckerParams
+	compared  atomic.Uint64
+	disagreed atomic.Uint64
+}
+
+// NewShadowChecker constructs a ShadowChecker. It returns an error if either
+// Checker is missing.
+func NewShadowChecker(params ShadowCheckerParams) (*ShadowChecker, error) {
+	if params.Active == nil || params.Shadow == nil {
+		return nil, errors.New("shadow checker requires active and shadow checkers")
+	}
+	if params.Timeout <= 0 {
+		params.Timeout = 5 * time.Second
+	}
+	return &ShadowChecker{params: params}, nil
+}
+
+// Check implements Checker. The shadow check isn't canceled when ctx is, so it
+// can finish and be compared even after the active check has been served.
+func (c *ShadowChecker) Check(ctx context.Context, req *CheckRequest) (*CheckResponse, error) {
+	shadowCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), c.params.Timeout)
+	shadowResult := make(chan *CheckResult, 1)
+	go func() {
+		defer cancel()
+		shadowResult <- RunCheck(shadowCtx, c.params.Shadow, req)
+	}()
+	active := RunCheck(ctx, c.params.Active, req)
+	go c.compare(context.WithoutCancel(ctx), active, shadowResult)
+	if active.Err != nil {
+		return nil, active.Err
+	}
+	return &CheckResponse{
+		Status:     active.Status,
+		Details:    active.Details,
+		RetryAfter: active.RetryAfter,
+	}, nil
+}
+
+// Stats reports how the Checkers' verdicts have compared so far.
+func (c *ShadowChecker) Stats() ShadowStats {
+	return ShadowStats{
+		Compared:  c.compared.Load(),
+		Disagreed: c.disagreed.Load(),
+	}
+}
+
+func (c *ShadowChecker) compare(ctx context.Context, active *CheckResult, shadowResult <-chan *CheckResult) {
+	shadow := <-shadowResult
+	if (active.Err == nil) != (shadow.Err == nil) || active.Status != shadow.Status {
+		c.disagreed.Add(1)
+	}
+	c.compared.Add(1)
+	if c.params.Observe != nil {
+		c.params.Observe(ctx, active, shadow)
+	}
+}
@@ -0,0 +1,64 @@
+// Copyright 2022-2024 The Connect Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package grpchealth
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestShadowChecker(t *testing.T) {
+	t.Parallel()
+	if _, err := NewShadowChecker(ShadowCheckerParams{Active: NewStaticChecker()}); err == nil { //nolint:exhaustruct // missing Shadow is under test
+		t.Fatal("expected error without shadow checker")
+	}
+	active := NewStaticChecker()
+	shadowStatus := StatusServing
+	shadow := checkerFunc(func(context.Context, *CheckRequest) (*CheckResponse, error) {
+		if shadowStatus == StatusUnknown {
+			return nil, errors.New("replica lag unavailable")
+		}
+		return &CheckResponse{Status: shadowStatus}, nil
+	})
+	observed := make(chan [2]*CheckResult, 1)
+	checker, err := NewShadowChecker(ShadowCheckerParams{
+		Active: active,
+		Shadow: shadow,
+		Observe: func(_ context.Context, active, shadow *CheckResult) {
+			observed <- [2]*CheckResult{active, shadow}
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, status := range []Status{StatusServing, StatusNotServing, StatusUnknown} {
+		shadowStatus = status
+		res, err := checker.Check(context.Background(), &CheckRequest{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.Status != StatusServing {
+			t.Fatalf("got served status %v, expected the active %v", res.Status, StatusServing)
+		}
+		results := <-observed
+		if results[0].Status != StatusServing || results[1].Status != status {
+			t.Fatalf("observed %v and %v, expected %v and %v", results[0].Status, results[1].Status, StatusServing, status)
+		}
+	}
+	if got := checker.Stats(); got != (ShadowStats{Compared: 3, Disagreed: 2}) {
+		t.Fatalf("got stats %+v", got)
+	}
+}
@@ -0,0 +1,387 @@
+// Copyright 2022-2024 The Connect Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package grpchealth
+
+import (
+	"context"
+	"errors"
+	"math"
+	"sync"
+	"time"
+
+	"connectrpc.com/connect"
+)
+
+// LatencySLOParams configure a LatencySLO.
+type LatencySLOParams struct {
+	// Setter receives the service's status. It's usually a StaticChecker.
+	Setter StatusSetter
+	// Service is the service whose status the LatencySLO drives.
+	Service string
+	// Percentile is the latency percentile to track, between 0 and 1 (for
+	// example, 0.99).
+	Percentile float64
+	// Threshold is the latency above which the service is marked
+	// StatusNotServing.
+	Threshold time.Duration
+	// Recovery is the latency below which a degraded service is marked
+	// StatusServing again. It must not exceed Threshold; the gap between them
+	// keeps the status from flapping. If it's zero, it defaults to Threshold.
+	Recovery time.Duration
+	// Window is the period over which latencies are tracked. The percentile is
+	// computed over all the observations in the window, so brief spikes that
+	// affect few requests are ignored.
+	Window time.Duration
+	// MinSamples is the number of observations required in the window before
+	// the LatencySLO changes the service's status.
+	MinSamples int
+	// Clock timestamps observations. The default is the system clock.
+	Clock Clock
+}
+
+// LatencySLO automatically degrades a service when its request latency
+// exceeds a service-level objective. Feed it latencies with Observe (often
+// from middleware or an interceptor); when the configured percentile of
+// latencies within the window exceeds the threshold, it sets the service to
+// StatusNotServing. Once the percentile falls below the recovery latency, it
+// sets the service back to StatusServing.
+//
+// A degraded service often stops receiving traffic, so while it's degraded the
+// LatencySLO also reviews the window as observations expire. Once the window
+// holds fewer than MinSamples observations (or none), the service recovers.
+//
+// The LatencySLO only counts how many observations fall within the threshold
+// and recovery latencies, so Observe takes constant time and memory however
+// heavy the load. Observations expire a tenth of the window at a time.
+type LatencySLO struct {
+	params   LatencySLOParams
+	interval time.Duration
+
+	mu       sync.Mutex
+	buckets  [sloBuckets]latencyBucket
+	degraded bool
+	review   Timer // reviews the window while degraded
+}
+
+// NewLatencySLO constructs a LatencySLO. The service is assumed to be serving
+// until enough slow requests are observed.
+func NewLatencySLO(params LatencySLOParams) (*LatencySLO, error) {
+	switch {
+	case params.Setter == nil:
+		return nil, errors.New("latency SLO requires a StatusSetter")
+	case params.Percentile <= 0 || params.Percentile > 1:
+		return nil, errors.New("latency SLO percentile must be in (0, 1]")
+	case params.Recovery > params.Threshold:
+		return nil, errors.New("latency SLO recovery latency must not exceed threshold")
+	case params.Window < sloBuckets:
+		return nil, errors.New("latency SLO window is too short")
+	}
+	if params.Recovery == 0 {
+		params.Recovery = params.Threshold
+	}
+	if params.Clock == nil {
+		params.Clock = systemClock{}
+	}
+	return &LatencySLO{
+		params:   params,
+		interval: params.Window / sloBuckets,
+	}, nil
+}
+
+// Observe records the latency of a request and updates the service's status
+// if necessary. It's safe to call concurrently.
+func (s *LatencySLO) Observe(latency time.Duration) {
+	epoch := s.params.Clock.Now().UnixNano() / int64(s.interval)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	bucket := &s.buckets[epoch%sloBuckets]
+	if bucket.epoch != epoch {
+		*bucket = latencyBucket{epoch: epoch}
+	}
+	bucket.total++
+	if latency <= s.params.Threshold {
+		bucket.withinThreshold++
+	}
+	if latency < s.params.Recovery {
+		bucket.belowRecovery++
+	}
+
+	s.evaluate(epoch)
+}
+
+// evaluate updates the service's status from the observations in the window
+// ending with epoch. The caller must hold s.mu.
+func (s *LatencySLO) evaluate(epoch int64) {
+	var total, withinThreshold, belowRecovery int
+	for _, bucket := range s.buckets {
+		if epoch-bucket.epoch < sloBuckets {
+			total += bucket.total
+			withinThreshold += bucket.withinThreshold
+			belowRecovery += bucket.belowRecovery
+		}
+	}
+	// The percentile is the latency of the rank-th fastest observation, so it
+	// exceeds a latency exactly when fewer than rank observations are within
+	// it.
+	rank := int(math.Ceil(s.params.Percentile * float64(total)))
+	switch {
+	case total < s.params.MinSamples || total == 0:
+		if s.degraded {
+			s.setDegraded(false)
+		}
+	case !s.degraded && withinThreshold < rank:
+		s.setDegraded(true)
+	case s.degraded && belowRecovery >= rank:
+		s.setDegraded(false)
+	}
+}
+
+// setDegraded sets the service's status, reviewing the window every interval
+// while it's degraded. The caller must hold s.mu.
+func (s *LatencySLO) setDegraded(degraded bool) {
+	s.degraded = degraded
+	if !degraded {
+		if s.review != nil {
+			s.review.Stop()
+		}
+		s.params.Setter.SetStatus(s.params.Service, StatusServing)
+		return
+	}
+	s.params.Setter.SetStatus(s.params.Service, StatusNotServing)
+	if s.review == nil {
+		s.review = s.params.Clock.AfterFunc(s.interval, s.reviewWindow)
+		return
+	}
+	s.review.Reset(s.interval)
+}
+
+func (s *LatencySLO) reviewWindow() {
+	epoch := s.params.Clock.Now().UnixNano() / int64(s.interval)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.degraded {
+		return
+	}
+	s.evaluate(epoch)
+	if s.degraded {
+		s.review.Reset(s.interval)
+	}
+}
+
+// sloBuckets is the number of intervals into which the SLOs divide their
+// windows.
+const sloBuckets = 10
+
+type latencyBucket struct {
+	epoch           int64
+	total           int
+	withinThreshold int // observations at or below the threshold
+	belowRecovery   int // observations below the recovery latency
+}
+
+// ErrorRateSLOParams configure an ErrorRateSLO.
+type ErrorRateSLOParams struct {
+	// Setter receives the service's status. It's usually a StaticChecker.
+	Setter StatusSetter
+	// Service is the service whose status the ErrorRateSLO drives.
+	Service string
+	// Threshold is the fraction of failed requests, between 0 and 1, above
+	// which the service is marked StatusNotServing.
+	Threshold float64
+	// Recovery is the fraction of failed requests below which a degraded
+	// service is marked StatusServing again. It must not exceed Threshold. If
+	// it's zero, it defaults to Threshold.
+	Recovery float64
+	// Window is the period over which requests are counted.
+	Window time.Duration
+	// MinRequests is the number of requests required in the window before the
+	// ErrorRateSLO changes the service's status.
+	MinRequests int
+	// Clock timestamps observations. The default is the system clock.
+	Clock Clock
+}
+
+// ErrorRateSLO automatically degrades a service when too many of its requests
+// fail, so that load balancers shift traffic to healthier instances. Feed it
+// request outcomes with Observe, or install its Interceptor on the service's
+// handlers.
+//
+// Like LatencySLO, an ErrorRateSLO reviews the window while the service is
+// degraded, and the service recovers once the window holds fewer than
+// MinRequests requests (or none).
+type ErrorRateSLO struct {
+	params   ErrorRateSLOParams
+	interval time.Duration
+
+	mu       sync.Mutex
+	buckets  [sloBuckets]errorRateBucket
+	degraded bool
+	review   Timer // reviews the window while degraded
+}
+
+// NewErrorRateSLO constructs an ErrorRateSLO. The service is assumed to be
+// serving until enough failures are observed.
+func NewErrorRateSLO(params ErrorRateSLOParams) (*ErrorRateSLO, error) {
+	switch {
+	case params.Setter == nil:
+		return nil, errors.New("error rate SLO requires a StatusSetter")
+	case params.Threshold <= 0 || params.Threshold > 1:
+		return nil, errors.New("error rate SLO threshold must be in (0, 1]")
+	case params.Recovery > params.Threshold:
+		return nil, errors.New("error rate SLO recovery rate must not exceed threshold")
+	case params.Window < sloBuckets:
+		return nil, errors.New("error rate SLO window is too short")
+	}
+	if params.Recovery == 0 {
+		params.Recovery = params.Threshold
+	}
+	if params.Clock == nil {
+		params.Clock = systemClock{}
+	}
+	return &ErrorRateSLO{
+		params:   params,
+		interval: params.Window / sloBuckets,
+	}, nil
+}
+
+// Observe records the outcome of a request and updates the service's status
+// if necessary. Only errors that indicate a problem with the server count as
+// failures: connect.CodeUnknown, CodeInternal, CodeUnavailable, CodeDataLoss,
+// and CodeDeadlineExceeded. Other errors, such as CodeInvalidArgument or
+// CodeNotFound, count as successes. It's safe to call concurrently.
+func (s *ErrorRateSLO) Observe(err error) {
+	epoch := s.params.Clock.Now().UnixNano() / int64(s.interval)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	bucket := &s.buckets[epoch%sloBuckets]
+	if bucket.epoch != epoch {
+		*bucket = errorRateBucket{epoch: epoch}
+	}
+	bucket.total++
+	if isServerError(err) {
+		bucket.failed++
+	}
+
+	s.evaluate(epoch)
+}
+
+// evaluate updates the service's status from the requests in the window
+// ending with epoch. The caller must hold s.mu.
+func (s *ErrorRateSLO) evaluate(epoch int64) {
+	var total, failed int
+	for _, bucket := range s.buckets {
+		if epoch-bucket.epoch < sloBuckets {
+			total += bucket.total
+			failed += bucket.failed
+		}
+	}
+	if total < s.params.MinRequests || total == 0 {
+		if s.degraded {
+			s.setDegraded(false)
+		}
+		return
+	}
+	rate := float64(failed) / float64(total)
+	switch {
+	case !s.degraded && rate > s.params.Threshold:
+		s.setDegraded(true)
+	case s.degraded && rate < s.params.Recovery:
+		s.setDegraded(false)
+	}
+}
+
+// setDegraded sets the service's status, reviewing the window every interval
+// while it's degraded. The caller must hold s.mu.
+func (s *ErrorRateSLO) setDegraded(degraded bool) {
+	s.degraded = degraded
+	if !degraded {
+		if s.review != nil {
+			s.review.Stop()
+		}
+		s.params.Setter.SetStatus(s.params.Service, StatusServing)
+		return
+	}
+	s.params.Setter.SetStatus(s.params.Service, StatusNotServing)
+	if s.review == nil {
+		s.review = s.params.Clock.AfterFunc(s.interval, s.reviewWindow)
+		return
+	}
+	s.review.Reset(s.interval)
+}
+
+func (s *ErrorRateSLO) reviewWindow() {
+	epoch := s.params.Clock.Now().UnixNano() / int64(s.interval)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.degraded {
+		return
+	}
+	s.evaluate(epoch)
+	if s.degraded {
+		s.review.Reset(s.interval)
+	}
+}
+
+// Interceptor returns a connect.Interceptor that observes the outcome of every
+// RPC it handles. Install it on the handlers of the service whose status the
+// ErrorRateSLO drives. It has no effect on clients.
+func (s *ErrorRateSLO) Interceptor() connect.Interceptor {
+	return &errorRateInterceptor{slo: s}
+}
+
+type errorRateBucket struct {
+	epoch  int64
+	total  int
+	failed int
+}
+
+type errorRateInterceptor struct {
+	slo *ErrorRateSLO
+}
+
+func (i *errorRateInterceptor) WrapUnary(next connect.UnaryFunc) connect.UnaryFunc {
+	return func(ctx context.Context, req connect.AnyRequest) (connect.AnyResponse, error) {
+		res, err := next(ctx, req)
+		if !req.Spec().IsClient {
+			i.slo.Observe(err)
+		}
+		return res, err
+	}
+}
+
+func (i *errorRateInterceptor) WrapStreamingClient(next connect.StreamingClientFunc) connect.StreamingClientFunc {
+	return next
+}
+
+func (i *errorRateInterceptor) WrapStreamingHandler(next connect.StreamingHandlerFunc) connect.StreamingHandlerFunc {
+	return func(ctx context.Context, conn connect.StreamingHandlerConn) error {
+		err := next(ctx, conn)
+		i.slo.Observe(err)
+		return err
+	}
+}
+
+func isServerError(err error) bool {
+	if err == nil {
+		return false
+	}
+	switch connect.CodeOf(err) {
+	case connect.CodeUnknown, connect.CodeInternal, connect.CodeUnavailable,
+		connect.CodeDataLoss, connect.CodeDeadlineExceeded:
+		return true
+	default:
+		return false
+	}
+}
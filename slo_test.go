@@ -0,0 +1,257 @@
+// Copyright 2022-2024 The Connect Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package grpchealth
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"connectrpc.com/connect"
+)
+
+func TestLatencySLO(t *testing.T) {
+	const userFQN = "acme.user.v1.UserService"
+	t.Parallel()
+	checker := NewStaticChecker(userFQN)
+	slo, err := NewLatencySLO(LatencySLOParams{
+		Setter:     checker,
+		Service:    userFQN,
+		Percentile: 0.9,
+		Threshold:  100 * time.Millisecond,
+		Recovery:   50 * time.Millisecond,
+		Window:     time.Minute,
+		MinSamples: 10,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertStatus := func(t *testing.T, expect Status) {
+		t.Helper()
+		res, err := checker.Check(context.Background(), &CheckRequest{Service: userFQN})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.Status != expect {
+			t.Fatalf("got status %v, expected %v", res.Status, expect)
+		}
+	}
+
+	for i := 0; i < 9; i++ {
+		slo.Observe(time.Second) // too few samples to act on
+	}
+	assertStatus(t, StatusServing)
+	slo.Observe(time.Second)
+	assertStatus(t, StatusNotServing)
+
+	// The 90th percentile falls between the thresholds, so nothing changes.
+	for i := 0; i < 90; i++ {
+		slo.Observe(75 * time.Millisecond)
+	}
+	assertStatus(t, StatusNotServing)
+	for i := 0; i < 1000; i++ {
+		slo.Observe(time.Millisecond)
+	}
+	assertStatus(t, StatusServing)
+}
+
+func TestLatencySLOWindow(t *testing.T) {
+	const userFQN = "acme.user.v1.UserService"
+	t.Parallel()
+	checker := NewStaticChecker(userFQN)
+	clock := &manualClock{now: time.Unix(0, 0)}
+	slo, err := NewLatencySLO(LatencySLOParams{
+		Setter:     checker,
+		Service:    userFQN,
+		Percentile: 0.5,
+		Threshold:  100 * time.Millisecond,
+		Window:     time.Minute,
+		Clock:      clock,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertStatus := func(t *testing.T, expect Status) {
+		t.Helper()
+		res, err := checker.Check(context.Background(), &CheckRequest{Service: userFQN})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.Status != expect {
+			t.Fatalf("got status %v, expected %v", res.Status, expect)
+		}
+	}
+
+	for i := 0; i < 100; i++ {
+		slo.Observe(time.Second)
+	}
+	assertStatus(t, StatusNotServing)
+	// Once the slow observations leave the window, a single fast one
+	// recovers the service, since the recovery latency defaults to the
+	// threshold.
+	clock.Advance(time.Minute)
+	slo.Observe(time.Millisecond)
+	assertStatus(t, StatusServing)
+}
+
+func TestLatencySLOParams(t *testing.T) {
+	t.Parallel()
+	valid := LatencySLOParams{
+		Setter:     NewStaticChecker(),
+		Service:    "",
+		Percentile: 0.99,
+		Threshold:  time.Second,
+		Recovery:   time.Second,
+		Window:     time.Minute,
+		MinSamples: 0,
+	}
+	if _, err := NewLatencySLO(valid); err != nil {
+		t.Fatal(err)
+	}
+	invalid := []func(*LatencySLOParams){
+		func(p *LatencySLOParams) { p.Setter = nil },
+		func(p *LatencySLOParams) { p.Percentile = 0 },
+		func(p *LatencySLOParams) { p.Percentile = 1.5 },
+		func(p *LatencySLOParams) { p.Recovery = 2 * time.Second },
+		func(p *LatencySLOParams) { p.Window = 0 },
+	}
+	for i, mutate := range invalid {
+		params := valid
+		mutate(&params)
+		if _, err := NewLatencySLO(params); err == nil {
+			t.Errorf("case %d: expected error", i)
+		}
+	}
+}
+
+func TestErrorRateSLO(t *testing.T) {
+	const userFQN = "acme.user.v1.UserService"
+	t.Parallel()
+	checker := NewStaticChecker(userFQN)
+	slo, err := NewErrorRateSLO(ErrorRateSLOParams{
+		Setter:      checker,
+		Service:     userFQN,
+		Threshold:   0.5,
+		Recovery:    0.2,
+		Window:      time.Minute,
+		MinRequests: 4,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertStatus := func(t *testing.T, expect Status) {
+		t.Helper()
+		res, err := checker.Check(context.Background(), &CheckRequest{Service: userFQN})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.Status != expect {
+			t.Fatalf("got status %v, expected %v", res.Status, expect)
+		}
+	}
+
+	internal := connect.NewError(connect.CodeInternal, errors.New("oh no"))
+	slo.Observe(internal)
+	slo.Observe(internal)
+	slo.Observe(internal)
+	assertStatus(t, StatusServing) // too few requests to act on
+	slo.Observe(connect.NewError(connect.CodeInvalidArgument, errors.New("bad request")))
+	assertStatus(t, StatusNotServing)
+	for i := 0; i < 8; i++ {
+		slo.Observe(nil) // 3 of 12 failed, between the thresholds
+	}
+	assertStatus(t, StatusNotServing)
+	for i := 0; i < 4; i++ {
+		slo.Observe(nil)
+	}
+	assertStatus(t, StatusServing)
+}
+
+func TestErrorRateSLOWindow(t *testing.T) {
+	const userFQN = "acme.user.v1.UserService"
+	t.Parallel()
+	checker := NewStaticChecker(userFQN)
+	clock := &manualClock{now: time.Unix(0, 0)}
+	slo, err := NewErrorRateSLO(ErrorRateSLOParams{
+		Setter:    checker,
+		Service:   userFQN,
+		Threshold: 0.5,
+		Window:    time.Minute,
+		Clock:     clock,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertStatus := func(t *testing.T, expect Status) {
+		t.Helper()
+		res, err := checker.Check(context.Background(), &CheckRequest{Service: userFQN})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.Status != expect {
+			t.Fatalf("got status %v, expected %v", res.Status, expect)
+		}
+	}
+
+	internal := connect.NewError(connect.CodeInternal, errors.New("oh no"))
+	for i := 0; i < 10; i++ {
+		slo.Observe(internal)
+	}
+	assertStatus(t, StatusNotServing)
+	// Once the failures leave the window, a single success recovers the
+	// service, since the recovery rate defaults to the threshold.
+	clock.Advance(time.Minute)
+	slo.Observe(nil)
+	assertStatus(t, StatusServing)
+}
+
+func TestErrorRateInterceptor(t *testing.T) {
+	const userFQN = "acme.user.v1.UserService"
+	t.Parallel()
+	checker := NewStaticChecker(userFQN)
+	slo, err := NewErrorRateSLO(ErrorRateSLOParams{
+		Setter:      checker,
+		Service:     userFQN,
+		Threshold:   0.5,
+		Recovery:    0.1,
+		Window:      time.Minute,
+		MinRequests: 1,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	failing := checkerFunc(func(context.Context, *CheckRequest) (*CheckResponse, error) {
+		return nil, connect.NewError(connect.CodeUnavailable, errors.New("down"))
+	})
+	mux := http.NewServeMux()
+	mux.Handle(NewHandler(failing, connect.WithInterceptors(slo.Interceptor())))
+	server := httptest.NewServer(NewH2CHandler(mux))
+	t.Cleanup(server.Close)
+
+	client := NewClient(server.URL)
+	if _, err := client.Check(context.Background(), &CheckRequest{}); err == nil {
+		t.Fatal("expected error")
+	}
+	res, err := checker.Check(context.Background(), &CheckRequest{Service: userFQN})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Status != StatusNotServing {
+		t.Fatalf("got status %v, expected %v", res.Status, StatusNotServing)
+	}
+}
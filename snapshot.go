@@ -0,0 +1,272 @@
+// Copyright 2022-2024 The Connect Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package grpchealth
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// snapshotVersion identifies the encoding produced by Snapshot.
+const snapshotVersion = 1
+
+// Snapshot encodes the state of the checker as JSON: the status set for each
+// service, declared dependencies, and active overrides. The encoding is
+// stable, with services sorted by name, so snapshots can be diffed and
+// handed from one process to another during blue/green deployments. Watchers
+// and counters aren't included.
+func (c *StaticChecker) Snapshot() ([]byte, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	services := make(map[string]*snapshotService)
+	entry := func(name string) *snapshotService {
+		service, ok := services[name]
+		if !ok {
+			service = &snapshotService{Name: name}
+			services[name] = service
+		}
+		return service
+	}
+	for name, status := range c.statuses {
+		status := status
+		entry(name).Status = &status
+	}
+	for name, dependencies := range c.dependencies {
+		entry(name).Dependencies = append([]string(nil), dependencies...)
+	}
+	for name := range c.overrides {
+		override, ok := c.activeOverride(name)
+		if !ok {
+			continue
+		}
+		entry(name).Override = &snapshotOverride{Status: override.Status}
+		if !override.Expires.IsZero() {
+			expires := override.Expires.UTC()
+			entry(name).Override.Expires = &expires
+		}
+	}
+	snap := snapshot{Version: snapshotVersion, Services: make([]*snapshotService, 0, len(services))}
+	for _, service := range services {
+		snap.Services = append(snap.Services, service)
+	}
+	sort.Slice(snap.Services, func(i, j int) bool {
+		return snap.Services[i].Name < snap.Services[j].Name
+	})
+	return json.Marshal(snap)
+}
+
+// Restore replaces the state of the checker with a snapshot produced by
+// Snapshot, possibly in another process, and notifies watchers of the
+// services whose status may have changed. Overrides that have expired since
+// the snapshot was taken are discarded; the rest keep their original
+// expiration time. Restore returns an error, leaving the checker unchanged,
+// if the snapshot is malformed.
+func (c *StaticChecker) Restore(data []byte) error {
+	var snap snapshot
+	if err := json.Unmarshal(data, &snap); err != nil {
+		return fmt.Errorf("decode health snapshot: %w", err)
+	}
+	if snap.Version != snapshotVersion {
+		return fmt.Errorf("unsupported health snapshot version %d", snap.Version)
+	}
+	// Validate dependencies on a scratch checker, so a snapshot with a cycle
+	// doesn't leave the checker half-restored.
+	scratch := &StaticChecker{}
+	for _, service := range snap.Services {
+		if err := scratch.SetDependencies(service.Name, service.Dependencies...); err != nil {
+			return fmt.Errorf("restore health snapshot: %w", err)
+		}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for name := range c.overrides {
+		c.clearOverride(name)
+	}
+	previous := c.statuses
+	c.statuses = make(map[string]Status, len(snap.Services))
+	c.dependencies = scratch.dependencies
+	now := c.clock.Now()
+	for _, service := range snap.Services {
+		if service.Status != nil {
+			c.statuses[service.Name] = *service.Status
+			if old, ok := previous[service.Name]; !ok || old != *service.Status {
+				c.transition(service.Name, old, *service.Status)
+			}
+		}
+		if override := service.Override; override != nil {
+			var expires time.Time
+			if override.Expires != nil {
+				if !now.Before(*override.Expires) {
+					continue
+				}
+				expires = *override.Expires
+			}
+			c.setOverride(service.Name, override.Status, expires)
+		}
+	}
+	// Any service's status may have changed, so wake every watcher.
+	for watched := range c.watchers {
+		c.notify(watched)
+	}
+	c.signalChange()
+	return nil
+}
+
+// SnapshotWriterParams configure a SnapshotWriter. Exactly one of Path and
+// Writer must be set.
+type SnapshotWriterParams struct {
+	// Checker is the StaticChecker to snapshot.
+	Checker *StaticChecker
+	// Path is the file to write snapshots to. Each snapshot replaces the file
+	// atomically, so readers never see a partial snapshot.
+	Path string
+	// Writer receives each snapshot, followed by a newline.
+	Writer io.Writer
+	// Interval is how often to write a snapshot. If it's zero, a snapshot is
+	// written after every change instead. Either way, a snapshot identical to
+	// the last one written is skipped.
+	Interval time.Duration
+	// OnError, if set, is called with errors writing snapshots. Writing
+	// continues after errors.
+	OnError func(error)
+	// Clock schedules interval snapshots. The default is the system clock.
+	Clock Clock
+}
+
+// SnapshotWriter persists a StaticChecker's snapshots in the background, for
+// file-based probes, handoffs between processes, and post-mortem analysis.
+type SnapshotWriter struct {
+	params SnapshotWriterParams
+	last   []byte
+}
+
+// NewSnapshotWriter constructs a SnapshotWriter. It returns an error if the
+// checker is missing, or unless exactly one of Path and Writer is set.
+func NewSnapshotWriter(params SnapshotWriterParams) (*SnapshotWriter, error) {
+	if params.Checker == nil {
+		return nil, errors.New("snapshot writer requires a checker")
+	}
+	if (params.Path == "") == (params.Writer == nil) {
+		return nil, errors.New("snapshot writer requires exactly one of a path or a writer")
+	}
+	if params.Interval < 0 {
+		return nil, fmt.Errorf("snapshot writer interval %v is negative", params.Interval)
+	}
+	if params.Clock == nil {
+		params.Clock = systemClock{}
+	}
+	return &SnapshotWriter{params: params}, nil
+}
+
+// Run writes a snapshot immediately, then after every change or on every
+// interval until ctx ends, when it writes a final snapshot and returns ctx's
+// error. Run should be called once.
+func (w *SnapshotWriter) Run(ctx context.Context) error {
+	var (
+		timer Timer
+		tick  <-chan time.Time
+	)
+	if w.params.Interval > 0 {
+		timer = w.params.Clock.NewTimer(w.params.Interval)
+		defer timer.Stop()
+		tick = timer.Chan()
+	}
+	for {
+		var changed <-chan struct{}
+		if tick == nil {
+			// Register before snapshotting, so no change goes unnoticed.
+			changed = w.params.Checker.changed()
+		}
+		w.write()
+		select {
+		case <-ctx.Done():
+			w.write()
+			return ctx.Err()
+		case <-changed:
+		case <-tick:
+			timer.Reset(w.params.Interval)
+		}
+	}
+}
+
+func (w *SnapshotWriter) write() {
+	data, err := w.params.Checker.Snapshot()
+	if err == nil && !bytes.Equal(data, w.last) {
+		if w.params.Path != "" {
+			err = writeFileAtomic(w.params.Path, data)
+		} else {
+			_, err = w.params.Writer.Write(append(data, '\n'))
+		}
+		if err == nil {
+			w.last = data
+		}
+	}
+	if err != nil && w.params.OnError != nil {
+		w.params.OnError(err)
+	}
+}
+
+// writeFileAtomic writes data to a temporary file in the same directory as
+// path, syncs it, and renames it over path. The file is readable by everyone,
+// like one written by os.WriteFile with the usual permissions.
+func writeFileAtomic(path string, data []byte) error {
+	file, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+"-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name())
+	if err := file.Chmod(0o644); err != nil {
+		file.Close()
+		return err
+	}
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	return os.Rename(file.Name(), path)
+}
+
+type snapshot struct {
+	Version  int                `json:"version"`
+	Services []*snapshotService `json:"services"`
+}
+
+type snapshotService struct {
+	Name         string            `json:"name"`
+	Status       *Status           `json:"status,omitempty"`
+	Dependencies []string          `json:"dependencies,omitempty"`
+	Override     *snapshotOverride `json:"override,omitempty"`
+}
+
+type snapshotOverride struct {
+	Status  Status     `json:"status"`
+	Expires *time.Time `json:"expires,omitempty"`
+}
@@ -0,0 +1,177 @@
+// Copyright 2022-2024 The Connect Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package grpchealth
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSnapshot(t *testing.T) {
+	const (
+		userFQN  = "acme.user.v1.UserService"
+		adminFQN = "acme.admin.v1.AdminService"
+	)
+	t.Parallel()
+	blue := NewStaticChecker(userFQN, adminFQN)
+	if err := blue.SetDependencies(adminFQN, userFQN); err != nil {
+		t.Fatal(err)
+	}
+	blue.SetStatus(userFQN, StatusNotServing)
+	if err := blue.SetOverride(adminFQN, StatusServing, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	if err := blue.SetOverride("", StatusNotServing, 0); err != nil {
+		t.Fatal(err)
+	}
+	data, err := blue.Snapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	again, err := blue.Snapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != string(again) {
+		t.Fatalf("snapshots differ:\n%s\n%s", data, again)
+	}
+
+	green := NewStaticChecker("acme.stale.v1.StaleService")
+	server := newTestServer(t, green)
+	receive := newTestWatch(t, server, userFQN)
+	receive(StatusServiceUnknown)
+	if err := green.Restore(data); err != nil {
+		t.Fatal(err)
+	}
+	receive(StatusNotServing)
+	for service, expect := range map[string]StatusLayers{
+		"":       {Effective: StatusNotServing, Computed: StatusServing},
+		userFQN:  {Effective: StatusNotServing, Computed: StatusNotServing},
+		adminFQN: {Effective: StatusServing, Computed: StatusNotServing},
+	} {
+		layers, known := green.StatusLayers(service)
+		if !known {
+			t.Fatalf("service %q unknown after restore", service)
+		}
+		if layers.Effective != expect.Effective || layers.Computed != expect.Computed {
+			t.Errorf("got layers %+v for %q, expected %+v", layers, service, expect)
+		}
+	}
+	if _, known := green.StatusLayers("acme.stale.v1.StaleService"); known {
+		t.Error("stale service survived restore")
+	}
+	if restored, _ := green.Snapshot(); string(restored) != string(data) {
+		t.Fatalf("got snapshot %s after restore, expected %s", restored, data)
+	}
+
+	for _, bad := range []string{
+		`{`,
+		`{"version":2,"services":[]}`,
+		`{"version":1,"services":[{"name":"a","status":"BOGUS"}]}`,
+		`{"version":1,"services":[{"name":"a","dependencies":["b"]},{"name":"b","dependencies":["a"]}]}`,
+	} {
+		if err := green.Restore([]byte(bad)); err == nil {
+			t.Errorf("expected error restoring %s", bad)
+		}
+	}
+	if layers, _ := green.StatusLayers(userFQN); layers.Effective != StatusNotServing {
+		t.Fatalf("failed restore changed status to %v", layers.Effective)
+	}
+	if !strings.Contains(string(data), `"expires"`) {
+		t.Fatalf("snapshot %s lacks override expiration", data)
+	}
+}
+
+func TestSnapshotWriter(t *testing.T) {
+	const userFQN = "acme.user.v1.UserService"
+	t.Parallel()
+	t.Run("path", func(t *testing.T) {
+		t.Parallel()
+		checker := NewStaticChecker(userFQN)
+		path := filepath.Join(t.TempDir(), "health.json")
+		writer, err := NewSnapshotWriter(SnapshotWriterParams{Checker: checker, Path: path})
+		if err != nil {
+			t.Fatal(err)
+		}
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan error, 1)
+		go func() { done <- writer.Run(ctx) }()
+		waitForSnapshot := func(expect Status) {
+			t.Helper()
+			for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(5 * time.Millisecond) {
+				data, err := os.ReadFile(path)
+				if err != nil {
+					continue
+				}
+				restored := NewStaticChecker()
+				if err := restored.Restore(data); err != nil {
+					t.Fatal(err)
+				}
+				if res, err := restored.Check(context.Background(), &CheckRequest{Service: userFQN}); err == nil && res.Status == expect {
+					return
+				}
+			}
+			t.Fatalf("snapshot file never reported %v", expect)
+		}
+		waitForSnapshot(StatusServing)
+		checker.SetStatus(userFQN, StatusNotServing)
+		waitForSnapshot(StatusNotServing)
+		cancel()
+		if err := <-done; !errors.Is(err, context.Canceled) {
+			t.Fatalf("got error %v, expected %v", err, context.Canceled)
+		}
+	})
+	t.Run("writer", func(t *testing.T) {
+		t.Parallel()
+		checker := NewStaticChecker(userFQN)
+		var out bytes.Buffer
+		writer, err := NewSnapshotWriter(SnapshotWriterParams{
+			Checker:  checker,
+			Writer:   &out,
+			Interval: time.Hour,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		_ = writer.Run(ctx)
+		// The initial and final snapshots are identical, so only one is
+		// written.
+		if lines := strings.Count(out.String(), "\n"); lines != 1 {
+			t.Fatalf("got %d snapshots, expected 1: %s", lines, out.String())
+		}
+	})
+	t.Run("invalid", func(t *testing.T) {
+		t.Parallel()
+		for _, params := range []SnapshotWriterParams{
+			{Path: "health.json"},
+			{Checker: NewStaticChecker()},
+			{Checker: NewStaticChecker(), Path: "health.json", Writer: io.Discard},
+			{Checker: NewStaticChecker(), Path: "health.json", Interval: -time.Second},
+		} {
+			if _, err := NewSnapshotWriter(params); err == nil {
+				t.Errorf("expected error for %+v", params)
+			}
+		}
+	})
+}
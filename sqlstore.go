@@ -0,0 +1,240 @@
+// Copyright 2022-2024 The Connect Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package grpchealth
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// SQLStatusStoreParams configure a SQLStatusStore.
+type SQLStatusStoreParams struct {
+	// DB is the database holding the table.
+	DB *sql.DB
+	// Table is the name of the table, optionally qualified with a schema.
+	// The default is "grpchealth_statuses". The table needs a unique service
+	// column and a status column, both of text types; CreateTable creates a
+	// suitable one.
+	Table string
+	// NumberedPlaceholders makes queries use numbered placeholders ("$1"), as
+	// PostgreSQL requires, instead of question marks.
+	NumberedPlaceholders bool
+	// PollInterval is how often Run reloads the table, and bounds each
+	// reload. The default is five seconds.
+	PollInterval time.Duration
+	// WaitForChange, if set, blocks until the table may have changed or ctx
+	// ends, so Run can reload without waiting for the next poll. With
+	// PostgreSQL, it can wrap a driver's wait for notifications after
+	// LISTEN, with a trigger on the table calling NOTIFY.
+	WaitForChange func(ctx context.Context) error
+	// OnError, if set, is called with errors reloading the table. Run keeps
+	// polling after errors.
+	OnError func(error)
+	// Clock schedules polls. The default is the system clock.
+	Clock Clock
+}
+
+// SQLStatusStore is a StatusStore backed by a SQL table with one row per
+// service, so operational tooling can change an instance's health by
+// updating a row:
+//
+//	UPDATE grpchealth_statuses SET status = 'not_serving' WHERE service = '';
+//
+// Statuses are stored as text, using the names accepted by ParseStatus. Run
+// reloads the table into a StaticChecker as it changes, which notifies the
+// checker's watchers, so the change propagates to Watch streams.
+//
+// Deleting a row doesn't unregister its service: the checker keeps the last
+// status it loaded. Saves are bounded by the checker's store timeout (see
+// WithStatusStoreTimeout), so a locked table doesn't hold up later saves
+// indefinitely.
+//
+// SQLStatusStore uses only database/sql, so it works with any driver.
+type SQLStatusStore struct {
+	params SQLStatusStoreParams
+	load   string
+	exists string
+	update string
+	insert string
+}
+
+// NewSQLStatusStore constructs a SQLStatusStore. It returns an error if the DB
+// is missing or the table name isn't a valid identifier.
+func NewSQLStatusStore(params SQLStatusStoreParams) (*SQLStatusStore, error) {
+	if params.DB == nil {
+		return nil, errors.New("SQL status store requires a database")
+	}
+	if params.Table == "" {
+		params.Table = "grpchealth_statuses"
+	}
+	for _, part := range strings.Split(params.Table, ".") {
+		if !isProtoIdentifier(part) {
+			return nil, fmt.Errorf("invalid table name %q", params.Table)
+		}
+	}
+	if params.PollInterval <= 0 {
+		params.PollInterval = 5 * time.Second
+	}
+	if params.Clock == nil {
+		params.Clock = systemClock{}
+	}
+	placeholder := func(int) string { return "?" }
+	if params.NumberedPlaceholders {
+		placeholder = func(n int) string { return fmt.Sprintf("$%d", n) }
+	}
+	return &SQLStatusStore{
+		params: params,
+		load:   "SELECT service, status FROM " + params.Table,
+		exists: fmt.Sprintf("SELECT 1 FROM %s WHERE service = %s", params.Table, placeholder(1)),
+		update: fmt.Sprintf("UPDATE %s SET status = %s WHERE service = %s", params.Table, placeholder(1), placeholder(2)),
+		insert: fmt.Sprintf("INSERT INTO %s (service, status) VALUES (%s, %s)", params.Table, placeholder(1), placeholder(2)),
+	}, nil
+}
+
+// CreateTable creates the table if it doesn't exist.
+func (s *SQLStatusStore) CreateTable(ctx context.Context) error {
+	_, err := s.params.DB.ExecContext(ctx, "CREATE TABLE IF NOT EXISTS "+s.params.Table+
+		" (service VARCHAR(255) NOT NULL PRIMARY KEY, status VARCHAR(32) NOT NULL)")
+	return err
+}
+
+// Load implements StatusStore. It returns an error if a row's status can't be
+// parsed.
+func (s *SQLStatusStore) Load(ctx context.Context) (map[string]Status, error) {
+	rows, err := s.params.DB.QueryContext(ctx, s.load)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	statuses := make(map[string]Status)
+	for rows.Next() {
+		var service, text string
+		if err := rows.Scan(&service, &text); err != nil {
+			return nil, err
+		}
+		status, err := ParseStatus(strings.TrimSpace(text))
+		if err != nil {
+			return nil, fmt.Errorf("service %q: %w", service, err)
+		}
+		statuses[service] = status
+	}
+	return statuses, rows.Err()
+}
+
+// Save implements StatusStore, updating the service's row or inserting one.
+func (s *SQLStatusStore) Save(ctx context.Context, service string, status Status) error {
+	updated, err := s.updateRow(ctx, service, status)
+	if err != nil || updated {
+		return err
+	}
+	_, insertErr := s.params.DB.ExecContext(ctx, s.insert, service, status.String())
+	if insertErr == nil {
+		return nil
+	}
+	// Another writer may have inserted the row first, or the database may
+	// only count rows whose values changed, as MySQL does.
+	if _, err := s.updateRow(ctx, service, status); err != nil {
+		return err
+	}
+	var exists int
+	if err := s.params.DB.QueryRowContext(ctx, s.exists, service).Scan(&exists); err != nil {
+		return insertErr
+	}
+	return nil
+}
+
+// Run reloads the table into the checker, which must have been constructed
+// with WithStatusStore using this store, every PollInterval and whenever
+// WaitForChange returns, until ctx ends. It then returns ctx's error.
+func (s *SQLStatusStore) Run(ctx context.Context, checker *StaticChecker) error {
+	changed := make(chan struct{}, 1)
+	if s.params.WaitForChange != nil {
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+		go s.waitForChanges(ctx, changed)
+	}
+	timer := s.params.Clock.NewTimer(s.params.PollInterval)
+	defer timer.Stop()
+	for {
+		loadCtx, cancel := context.WithTimeout(ctx, s.params.PollInterval)
+		err := checker.LoadStore(loadCtx)
+		cancel()
+		if err != nil && ctx.Err() == nil {
+			s.report(err)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-timer.Chan():
+		case <-changed:
+			if !timer.Stop() {
+				// Drain a poll that came due meanwhile.
+				select {
+				case <-timer.Chan():
+				default:
+				}
+			}
+		}
+		timer.Reset(s.params.PollInterval)
+	}
+}
+
+func (s *SQLStatusStore) updateRow(ctx context.Context, service string, status Status) (bool, error) {
+	result, err := s.params.DB.ExecContext(ctx, s.update, status.String(), service)
+	if err != nil {
+		return false, err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return affected > 0, nil
+}
+
+// waitForChanges signals changed each time WaitForChange returns, until ctx
+// ends. It waits a poll interval after errors.
+func (s *SQLStatusStore) waitForChanges(ctx context.Context, changed chan<- struct{}) {
+	for {
+		err := s.params.WaitForChange(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			s.report(err)
+			timer := s.params.Clock.NewTimer(s.params.PollInterval)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return
+			case <-timer.Chan():
+			}
+			continue
+		}
+		select {
+		case changed <- struct{}{}:
+		default:
+		}
+	}
+}
+
+func (s *SQLStatusStore) report(err error) {
+	if err != nil && s.params.OnError != nil {
+		s.params.OnError(err)
+	}
+}
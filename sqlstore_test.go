@@ -0,0 +1,232 @@
+// Copyright 2022-2024 The Connect Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package grpchealth
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSQLStatusStore(t *testing.T) {
+	t.Parallel()
+	table := &fakeTable{rows: make(map[string]string)}
+	db := sql.OpenDB(table)
+	t.Cleanup(func() { _ = db.Close() })
+	changes := make(chan struct{})
+	store, err := NewSQLStatusStore(SQLStatusStoreParams{
+		DB:                   db,
+		NumberedPlaceholders: true,
+		PollInterval:         time.Hour,
+		WaitForChange: func(ctx context.Context) error {
+			select {
+			case <-changes:
+				return nil
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if err := store.CreateTable(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	checker := NewStaticCheckerWithOptions([]string{"acme.user.v1.UserService"}, WithStatusStore(store, func(err error) {
+		t.Errorf("saving status: %v", err)
+	}))
+	checker.SetStatus("acme.user.v1.UserService", StatusNotServing)
+	checker.SetStatus("acme.user.v1.UserService", StatusServing)
+	if err := checker.FlushStore(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if got := table.get("acme.user.v1.UserService"); got != "serving" {
+		t.Fatalf("got stored status %q", got)
+	}
+	if !strings.Contains(table.lastQuery(), "$1") {
+		t.Errorf("got query %q, expected numbered placeholders", table.lastQuery())
+	}
+
+	// Operators change the status by updating a row, and watchers follow.
+	go func() { _ = store.Run(ctx, checker) }()
+	updates := make(chan Status, 10)
+	go func() {
+		_ = checker.Watch(ctx, &CheckRequest{Service: "acme.user.v1.UserService"}, func(res *CheckResponse) error {
+			updates <- res.Status
+			return nil
+		})
+	}()
+	if status := <-updates; status != StatusServing {
+		t.Fatalf("got initial status %v", status)
+	}
+	table.set("acme.user.v1.UserService", "NOT_SERVING")
+	changes <- struct{}{}
+	if status := <-updates; status != StatusNotServing {
+		t.Fatalf("got status %v after updating the row", status)
+	}
+
+	table.set("", "sideways")
+	if _, err := store.Load(ctx); err == nil {
+		t.Fatal("expected an error loading an invalid status")
+	}
+}
+
+func TestSQLStatusStoreUnchangedRows(t *testing.T) {
+	t.Parallel()
+	table := &fakeTable{changedRowsOnly: true, rows: make(map[string]string)}
+	db := sql.OpenDB(table)
+	t.Cleanup(func() { _ = db.Close() })
+	store, err := NewSQLStatusStore(SQLStatusStoreParams{DB: db})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		if err := store.Save(context.Background(), "", StatusNotServing); err != nil {
+			t.Fatalf("save %d: %v", i, err)
+		}
+	}
+	if got := table.get(""); got != "not_serving" {
+		t.Fatalf("got stored status %q", got)
+	}
+}
+
+func TestSQLStatusStoreInvalid(t *testing.T) {
+	t.Parallel()
+	if _, err := NewSQLStatusStore(SQLStatusStoreParams{}); err == nil {
+		t.Error("expected an error without a database")
+	}
+	db := sql.OpenDB(&fakeTable{rows: make(map[string]string)})
+	t.Cleanup(func() { _ = db.Close() })
+	if _, err := NewSQLStatusStore(SQLStatusStoreParams{DB: db, Table: "statuses; DROP TABLE users"}); err == nil {
+		t.Error("expected an error from an invalid table name")
+	}
+	if _, err := NewSQLStatusStore(SQLStatusStoreParams{DB: db, Table: "ops.health"}); err != nil {
+		t.Error(err)
+	}
+}
+
+// fakeTable is a database/sql driver serving the queries of SQLStatusStore
+// from a single in-memory table.
+type fakeTable struct {
+	changedRowsOnly bool // count only changed rows as affected, like MySQL
+
+	mu      sync.Mutex
+	rows    map[string]string
+	queries []string
+}
+
+func (t *fakeTable) get(service string) string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.rows[service]
+}
+
+func (t *fakeTable) set(service, status string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.rows[service] = status
+}
+
+func (t *fakeTable) lastQuery() string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.queries[len(t.queries)-1]
+}
+
+func (t *fakeTable) Connect(context.Context) (driver.Conn, error) { return &fakeConn{table: t}, nil }
+func (t *fakeTable) Driver() driver.Driver                        { return nil }
+
+type fakeConn struct {
+	table *fakeTable
+}
+
+func (c *fakeConn) Prepare(string) (driver.Stmt, error) { return nil, errors.New("not supported") }
+func (c *fakeConn) Close() error                        { return nil }
+func (c *fakeConn) Begin() (driver.Tx, error)           { return nil, errors.New("not supported") }
+
+func (c *fakeConn) ExecContext(_ context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	t := c.table
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.queries = append(t.queries, query)
+	switch {
+	case strings.HasPrefix(query, "CREATE TABLE"):
+		return driver.RowsAffected(0), nil
+	case strings.HasPrefix(query, "UPDATE"):
+		service, status := args[1].Value.(string), args[0].Value.(string) //nolint:forcetypeassert // the store only passes strings
+		if previous, ok := t.rows[service]; !ok || (t.changedRowsOnly && previous == status) {
+			return driver.RowsAffected(0), nil
+		}
+		t.rows[service] = status
+		return driver.RowsAffected(1), nil
+	case strings.HasPrefix(query, "INSERT"):
+		service, status := args[0].Value.(string), args[1].Value.(string) //nolint:forcetypeassert // the store only passes strings
+		if _, ok := t.rows[service]; ok {
+			return nil, errors.New("duplicate key")
+		}
+		t.rows[service] = status
+		return driver.RowsAffected(1), nil
+	}
+	return nil, errors.New("unexpected query")
+}
+
+func (c *fakeConn) QueryContext(_ context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	t := c.table
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.queries = append(t.queries, query)
+	rows := &fakeRows{columns: []string{"service", "status"}}
+	switch {
+	case strings.HasPrefix(query, "SELECT service, status"):
+		for service, status := range t.rows {
+			rows.values = append(rows.values, []driver.Value{service, status})
+		}
+	case strings.HasPrefix(query, "SELECT 1"):
+		rows.columns = []string{"1"}
+		if _, ok := t.rows[args[0].Value.(string)]; ok { //nolint:forcetypeassert // the store only passes strings
+			rows.values = append(rows.values, []driver.Value{int64(1)})
+		}
+	default:
+		return nil, errors.New("unexpected query")
+	}
+	return rows, nil
+}
+
+type fakeRows struct {
+	columns []string
+	values  [][]driver.Value
+}
+
+func (r *fakeRows) Columns() []string { return r.columns }
+func (r *fakeRows) Close() error      { return nil }
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if len(r.values) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.values[0])
+	r.values = r.values[1:]
+	return nil
+}
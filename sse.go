@@ -0,0 +1,135 @@
+// Copyright 2022-2024 The Connect Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package grpchealth
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"connectrpc.com/connect"
+)
+
+// SSEEvent is the JSON payload of each event sent by NewSSEHandler.
+type SSEEvent struct {
+	Service string    `json:"service"`
+	Status  Status    `json:"status"`
+	Time    time.Time `json:"timestamp"`
+}
+
+// NewSSEHandler builds an HTTP handler that streams status transitions as
+// Server-Sent Events, so browser dashboards can subscribe to health changes
+// with the built-in EventSource API and no other dependencies:
+//
+//	const events = new EventSource("/health/events?service=acme.user.v1.UserService");
+//	events.addEventListener("status", (e) => render(JSON.parse(e.data)));
+//
+// Clients name the services to watch with one or more "service" query
+// parameters; without any, they watch the whole process. Each event has the
+// type "status" and carries an SSEEvent as JSON: the current status when the
+// stream starts, then one event per transition. Streams end with an "error"
+// event if the Watcher fails, and EventSource reconnects on its own.
+//
+// The handler accepts the same options as NewHandler, and those that apply to
+// Watch, such as WithWatchHeartbeat and WithWatchQuota, apply to each stream.
+func NewSSEHandler(watcher Watcher, options ...connect.HandlerOption) http.Handler {
+	config := newHandlerConfig(options)
+	return config.withCORS(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.Header().Set("Allow", http.MethodGet)
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		}
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			http.Error(w, "streaming isn't supported", http.StatusInternalServerError)
+			return
+		}
+		services := r.URL.Query()["service"]
+		if len(services) == 0 {
+			services = []string{""}
+		}
+		ctx := config.withRequestID(r.Context(), r.Header, w.Header())
+		ctx = config.withChannel(ctx, r.Header)
+		ctx = withHTTPRequestInfo(ctx, r)
+		if config.WatchQuota != nil {
+			release, err := config.WatchQuota.acquire(connect.Peer{Addr: r.RemoteAddr}, r.Header)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusTooManyRequests)
+				return
+			}
+			defer release()
+		}
+		config.setBuildHeaders(w.Header())
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-store")
+		w.WriteHeader(http.StatusOK)
+		flusher.Flush()
+
+		var mu sync.Mutex
+		write := func(event string, data []byte) error {
+			mu.Lock()
+			defer mu.Unlock()
+			if _, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, data); err != nil {
+				return err
+			}
+			flusher.Flush()
+			return nil
+		}
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+		var wg sync.WaitGroup
+		for _, service := range services {
+			wg.Add(1)
+			go func(service string) {
+				defer wg.Done()
+				// Any stream ending ends them all, so EventSource reconnects
+				// and resubscribes to every service.
+				defer cancel()
+				settings := config.forWatch(service)
+				send, stop := settings.heartbeatWatchUpdates(func(res *CheckResponse) error {
+					data, err := json.Marshal(SSEEvent{
+						Service: service,
+						Status:  res.Status,
+						Time:    config.Clock.Now(),
+					})
+					if err != nil {
+						return err
+					}
+					if err := write("status", data); err != nil {
+						return err
+					}
+					res.markSent()
+					return nil
+				})
+				defer stop()
+				send, stopDelay := settings.delayWatchUpdates(send)
+				defer stopDelay()
+				err := watcher.Watch(withSendReports(ctx), &CheckRequest{Service: service}, send)
+				if err != nil && ctx.Err() == nil {
+					data, _ := json.Marshal(map[string]string{
+						"service": service,
+						"error":   err.Error(),
+					})
+					_ = write("error", data)
+				}
+			}(service)
+		}
+		wg.Wait()
+	}))
+}
@@ -0,0 +1,88 @@
+// Copyright 2022-2024 The Connect Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package grpchealth
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestSSEHandler(t *testing.T) {
+	const userFQN = "acme.user.v1.UserService"
+	t.Parallel()
+	checker := NewStaticChecker(userFQN)
+	server := httptest.NewServer(NewSSEHandler(checker))
+	t.Cleanup(server.Close)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, server.URL+"?service="+userFQN, http.NoBody)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := server.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	if got := res.Header.Get("Content-Type"); got != "text/event-stream" {
+		t.Fatalf("got Content-Type %q, expected %q", got, "text/event-stream")
+	}
+	lines := bufio.NewScanner(res.Body)
+	receive := func(expect Status) {
+		t.Helper()
+		var event, data string
+		for lines.Scan() {
+			line := lines.Text()
+			if line == "" {
+				break
+			}
+			if value, ok := strings.CutPrefix(line, "event: "); ok {
+				event = value
+			}
+			if value, ok := strings.CutPrefix(line, "data: "); ok {
+				data = value
+			}
+		}
+		if event != "status" {
+			t.Fatalf("got event %q, expected %q", event, "status")
+		}
+		var payload SSEEvent
+		if err := json.Unmarshal([]byte(data), &payload); err != nil {
+			t.Fatal(err)
+		}
+		if payload.Service != userFQN || payload.Status != expect || payload.Time.IsZero() {
+			t.Fatalf("got event %+v, expected %v for %q with a timestamp", payload, expect, userFQN)
+		}
+	}
+	receive(StatusServing)
+	checker.SetStatus(userFQN, StatusNotServing)
+	receive(StatusNotServing)
+	checker.SetStatus(userFQN, StatusServing)
+	receive(StatusServing)
+}
+
+func TestSSEHandlerMethod(t *testing.T) {
+	t.Parallel()
+	res := httptest.NewRecorder()
+	NewSSEHandler(NewStaticChecker()).ServeHTTP(res, httptest.NewRequest(http.MethodPost, "/", nil))
+	if res.Code != http.StatusMethodNotAllowed {
+		t.Errorf("got HTTP %d, expected %d", res.Code, http.StatusMethodNotAllowed)
+	}
+}
@@ -0,0 +1,73 @@
+// Copyright 2022-2024 The Connect Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package grpchealth
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// WithStabilityHeaders attaches context about how stable the instance is to
+// the responses of Check, NewHTTPHandler, and NewEnvoyHandler:
+//
+//   - Process-Uptime is the number of whole seconds the process has been up,
+//     measured from the StartTime passed to WithBuildInfo or, without it, from
+//     when the handler was built.
+//   - Status-Last-Transition is when the checked service's status last
+//     changed, formatted as RFC 3339. It's only sent if the Checker tracks
+//     transitions, as StaticChecker does.
+func WithStabilityHeaders() HandlerOption {
+	return newHandlerOption(func(config *handlerConfig) {
+		config.StabilityHeaders = true
+	})
+}
+
+// transitionReporter is implemented by Checkers that track when each
+// service's status last changed.
+type transitionReporter interface {
+	LastTransition(service string) (time.Time, bool)
+}
+
+// LastTransition returns when SetStatus last changed a service's status, or
+// first set it. It returns false if SetStatus has never been called for the
+// service.
+func (c *StaticChecker) LastTransition(service string) (time.Time, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	counters, ok := c.counters[service]
+	if !ok || counters.lastTransition.IsZero() {
+		return time.Time{}, false
+	}
+	return counters.lastTransition, true
+}
+
+// setStabilityHeaders adds the headers enabled by WithStabilityHeaders.
+func (c *handlerConfig) setStabilityHeaders(header http.Header, checker Checker, service string) {
+	if !c.StabilityHeaders {
+		return
+	}
+	started := c.Started
+	if c.BuildInfo != nil && !c.BuildInfo.StartTime.IsZero() {
+		started = c.BuildInfo.StartTime
+	}
+	uptime := c.Clock.Now().Sub(started) / time.Second
+	header.Set("Process-Uptime", strconv.FormatInt(int64(uptime), 10))
+	if reporter, ok := checker.(transitionReporter); ok {
+		if at, ok := reporter.LastTransition(service); ok {
+			header.Set("Status-Last-Transition", at.UTC().Format(time.RFC3339))
+		}
+	}
+}
@@ -0,0 +1,69 @@
+// Copyright 2022-2024 The Connect Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package grpchealth
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestStabilityHeaders(t *testing.T) {
+	t.Parallel()
+	clock := &manualClock{now: time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)}
+	checker := NewStaticCheckerWithOptions(nil, WithClock(clock))
+	checker.SetStatus("", StatusServing)
+	clock.Advance(time.Minute)
+	checker.SetStatus("", StatusNotServing)
+	transition := clock.Now()
+	handler := NewHTTPHandler(checker, WithStabilityHeaders(), WithHandlerClock(clock))
+	clock.Advance(90*time.Second + 500*time.Millisecond)
+
+	res := httptest.NewRecorder()
+	handler.ServeHTTP(res, httptest.NewRequest(http.MethodGet, "/", nil))
+	if got := res.Header().Get("Process-Uptime"); got != "90" {
+		t.Errorf("got Process-Uptime %q, expected %q", got, "90")
+	}
+	if got, expect := res.Header().Get("Status-Last-Transition"), transition.Format(time.RFC3339); got != expect {
+		t.Errorf("got Status-Last-Transition %q, expected %q", got, expect)
+	}
+	if at, ok := checker.LastTransition(""); !ok || !at.Equal(transition) {
+		t.Errorf("got last transition %v, %v, expected %v", at, ok, transition)
+	}
+	if stats := checker.Stats()[""]; !stats.LastTransition.Equal(transition) {
+		t.Errorf("got LastTransition %v in stats, expected %v", stats.LastTransition, transition)
+	}
+
+	// Uptime starts from the build info's start time, if any, and checkers
+	// that don't track transitions omit the header.
+	handler = NewHTTPHandler(
+		checkerFunc(func(context.Context, *CheckRequest) (*CheckResponse, error) {
+			return &CheckResponse{Status: StatusServing}, nil
+		}),
+		WithStabilityHeaders(),
+		WithHandlerClock(clock),
+		WithBuildInfo(BuildInfo{StartTime: clock.Now().Add(-time.Hour)}),
+	)
+	res = httptest.NewRecorder()
+	handler.ServeHTTP(res, httptest.NewRequest(http.MethodGet, "/", nil))
+	if got := res.Header().Get("Process-Uptime"); got != "3600" {
+		t.Errorf("got Process-Uptime %q, expected %q", got, "3600")
+	}
+	if got := res.Header().Get("Status-Last-Transition"); got != "" {
+		t.Errorf("got Status-Last-Transition %q, expected none", got)
+	}
+}
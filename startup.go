@@ -0,0 +1,255 @@
+// Copyright 2022-2024 The Connect Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package grpchealth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// StartupDependency is something a service needs before it can serve, such as
+// a database connection, a warmed cache, or a downstream API.
+type StartupDependency struct {
+	// Name identifies the dependency in progress details and in other
+	// dependencies' After lists.
+	Name string
+	// Probe reports whether the dependency is ready. It's retried until it
+	// returns nil.
+	Probe func(ctx context.Context) error
+	// After lists dependencies that must be ready before this one is probed.
+	After []string
+	// Critical dependencies must be ready before the service reports
+	// StatusServing. Others are sequenced and reported, but don't hold up
+	// serving.
+	Critical bool
+}
+
+// StartupSequencerParams configure a StartupSequencer.
+type StartupSequencerParams struct {
+	// Dependencies must form a directed acyclic graph through their After
+	// lists.
+	Dependencies []StartupDependency
+	// RetryInterval is the time between failed probes of a dependency. The
+	// default is one second.
+	RetryInterval time.Duration
+	// ProbeTimeout bounds each probe. Zero means no timeout beyond Run's
+	// context.
+	ProbeTimeout time.Duration
+	// Setter, if set, has Service set to StatusServing once every critical
+	// dependency is ready, so readiness reported by a StaticChecker can be
+	// gated on startup. Register the service as StatusNotServing beforehand.
+	Setter StatusSetter
+	// Service is the service Setter marks as serving. The empty string, the
+	// default, represents the whole process.
+	Service string
+	// Clock schedules retries. The default is the system clock.
+	Clock Clock
+}
+
+// StartupSequencer brings up a service's dependencies in order during boot.
+// As a Checker, it reports StatusNotServing until every critical dependency
+// is ready, and StatusServing from then on. The details of the response map
+// each dependency to its progress: "waiting" for the dependencies it comes
+// after, "probing", "ready", or the error from its latest probe.
+//
+// StartupSequencer reports the same status for every service.
+type StartupSequencer struct {
+	params StartupSequencerParams
+	ready  map[string]chan struct{}
+
+	mu       sync.Mutex
+	progress map[string]string
+	pending  int // critical dependencies that aren't ready
+}
+
+// NewStartupSequencer constructs a StartupSequencer. It returns an error if
+// dependency names aren't unique, if an After list names an unknown
+// dependency, or if the dependencies form a cycle.
+func NewStartupSequencer(params StartupSequencerParams) (*StartupSequencer, error) {
+	if params.RetryInterval <= 0 {
+		params.RetryInterval = time.Second
+	}
+	if params.Clock == nil {
+		params.Clock = systemClock{}
+	}
+	byName := make(map[string]*StartupDependency, len(params.Dependencies))
+	sequencer := &StartupSequencer{
+		params:   params,
+		ready:    make(map[string]chan struct{}, len(params.Dependencies)),
+		progress: make(map[string]string, len(params.Dependencies)),
+	}
+	for i := range params.Dependencies {
+		dep := &params.Dependencies[i]
+		if dep.Name == "" || dep.Probe == nil {
+			return nil, errors.New("startup dependencies require a name and a probe")
+		}
+		if _, ok := byName[dep.Name]; ok {
+			return nil, fmt.Errorf("duplicate startup dependency %q", dep.Name)
+		}
+		byName[dep.Name] = dep
+		sequencer.ready[dep.Name] = make(chan struct{})
+		sequencer.progress[dep.Name] = "waiting"
+		if dep.Critical {
+			sequencer.pending++
+		}
+	}
+	// Depth-first search for cycles and unknown names.
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	state := make(map[string]int, len(byName))
+	var visit func(name string) error
+	visit = func(name string) error {
+		switch state[name] {
+		case visiting:
+			return fmt.Errorf("startup dependency cycle through %q", name)
+		case visited:
+			return nil
+		}
+		state[name] = visiting
+		for _, after := range byName[name].After {
+			if _, ok := byName[after]; !ok {
+				return fmt.Errorf("startup dependency %q comes after unknown %q", name, after)
+			}
+			if err := visit(after); err != nil {
+				return err
+			}
+		}
+		state[name] = visited
+		return nil
+	}
+	for name := range byName {
+		if err := visit(name); err != nil {
+			return nil, err
+		}
+	}
+	return sequencer, nil
+}
+
+// Run probes every dependency once the ones it comes after are ready,
+// retrying failures, and returns once all dependencies are ready. If ctx
+// ends first, Run returns its error. Run should be called once.
+func (s *StartupSequencer) Run(ctx context.Context) error {
+	s.mu.Lock()
+	ready := s.pending == 0
+	s.mu.Unlock()
+	if ready {
+		s.setServing()
+	}
+	var wg sync.WaitGroup
+	for i := range s.params.Dependencies {
+		dep := &s.params.Dependencies[i]
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.run(ctx, dep)
+		}()
+	}
+	wg.Wait()
+	return ctx.Err()
+}
+
+// Wait blocks until every critical dependency is ready or ctx ends.
+func (s *StartupSequencer) Wait(ctx context.Context) error {
+	for _, dep := range s.params.Dependencies {
+		if !dep.Critical {
+			continue
+		}
+		select {
+		case <-s.ready[dep.Name]:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+// Check implements Checker.
+func (s *StartupSequencer) Check(_ context.Context, _ *CheckRequest) (*CheckResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	status := StatusServing
+	if s.pending > 0 {
+		status = StatusNotServing
+	}
+	details := make(map[string]string, len(s.progress))
+	for name, progress := range s.progress {
+		details[name] = progress
+	}
+	return &CheckResponse{Status: status, Details: details}, nil
+}
+
+func (s *StartupSequencer) run(ctx context.Context, dep *StartupDependency) {
+	for _, after := range dep.After {
+		select {
+		case <-s.ready[after]:
+		case <-ctx.Done():
+			return
+		}
+	}
+	s.setProgress(dep.Name, "probing")
+	for {
+		err := s.probe(ctx, dep)
+		if err == nil {
+			break
+		}
+		s.setProgress(dep.Name, err.Error())
+		timer := s.params.Clock.NewTimer(s.params.RetryInterval)
+		select {
+		case <-timer.Chan():
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		}
+	}
+	s.mu.Lock()
+	s.progress[dep.Name] = "ready"
+	ready := false
+	if dep.Critical {
+		s.pending--
+		ready = s.pending == 0
+	}
+	s.mu.Unlock()
+	close(s.ready[dep.Name])
+	if ready {
+		s.setServing()
+	}
+}
+
+func (s *StartupSequencer) setServing() {
+	if s.params.Setter != nil {
+		s.params.Setter.SetStatus(s.params.Service, StatusServing)
+	}
+}
+
+func (s *StartupSequencer) probe(ctx context.Context, dep *StartupDependency) error {
+	if s.params.ProbeTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.params.ProbeTimeout)
+		defer cancel()
+	}
+	return dep.Probe(ctx)
+}
+
+func (s *StartupSequencer) setProgress(name, progress string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.progress[name] = progress
+}
@@ -0,0 +1,155 @@
+// Copyright 2022-2024 The Connect Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package grpchealth
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestStartupSequencer(t *testing.T) {
+	t.Parallel()
+	var (
+		mu       sync.Mutex
+		order    []string
+		cacheErr = errors.New("cache cold")
+		release  = make(chan struct{})
+	)
+	probe := func(name string, wait <-chan struct{}) func(context.Context) error {
+		return func(ctx context.Context) error {
+			if wait != nil {
+				select {
+				case <-wait:
+				default:
+					return cacheErr
+				}
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			order = append(order, name)
+			return nil
+		}
+	}
+	sequencer, err := NewStartupSequencer(StartupSequencerParams{
+		Dependencies: []StartupDependency{
+			{Name: "cache", Probe: probe("cache", release), After: []string{"db"}, Critical: false},
+			{Name: "api", Probe: probe("api", nil), After: []string{"db", "config"}, Critical: true},
+			{Name: "db", Probe: probe("db", nil), After: []string{"config"}, Critical: true},
+			{Name: "config", Probe: probe("config", nil), After: nil, Critical: true},
+		},
+		RetryInterval: time.Millisecond,
+		ProbeTimeout:  time.Second,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := sequencer.Check(context.Background(), &CheckRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Status != StatusNotServing || res.Details["api"] != "waiting" {
+		t.Fatalf("got %v with details %v before Run", res.Status, res.Details)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	done := make(chan error, 1)
+	go func() { done <- sequencer.Run(ctx) }()
+	if err := sequencer.Wait(ctx); err != nil {
+		t.Fatal(err)
+	}
+	res, err = sequencer.Check(context.Background(), &CheckRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Status != StatusServing || res.Details["api"] != "ready" {
+		t.Fatalf("got %v with details %v after critical dependencies", res.Status, res.Details)
+	}
+	for res.Details["cache"] != cacheErr.Error() {
+		time.Sleep(time.Millisecond)
+		res, _ = sequencer.Check(context.Background(), &CheckRequest{})
+	}
+	close(release)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(order) != 4 || order[0] != "config" || order[1] != "db" || order[3] != "cache" {
+		t.Fatalf("got order %v", order)
+	}
+}
+
+func TestStartupSequencerInvalid(t *testing.T) {
+	t.Parallel()
+	probe := func(context.Context) error { return nil }
+	for name, deps := range map[string][]StartupDependency{
+		"duplicate": {
+			{Name: "a", Probe: probe, After: nil, Critical: true},
+			{Name: "a", Probe: probe, After: nil, Critical: true},
+		},
+		"unknown": {
+			{Name: "a", Probe: probe, After: []string{"b"}, Critical: true},
+		},
+		"cycle": {
+			{Name: "a", Probe: probe, After: []string{"b"}, Critical: true},
+			{Name: "b", Probe: probe, After: []string{"a"}, Critical: true},
+		},
+	} {
+		_, err := NewStartupSequencer(StartupSequencerParams{
+			Dependencies:  deps,
+			RetryInterval: 0,
+			ProbeTimeout:  0,
+		})
+		if err == nil {
+			t.Fatalf("%s: expected error", name)
+		}
+	}
+}
+
+func TestStartupSequencerRetryDefault(t *testing.T) {
+	t.Parallel()
+	var probes atomic.Int32
+	sequencer, err := NewStartupSequencer(StartupSequencerParams{
+		Dependencies: []StartupDependency{{
+			Name: "db",
+			Probe: func(context.Context) error {
+				probes.Add(1)
+				return errors.New("connection refused")
+			},
+			After:    nil,
+			Critical: true,
+		}},
+		RetryInterval: 0,
+		ProbeTimeout:  0,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Without a retry interval, failing probes are retried every second
+	// rather than in a tight loop.
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if err := sequencer.Run(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("got error %v, expected %v", err, context.DeadlineExceeded)
+	}
+	if n := probes.Load(); n != 1 {
+		t.Fatalf("probed %d times, expected 1", n)
+	}
+}
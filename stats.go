@@ -0,0 +1,163 @@
+// Copyright 2022-2024 The Connect Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package grpchealth
+
+import (
+	"context"
+	"log/slog"
+	"time"
+)
+
+// A StatsHandler observes the health subsystem: checks starting and finishing,
+// Watch streams starting and ending, services changing status, and status
+// changes reaching watchers. Telemetry backends implement it once instead of
+// wiring individual hooks, and this package's sinks, such as
+// CheckLatencyRecorder, StatsDEmitter, EMFExporter, and the handler returned
+// by NewLogStatsHandler, all implement it. Register StatsHandlers with
+// WithHandlerStats and WithStatusStats.
+//
+// HandleStats is called synchronously, so it must be safe to call
+// concurrently and must not block. Transitions and propagations are reported
+// while the StaticChecker is locked, so HandleStats must not call back into
+// it.
+type StatsHandler interface {
+	HandleStats(context.Context, Stats)
+}
+
+// Stats are the events reported to a StatsHandler: one of *CheckBegin,
+// *CheckEnd, *WatchBegin, *WatchEnd, *Transition, or *Propagation.
+type Stats interface {
+	isStats()
+}
+
+// CheckBegin is reported when a handler starts a check.
+type CheckBegin struct {
+	// Service is the service being checked.
+	Service string
+	// Time is when the check started.
+	Time time.Time
+}
+
+// CheckEnd is reported when a check finishes, including its duration.
+type CheckEnd struct {
+	Result *CheckResult
+}
+
+// WatchBegin is reported when a Watch stream starts.
+type WatchBegin struct {
+	Info *WatchInfo
+	// Time is when the stream started.
+	Time time.Time
+}
+
+// WatchEnd is reported when a Watch stream ends.
+type WatchEnd struct {
+	Info *WatchInfo
+	// Err is the error that ended the stream. Streams ended by the client
+	// usually end with context.Canceled.
+	Err error
+	// Time is when the stream ended.
+	Time time.Time
+}
+
+// Transition is reported when a StaticChecker's service changes status, or is
+// first registered.
+type Transition struct {
+	Service string
+	// Previous is the old status. It's StatusUnknown when a service is first
+	// registered.
+	Previous Status
+	Status   Status
+	// Time is when the status changed.
+	Time time.Time
+}
+
+func (*CheckBegin) isStats() {}
+func (*CheckEnd) isStats()   {}
+func (*WatchBegin) isStats() {}
+func (*WatchEnd) isStats()   {}
+func (*Transition) isStats() {}
+
+// WithHandlerStats makes handlers report checks and Watch streams to the
+// StatsHandlers.
+func WithHandlerStats(handlers ...StatsHandler) HandlerOption {
+	return newHandlerOption(func(config *handlerConfig) {
+		config.StatsHandlers = append(config.StatsHandlers, handlers...)
+	})
+}
+
+// WithStatusStats makes a StaticChecker report status transitions, and their
+// propagation to watchers, to the StatsHandlers. As with WithStatusEvents,
+// changes caused by dependencies aren't reported separately.
+func WithStatusStats(handlers ...StatsHandler) StaticCheckerOption {
+	return &statusStatsOption{handlers: handlers}
+}
+
+type statusStatsOption struct {
+	handlers []StatsHandler
+}
+
+func (o *statusStatsOption) applyToStaticChecker(checker *StaticChecker) {
+	checker.stats = append(checker.stats, o.handlers...)
+}
+
+// handleStats reports stats to every handler.
+func handleStats(ctx context.Context, handlers []StatsHandler, stats Stats) {
+	for _, handler := range handlers {
+		handler.HandleStats(ctx, stats)
+	}
+}
+
+// NewLogStatsHandler returns a StatsHandler that logs to the logger: status
+// transitions at the info level, failed checks at the warning level, and
+// Watch streams at the debug level.
+func NewLogStatsHandler(logger *slog.Logger) StatsHandler {
+	return &logStatsHandler{logger: logger}
+}
+
+type logStatsHandler struct {
+	logger *slog.Logger
+}
+
+func (h *logStatsHandler) HandleStats(ctx context.Context, stats Stats) {
+	switch stats := stats.(type) {
+	case *CheckEnd:
+		if stats.Result.Err == nil {
+			return
+		}
+		h.logger.WarnContext(ctx, "health check failed",
+			slog.String("service", stats.Result.Service),
+			slog.Duration("duration", stats.Result.Duration),
+			slog.Any("error", stats.Result.Err),
+		)
+	case *WatchBegin:
+		h.logger.DebugContext(ctx, "health watch started",
+			slog.String("service", stats.Info.Service),
+			slog.String("peer", stats.Info.Peer.Addr),
+		)
+	case *WatchEnd:
+		h.logger.DebugContext(ctx, "health watch ended",
+			slog.String("service", stats.Info.Service),
+			slog.String("peer", stats.Info.Peer.Addr),
+			slog.Any("error", stats.Err),
+		)
+	case *Transition:
+		h.logger.InfoContext(ctx, "health status changed",
+			slog.String("service", stats.Service),
+			slog.String("previous", stats.Previous.String()),
+			slog.String("status", stats.Status.String()),
+		)
+	}
+}
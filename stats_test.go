@@ -0,0 +1,127 @@
+// Copyright 2022-2024 The Connect Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package grpchealth
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"connectrpc.com/connect"
+	healthv1 "connectrpc.com/grpchealth/internal/gen/go/connectext/grpc/health/v1"
+)
+
+func TestStatsHandler(t *testing.T) {
+	const userFQN = "acme.user.v1.UserService"
+	t.Parallel()
+	stats := &statsRecorder{}
+	checker := NewStaticCheckerWithOptions([]string{userFQN}, WithStatusStats(stats))
+	mux := http.NewServeMux()
+	mux.Handle(NewHandler(checker, WithHandlerStats(stats)))
+	server := httptest.NewUnstartedServer(mux)
+	server.EnableHTTP2 = true
+	server.StartTLS()
+	t.Cleanup(server.Close)
+
+	client := connect.NewClient[healthv1.HealthCheckRequest, healthv1.HealthCheckResponse](
+		server.Client(),
+		server.URL+"/grpc.health.v1.Health/Check",
+		connect.WithGRPC(),
+	)
+	if _, err := client.CallUnary(context.Background(), connect.NewRequest(&healthv1.HealthCheckRequest{Service: userFQN})); err != nil {
+		t.Fatal(err)
+	}
+	receive := newTestWatch(t, server, userFQN)
+	receive(StatusServing)
+	checker.SetStatus(userFQN, StatusNotServing)
+	receive(StatusNotServing)
+
+	recorded := stats.all()
+	if len(recorded) < 4 {
+		t.Fatalf("got stats %v", recorded)
+	}
+	if begin, ok := recorded[0].(*CheckBegin); !ok || begin.Service != userFQN {
+		t.Errorf("got %#v first, expected CheckBegin", recorded[0])
+	}
+	if end, ok := recorded[1].(*CheckEnd); !ok || end.Result.Status != StatusServing {
+		t.Errorf("got %#v second, expected CheckEnd", recorded[1])
+	}
+	if begin, ok := recorded[2].(*WatchBegin); !ok || begin.Info.Service != userFQN {
+		t.Errorf("got %#v third, expected WatchBegin", recorded[2])
+	}
+	if transition, ok := recorded[3].(*Transition); !ok ||
+		*transition != (Transition{Service: userFQN, Previous: StatusServing, Status: StatusNotServing, Time: transition.Time}) {
+		t.Errorf("got %#v fourth, expected Transition", recorded[3])
+	}
+}
+
+func TestLogStatsHandler(t *testing.T) {
+	t.Parallel()
+	var buf bytes.Buffer
+	handler := NewLogStatsHandler(slog.New(slog.NewTextHandler(&buf, nil)))
+	ctx := context.Background()
+	handler.HandleStats(ctx, &CheckBegin{Service: "cache"})
+	handler.HandleStats(ctx, &CheckEnd{Result: &CheckResult{Service: "cache", Status: StatusServing}})
+	handler.HandleStats(ctx, &WatchBegin{Info: &WatchInfo{Service: "cache"}})
+	handler.HandleStats(ctx, &CheckEnd{Result: &CheckResult{Service: "db", Err: errors.New("timeout")}})
+	handler.HandleStats(ctx, &Transition{Service: "db", Previous: StatusServing, Status: StatusNotServing})
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("got log lines %q, expected a failed check and a transition", lines)
+	}
+	for i, expect := range []string{
+		`level=WARN msg="health check failed" service=db`,
+		`level=INFO msg="health status changed" service=db previous=serving status=not_serving`,
+	} {
+		if !strings.Contains(lines[i], expect) {
+			t.Errorf("got log line %q, expected it to contain %q", lines[i], expect)
+		}
+	}
+}
+
+func TestLatencyRecorderStats(t *testing.T) {
+	t.Parallel()
+	recorder := NewCheckLatencyRecorder(time.Second)
+	recorder.HandleStats(context.Background(), &CheckEnd{Result: &CheckResult{Service: "cache", Duration: time.Millisecond}})
+	recorder.HandleStats(context.Background(), &CheckBegin{Service: "cache"})
+	if got := recorder.Snapshot()["cache"].Count; got != 1 {
+		t.Errorf("got %d observations, expected 1", got)
+	}
+}
+
+// statsRecorder is a StatsHandler that records everything it's handed.
+type statsRecorder struct {
+	mu    sync.Mutex
+	stats []Stats
+}
+
+func (r *statsRecorder) HandleStats(_ context.Context, stats Stats) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.stats = append(r.stats, stats)
+}
+
+func (r *statsRecorder) all() []Stats {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]Stats(nil), r.stats...)
+}
@@ -0,0 +1,185 @@
+// Copyright 2022-2024 The Connect Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package grpchealth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// StatsDParams configure a StatsDEmitter. Exactly one of Addr and Writer must
+// be set.
+type StatsDParams struct {
+	// Addr is the host and port of the StatsD server, such as
+	// "localhost:8125". Metrics are sent over UDP.
+	Addr string
+	// Writer receives metrics instead, one line per Write call. Writes are
+	// serialized, so it needn't be safe for concurrent use.
+	Writer io.Writer
+	// Prefix is prepended to metric names. The default is "grpchealth.".
+	Prefix string
+	// DogStatsD enables the DogStatsD extensions: services and Tags are sent
+	// as tags rather than embedded in metric names, and each transition is
+	// also sent as an event.
+	DogStatsD bool
+	// Tags are added to every metric and event, in DogStatsD mode. Characters
+	// that DogStatsD treats as separators are replaced with underscores.
+	Tags map[string]string
+	// OnError, if set, is called with errors sending metrics. Sending
+	// continues after errors.
+	OnError func(error)
+}
+
+// StatsDEmitter sends status transitions to StatsD, for telemetry pipelines
+// built on StatsD rather than Prometheus or OpenTelemetry. For each change in a
+// service's status, it sets the serving gauge to 1 or 0 and increments the
+// transitions counter. Feed it a StaticChecker's transitions with
+// WithStatusEvents and Run.
+type StatsDEmitter struct {
+	params StatsDParams
+	tags   string
+	conn   net.Conn
+
+	mu sync.Mutex // serializes writes
+}
+
+// NewStatsDEmitter constructs a StatsDEmitter, dialing Addr if it's set. It
+// returns an error unless exactly one of Addr and Writer is set.
+func NewStatsDEmitter(params StatsDParams) (*StatsDEmitter, error) {
+	if (params.Addr == "") == (params.Writer == nil) {
+		return nil, errors.New("statsd emitter requires exactly one of an address or a writer")
+	}
+	var conn net.Conn
+	if params.Addr != "" {
+		var err error
+		conn, err = net.Dial("udp", params.Addr)
+		if err != nil {
+			return nil, fmt.Errorf("dial statsd: %w", err)
+		}
+		params.Writer = conn
+	}
+	if params.Prefix == "" {
+		params.Prefix = "grpchealth."
+	}
+	tags := make([]string, 0, len(params.Tags))
+	for key, value := range params.Tags {
+		tags = append(tags, dogStatsDTag(strings.ReplaceAll(key, ":", "_"))+":"+dogStatsDTag(value))
+	}
+	sort.Strings(tags)
+	return &StatsDEmitter{params: params, tags: strings.Join(tags, ","), conn: conn}, nil
+}
+
+// Close closes the connection dialed for Addr, if any.
+func (e *StatsDEmitter) Close() error {
+	if e.conn == nil {
+		return nil
+	}
+	return e.conn.Close()
+}
+
+// Run sends the transitions reported by an EventStream until ctx ends, and
+// then returns ctx's error. Events other than EventStatusChanged are ignored,
+// so Run should be the stream's only consumer. Run should be called once.
+func (e *StatsDEmitter) Run(ctx context.Context, stream *EventStream) error {
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case event := <-stream.Events():
+			if event.Kind == EventStatusChanged {
+				e.Emit(event.Service, event.Previous, event.Status)
+			}
+		}
+	}
+}
+
+// HandleStats implements StatsHandler, sending each transition. Register the
+// emitter with WithStatusStats as an alternative to Run.
+func (e *StatsDEmitter) HandleStats(_ context.Context, stats Stats) {
+	if transition, ok := stats.(*Transition); ok {
+		e.Emit(transition.Service, transition.Previous, transition.Status)
+	}
+}
+
+// Emit sends a single transition.
+func (e *StatsDEmitter) Emit(service string, previous, status Status) {
+	var serving int
+	if status == StatusServing {
+		serving = 1
+	}
+	if !e.params.DogStatsD {
+		name := statsDName(service)
+		e.send(fmt.Sprintf("%sserving.%s:%d|g", e.params.Prefix, name, serving))
+		e.send(fmt.Sprintf("%stransitions.%s:1|c", e.params.Prefix, name))
+		return
+	}
+	name := dogStatsDTag(metricServiceName(service))
+	tags := e.withTags("service:" + name)
+	e.send(fmt.Sprintf("%sserving:%d|g|#%s", e.params.Prefix, serving, tags))
+	e.send(fmt.Sprintf("%stransitions:1|c|#%s", e.params.Prefix, e.withTags(
+		"service:"+name,
+		"from:"+previous.String(),
+		"to:"+status.String(),
+	)))
+	title := fmt.Sprintf("Health of %s changed", name)
+	text := fmt.Sprintf("%s -> %s", previous, status)
+	alert := "success"
+	if status != StatusServing {
+		alert = "warning"
+	}
+	e.send(fmt.Sprintf("_e{%d,%d}:%s|%s|t:%s|#%s", len(title), len(text), title, text, alert, tags))
+}
+
+func (e *StatsDEmitter) withTags(tags ...string) string {
+	if e.tags != "" {
+		tags = append(tags, e.tags)
+	}
+	return strings.Join(tags, ",")
+}
+
+func (e *StatsDEmitter) send(line string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if _, err := io.WriteString(e.params.Writer, line); err != nil && e.params.OnError != nil {
+		e.params.OnError(err)
+	}
+}
+
+// metricServiceName names a service in metric tags, dimensions, and event
+// titles. The empty service name represents the whole process.
+func metricServiceName(service string) string {
+	if service == "" {
+		return "process"
+	}
+	return service
+}
+
+// dogStatsDTag sanitizes a DogStatsD tag or event title, replacing characters
+// that separate tags, fields, and packets.
+func dogStatsDTag(value string) string {
+	return strings.NewReplacer(",", "_", "|", "_", "#", "_", "\n", "_", "\r", "_").Replace(value)
+}
+
+// statsDName names a service as a single component of a metric name,
+// replacing characters that StatsD treats as separators.
+func statsDName(service string) string {
+	return strings.NewReplacer(".", "_", ":", "_", "|", "_", "@", "_", "/", "_").Replace(metricServiceName(service))
+}
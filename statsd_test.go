@@ -0,0 +1,141 @@
+// Copyright 2022-2024 The Connect Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package grpchealth
+
+import (
+	"context"
+	"net"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestStatsDEmitter(t *testing.T) {
+	const userFQN = "acme.user.v1.UserService"
+	t.Parallel()
+	t.Run("statsd", func(t *testing.T) {
+		t.Parallel()
+		var lines lineRecorder
+		emitter, err := NewStatsDEmitter(StatsDParams{Writer: &lines})
+		if err != nil {
+			t.Fatal(err)
+		}
+		emitter.Emit(userFQN, StatusServing, StatusNotServing)
+		expect := []string{
+			"grpchealth.serving.acme_user_v1_UserService:0|g",
+			"grpchealth.transitions.acme_user_v1_UserService:1|c",
+		}
+		if !reflect.DeepEqual([]string(lines), expect) {
+			t.Fatalf("got %q, expected %q", lines, expect)
+		}
+	})
+	t.Run("concurrent", func(t *testing.T) {
+		t.Parallel()
+		var lines lineRecorder
+		emitter, err := NewStatsDEmitter(StatsDParams{Writer: &lines})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var wg sync.WaitGroup
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				emitter.Emit(userFQN, StatusServing, StatusNotServing)
+			}()
+		}
+		wg.Wait()
+		if len(lines) != 20 {
+			t.Fatalf("got %d lines, expected 20", len(lines))
+		}
+	})
+	t.Run("dogstatsd", func(t *testing.T) {
+		t.Parallel()
+		listener, err := net.ListenPacket("udp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { listener.Close() })
+		emitter, err := NewStatsDEmitter(StatsDParams{
+			Addr:      listener.LocalAddr().String(),
+			Prefix:    "acme.",
+			DogStatsD: true,
+			Tags:      map[string]string{"env": "prod"},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { emitter.Close() })
+		stream := NewEventStream(1)
+		checker := NewStaticCheckerWithOptions(nil, WithStatusEvents(stream))
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		go func() { _ = emitter.Run(ctx, stream) }()
+		checker.SetStatus("", StatusNotServing)
+
+		expect := []string{
+			"acme.serving:0|g|#service:process,env:prod",
+			"acme.transitions:1|c|#service:process,from:serving,to:not_serving,env:prod",
+			"_e{25,22}:Health of process changed|serving -> not_serving|t:warning|#service:process,env:prod",
+		}
+		buf := make([]byte, 1024)
+		_ = listener.SetReadDeadline(time.Now().Add(5 * time.Second))
+		for _, line := range expect {
+			n, _, err := listener.ReadFrom(buf)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := string(buf[:n]); got != line {
+				t.Fatalf("got %q, expected %q", got, line)
+			}
+		}
+	})
+	t.Run("dogstatsd escaping", func(t *testing.T) {
+		t.Parallel()
+		var lines lineRecorder
+		emitter, err := NewStatsDEmitter(StatsDParams{
+			Writer:    &lines,
+			DogStatsD: true,
+			Tags:      map[string]string{"team:name": "a,b|c"},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		emitter.Emit("acme|user,v1#x\nY", StatusServing, StatusNotServing)
+		expect := []string{
+			"grpchealth.serving:0|g|#service:acme_user_v1_x_Y,team_name:a_b_c",
+			"grpchealth.transitions:1|c|#service:acme_user_v1_x_Y,from:serving,to:not_serving,team_name:a_b_c",
+			"_e{34,22}:Health of acme_user_v1_x_Y changed|serving -> not_serving|t:warning|#service:acme_user_v1_x_Y,team_name:a_b_c",
+		}
+		if !reflect.DeepEqual([]string(lines), expect) {
+			t.Fatalf("got %q, expected %q", lines, expect)
+		}
+	})
+	t.Run("invalid", func(t *testing.T) {
+		t.Parallel()
+		if _, err := NewStatsDEmitter(StatsDParams{}); err == nil {
+			t.Fatal("expected error without a destination")
+		}
+	})
+}
+
+// lineRecorder records each Write as a line.
+type lineRecorder []string
+
+func (r *lineRecorder) Write(data []byte) (int, error) {
+	*r = append(*r, string(data))
+	return len(data), nil
+}
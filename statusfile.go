@@ -0,0 +1,148 @@
+// Copyright 2022-2024 The Connect Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package grpchealth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// StatusFileParams configure a StatusFileWriter.
+type StatusFileParams struct {
+	// Watcher reports the statuses to mirror, such as a StaticChecker.
+	Watcher Watcher
+	// Dir is the directory to write status files to, such as
+	// "/var/run/health". It must exist.
+	Dir string
+	// Services are the services to mirror. The empty string, which represents
+	// the whole process, is mirrored to a file named "process". If there are
+	// no services, only the whole process is mirrored.
+	Services []string
+	// OnError, if set, is called with errors watching services and writing
+	// files. Writing continues after errors. It must be safe to call
+	// concurrently.
+	OnError func(error)
+}
+
+// StatusFileWriter mirrors the status of services into small files, one per
+// service, for environments whose probes can only stat or read files, such as
+// initramfs scripts, exec probes, and s6 supervision trees. Each file is named
+// after its service (escaped as a URL path segment, with the dots of "." and
+// ".." escaped too, so every file stays in Dir) and holds the service's
+// status, such as "serving", followed by a newline. Files are replaced
+// atomically on every transition. While the Watcher is failing, files hold
+// "unknown", so they never report a service as serving when its status can't
+// be watched.
+type StatusFileWriter struct {
+	params StatusFileParams
+}
+
+// NewStatusFileWriter constructs a StatusFileWriter. It returns an error if the
+// Watcher or Dir is missing, or if two services would share a file, such as
+// the whole process and a service named "process".
+func NewStatusFileWriter(params StatusFileParams) (*StatusFileWriter, error) {
+	if params.Watcher == nil {
+		return nil, errors.New("status file writer requires a watcher")
+	}
+	if params.Dir == "" {
+		return nil, errors.New("status file writer requires a directory")
+	}
+	if len(params.Services) == 0 {
+		params.Services = []string{""}
+	}
+	writer := &StatusFileWriter{params: params}
+	services := make(map[string]string, len(params.Services))
+	for _, service := range params.Services {
+		path := writer.Path(service)
+		if other, ok := services[path]; ok {
+			return nil, fmt.Errorf("services %q and %q would share status file %s", other, service, path)
+		}
+		services[path] = service
+	}
+	return writer, nil
+}
+
+// Path returns the path of a service's status file.
+func (w *StatusFileWriter) Path(service string) string {
+	name := "process"
+	switch service {
+	case "":
+	case ".", "..":
+		name = strings.Repeat("%2E", len(service))
+	default:
+		name = url.PathEscape(service)
+	}
+	return filepath.Join(w.params.Dir, name)
+}
+
+// Run watches every service and writes its status file on each transition
+// until ctx ends. Then it removes the files, so stale files never report a
+// stopped process as serving, and returns ctx's error. Run should be called
+// once.
+func (w *StatusFileWriter) Run(ctx context.Context) error {
+	var wg sync.WaitGroup
+	for _, service := range w.params.Services {
+		wg.Add(1)
+		go func(service string) {
+			defer wg.Done()
+			w.mirror(ctx, service)
+		}(service)
+	}
+	wg.Wait()
+	for _, service := range w.params.Services {
+		if err := os.Remove(w.Path(service)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			w.report(err)
+		}
+	}
+	return ctx.Err()
+}
+
+// mirror writes a service's status file on each transition until ctx ends,
+// watching again after a backoff if the Watcher fails.
+func (w *StatusFileWriter) mirror(ctx context.Context, service string) {
+	path := w.Path(service)
+	retry := NewBackoff()
+	for attempt := 0; ; attempt++ {
+		err := w.params.Watcher.Watch(ctx, &CheckRequest{Service: service}, func(res *CheckResponse) error {
+			attempt = 0
+			if err := writeFileAtomic(path, []byte(res.Status.String()+"\n")); err != nil {
+				w.report(err)
+			}
+			return nil
+		})
+		if ctx.Err() != nil {
+			return
+		}
+		w.report(err)
+		if err := writeFileAtomic(path, []byte(StatusUnknown.String()+"\n")); err != nil {
+			w.report(err)
+		}
+		if retry.Wait(ctx, attempt) != nil {
+			return
+		}
+	}
+}
+
+func (w *StatusFileWriter) report(err error) {
+	if err != nil && w.params.OnError != nil {
+		w.params.OnError(err)
+	}
+}
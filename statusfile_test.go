@@ -0,0 +1,119 @@
+// Copyright 2022-2024 The Connect Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package grpchealth
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestStatusFileWriter(t *testing.T) {
+	const userFQN = "acme.user.v1.UserService"
+	t.Parallel()
+	checker := NewStaticChecker(userFQN)
+	dir := t.TempDir()
+	tenantService := TenantService("tenant-a", userFQN)
+	writer, err := NewStatusFileWriter(StatusFileParams{
+		Watcher:  checker,
+		Dir:      dir,
+		Services: []string{"", userFQN, tenantService},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, expect := writer.Path(""), filepath.Join(dir, "process"); got != expect {
+		t.Fatalf("got process path %q, expected %q", got, expect)
+	}
+	if got, expect := writer.Path(tenantService), filepath.Join(dir, "tenant-a%2Facme.user.v1.UserService"); got != expect {
+		t.Fatalf("got tenant service path %q, expected %q", got, expect)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- writer.Run(ctx) }()
+	waitForFile := func(service, expect string) {
+		t.Helper()
+		var got []byte
+		for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(5 * time.Millisecond) {
+			if got, _ = os.ReadFile(writer.Path(service)); string(got) == expect {
+				return
+			}
+		}
+		t.Fatalf("got %q in status file of %q, expected %q", got, service, expect)
+	}
+	waitForFile("", "serving\n")
+	waitForFile(userFQN, "serving\n")
+	waitForFile(tenantService, "service_unknown\n")
+	checker.SetStatus(userFQN, StatusNotServing)
+	waitForFile(userFQN, "not_serving\n")
+
+	cancel()
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Fatalf("got error %v, expected %v", err, context.Canceled)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Fatalf("got %d files after Run returned, expected none", len(entries))
+	}
+}
+
+func TestStatusFileWriterWatchFailure(t *testing.T) {
+	t.Parallel()
+	// The watcher sends the current status and then ends the stream.
+	watcher := &oneShotWatcher{Checker: NewStaticChecker(), streams: &atomic.Int32{}}
+	writer, err := NewStatusFileWriter(StatusFileParams{Watcher: watcher, Dir: t.TempDir()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() { _ = writer.Run(ctx) }()
+	var got []byte
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(time.Millisecond) {
+		if got, _ = os.ReadFile(writer.Path("")); string(got) == "unknown\n" {
+			return
+		}
+	}
+	t.Fatalf("got %q in status file while the watcher was failing, expected %q", got, "unknown\n")
+}
+
+func TestStatusFilePaths(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	writer, err := NewStatusFileWriter(StatusFileParams{
+		Watcher:  NewStaticChecker(),
+		Dir:      dir,
+		Services: []string{".", ".."},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for service, expect := range map[string]string{".": "%2E", "..": "%2E%2E"} {
+		if got := writer.Path(service); got != filepath.Join(dir, expect) {
+			t.Errorf("got path %q for %q, expected %q", got, service, filepath.Join(dir, expect))
+		}
+	}
+	_, err = NewStatusFileWriter(StatusFileParams{
+		Watcher:  NewStaticChecker(),
+		Dir:      dir,
+		Services: []string{"", "process"},
+	})
+	if err == nil {
+		t.Fatal("expected error for services sharing a file")
+	}
+}
@@ -0,0 +1,261 @@
+// Copyright 2022-2024 The Connect Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package grpchealth
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// A StatusStore keeps the statuses set on a StaticChecker outside of it, so
+// they can survive restarts in a file or be shared between processes in
+// Redis or SQL. Backends only store statuses: the StaticChecker still answers
+// checks from memory and notifies watchers itself.
+//
+// Implementations must be safe to call concurrently.
+type StatusStore interface {
+	// Load returns every stored status, keyed by service name.
+	Load(ctx context.Context) (map[string]Status, error)
+	// Save stores a service's status.
+	Save(ctx context.Context, service string, status Status) error
+}
+
+// WithStatusStore makes a StaticChecker save every status set with SetStatus
+// to the store. Call StaticChecker.LoadStore to read the stored statuses at
+// startup and, for stores shared with other processes, whenever they may have
+// changed. Errors saving statuses are passed to onError, if it's not nil.
+//
+// Saves happen in the background after SetStatus has updated the checker and
+// notified watchers, so a slow store delays neither checks nor SetStatus.
+// While a store is behind, only the latest status set for each service is
+// saved, in the order the services were set. Each save is bounded by a
+// timeout; see WithStatusStoreTimeout. Call StaticChecker.FlushStore to wait
+// for pending saves, for example before exiting.
+func WithStatusStore(store StatusStore, onError func(error)) StaticCheckerOption {
+	return &statusStoreOption{store: store, onError: onError}
+}
+
+// WithStatusStoreTimeout bounds each save to the StatusStore, so a hung store
+// can't hold up later saves indefinitely. Saves that time out are reported to the
+// error handler passed to WithStatusStore. The default is five seconds.
+func WithStatusStoreTimeout(timeout time.Duration) StaticCheckerOption {
+	return &statusStoreTimeoutOption{timeout: timeout}
+}
+
+// LoadStore reads the statuses in the checker's StatusStore, applying any
+// that differ from the checker's and notifying their watchers. Services set
+// with SetStatus while the store was being read, or whose saves are still
+// pending, keep their statuses, since the read may predate the save. Services that aren't in the store keep
+// their statuses too, so deleting a service from the store doesn't
+// unregister it; store a status for it instead. LoadStore does nothing if the
+// checker wasn't constructed with WithStatusStore.
+func (c *StaticChecker) LoadStore(ctx context.Context) error {
+	if c.store == nil {
+		return nil
+	}
+	c.mu.RLock()
+	start := c.sets
+	unsaved := c.saves.pending()
+	c.mu.RUnlock()
+	statuses, err := c.store.Load(ctx)
+	if err != nil {
+		return err
+	}
+	for service := range statuses {
+		if err := c.validateService(service); err != nil {
+			return err
+		}
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for service, status := range statuses {
+		if counters := c.counters[service]; counters != nil && counters.lastSet > start {
+			continue
+		}
+		if _, ok := unsaved[service]; ok || c.saves.isPending(service) {
+			continue
+		}
+		if current, ok := c.statuses[service]; !ok || current != status {
+			c.setStatus(service, status)
+		}
+	}
+	return nil
+}
+
+// FlushStore waits until the statuses set so far have been saved to the
+// checker's StatusStore, or until ctx ends, in which case it returns ctx's
+// error. Errors saving statuses are still reported to the handler passed to
+// WithStatusStore.
+func (c *StaticChecker) FlushStore(ctx context.Context) error {
+	idle := c.saves.idleChan()
+	if idle == nil {
+		return nil
+	}
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-idle:
+		return nil
+	}
+}
+
+// saveStatuses saves queued statuses until the queue is empty.
+func (c *StaticChecker) saveStatuses() {
+	for {
+		service, status, ok := c.saves.pop()
+		if !ok {
+			return
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), c.storeTimeout)
+		c.reportStoreError(c.store.Save(ctx, service, status))
+		cancel()
+	}
+}
+
+// saveQueue holds the statuses waiting to be saved to a StatusStore. A
+// goroutine drains it while it's not empty, so none runs while the store is
+// caught up. Setting a status for a service that's already queued replaces
+// the queued status.
+type saveQueue struct {
+	mu      sync.Mutex
+	order   []string          // queued services, oldest first
+	queued  map[string]Status // the latest status of each queued service
+	saving  bool              // whether current is being saved
+	current string
+	idle    chan struct{} // closed when the queue drains; nil if it's empty
+}
+
+// push queues a save, calling start in a new goroutine if the queue was
+// empty.
+func (q *saveQueue) push(service string, status Status, start func()) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.queued == nil {
+		q.queued = make(map[string]Status)
+	}
+	if _, ok := q.queued[service]; !ok {
+		q.order = append(q.order, service)
+	}
+	q.queued[service] = status
+	if q.idle == nil {
+		q.idle = make(chan struct{})
+		go start()
+	}
+}
+
+// pop finishes the previous save, if any, and removes the oldest queued one.
+// If the queue is empty, it reports false and the caller must exit.
+func (q *saveQueue) pop() (string, Status, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.saving = false
+	if len(q.order) == 0 {
+		close(q.idle)
+		q.idle = nil
+		return "", StatusUnknown, false
+	}
+	service := q.order[0]
+	q.order = q.order[1:]
+	status := q.queued[service]
+	delete(q.queued, service)
+	q.saving, q.current = true, service
+	return service, status, true
+}
+
+// pending returns the services with queued or unfinished saves.
+func (q *saveQueue) pending() map[string]struct{} {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	services := make(map[string]struct{}, len(q.queued)+1)
+	for service := range q.queued {
+		services[service] = struct{}{}
+	}
+	if q.saving {
+		services[q.current] = struct{}{}
+	}
+	return services
+}
+
+// isPending reports whether a service has a queued or unfinished save.
+func (q *saveQueue) isPending(service string) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	_, queued := q.queued[service]
+	return queued || (q.saving && q.current == service)
+}
+
+// idleChan returns a channel that's closed when the queue drains, or nil if
+// it's empty.
+func (q *saveQueue) idleChan() <-chan struct{} {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.idle
+}
+
+// MemoryStatusStore is a StatusStore that keeps statuses in memory. It's
+// useful in tests, and as a starting point for other implementations.
+type MemoryStatusStore struct {
+	mu       sync.Mutex
+	statuses map[string]Status
+}
+
+// NewMemoryStatusStore constructs an empty MemoryStatusStore.
+func NewMemoryStatusStore() *MemoryStatusStore {
+	return &MemoryStatusStore{statuses: make(map[string]Status)}
+}
+
+// Load implements StatusStore.
+func (s *MemoryStatusStore) Load(context.Context) (map[string]Status, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	statuses := make(map[string]Status, len(s.statuses))
+	for service, status := range s.statuses {
+		statuses[service] = status
+	}
+	return statuses, nil
+}
+
+// Save implements StatusStore.
+func (s *MemoryStatusStore) Save(_ context.Context, service string, status Status) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.statuses[service] = status
+	return nil
+}
+
+type statusStoreOption struct {
+	store   StatusStore
+	onError func(error)
+}
+
+func (o *statusStoreOption) applyToStaticChecker(checker *StaticChecker) {
+	checker.store = o.store
+	checker.storeErr = o.onError
+}
+
+type statusStoreTimeoutOption struct {
+	timeout time.Duration
+}
+
+func (o *statusStoreTimeoutOption) applyToStaticChecker(checker *StaticChecker) {
+	checker.storeTimeout = o.timeout
+}
+
+func (c *StaticChecker) reportStoreError(err error) {
+	if err != nil && c.storeErr != nil {
+		c.storeErr(err)
+	}
+}
@@ -0,0 +1,267 @@
+// Copyright 2022-2024 The Connect Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package grpchealth
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestStatusStore(t *testing.T) {
+	const userFQN = "acme.user.v1.UserService"
+	t.Parallel()
+	store := NewMemoryStatusStore()
+	writer := NewStaticCheckerWithOptions(nil, WithStatusStore(store, nil))
+	writer.SetStatus(userFQN, StatusNotServing)
+	writer.SetStatus("", StatusNotServing)
+	if err := writer.FlushStore(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	// Another process sharing the store picks up the statuses, and its
+	// watchers are notified.
+	reader := NewStaticCheckerWithOptions([]string{userFQN}, WithStatusStore(store, nil))
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	updates := make(chan Status, 2)
+	go func() {
+		_ = reader.Watch(ctx, &CheckRequest{Service: userFQN}, func(res *CheckResponse) error {
+			updates <- res.Status
+			return nil
+		})
+	}()
+	if status := <-updates; status != StatusServing {
+		t.Fatalf("got initial status %v", status)
+	}
+	if err := reader.LoadStore(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if status := <-updates; status != StatusNotServing {
+		t.Fatalf("got status %v after loading the store", status)
+	}
+	statuses, err := reader.List(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if statuses[""] != StatusNotServing {
+		t.Fatalf("got process status %v after loading the store", statuses[""])
+	}
+
+	// Without a store, LoadStore does nothing.
+	if err := NewStaticChecker().LoadStore(ctx); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestStatusStoreErrors(t *testing.T) {
+	t.Parallel()
+	errStore := errors.New("store unavailable")
+	var reported []error
+	checker := NewStaticCheckerWithOptions(nil, WithStatusStore(failingStore{err: errStore}, func(err error) {
+		reported = append(reported, err)
+	}))
+	checker.SetStatus("", StatusNotServing)
+	if err := checker.FlushStore(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if len(reported) != 1 || !errors.Is(reported[0], errStore) {
+		t.Fatalf("got reported errors %v", reported)
+	}
+	// The checker still reports the status it was given.
+	res, err := checker.Check(context.Background(), &CheckRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Status != StatusNotServing {
+		t.Fatalf("got status %v", res.Status)
+	}
+	if err := checker.LoadStore(context.Background()); !errors.Is(err, errStore) {
+		t.Fatalf("got error %v loading, expected %v", err, errStore)
+	}
+}
+
+func TestStatusStoreTimeout(t *testing.T) {
+	t.Parallel()
+	reported := make(chan error, 1)
+	checker := NewStaticCheckerWithOptions(
+		nil,
+		WithStatusStore(hungStore{}, func(err error) { reported <- err }),
+		WithStatusStoreTimeout(10*time.Millisecond),
+	)
+	// The save times out, rather than holding up later saves forever.
+	checker.SetStatus("", StatusNotServing)
+	if err := <-reported; !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("got reported error %v, expected %v", err, context.DeadlineExceeded)
+	}
+}
+
+func TestStatusStoreStaleLoad(t *testing.T) {
+	t.Parallel()
+	store := &slowLoadStore{
+		MemoryStatusStore: NewMemoryStatusStore(),
+		loading:           make(chan struct{}),
+		release:           make(chan struct{}),
+	}
+	checker := NewStaticCheckerWithOptions(nil, WithStatusStore(store, nil))
+	checker.SetStatus("", StatusServing)
+	if err := checker.FlushStore(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan error, 1)
+	go func() { done <- checker.LoadStore(context.Background()) }()
+	<-store.loading
+	// The load read StatusServing, but the status changes before it's
+	// applied.
+	checker.SetStatus("", StatusNotServing)
+	close(store.release)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	res, err := checker.Check(context.Background(), &CheckRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Status != StatusNotServing {
+		t.Fatalf("got status %v, expected the stale load to be ignored", res.Status)
+	}
+}
+
+func TestStatusStoreBackgroundSaves(t *testing.T) {
+	const (
+		userFQN  = "acme.user.v1.UserService"
+		adminFQN = "acme.admin.v1.AdminService"
+	)
+	t.Parallel()
+	store := &gatedSaveStore{
+		MemoryStatusStore: NewMemoryStatusStore(),
+		saving:            make(chan struct{}, 3),
+		release:           make(chan struct{}),
+	}
+	checker := NewStaticCheckerWithOptions([]string{userFQN, adminFQN}, WithStatusStore(store, nil))
+	// SetStatus doesn't wait for the store, which is stuck on the first save.
+	checker.SetStatus(userFQN, StatusNotServing)
+	<-store.saving
+	checker.SetStatus(adminFQN, StatusServing)
+	checker.SetStatus(userFQN, StatusServing)
+	checker.SetStatus(userFQN, StatusNotServing)
+	checker.SetStatus(adminFQN, StatusNotServing)
+	// Loading the store, which doesn't have the pending saves yet, doesn't
+	// revert them.
+	if err := checker.LoadStore(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	assertStatus := func(service string, expect Status) {
+		t.Helper()
+		res, err := checker.Check(context.Background(), &CheckRequest{Service: service})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.Status != expect {
+			t.Fatalf("got status %v for %q, expected %v", res.Status, service, expect)
+		}
+	}
+	assertStatus(userFQN, StatusNotServing)
+	assertStatus(adminFQN, StatusNotServing)
+
+	close(store.release)
+	if err := checker.FlushStore(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	// Only the latest status of each service is saved once the store
+	// catches up.
+	expect := []string{
+		userFQN + "=" + StatusNotServing.String(),
+		adminFQN + "=" + StatusNotServing.String(),
+		userFQN + "=" + StatusNotServing.String(),
+	}
+	if got := store.saved(); strings.Join(got, ",") != strings.Join(expect, ",") {
+		t.Fatalf("got saves %v, expected %v", got, expect)
+	}
+	// Flushing a caught-up store returns immediately.
+	if err := checker.FlushStore(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// gatedSaveStore is a MemoryStatusStore that records its saves, which signal
+// saving and then block until release is closed.
+type gatedSaveStore struct {
+	*MemoryStatusStore
+
+	saving  chan struct{}
+	release chan struct{}
+	mu      sync.Mutex
+	saves   []string
+}
+
+func (s *gatedSaveStore) Save(ctx context.Context, service string, status Status) error {
+	s.saving <- struct{}{}
+	<-s.release
+	s.mu.Lock()
+	s.saves = append(s.saves, service+"="+status.String())
+	s.mu.Unlock()
+	return s.MemoryStatusStore.Save(ctx, service, status)
+}
+
+func (s *gatedSaveStore) saved() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.saves...)
+}
+
+// slowLoadStore is a MemoryStatusStore whose loads read the statuses, signal
+// loading, and then wait for release before returning.
+type slowLoadStore struct {
+	*MemoryStatusStore
+
+	loading chan struct{}
+	release chan struct{}
+}
+
+func (s *slowLoadStore) Load(ctx context.Context) (map[string]Status, error) {
+	statuses, err := s.MemoryStatusStore.Load(ctx)
+	close(s.loading)
+	<-s.release
+	return statuses, err
+}
+
+// hungStore is a StatusStore whose calls block until their context ends.
+type hungStore struct{}
+
+func (hungStore) Load(ctx context.Context) (map[string]Status, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func (hungStore) Save(ctx context.Context, _ string, _ Status) error {
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+type failingStore struct {
+	err error
+}
+
+func (s failingStore) Load(context.Context) (map[string]Status, error) {
+	return nil, s.err
+}
+
+func (s failingStore) Save(context.Context, string, Status) error {
+	return s.err
+}
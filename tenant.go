@@ -0,0 +1,109 @@
+// Copyright 2022-2024 The Connect Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package grpchealth
+
+import "strings"
+
+// WithTenants enables tenant-scoped health, for SaaS control planes that
+// expose the health of each tenant. Service names may then be qualified with
+// a tenant and a slash, as in "tenant-a/acme.user.v1.UserService", and the
+// tenant followed by a slash ("tenant-a/") reports the worst status of the
+// tenant's services, including any status set explicitly for the tenant.
+// Checks and Watches of the tenant aggregate work like those of any other
+// service, so load balancers and dashboards can follow a single tenant.
+//
+// Use TenantService to build qualified names, and SetTenantStatus and
+// TenantStatuses to work with one tenant at a time.
+func WithTenants() StaticCheckerOption {
+	return &tenantsOption{}
+}
+
+// TenantService qualifies a service name with a tenant. The empty service name
+// refers to the tenant as a whole.
+func TenantService(tenant, service string) string {
+	return tenant + "/" + service
+}
+
+// SetTenantStatus sets the health status of one of a tenant's services. It's
+// equivalent to calling SetStatus with the qualified service name.
+func (c *StaticChecker) SetTenantStatus(tenant, service string, status Status) {
+	c.SetStatus(TenantService(tenant, service), status)
+}
+
+// TenantStatuses returns a snapshot of the health of a tenant's services,
+// keyed by unqualified service name. The empty service name represents the
+// tenant as a whole. It returns nil if the tenant has no registered services.
+func (c *StaticChecker) TenantStatuses(tenant string) map[string]Status {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	prefix := TenantService(tenant, "")
+	aggregate, known := c.tenantStatus(prefix)
+	if !known {
+		return nil
+	}
+	statuses := map[string]Status{"": aggregate}
+	for service := range c.statuses {
+		if name, ok := strings.CutPrefix(service, prefix); ok && name != "" {
+			statuses[name], _ = c.status(service)
+		}
+	}
+	return statuses
+}
+
+// tenantStatus returns the worst status of a tenant's services, given the
+// tenant's aggregate name, and whether the tenant has any registered services.
+// The caller must hold c.mu.
+func (c *StaticChecker) tenantStatus(prefix string) (Status, bool) {
+	aggregate, known := c.statuses[prefix]
+	if !known {
+		aggregate = StatusServing
+	}
+	aggregate = c.degrade(prefix, aggregate)
+	for service := range c.statuses {
+		if service == prefix || !strings.HasPrefix(service, prefix) {
+			continue
+		}
+		known = true
+		if status, _ := c.status(service); severity(status) > severity(aggregate) {
+			aggregate = status
+		}
+	}
+	return aggregate, known
+}
+
+// tenantOf returns the aggregate name of the tenant owning a qualified
+// service, if tenants are enabled. The caller must hold c.mu.
+func (c *StaticChecker) tenantOf(service string) (string, bool) {
+	if !c.tenants || isTenantAggregate(service) {
+		return "", false
+	}
+	tenant, _, ok := strings.Cut(service, "/")
+	if !ok {
+		return "", false
+	}
+	return TenantService(tenant, ""), true
+}
+
+// isTenantAggregate reports whether a service name refers to a tenant as a
+// whole.
+func isTenantAggregate(service string) bool {
+	return len(service) > 1 && strings.IndexByte(service, '/') == len(service)-1
+}
+
+type tenantsOption struct{}
+
+func (o *tenantsOption) applyToStaticChecker(checker *StaticChecker) {
+	checker.tenants = true
+}
@@ -0,0 +1,64 @@
+// Copyright 2022-2024 The Connect Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package grpchealth
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"connectrpc.com/connect"
+)
+
+func TestTenants(t *testing.T) {
+	const (
+		userFQN  = "acme.user.v1.UserService"
+		adminFQN = "acme.admin.v1.AdminService"
+	)
+	t.Parallel()
+	checker := NewStaticCheckerWithOptions(nil, WithTenants())
+	checker.SetTenantStatus("tenant-a", userFQN, StatusServing)
+	checker.SetTenantStatus("tenant-a", adminFQN, StatusServing)
+	checker.SetTenantStatus("tenant-b", userFQN, StatusServing)
+	server := newTestServer(t, checker)
+	receive := newTestWatch(t, server, TenantService("tenant-a", ""))
+	receive(StatusServing)
+
+	checker.SetTenantStatus("tenant-a", adminFQN, StatusNotServing)
+	receive(StatusNotServing)
+	expect := map[string]Status{
+		"":       StatusNotServing,
+		userFQN:  StatusServing,
+		adminFQN: StatusNotServing,
+	}
+	if got := checker.TenantStatuses("tenant-a"); !reflect.DeepEqual(got, expect) {
+		t.Fatalf("got tenant-a statuses %v, expected %v", got, expect)
+	}
+	res, err := checker.Check(context.Background(), &CheckRequest{Service: TenantService("tenant-b", "")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Status != StatusServing {
+		t.Fatalf("got tenant-b status %v, expected %v", res.Status, StatusServing)
+	}
+
+	if got := checker.TenantStatuses("tenant-c"); got != nil {
+		t.Fatalf("got statuses %v for unknown tenant", got)
+	}
+	_, err = checker.Check(context.Background(), &CheckRequest{Service: TenantService("tenant-c", "")})
+	if code := connect.CodeOf(err); code != connect.CodeNotFound {
+		t.Fatalf("got code %v for unknown tenant, expected %v", code, connect.CodeNotFound)
+	}
+}
@@ -0,0 +1,183 @@
+// Copyright 2022-2024 The Connect Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package grpchealth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+)
+
+// A ThresholdOption configures a ThresholdChecker.
+type ThresholdOption interface {
+	applyToThresholdChecker(*ThresholdChecker)
+}
+
+// WithMaxThreshold makes a ThresholdChecker report StatusNotServing once the
+// value exceeds limit, and StatusServing again once it falls to recovery or
+// below. The gap between the two keeps the status from flapping around a
+// single value; to disable hysteresis, make them equal.
+func WithMaxThreshold(limit, recovery float64) ThresholdOption {
+	return &thresholdBoundOption{limit: limit, recovery: recovery, max: true}
+}
+
+// WithMinThreshold makes a ThresholdChecker report StatusNotServing once the
+// value falls below limit, and StatusServing again once it rises to recovery
+// or above. It's the mirror image of WithMaxThreshold, for values like free
+// capacity or throughput where less is worse.
+func WithMinThreshold(limit, recovery float64) ThresholdOption {
+	return &thresholdBoundOption{limit: limit, recovery: recovery, max: false}
+}
+
+// WithSmoothing makes a ThresholdChecker compare an exponentially weighted
+// moving average of the values rather than the latest one, so a single
+// outlier doesn't change the status. Alpha, between 0 and 1, is the weight of
+// each new value; 1 disables smoothing.
+func WithSmoothing(alpha float64) ThresholdOption {
+	return &smoothingOption{alpha: alpha}
+}
+
+// WithThresholdDetail sets the key under which a ThresholdChecker reports
+// the compared value in its response details. The default is "value".
+func WithThresholdDetail(key string) ThresholdOption {
+	return &thresholdDetailOption{key: key}
+}
+
+// ThresholdChecker is a Checker that compares a value from a provider against
+// bounds. It's the building block for checkers driven by a single measurement,
+// such as resource usage, lag, or latency. If the provider fails, it reports
+// StatusNotServing. The details of the response include the compared value or
+// the error.
+//
+// ThresholdChecker reports the same status for every service.
+type ThresholdChecker struct {
+	provider  func(context.Context) (float64, error)
+	max       *thresholdBound
+	min       *thresholdBound
+	alpha     float64
+	detailKey string
+
+	mu       sync.Mutex
+	smoothed float64
+	sampled  bool
+	aboveMax bool
+	belowMin bool
+}
+
+type thresholdBound struct {
+	limit    float64
+	recovery float64
+}
+
+// NewThresholdChecker constructs a ThresholdChecker. Without a WithMaxThreshold
+// or WithMinThreshold option, it always reports StatusServing unless the
+// provider fails.
+func NewThresholdChecker(provider func(ctx context.Context) (float64, error), options ...ThresholdOption) (*ThresholdChecker, error) {
+	if provider == nil {
+		return nil, errors.New("threshold checker requires a provider")
+	}
+	checker := &ThresholdChecker{
+		provider:  provider,
+		alpha:     1,
+		detailKey: "value",
+	}
+	for _, opt := range options {
+		opt.applyToThresholdChecker(checker)
+	}
+	if checker.max != nil && checker.max.recovery > checker.max.limit {
+		return nil, fmt.Errorf("max recovery %v exceeds limit %v", checker.max.recovery, checker.max.limit)
+	}
+	if checker.min != nil && checker.min.recovery < checker.min.limit {
+		return nil, fmt.Errorf("min recovery %v is below limit %v", checker.min.recovery, checker.min.limit)
+	}
+	if checker.alpha <= 0 || checker.alpha > 1 {
+		return nil, fmt.Errorf("smoothing alpha must be in (0, 1], got %v", checker.alpha)
+	}
+	return checker, nil
+}
+
+// Check implements Checker.
+func (c *ThresholdChecker) Check(ctx context.Context, _ *CheckRequest) (*CheckResponse, error) {
+	value, err := c.provider(ctx)
+	if err != nil {
+		return &CheckResponse{
+			Status:  StatusNotServing,
+			Details: map[string]string{"error": err.Error()},
+		}, nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.sampled {
+		value = c.alpha*value + (1-c.alpha)*c.smoothed
+	}
+	c.smoothed, c.sampled = value, true
+	if c.max != nil {
+		switch {
+		case value > c.max.limit:
+			c.aboveMax = true
+		case value <= c.max.recovery:
+			c.aboveMax = false
+		}
+	}
+	if c.min != nil {
+		switch {
+		case value < c.min.limit:
+			c.belowMin = true
+		case value >= c.min.recovery:
+			c.belowMin = false
+		}
+	}
+	status := StatusServing
+	if c.aboveMax || c.belowMin {
+		status = StatusNotServing
+	}
+	return &CheckResponse{
+		Status:  status,
+		Details: map[string]string{c.detailKey: strconv.FormatFloat(value, 'f', -1, 64)},
+	}, nil
+}
+
+type thresholdBoundOption struct {
+	limit    float64
+	recovery float64
+	max      bool
+}
+
+func (o *thresholdBoundOption) applyToThresholdChecker(checker *ThresholdChecker) {
+	bound := &thresholdBound{limit: o.limit, recovery: o.recovery}
+	if o.max {
+		checker.max = bound
+	} else {
+		checker.min = bound
+	}
+}
+
+type smoothingOption struct {
+	alpha float64
+}
+
+func (o *smoothingOption) applyToThresholdChecker(checker *ThresholdChecker) {
+	checker.alpha = o.alpha
+}
+
+type thresholdDetailOption struct {
+	key string
+}
+
+func (o *thresholdDetailOption) applyToThresholdChecker(checker *ThresholdChecker) {
+	checker.detailKey = o.key
+}
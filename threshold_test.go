@@ -0,0 +1,110 @@
+// Copyright 2022-2024 The Connect Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package grpchealth
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestThresholdChecker(t *testing.T) {
+	t.Parallel()
+	var value float64
+	var valueErr error
+	provider := func(context.Context) (float64, error) { return value, valueErr }
+	checker, err := NewThresholdChecker(
+		provider,
+		WithMaxThreshold(10, 5),
+		WithMinThreshold(1, 2),
+		WithThresholdDetail("load"),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, testCase := range []struct {
+		value    float64
+		valueErr error
+		expect   Status
+	}{
+		{value: 3, expect: StatusServing},
+		{value: 11, expect: StatusNotServing},
+		{value: 6, expect: StatusNotServing},
+		{value: 5, expect: StatusServing},
+		{value: 0.5, expect: StatusNotServing},
+		{value: 1.5, expect: StatusNotServing},
+		{value: 2, expect: StatusServing},
+		{valueErr: errors.New("unavailable"), expect: StatusNotServing},
+	} {
+		value, valueErr = testCase.value, testCase.valueErr
+		res, err := checker.Check(context.Background(), &CheckRequest{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.Status != testCase.expect {
+			t.Fatalf("value %v: got status %v, expected %v", value, res.Status, testCase.expect)
+		}
+		if valueErr == nil && res.Details["load"] == "" {
+			t.Fatalf("value %v: got details %v", value, res.Details)
+		}
+	}
+}
+
+func TestThresholdCheckerSmoothing(t *testing.T) {
+	t.Parallel()
+	var value float64
+	checker, err := NewThresholdChecker(
+		func(context.Context) (float64, error) { return value, nil },
+		WithMaxThreshold(10, 10),
+		WithSmoothing(0.5),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, testCase := range []struct {
+		value  float64
+		expect string
+	}{
+		{value: 8, expect: "8"},
+		{value: 16, expect: "12"}, // a single spike is averaged...
+		{value: 0, expect: "6"},   // ...and quickly decays
+	} {
+		value = testCase.value
+		res, err := checker.Check(context.Background(), &CheckRequest{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := res.Details["value"]; got != testCase.expect {
+			t.Fatalf("got smoothed value %s, expected %s", got, testCase.expect)
+		}
+	}
+}
+
+func TestThresholdCheckerInvalid(t *testing.T) {
+	t.Parallel()
+	provider := func(context.Context) (float64, error) { return 0, nil }
+	for _, options := range [][]ThresholdOption{
+		{WithMaxThreshold(5, 10)},
+		{WithMinThreshold(5, 1)},
+		{WithSmoothing(0)},
+	} {
+		if _, err := NewThresholdChecker(provider, options...); err == nil {
+			t.Fatalf("expected error for options %v", options)
+		}
+	}
+	if _, err := NewThresholdChecker(nil); err == nil {
+		t.Fatal("expected error without provider")
+	}
+}
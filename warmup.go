@@ -0,0 +1,110 @@
+// Copyright 2022-2024 The Connect Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package grpchealth
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+
+	"connectrpc.com/connect"
+)
+
+// WarmDNS returns a critical StartupDependency that resolves host, so the
+// first request after a deploy doesn't wait on DNS. It's named "dns:" followed
+// by the host.
+func WarmDNS(host string) StartupDependency {
+	return StartupDependency{
+		Name: "dns:" + host,
+		Probe: func(ctx context.Context) error {
+			_, err := net.DefaultResolver.LookupHost(ctx, host)
+			return err
+		},
+		Critical: true,
+	}
+}
+
+// WarmTLS returns a critical StartupDependency that dials address and
+// completes a TLS handshake using config, then closes the connection. Passing
+// the same config as the application's clients fills its ClientSessionCache,
+// if any, so later connections resume the session instead of doing a full
+// handshake. It's named "tls:" followed by the address.
+func WarmTLS(address string, config *tls.Config) StartupDependency {
+	return StartupDependency{
+		Name: "tls:" + address,
+		Probe: func(ctx context.Context) error {
+			dialer := &tls.Dialer{Config: config}
+			conn, err := dialer.DialContext(ctx, "tcp", address)
+			if err != nil {
+				return err
+			}
+			return conn.Close()
+		},
+		Critical: true,
+	}
+}
+
+// WarmHTTP returns a critical StartupDependency that sends a GET request to url
+// with client, leaving an open connection in the client's pool for the first
+// real request. Use the same client as the application, such as the one
+// behind its Connect clients. Any response counts as warm, except a 5xx
+// status. It's named "http:" followed by the URL.
+func WarmHTTP(client *http.Client, url string) StartupDependency {
+	return StartupDependency{
+		Name: "http:" + url,
+		Probe: func(ctx context.Context) error {
+			req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, http.NoBody)
+			if err != nil {
+				return err
+			}
+			res, err := client.Do(req)
+			if err != nil {
+				return err
+			}
+			// Drain the body so the connection can be reused.
+			_, _ = io.Copy(io.Discard, res.Body)
+			_ = res.Body.Close()
+			if res.StatusCode >= http.StatusInternalServerError {
+				return fmt.Errorf("warm-up request got %s", res.Status)
+			}
+			return nil
+		},
+		Critical: true,
+	}
+}
+
+// WarmCheck returns a critical StartupDependency that checks a service with a
+// Checker, such as a Client for an upstream, so the first RPC to it has an
+// open connection. Any response counts as warm, whatever the status, as do
+// connect.CodeNotFound and connect.CodeUnimplemented errors, which the
+// upstream only returns once it's reachable. It's named "check:" followed by
+// name.
+func WarmCheck(name string, checker Checker, service string) StartupDependency {
+	return StartupDependency{
+		Name: "check:" + name,
+		Probe: func(ctx context.Context) error {
+			_, err := checker.Check(ctx, &CheckRequest{Service: service})
+			switch connect.CodeOf(err) {
+			case connect.CodeNotFound, connect.CodeUnimplemented:
+				return nil
+			}
+			return err
+		},
+		Critical: true,
+	}
+}
@@ -0,0 +1,81 @@
+// Copyright 2022-2024 The Connect Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package grpchealth
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWarmUp(t *testing.T) {
+	t.Parallel()
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/broken" {
+			http.Error(w, "broken", http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	t.Cleanup(server.Close)
+	roots := x509.NewCertPool()
+	roots.AddCert(server.Certificate())
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12, RootCAs: roots}
+	readiness := NewStaticChecker()
+	readiness.SetStatus("", StatusNotServing)
+	sequencer, err := NewStartupSequencer(StartupSequencerParams{
+		Dependencies: []StartupDependency{
+			WarmDNS("localhost"),
+			WarmTLS(strings.TrimPrefix(server.URL, "https://"), tlsConfig),
+			WarmHTTP(server.Client(), server.URL+"/"),
+			WarmCheck("upstream", NewStaticChecker(), "unknown"),
+		},
+		RetryInterval: time.Millisecond,
+		Setter:        readiness,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := sequencer.Run(ctx); err != nil {
+		t.Fatal(err)
+	}
+	res, err := readiness.Check(ctx, &CheckRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Status != StatusServing {
+		t.Fatalf("got status %v after warming up, expected %v", res.Status, StatusServing)
+	}
+
+	// Failing upstreams aren't warm.
+	broken := WarmHTTP(server.Client(), server.URL+"/broken")
+	if err := broken.Probe(ctx); err == nil {
+		t.Error("expected an error from a failing upstream")
+	}
+	if broken.Name != "http:"+server.URL+"/broken" || !broken.Critical {
+		t.Errorf("got dependency %q, critical %v", broken.Name, broken.Critical)
+	}
+	insecure := WarmTLS(strings.TrimPrefix(server.URL, "https://"), &tls.Config{MinVersion: tls.VersionTLS12})
+	if err := insecure.Probe(ctx); err == nil {
+		t.Error("expected an error from an untrusted certificate")
+	}
+}
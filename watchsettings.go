@@ -0,0 +1,66 @@
+// Copyright 2022-2024 The Connect Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package grpchealth
+
+import "time"
+
+// WatchSettings tune Watch streams for a single service; see
+// WithServiceWatchSettings. A zero field keeps the setting configured for the
+// whole handler, and a negative one disables it for the service.
+type WatchSettings struct {
+	// InitialDelay overrides WithWatchInitialDelay.
+	InitialDelay time.Duration
+	// Jitter overrides WithWatchJitter.
+	Jitter time.Duration
+	// HoldTime overrides WithWatchHoldTime. A longer hold time smooths a
+	// flapping service.
+	HoldTime time.Duration
+	// Heartbeat overrides WithWatchHeartbeat.
+	Heartbeat time.Duration
+}
+
+// WithServiceWatchSettings overrides the Watch settings of the handler for
+// streams watching one service, since services that flap quickly, like a cache
+// dependency, and slow subsystems, like batch pipelines, need different
+// smoothing. The empty service name represents the whole process. Applying the
+// option again for the same service replaces its settings.
+func WithServiceWatchSettings(service string, settings WatchSettings) HandlerOption {
+	return newHandlerOption(func(config *handlerConfig) {
+		if config.WatchOverrides == nil {
+			config.WatchOverrides = make(map[string]WatchSettings)
+		}
+		config.WatchOverrides[service] = settings
+	})
+}
+
+// forWatch returns the configuration for Watch streams of a service, applying
+// any settings configured with WithServiceWatchSettings.
+func (c *handlerConfig) forWatch(service string) *handlerConfig {
+	settings, ok := c.WatchOverrides[service]
+	if !ok {
+		return c
+	}
+	config := *c
+	override := func(setting *time.Duration, value time.Duration) {
+		if value != 0 {
+			*setting = value
+		}
+	}
+	override(&config.WatchInitialDelay, settings.InitialDelay)
+	override(&config.WatchJitter, settings.Jitter)
+	override(&config.WatchHoldTime, settings.HoldTime)
+	override(&config.WatchHeartbeat, settings.Heartbeat)
+	return &config
+}
@@ -0,0 +1,136 @@
+// Copyright 2022-2024 The Connect Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package grpchealth
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"connectrpc.com/connect"
+)
+
+func TestServiceWatchSettings(t *testing.T) {
+	const (
+		cacheFQN = "acme.cache.v1.CacheService"
+		batchFQN = "acme.batch.v1.BatchService"
+	)
+	t.Parallel()
+	config := newHandlerConfig([]connect.HandlerOption{
+		WithWatchInitialDelay(time.Second),
+		WithWatchJitter(time.Second),
+		WithWatchHeartbeat(time.Minute),
+		WithServiceWatchSettings(cacheFQN, WatchSettings{Jitter: 5 * time.Second, HoldTime: time.Second}),
+		WithServiceWatchSettings(batchFQN, WatchSettings{Jitter: time.Hour}),
+		WithServiceWatchSettings(batchFQN, WatchSettings{Heartbeat: time.Hour, InitialDelay: -1}),
+	})
+	type settings struct {
+		delay, jitter, hold, heartbeat time.Duration
+	}
+	for service, expect := range map[string]settings{
+		"":       {delay: time.Second, jitter: time.Second, heartbeat: time.Minute},
+		cacheFQN: {delay: time.Second, jitter: 5 * time.Second, hold: time.Second, heartbeat: time.Minute},
+		batchFQN: {delay: -1, jitter: time.Second, heartbeat: time.Hour},
+	} {
+		watch := config.forWatch(service)
+		got := settings{watch.WatchInitialDelay, watch.WatchJitter, watch.WatchHoldTime, watch.WatchHeartbeat}
+		if got != expect {
+			t.Errorf("got settings %+v for %q, expected %+v", got, service, expect)
+		}
+	}
+	if config.WatchJitter != time.Second {
+		t.Errorf("overrides changed the handler's jitter to %v", config.WatchJitter)
+	}
+}
+
+func TestServiceWatchHeartbeat(t *testing.T) {
+	const userFQN = "acme.user.v1.UserService"
+	t.Parallel()
+	checker := NewStaticChecker(userFQN)
+	config := newHandlerConfig([]connect.HandlerOption{
+		WithServiceWatchSettings(userFQN, WatchSettings{Heartbeat: time.Millisecond}),
+	})
+	sent := make(chan Status, 16)
+	update, stop := config.forWatch(userFQN).heartbeatWatchUpdates(func(res *CheckResponse) error {
+		select {
+		case sent <- res.Status:
+		default:
+		}
+		return nil
+	})
+	defer stop()
+	res, err := checker.Check(context.Background(), &CheckRequest{Service: userFQN})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := update(res); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		if status := <-sent; status != StatusServing {
+			t.Fatalf("got status %v, expected %v", status, StatusServing)
+		}
+	}
+}
+
+func TestServiceWatchHoldTime(t *testing.T) {
+	const cacheFQN = "acme.cache.v1.CacheService"
+	t.Parallel()
+	const hold = 30 * time.Millisecond
+	config := newHandlerConfig([]connect.HandlerOption{
+		WithServiceWatchSettings(cacheFQN, WatchSettings{HoldTime: hold}),
+	})
+	sent := make(chan *CheckResponse, 16)
+	update, stop := config.forWatch(cacheFQN).delayWatchUpdates(func(res *CheckResponse) error {
+		sent <- res
+		return nil
+	})
+	defer stop()
+
+	// The first status isn't held.
+	if err := update(&CheckResponse{Status: StatusServing}); err != nil {
+		t.Fatal(err)
+	}
+	if res := <-sent; res.Status != StatusServing {
+		t.Fatalf("got status %v, expected %v", res.Status, StatusServing)
+	}
+
+	// While the service flaps, nothing is sent; once it settles for the hold
+	// time, its latest status is.
+	var last time.Time
+	for _, res := range []*CheckResponse{
+		{Status: StatusNotServing, Previous: StatusServing},
+		{Status: StatusServiceUnknown, Previous: StatusNotServing},
+		{Status: StatusNotServing, Previous: StatusServiceUnknown},
+	} {
+		last = time.Now()
+		if err := update(res); err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(hold / 3)
+	}
+	res := <-sent
+	if elapsed := time.Since(last); elapsed < hold {
+		t.Errorf("sent status %v after it was stable for %v, expected at least %v", res.Status, elapsed, hold)
+	}
+	if res.Status != StatusNotServing || res.Previous != StatusServing {
+		t.Fatalf("got update %+v", res)
+	}
+	select {
+	case res := <-sent:
+		t.Fatalf("got unexpected update %+v", res)
+	case <-time.After(2 * hold):
+	}
+}
@@ -0,0 +1,154 @@
+// Copyright 2022-2024 The Connect Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package grpchealth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"connectrpc.com/connect"
+	healthv1 "connectrpc.com/grpchealth/internal/gen/go/connectext/grpc/health/v1"
+	"golang.org/x/net/websocket"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+// NewWebSocketHandler builds an HTTP handler that mirrors the Watch method
+// over a WebSocket, for tools where WebSockets are the most practical way to
+// stream through corporate proxies, such as Electron apps and web consoles.
+//
+// After connecting, the client sends a HealthCheckRequest as a JSON text
+// message, such as {"service":"acme.user.v1.UserService"}. The handler then
+// sends a HealthCheckResponse in the same JSON as Connect, such as
+// {"status":"SERVING_STATUS_SERVING"}, with the current status and again on
+// each change, exactly as Watch does. If the Watcher fails, the handler sends
+// the error as {"code":...,"message":...}, using Connect's error codes, and
+// closes the connection. Closing the connection ends the watch.
+//
+// To prevent cross-site WebSocket hijacking, the handler only accepts
+// connections from browsers on the same host or on origins allowed by
+// WithCORS. Clients that don't send an Origin header are always accepted.
+//
+// The handler accepts the same options as NewHandler, and those that apply to
+// Watch, such as WithWatchHeartbeat and WithWatchQuota, apply to each
+// connection.
+func NewWebSocketHandler(watcher Watcher, options ...connect.HandlerOption) http.Handler {
+	config := newHandlerConfig(options)
+	return websocket.Server{
+		Handshake: func(_ *websocket.Config, r *http.Request) error {
+			return config.checkWebSocketOrigin(r)
+		},
+		Handler: func(conn *websocket.Conn) {
+			defer conn.Close()
+			if err := config.serveWebSocket(conn, watcher); err != nil {
+				_ = sendWebSocketError(conn, err)
+			}
+		},
+	}
+}
+
+// checkWebSocketOrigin rejects WebSocket handshakes from browsers on other
+// origins, unless WithCORS allows them.
+func (c *handlerConfig) checkWebSocketOrigin(r *http.Request) error {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return nil
+	}
+	if parsed, err := url.Parse(origin); err == nil && parsed.Host == r.Host {
+		return nil
+	}
+	if c.CORS != nil && c.CORS.allows(origin) {
+		return nil
+	}
+	return fmt.Errorf("origin %q isn't allowed", origin)
+}
+
+// serveWebSocket runs a watch for a WebSocket connection until the Watcher
+// fails or the client goes away.
+func (c *handlerConfig) serveWebSocket(conn *websocket.Conn, watcher Watcher) error {
+	var data []byte
+	if websocket.Message.Receive(conn, &data) != nil {
+		// The client went away before sending a request.
+		return nil
+	}
+	req := &healthv1.HealthCheckRequest{}
+	if len(data) > 0 {
+		if err := protojson.Unmarshal(data, req); err != nil {
+			return connect.NewError(connect.CodeInvalidArgument, fmt.Errorf("invalid request: %w", err))
+		}
+	}
+	r := conn.Request()
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+	go func() {
+		// The client has nothing more to say, so any message or error ends
+		// the watch.
+		defer cancel()
+		var ignored []byte
+		_ = websocket.Message.Receive(conn, &ignored)
+	}()
+	ctx = c.withRequestID(ctx, r.Header, nil)
+	ctx = c.withChannel(ctx, r.Header)
+	ctx = withHTTPRequestInfo(ctx, r)
+	if c.WatchQuota != nil {
+		release, err := c.WatchQuota.acquire(connect.Peer{Addr: r.RemoteAddr}, r.Header)
+		if err != nil {
+			return err
+		}
+		defer release()
+	}
+	settings := c.forWatch(req.Service)
+	send, stopHeartbeat := settings.heartbeatWatchUpdates(func(res *CheckResponse) error {
+		data, err := protojson.Marshal(c.healthCheckResponse(res.Status))
+		if err != nil {
+			return err
+		}
+		if err := websocket.Message.Send(conn, string(data)); err != nil {
+			return err
+		}
+		res.markSent()
+		return nil
+	})
+	send, stopDelay := settings.delayWatchUpdates(send)
+	err := watcher.Watch(withSendReports(ctx), &CheckRequest{Service: req.Service}, send)
+	stopDelay()
+	stopHeartbeat()
+	if ctx.Err() != nil {
+		return nil
+	}
+	return err
+}
+
+// sendWebSocketError sends an error as JSON, in the shape Connect uses for
+// unary errors.
+func sendWebSocketError(conn *websocket.Conn, err error) error {
+	code := connect.CodeUnknown
+	message := err.Error()
+	var connectErr *connect.Error
+	if errors.As(err, &connectErr) {
+		code, message = connectErr.Code(), connectErr.Message()
+	}
+	data, err := json.Marshal(map[string]string{
+		"code":    code.String(),
+		"message": message,
+	})
+	if err != nil {
+		return err
+	}
+	return websocket.Message.Send(conn, string(data))
+}
@@ -0,0 +1,104 @@
+// Copyright 2022-2024 The Connect Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package grpchealth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/websocket"
+)
+
+func TestWebSocketHandler(t *testing.T) {
+	const userFQN = "acme.user.v1.UserService"
+	t.Parallel()
+	checker := NewStaticChecker(userFQN)
+	server := httptest.NewServer(NewWebSocketHandler(checker, WithCORS(CORSParams{
+		AllowedOrigins: []string{"https://console.example.com"},
+	})))
+	t.Cleanup(server.Close)
+	url := "ws" + strings.TrimPrefix(server.URL, "http")
+	dial := func(t *testing.T, origin string) *websocket.Conn {
+		t.Helper()
+		conn, err := websocket.Dial(url, "", origin)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { conn.Close() })
+		return conn
+	}
+	receive := func(t *testing.T, conn *websocket.Conn, expect string) {
+		t.Helper()
+		var message string
+		if err := websocket.Message.Receive(conn, &message); err != nil {
+			t.Fatal(err)
+		}
+		if message != expect {
+			t.Fatalf("got message %s, expected %s", message, expect)
+		}
+	}
+
+	t.Run("watch", func(t *testing.T) {
+		t.Parallel()
+		conn := dial(t, "https://console.example.com")
+		if err := websocket.Message.Send(conn, `{"service":"`+userFQN+`"}`); err != nil {
+			t.Fatal(err)
+		}
+		receive(t, conn, `{"status":"SERVING_STATUS_SERVING"}`)
+		checker.SetStatus(userFQN, StatusNotServing)
+		receive(t, conn, `{"status":"SERVING_STATUS_NOT_SERVING"}`)
+	})
+	t.Run("invalid_request", func(t *testing.T) {
+		t.Parallel()
+		conn := dial(t, server.URL)
+		if err := websocket.Message.Send(conn, `{"service":1}`); err != nil {
+			t.Fatal(err)
+		}
+		var message string
+		if err := websocket.Message.Receive(conn, &message); err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(message, `"code":"invalid_argument"`) {
+			t.Fatalf("got message %s, expected an invalid_argument error", message)
+		}
+	})
+	t.Run("cross_origin", func(t *testing.T) {
+		t.Parallel()
+		if _, err := websocket.Dial(url, "", "https://evil.example.com"); err == nil {
+			t.Fatal("expected cross-origin handshake to fail")
+		}
+	})
+}
+
+func TestCheckWebSocketOrigin(t *testing.T) {
+	t.Parallel()
+	config := newHandlerConfig(nil)
+	for origin, allowed := range map[string]bool{
+		"":                           true,
+		"http://health.example.com":  true,
+		"https://health.example.com": true,
+		"https://other.example.com":  false,
+	} {
+		req := httptest.NewRequest(http.MethodGet, "http://health.example.com/ws", nil)
+		if origin != "" {
+			req.Header.Set("Origin", origin)
+		}
+		if err := config.checkWebSocketOrigin(req); (err == nil) != allowed {
+			t.Errorf("got error %v for origin %q, expected allowed=%v", err, origin, allowed)
+		}
+	}
+}